@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notification channels for the alerting engine
+
+var alertHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// sendAlertNotification delivers a notification through one channel
+func sendAlertNotification(ch *AlertChannel, n AlertNotification) error {
+	switch ch.Type {
+	case "webhook":
+		return sendWebhookAlert(ch, n)
+	case "ntfy":
+		return sendNtfyAlert(ch, n)
+	case "gotify":
+		return sendGotifyAlert(ch, n)
+	case "smtp":
+		return sendSMTPAlert(ch, n)
+	default:
+		return fmt.Errorf("unknown channel type %q", ch.Type)
+	}
+}
+
+// postAlert sends an HTTP POST and checks for a 2xx response
+func postAlert(url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := alertHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+// sendWebhookAlert posts the notification as JSON
+func sendWebhookAlert(ch *AlertChannel, n AlertNotification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{"Content-Type": "application/json"}
+	for k, v := range ch.Headers {
+		headers[k] = v
+	}
+	return postAlert(ch.URL, body, headers)
+}
+
+// sendNtfyAlert publishes to an ntfy topic URL (e.g. https://ntfy.sh/my-heatpump)
+func sendNtfyAlert(ch *AlertChannel, n AlertNotification) error {
+	priority := ch.Priority
+	if priority == 0 {
+		switch {
+		case n.Status == AlertStatusResolved:
+			priority = 2
+		case n.Severity == "error":
+			priority = 5
+		case n.Severity == "warning":
+			priority = 4
+		default:
+			priority = 3
+		}
+	}
+
+	tag := "warning"
+	if n.Status == AlertStatusResolved {
+		tag = "white_check_mark"
+	} else if n.Severity == "error" {
+		tag = "rotating_light"
+	}
+
+	headers := map[string]string{
+		"Title":    mime.QEncoding.Encode("utf-8", n.Title),
+		"Priority": strconv.Itoa(priority),
+		"Tags":     tag,
+	}
+	if ch.Token != "" {
+		headers["Authorization"] = "Bearer " + ch.Token
+	}
+	return postAlert(ch.URL, []byte(n.Message), headers)
+}
+
+// sendGotifyAlert sends a message to a Gotify server using an application token
+func sendGotifyAlert(ch *AlertChannel, n AlertNotification) error {
+	priority := ch.Priority
+	if priority == 0 {
+		switch {
+		case n.Status == AlertStatusResolved:
+			priority = 2
+		case n.Severity == "error":
+			priority = 8
+		default:
+			priority = 5
+		}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"title":    n.Title,
+		"message":  n.Message,
+		"priority": priority,
+	})
+	if err != nil {
+		return err
+	}
+
+	return postAlert(strings.TrimRight(ch.URL, "/")+"/message", body, map[string]string{
+		"Content-Type": "application/json",
+		"X-Gotify-Key": ch.Token,
+	})
+}
+
+// sendSMTPAlert sends the notification as a plain text email
+func sendSMTPAlert(ch *AlertChannel, n AlertNotification) error {
+	port := ch.SMTPPort
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(ch.SMTPHost, strconv.Itoa(port))
+
+	subject := "[ViEventLog] " + n.Title
+	if n.Status == AlertStatusFiring {
+		subject = "[ViEventLog] " + strings.ToUpper(n.Severity) + ": " + n.Title
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", ch.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(ch.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(n.Message, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	var auth smtp.Auth
+	if ch.Username != "" {
+		auth = smtp.PlainAuth("", ch.Username, ch.Password, ch.SMTPHost)
+	}
+
+	// Port 465 uses implicit TLS, smtp.SendMail upgrades via STARTTLS when offered
+	if port != 465 {
+		return smtp.SendMail(addr, auth, ch.From, ch.To, msg.Bytes())
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 15 * time.Second}, "tcp", addr, &tls.Config{ServerName: ch.SMTPHost})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, ch.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(ch.From); err != nil {
+		return err
+	}
+	for _, to := range ch.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,865 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Alerting evaluates newly archived events, open fault incidents and logged
+// temperature snapshots against user-defined rules and notifies the configured
+// channels. State is tracked per rule and subject (device, gateway or error
+// code), so an ongoing condition is reported once, repeated notifications are
+// held back by the rule's cooldown and a resolve message follows when it clears.
+
+// Alert rule types
+const (
+	AlertRuleEvent          = "event"           // matching events (error events resolve on their inactive event)
+	AlertRuleFaultDuration  = "fault_duration"  // fault incident open for longer than durationMinutes
+	AlertRuleGatewayOffline = "gateway_offline" // gateway offline (for longer than durationMinutes)
+	AlertRuleThreshold      = "threshold"       // snapshot value beyond threshold (for durationMinutes)
+	AlertRuleShortCycling   = "short_cycling"   // compressor starts or short runs beyond the cycle limits within durationMinutes
+)
+
+// Alert notification states
+const (
+	AlertStatusFiring   = "firing"
+	AlertStatusResolved = "resolved"
+	AlertStatusTest     = "test"
+)
+
+const (
+	alertCheckInterval = 1 * time.Minute
+	alertMaxEventAge   = 24 * time.Hour // older events (e.g. first archive run) only resolve alerts
+	alertHistorySize   = 100
+	alertSecretMask    = "********"
+)
+
+// AlertRule describes when to notify. Device and code filters are optional.
+type AlertRule struct {
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`
+	Enabled         bool     `json:"enabled"`
+	Type            string   `json:"type"`
+	InstallationID  string   `json:"installationId,omitempty"`
+	GatewaySerial   string   `json:"gatewaySerial,omitempty"`
+	DeviceID        string   `json:"deviceId,omitempty"`
+	ErrorCodes      []string `json:"errorCodes,omitempty"`     // patterns like "F.*" or "F.1078"
+	Severities      []string `json:"severities,omitempty"`     // info, warning, error
+	CodeCategories  []string `json:"codeCategories,omitempty"` // status, fault, maintenance, ...
+	EventTypes      []string `json:"eventTypes,omitempty"`     // device-error, feature-changed, ...
+	Field           string   `json:"field,omitempty"`          // threshold: TemperatureSnapshot field, e.g. dhw_temp
+	Operator        string   `json:"operator,omitempty"`       // threshold: <, <=, >, >=
+	Threshold       float64  `json:"threshold"`
+	DurationMinutes int      `json:"durationMinutes,omitempty"`
+	CooldownMinutes int      `json:"cooldownMinutes,omitempty"` // minimum time between notifications per subject
+	NotifyResolve   bool     `json:"notifyResolve"`
+	Channels        []string `json:"channels,omitempty"` // channel IDs, empty = all enabled channels
+}
+
+// AlertChannel is a notification target
+type AlertChannel struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Type     string            `json:"type"` // webhook, ntfy, gotify, smtp
+	Enabled  bool              `json:"enabled"`
+	URL      string            `json:"url,omitempty"`      // webhook URL, ntfy topic URL or Gotify server URL
+	Headers  map[string]string `json:"headers,omitempty"`  // additional webhook headers
+	Token    string            `json:"token,omitempty"`    // ntfy access token or Gotify application token
+	Priority int               `json:"priority,omitempty"` // ntfy (1-5) / Gotify (0-10), 0 = derived from severity
+	SMTPHost string            `json:"smtpHost,omitempty"`
+	SMTPPort int               `json:"smtpPort,omitempty"` // 465 = implicit TLS, otherwise STARTTLS if offered
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"`
+	From     string            `json:"from,omitempty"`
+	To       []string          `json:"to,omitempty"`
+}
+
+// AlertSettings holds all rules and channels (stored next to EventArchiveSettings)
+type AlertSettings struct {
+	Enabled  bool           `json:"enabled"`
+	Rules    []AlertRule    `json:"rules"`
+	Channels []AlertChannel `json:"channels"`
+}
+
+// AlertNotification is the message sent to channels (webhooks receive it as JSON)
+type AlertNotification struct {
+	RuleID    string            `json:"ruleId"`
+	RuleName  string            `json:"ruleName"`
+	Status    string            `json:"status"`
+	Subject   string            `json:"subject"`
+	Title     string            `json:"title"`
+	Message   string            `json:"message"`
+	Severity  string            `json:"severity"`
+	Timestamp string            `json:"timestamp"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// AlertHistoryEntry records a sent notification and its delivery results
+type AlertHistoryEntry struct {
+	AlertNotification
+	Deliveries map[string]string `json:"deliveries"` // channel ID -> "ok" or error
+}
+
+// ActiveAlert describes a firing or pending condition
+type ActiveAlert struct {
+	RuleID       string `json:"ruleId"`
+	RuleName     string `json:"ruleName"`
+	Subject      string `json:"subject"`
+	Title        string `json:"title"`
+	Firing       bool   `json:"firing"`
+	PendingSince string `json:"pendingSince,omitempty"`
+	FiredAt      string `json:"firedAt,omitempty"`
+	Notified     bool   `json:"notified"` // false if held back by the cooldown
+}
+
+// alertState is the state of one rule for one subject
+type alertState struct {
+	pendingSince time.Time // condition true since (duration not yet reached)
+	firing       bool
+	notified     bool // firing notification was sent
+	firedAt      time.Time
+	lastNotified time.Time
+	notification AlertNotification
+}
+
+type alertEngine struct {
+	mu       sync.Mutex
+	settings *AlertSettings
+	states   map[string]*alertState // key: ruleID + "|" + subject
+	history  []AlertHistoryEntry
+	running  bool
+	stop     chan bool
+}
+
+var alerts = &alertEngine{states: make(map[string]*alertState)}
+
+// StartAlertEngine loads the alert settings and starts the periodic checks
+// for fault durations and offline gateways
+func StartAlertEngine() error {
+	settings, err := GetAlertSettings()
+	if err != nil {
+		return err
+	}
+	alerts.applySettings(settings)
+
+	alerts.mu.Lock()
+	defer alerts.mu.Unlock()
+
+	if alerts.running {
+		return nil
+	}
+	alerts.running = true
+	alerts.stop = make(chan bool)
+
+	go func(stop chan bool) {
+		ticker := time.NewTicker(alertCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				alerts.checkTimedRules()
+			case <-stop:
+				return
+			}
+		}
+	}(alerts.stop)
+
+	log.Printf("Alert engine started (%d rules, %d channels)", len(settings.Rules), len(settings.Channels))
+	return nil
+}
+
+// StopAlertEngine stops the periodic checks
+func StopAlertEngine() {
+	alerts.mu.Lock()
+	defer alerts.mu.Unlock()
+
+	if !alerts.running {
+		return
+	}
+	close(alerts.stop)
+	alerts.running = false
+}
+
+// applySettings activates new settings and drops state of removed rules
+func (e *alertEngine) applySettings(settings *AlertSettings) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.settings = settings
+
+	ruleIDs := make(map[string]bool)
+	for _, rule := range settings.Rules {
+		if rule.Enabled {
+			ruleIDs[rule.ID] = true
+		}
+	}
+	for key := range e.states {
+		if !ruleIDs[strings.SplitN(key, "|", 2)[0]] {
+			delete(e.states, key)
+		}
+	}
+}
+
+// activeRules returns the enabled rules of the given type. Must be called with e.mu held.
+func (e *alertEngine) activeRules(ruleType string) []AlertRule {
+	if e.settings == nil || !e.settings.Enabled {
+		return nil
+	}
+	var rules []AlertRule
+	for _, rule := range e.settings.Rules {
+		if rule.Enabled && rule.Type == ruleType {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// state returns the state for a rule and subject, creating it if needed
+func (e *alertEngine) state(rule *AlertRule, subject string) *alertState {
+	key := rule.ID + "|" + subject
+	st, ok := e.states[key]
+	if !ok {
+		st = &alertState{}
+		e.states[key] = st
+	}
+	return st
+}
+
+// fire reports a condition. Sticky conditions stay firing until resolved and are
+// only notified once; non-sticky ones (plain events) notify on every occurrence.
+// Both are held back while the rule's cooldown for the subject runs.
+// Must be called with e.mu held.
+func (e *alertEngine) fire(rule *AlertRule, subject string, n AlertNotification, sticky bool, now time.Time) {
+	st := e.state(rule, subject)
+	if st.firing {
+		return
+	}
+
+	n.RuleID = rule.ID
+	n.RuleName = rule.Name
+	n.Status = AlertStatusFiring
+	n.Subject = subject
+	n.Timestamp = now.Format(time.RFC3339)
+
+	st.pendingSince = time.Time{}
+	st.firing = sticky
+	st.firedAt = now
+	st.notification = n
+
+	cooldown := time.Duration(rule.CooldownMinutes) * time.Minute
+	if !st.lastNotified.IsZero() && now.Sub(st.lastNotified) < cooldown {
+		st.notified = false
+		log.Printf("Alert %q for %s suppressed by cooldown", rule.Name, subject)
+		return
+	}
+
+	st.notified = true
+	st.lastNotified = now
+	e.dispatch(rule.Channels, n)
+}
+
+// resolve clears a firing condition and sends a resolve notification if the
+// rule asks for it and the firing notification went out. Must be called with e.mu held.
+func (e *alertEngine) resolve(rule *AlertRule, subject string, now time.Time) {
+	key := rule.ID + "|" + subject
+	st, ok := e.states[key]
+	if !ok {
+		return
+	}
+	st.pendingSince = time.Time{}
+	if !st.firing {
+		return
+	}
+	st.firing = false
+
+	if rule.NotifyResolve && st.notified {
+		n := st.notification
+		n.Status = AlertStatusResolved
+		n.Title = "Resolved: " + n.Title
+		n.Message = fmt.Sprintf("%s\nResolved after %s.", n.Message, now.Sub(st.firedAt).Round(time.Minute))
+		n.Timestamp = now.Format(time.RFC3339)
+		e.dispatch(rule.Channels, n)
+	}
+}
+
+// dispatch sends a notification to the rule's channels in the background.
+// Must be called with e.mu held.
+func (e *alertEngine) dispatch(channelIDs []string, n AlertNotification) {
+	var targets []AlertChannel
+	for _, ch := range e.settings.Channels {
+		if !ch.Enabled {
+			continue
+		}
+		if len(channelIDs) > 0 && !containsString(channelIDs, ch.ID) {
+			continue
+		}
+		targets = append(targets, ch)
+	}
+
+	log.Printf("Alert %s: %s (%d channels)", n.Status, n.Title, len(targets))
+
+	go func() {
+		entry := AlertHistoryEntry{AlertNotification: n, Deliveries: make(map[string]string)}
+		for i := range targets {
+			if err := sendAlertNotification(&targets[i], n); err != nil {
+				log.Printf("Warning: failed to send alert via %s channel %q: %v", targets[i].Type, targets[i].Name, err)
+				entry.Deliveries[targets[i].ID] = err.Error()
+			} else {
+				entry.Deliveries[targets[i].ID] = "ok"
+			}
+		}
+
+		e.mu.Lock()
+		e.history = append([]AlertHistoryEntry{entry}, e.history...)
+		if len(e.history) > alertHistorySize {
+			e.history = e.history[:alertHistorySize]
+		}
+		e.mu.Unlock()
+	}()
+}
+
+// EvaluateEventAlerts checks newly archived events against event and gateway rules
+func EvaluateEventAlerts(events []Event) {
+	alerts.mu.Lock()
+	defer alerts.mu.Unlock()
+
+	eventRules := alerts.activeRules(AlertRuleEvent)
+	gatewayRules := alerts.activeRules(AlertRuleGatewayOffline)
+	if len(eventRules) == 0 && len(gatewayRules) == 0 {
+		return
+	}
+
+	sorted := make([]Event, len(events))
+	copy(sorted, events)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].EventTimestamp < sorted[j].EventTimestamp
+	})
+
+	now := time.Now()
+	for i := range sorted {
+		event := &sorted[i]
+		eventTime, err := time.Parse(time.RFC3339, event.EventTimestamp)
+		if err != nil {
+			continue
+		}
+		recent := now.Sub(eventTime) <= alertMaxEventAge
+
+		for r := range eventRules {
+			rule := &eventRules[r]
+			if !rule.matchesEvent(event) {
+				continue
+			}
+			subject := eventAlertSubject(event)
+			if event.Active != nil && !*event.Active {
+				alerts.resolve(rule, subject, now)
+			} else if recent {
+				alerts.fire(rule, subject, eventNotification(event), event.Active != nil, now)
+			}
+		}
+
+		if event.EventType != "gateway-offline" && event.EventType != "gateway-online" {
+			continue
+		}
+		for r := range gatewayRules {
+			rule := &gatewayRules[r]
+			if !rule.matchesDevice(event.InstallationID, event.GatewaySerial, "") {
+				continue
+			}
+			subject := event.InstallationID + "/" + event.GatewaySerial
+			if event.EventType == "gateway-online" {
+				alerts.resolve(rule, subject, now)
+				continue
+			}
+			if !recent {
+				continue
+			}
+			st := alerts.state(rule, subject)
+			if st.firing || !st.pendingSince.IsZero() {
+				continue
+			}
+			st.pendingSince = eventTime
+			st.notification = AlertNotification{
+				Title:    fmt.Sprintf("Gateway %s offline", event.GatewaySerial),
+				Message:  fmt.Sprintf("Gateway %s (installation %s) went offline at %s.", event.GatewaySerial, event.InstallationID, eventTime.In(DefaultLocation).Format("02.01.2006 15:04")),
+				Severity: "error",
+				Labels:   map[string]string{"installationId": event.InstallationID, "gatewaySerial": event.GatewaySerial},
+			}
+			if now.Sub(eventTime) >= time.Duration(rule.DurationMinutes)*time.Minute {
+				alerts.fire(rule, subject, st.notification, true, now)
+			}
+		}
+	}
+}
+
+// EvaluateSnapshotAlerts checks a logged temperature snapshot against threshold rules
+func EvaluateSnapshotAlerts(snapshot *TemperatureSnapshot) {
+	alerts.mu.Lock()
+	defer alerts.mu.Unlock()
+
+	now := time.Now()
+	for _, rule := range alerts.activeRules(AlertRuleThreshold) {
+		if !rule.matchesDevice(snapshot.InstallationID, snapshot.GatewayID, snapshot.DeviceID) {
+			continue
+		}
+		value, ok := snapshotFieldValue(snapshot, rule.Field)
+		if !ok {
+			continue // no reading, keep the current state
+		}
+
+		subject := snapshot.InstallationID + "/" + snapshot.GatewayID + "/" + snapshot.DeviceID
+		if !compareThreshold(value, rule.Operator, rule.Threshold) {
+			alerts.resolve(&rule, subject, now)
+			continue
+		}
+
+		st := alerts.state(&rule, subject)
+		if st.firing {
+			continue
+		}
+		if st.pendingSince.IsZero() {
+			st.pendingSince = snapshot.Timestamp
+		}
+		if snapshot.Timestamp.Sub(st.pendingSince) < time.Duration(rule.DurationMinutes)*time.Minute {
+			continue
+		}
+
+		message := fmt.Sprintf("%s is %.1f (%s %g) on device %s, gateway %s", rule.Field, value, rule.Operator, rule.Threshold, snapshot.DeviceID, snapshot.GatewayID)
+		if rule.DurationMinutes > 0 {
+			message += fmt.Sprintf(" for %d minutes", rule.DurationMinutes)
+		}
+		alerts.fire(&rule, subject, AlertNotification{
+			Title:    fmt.Sprintf("%s: %s %.1f", rule.Name, rule.Field, value),
+			Message:  message + ".",
+			Severity: "warning",
+			Labels: map[string]string{
+				"installationId": snapshot.InstallationID,
+				"gatewaySerial":  snapshot.GatewayID,
+				"deviceId":       snapshot.DeviceID,
+				"field":          rule.Field,
+			},
+		}, true, now)
+	}
+}
+
+// EvaluateCycleAlerts checks the compressor runs of a device against short_cycling rules.
+// A rule looks at the last durationMinutes (default 60) and scales the limits of the cycle
+// settings to that window; a threshold > 0 replaces the starts per hour limit.
+func EvaluateCycleAlerts(installationID, gatewayID, deviceID string, settings *CycleSettings) {
+	alerts.mu.Lock()
+	rules := alerts.activeRules(AlertRuleShortCycling)
+	alerts.mu.Unlock()
+
+	var matching []AlertRule
+	longest := 0
+	for _, rule := range rules {
+		if !rule.matchesDevice(installationID, gatewayID, deviceID) {
+			continue
+		}
+		if rule.DurationMinutes == 0 {
+			rule.DurationMinutes = 60
+		}
+		if rule.DurationMinutes > longest {
+			longest = rule.DurationMinutes
+		}
+		matching = append(matching, rule)
+	}
+	if len(matching) == 0 {
+		return
+	}
+
+	now := time.Now()
+	runs, err := GetCompressorRuns(installationID, gatewayID, deviceID, now.Add(-time.Duration(longest)*time.Minute), now, 0)
+	if err != nil {
+		log.Printf("Warning: short-cycling check failed to load compressor runs: %v", err)
+		return
+	}
+
+	alerts.mu.Lock()
+	defer alerts.mu.Unlock()
+
+	subject := installationID + "/" + gatewayID + "/" + deviceID
+	for _, rule := range matching {
+		window := time.Duration(rule.DurationMinutes) * time.Minute
+		maxStarts := float64(settings.MaxStartsPerHour)
+		if rule.Threshold > 0 {
+			maxStarts = rule.Threshold
+		}
+		maxStarts *= window.Hours()
+		maxShortRuns := float64(settings.MaxShortRunsPerHour) * window.Hours()
+
+		starts, shortRuns := 0, 0
+		for i := range runs {
+			if runs[i].StartTime.Before(now.Add(-window)) {
+				continue
+			}
+			starts += runs[i].Starts
+			shortRuns += runs[i].shortRuns(settings)
+		}
+
+		if float64(starts) <= maxStarts && float64(shortRuns) <= maxShortRuns {
+			alerts.resolve(&rule, subject, now)
+			continue
+		}
+		alerts.fire(&rule, subject, AlertNotification{
+			Title:    fmt.Sprintf("%s: %d compressor starts in %d minutes", rule.Name, starts, rule.DurationMinutes),
+			Message:  fmt.Sprintf("The compressor of device %s, gateway %s started %d times in the last %d minutes (limit %g), %d runs were shorter than %d minutes (limit %g).", deviceID, gatewayID, starts, rule.DurationMinutes, maxStarts, shortRuns, settings.ShortRunMinutes, maxShortRuns),
+			Severity: "warning",
+			Labels: map[string]string{
+				"installationId": installationID,
+				"gatewaySerial":  gatewayID,
+				"deviceId":       deviceID,
+			},
+		}, true, now)
+	}
+}
+
+// checkTimedRules fires fault_duration rules from open incidents and
+// gateway_offline rules whose offline duration has been reached
+func (e *alertEngine) checkTimedRules() {
+	e.mu.Lock()
+	faultRules := e.activeRules(AlertRuleFaultDuration)
+	e.mu.Unlock()
+
+	var openIncidents []Incident
+	if len(faultRules) > 0 && dbInitialized {
+		open := true
+		incidents, err := GetIncidents(IncidentQueryOptions{Open: &open})
+		if err != nil {
+			log.Printf("Warning: alert check failed to load incidents: %v", err)
+			return
+		}
+		openIncidents = incidents
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	for r := range faultRules {
+		rule := &faultRules[r]
+		stillOpen := make(map[string]bool)
+		for _, inc := range openIncidents {
+			if !rule.matchesIncident(&inc) {
+				continue
+			}
+			subject := inc.InstallationID + "/" + inc.GatewaySerial + "/" + inc.DeviceID + "/" + inc.ErrorCode
+			stillOpen[subject] = true
+			if inc.DurationSeconds < int64(rule.DurationMinutes)*60 {
+				continue
+			}
+			e.fire(rule, subject, AlertNotification{
+				Title: fmt.Sprintf("%s %s active for %s", inc.ErrorCode, inc.ErrorDescription, (time.Duration(inc.DurationSeconds) * time.Second).Round(time.Minute)),
+				Message: fmt.Sprintf("Fault %s (%s) on device %s (%s), gateway %s is active since %s.",
+					inc.ErrorCode, inc.ErrorDescription, inc.DeviceID, inc.ModelID, inc.GatewaySerial, formatAlertTime(inc.StartTime)),
+				Severity: inc.Severity,
+				Labels: map[string]string{
+					"installationId": inc.InstallationID,
+					"gatewaySerial":  inc.GatewaySerial,
+					"deviceId":       inc.DeviceID,
+					"errorCode":      inc.ErrorCode,
+				},
+			}, true, now)
+		}
+
+		// Incidents that are no longer open have been cleared
+		prefix := rule.ID + "|"
+		for key, st := range e.states {
+			if strings.HasPrefix(key, prefix) && st.firing && !stillOpen[strings.TrimPrefix(key, prefix)] {
+				e.resolve(rule, strings.TrimPrefix(key, prefix), now)
+			}
+		}
+	}
+
+	for _, rule := range e.activeRules(AlertRuleGatewayOffline) {
+		prefix := rule.ID + "|"
+		for key, st := range e.states {
+			if !strings.HasPrefix(key, prefix) || st.firing || st.pendingSince.IsZero() {
+				continue
+			}
+			if now.Sub(st.pendingSince) >= time.Duration(rule.DurationMinutes)*time.Minute {
+				e.fire(&rule, strings.TrimPrefix(key, prefix), st.notification, true, now)
+			}
+		}
+	}
+}
+
+// Status returns the firing/pending conditions and the notification history
+func (e *alertEngine) Status() ([]ActiveAlert, []AlertHistoryEntry) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ruleNames := make(map[string]string)
+	if e.settings != nil {
+		for _, rule := range e.settings.Rules {
+			ruleNames[rule.ID] = rule.Name
+		}
+	}
+
+	active := []ActiveAlert{}
+	for key, st := range e.states {
+		if !st.firing && st.pendingSince.IsZero() {
+			continue
+		}
+		parts := strings.SplitN(key, "|", 2)
+		a := ActiveAlert{
+			RuleID:   parts[0],
+			RuleName: ruleNames[parts[0]],
+			Subject:  parts[1],
+			Title:    st.notification.Title,
+			Firing:   st.firing,
+			Notified: st.notified,
+		}
+		if st.firing {
+			a.FiredAt = st.firedAt.Format(time.RFC3339)
+		} else {
+			a.PendingSince = st.pendingSince.Format(time.RFC3339)
+		}
+		active = append(active, a)
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].RuleID+active[i].Subject < active[j].RuleID+active[j].Subject
+	})
+
+	history := make([]AlertHistoryEntry, len(e.history))
+	copy(history, e.history)
+	return active, history
+}
+
+// matchesDevice applies the rule's installation/gateway/device filters
+func (r *AlertRule) matchesDevice(installationID, gatewaySerial, deviceID string) bool {
+	return (r.InstallationID == "" || r.InstallationID == installationID) &&
+		(r.GatewaySerial == "" || r.GatewaySerial == gatewaySerial) &&
+		(r.DeviceID == "" || deviceID == "" || r.DeviceID == deviceID)
+}
+
+// matchesCode checks the error code against the rule's code patterns
+func (r *AlertRule) matchesCode(code string) bool {
+	if len(r.ErrorCodes) == 0 {
+		return true
+	}
+	for _, pattern := range r.ErrorCodes {
+		if ok, _ := path.Match(pattern, code); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesEvent applies all event filters of the rule
+func (r *AlertRule) matchesEvent(event *Event) bool {
+	if !r.matchesDevice(event.InstallationID, event.GatewaySerial, event.DeviceID) || !r.matchesCode(event.ErrorCode) {
+		return false
+	}
+	if len(r.ErrorCodes) > 0 && event.ErrorCode == "" {
+		return false
+	}
+	if len(r.Severities) > 0 && !containsString(r.Severities, event.Severity) {
+		return false
+	}
+	if len(r.CodeCategories) > 0 && !containsString(r.CodeCategories, event.CodeCategory) {
+		return false
+	}
+	if len(r.EventTypes) > 0 && !containsString(r.EventTypes, event.EventType) {
+		return false
+	}
+	return true
+}
+
+// matchesIncident applies the device, code, severity and category filters to an incident
+func (r *AlertRule) matchesIncident(inc *Incident) bool {
+	if !r.matchesDevice(inc.InstallationID, inc.GatewaySerial, inc.DeviceID) || !r.matchesCode(inc.ErrorCode) {
+		return false
+	}
+	if len(r.Severities) > 0 && !containsString(r.Severities, inc.Severity) {
+		return false
+	}
+	if len(r.CodeCategories) > 0 && !containsString(r.CodeCategories, inc.CodeCategory) {
+		return false
+	}
+	return true
+}
+
+// eventAlertSubject identifies what an event is about (device and code or type)
+func eventAlertSubject(event *Event) string {
+	what := event.ErrorCode
+	if what == "" {
+		what = event.EventType
+	}
+	return event.InstallationID + "/" + event.GatewaySerial + "/" + event.DeviceID + "/" + what
+}
+
+// eventNotification builds the notification text for an event
+func eventNotification(event *Event) AlertNotification {
+	title := event.HumanReadable
+	if event.ErrorCode != "" {
+		title = event.ErrorCode + " " + event.ErrorDescription
+	}
+	if title == "" {
+		title = event.EventType
+	}
+
+	severity := event.Severity
+	if severity == "" {
+		severity = "info"
+	}
+
+	return AlertNotification{
+		Title: title,
+		Message: fmt.Sprintf("%s on device %s (%s), gateway %s at %s.",
+			title, event.DeviceID, event.ModelID, event.GatewaySerial, formatAlertTime(event.EventTimestamp)),
+		Severity: severity,
+		Labels: map[string]string{
+			"installationId": event.InstallationID,
+			"gatewaySerial":  event.GatewaySerial,
+			"deviceId":       event.DeviceID,
+			"errorCode":      event.ErrorCode,
+			"eventType":      event.EventType,
+		},
+	}
+}
+
+// formatAlertTime formats an RFC3339 timestamp in local time
+func formatAlertTime(timestamp string) string {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return timestamp
+	}
+	return t.In(DefaultLocation).Format("02.01.2006 15:04")
+}
+
+// compareThreshold evaluates "value operator threshold"
+func compareThreshold(value float64, operator string, threshold float64) bool {
+	switch operator {
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	}
+	return false
+}
+
+// snapshotNumericFields maps TemperatureSnapshot JSON field names to numeric struct fields
+var snapshotNumericFields = func() map[string]int {
+	fields := make(map[string]int)
+	t := reflect.TypeOf(TemperatureSnapshot{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type == reflect.TypeOf((*float64)(nil)) {
+			fields[strings.Split(f.Tag.Get("json"), ",")[0]] = i
+		}
+	}
+	return fields
+}()
+
+// snapshotFieldValue returns a numeric snapshot field by its JSON name
+func snapshotFieldValue(snapshot *TemperatureSnapshot, field string) (float64, bool) {
+	index, ok := snapshotNumericFields[field]
+	if !ok {
+		return 0, false
+	}
+	value := reflect.ValueOf(snapshot).Elem().Field(index)
+	if value.IsNil() {
+		return 0, false
+	}
+	return value.Elem().Float(), true
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAlertSettings checks rules and channels and assigns missing IDs
+func validateAlertSettings(settings *AlertSettings) error {
+	channelIDs := make(map[string]bool)
+	for i := range settings.Channels {
+		ch := &settings.Channels[i]
+		if ch.ID == "" {
+			ch.ID = randomHex(4)
+		}
+		if channelIDs[ch.ID] {
+			return fmt.Errorf("duplicate channel id %q", ch.ID)
+		}
+		channelIDs[ch.ID] = true
+
+		switch ch.Type {
+		case "webhook", "ntfy", "gotify":
+			if !strings.HasPrefix(ch.URL, "http://") && !strings.HasPrefix(ch.URL, "https://") {
+				return fmt.Errorf("channel %q: url must start with http:// or https://", ch.Name)
+			}
+		case "smtp":
+			if ch.SMTPHost == "" || ch.From == "" || len(ch.To) == 0 {
+				return fmt.Errorf("channel %q: smtpHost, from and to are required", ch.Name)
+			}
+		default:
+			return fmt.Errorf("channel %q: unknown type %q (use webhook, ntfy, gotify or smtp)", ch.Name, ch.Type)
+		}
+	}
+
+	ruleIDs := make(map[string]bool)
+	for i := range settings.Rules {
+		rule := &settings.Rules[i]
+		if rule.ID == "" {
+			rule.ID = randomHex(4)
+		}
+		if ruleIDs[rule.ID] {
+			return fmt.Errorf("duplicate rule id %q", rule.ID)
+		}
+		ruleIDs[rule.ID] = true
+		if rule.Name == "" {
+			rule.Name = rule.Type
+		}
+
+		if rule.DurationMinutes < 0 || rule.CooldownMinutes < 0 {
+			return fmt.Errorf("rule %q: durationMinutes and cooldownMinutes must not be negative", rule.Name)
+		}
+		for _, pattern := range rule.ErrorCodes {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %q: invalid error code pattern %q", rule.Name, pattern)
+			}
+		}
+		for _, id := range rule.Channels {
+			if !channelIDs[id] {
+				return fmt.Errorf("rule %q: unknown channel %q", rule.Name, id)
+			}
+		}
+
+		switch rule.Type {
+		case AlertRuleEvent, AlertRuleGatewayOffline:
+		case AlertRuleShortCycling:
+			if rule.Threshold < 0 {
+				return fmt.Errorf("rule %q: threshold (starts per hour) must not be negative", rule.Name)
+			}
+		case AlertRuleFaultDuration:
+			if rule.DurationMinutes == 0 {
+				return fmt.Errorf("rule %q: durationMinutes is required", rule.Name)
+			}
+		case AlertRuleThreshold:
+			if _, ok := snapshotNumericFields[rule.Field]; !ok {
+				return fmt.Errorf("rule %q: unknown field %q", rule.Name, rule.Field)
+			}
+			if !containsString([]string{"<", "<=", ">", ">="}, rule.Operator) {
+				return fmt.Errorf("rule %q: operator must be <, <=, > or >=", rule.Name)
+			}
+		default:
+			return fmt.Errorf("rule %q: unknown type %q", rule.Name, rule.Type)
+		}
+	}
+
+	return nil
+}
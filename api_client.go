@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Shared HTTP client layer for the Viessmann IoT API.
+// It retries idempotent requests on transient failures and tracks rate-limit
+// bans (HTTP 429) so that no further calls are made until the limit resets.
+
+const (
+	apiMaxAttempts       = 4
+	apiRetryBaseDelay    = 1 * time.Second
+	apiRetryMaxDelay     = 20 * time.Second
+	apiDefaultBanTimeout = 10 * time.Minute // used when a 429 carries no reset time
+)
+
+var apiHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// errAPIThrottled is returned for calls made while the account is rate-limited
+var errAPIThrottled = errors.New("Viessmann API rate limit exceeded")
+
+// viessmannAPIError is the error body returned by the Viessmann API
+type viessmannAPIError struct {
+	ViErrorID       string `json:"viErrorId"`
+	StatusCode      int    `json:"statusCode"`
+	ErrorType       string `json:"errorType"`
+	Message         string `json:"message"`
+	ExtendedPayload struct {
+		Name              string `json:"name"`
+		RequestCountLimit int    `json:"requestCountLimit"`
+		LimitReset        int64  `json:"limitReset"` // Unix milliseconds
+	} `json:"extendedPayload"`
+}
+
+// apiThrottleState records an active rate-limit ban
+type apiThrottleState struct {
+	mu     sync.RWMutex
+	until  time.Time
+	reason string
+}
+
+var apiThrottle apiThrottleState
+
+// set extends the ban until the given time
+func (t *apiThrottleState) set(until time.Time, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if until.After(t.until) {
+		t.until = until
+		t.reason = reason
+		log.Printf("WARNING: Viessmann API throttled until %s (%s), pausing API calls\n", until.Local().Format(time.RFC3339), reason)
+	}
+}
+
+// Get returns the reset time and reason if the API is currently throttled
+func (t *apiThrottleState) Get() (time.Time, string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if time.Now().Before(t.until) {
+		return t.until, t.reason, true
+	}
+	return time.Time{}, "", false
+}
+
+// apiThrottledError returns an error describing the active ban, or nil
+func apiThrottledError() error {
+	if until, reason, throttled := apiThrottle.Get(); throttled {
+		return fmt.Errorf("%w (%s), retry after %s", errAPIThrottled, reason, until.Local().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// parseViessmannAPIError decodes an error body; returns nil if it is not one
+func parseViessmannAPIError(body []byte) *viessmannAPIError {
+	var apiErr viessmannAPIError
+	if err := json.Unmarshal(body, &apiErr); err != nil || (apiErr.ErrorType == "" && apiErr.ViErrorID == "") {
+		return nil
+	}
+	return &apiErr
+}
+
+// rateLimitReset determines when a 429 ban ends from the body or Retry-After header
+func rateLimitReset(resp *http.Response, apiErr *viessmannAPIError) time.Time {
+	if apiErr != nil && apiErr.ExtendedPayload.LimitReset > 0 {
+		return time.UnixMilli(apiErr.ExtendedPayload.LimitReset)
+	}
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			return time.Now().Add(time.Duration(seconds) * time.Second)
+		}
+		if t, err := http.ParseTime(retryAfter); err == nil {
+			return t
+		}
+	}
+	return time.Now().Add(apiDefaultBanTimeout)
+}
+
+// apiStatusError builds an error for a non-200 response, preferring the
+// message from a Viessmann error body. Wraps errAPIThrottled for HTTP 429.
+func apiStatusError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+
+	detail := string(body)
+	if apiErr := parseViessmannAPIError(body); apiErr != nil && apiErr.Message != "" {
+		detail = apiErr.ErrorType + ": " + apiErr.Message
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%w: API returned status %d: %s", errAPIThrottled, resp.StatusCode, detail)
+	}
+	return fmt.Errorf("API returned status %d: %s", resp.StatusCode, detail)
+}
+
+// isRetryableStatus reports transient server-side failures
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryDelay returns a full-jitter exponential backoff delay for the given attempt
+func retryDelay(attempt int) time.Duration {
+	max := apiRetryBaseDelay << attempt
+	if max > apiRetryMaxDelay {
+		max = apiRetryMaxDelay
+	}
+	return time.Duration(rand.Int64N(int64(max)))
+}
+
+// doAPIRequest sends a request created via NewRequest/NewPriorityRequest
+// GET requests are retried with jittered exponential backoff on network errors
+// and 5xx responses. A 429 puts all API calls on hold until the limit resets;
+// the 429 response is still returned so callers report the API's message.
+func doAPIRequest(req *http.Request) (*http.Response, error) {
+	if err := apiThrottledError(); err != nil {
+		return nil, err
+	}
+
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+
+	for attempt := 0; ; attempt++ {
+		// Each attempt counts against the budget like any other call
+		if err := acquireAPICall(req); err != nil {
+			return nil, err
+		}
+		resp, err := apiHTTPClient.Do(req)
+
+		if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+
+			apiErr := parseViessmannAPIError(body)
+			reason := "HTTP 429"
+			if apiErr != nil && apiErr.ExtendedPayload.Name != "" {
+				reason = apiErr.ExtendedPayload.Name
+			}
+			apiThrottle.set(rateLimitReset(resp, apiErr), reason)
+			return resp, nil
+		}
+
+		retryable := err != nil || isRetryableStatus(resp.StatusCode)
+		if !idempotent || !retryable || attempt+1 >= apiMaxAttempts {
+			return resp, err
+		}
+
+		if err != nil {
+			log.Printf("API request %s failed (attempt %d/%d): %v\n", req.URL.Path, attempt+1, apiMaxAttempts, err)
+		} else {
+			log.Printf("API request %s returned %d (attempt %d/%d), retrying\n", req.URL.Path, resp.StatusCode, attempt+1, apiMaxAttempts)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		time.Sleep(retryDelay(attempt))
+	}
+}
+
+// schedulerPausedByThrottle reports (and logs) whether a background job should
+// skip its run because the API is rate-limited
+func schedulerPausedByThrottle(job string) bool {
+	until, reason, throttled := apiThrottle.Get()
+	if throttled {
+		log.Printf("Skipping %s: Viessmann API throttled (%s) until %s\n", job, reason, until.Local().Format(time.RFC3339))
+	}
+	return throttled
+}
+
+// APIThrottleStatus is the throttle state reported by /api/status and /health
+type APIThrottleStatus struct {
+	Throttled      bool   `json:"throttled"`
+	ThrottledUntil string `json:"throttledUntil,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// getAPIThrottleStatus returns the current throttle state
+func getAPIThrottleStatus() APIThrottleStatus {
+	until, reason, throttled := apiThrottle.Get()
+	if !throttled {
+		return APIThrottleStatus{}
+	}
+	return APIThrottleStatus{
+		Throttled:      true,
+		ThrottledUntil: until.Format(time.RFC3339),
+		Reason:         reason,
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// roundTripFunc serves canned responses in place of the Viessmann API
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// sampleCapture is a minimal session: token, installation topology and features
+var sampleCapture = map[string]string{
+	"/idp/v3/token": `{"access_token":"secret-access","refresh_token":"secret-refresh","token_type":"Bearer","expires_in":3600}`,
+	"/iot/v2/equipment/installations": `{"data":[{"id":1234567,"description":"Haus Mustermann",
+		"address":{"street":"Musterstraße","houseNumber":"12","zip":"35108","city":"Allendorf","country":"DE"},
+		"gateways":[{"serial":"7637415022052200","installationId":1234567,"devices":[{"id":"0","deviceType":"heating"}]}]}],
+		"cursor":{"next":""}}`,
+	"/iot/v2/features/installations/1234567/gateways/7637415022052200/devices/0/features": `{"data":[{"feature":"heating.sensors.temperature.outside",
+		"properties":{"value":{"type":"number","value":7.5,"unit":"celsius"}},"installationId":"1234567","gatewayId":"7637415022052200"}]}`,
+}
+
+// captureSecrets must not appear in any fixture
+var captureSecrets = []string{"secret-access", "secret-refresh", "1234567", "7637415022052200", "Haus Mustermann", "Musterstraße", "demo@example.org", "s3cret"}
+
+// sampleAPI answers with the sample capture
+func sampleAPI(req *http.Request) (*http.Response, error) {
+	body, ok := sampleCapture[req.URL.Path]
+	if !ok {
+		return replayResponse(req, http.StatusNotFound, nil, nil), nil
+	}
+	return replayResponse(req, http.StatusOK, map[string]string{"Content-Type": "application/json"}, []byte(body)), nil
+}
+
+// fetch sends a request tagged as API traffic and returns the response body
+func fetch(t *testing.T, client *http.Client, method, url, body string) (int, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := client.Do(markAPIRequest(req, PriorityCommand))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
+
+func TestRecordScrubAndReplay(t *testing.T) {
+	t.Setenv("VICARE_CONFIG_DIR", filepath.Join(t.TempDir(), "config"))
+	dir := t.TempDir()
+
+	recorder, err := NewRecordingTransport(dir, roundTripFunc(sampleAPI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: recorder}
+
+	featuresPath := "/iot/v2/features/installations/1234567/gateways/7637415022052200/devices/0/features"
+	fetch(t, client, "POST", iamBaseURL+"/idp/v3/token", "grant_type=password&username=demo@example.org&password=s3cret")
+	_, live := fetch(t, client, "GET", apiBaseURL+"/iot/v2/equipment/installations", "")
+	fetch(t, client, "GET", apiBaseURL+featuresPath, "")
+
+	// The application still sees the real response
+	if !strings.Contains(string(live), "1234567") {
+		t.Fatalf("recorder changed the live response: %s", live)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 3 {
+		t.Fatalf("expected 3 fixtures, got %d", len(files))
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range captureSecrets {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("%s contains %q:\n%s", filepath.Base(file), secret, data)
+			}
+		}
+	}
+
+	// Replay without network: the topology gives the pseudonyms to request the features with
+	replay, err := NewReplayTransport(dir, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, fmt.Errorf("unexpected request to %s", req.URL)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = &http.Client{Transport: replay}
+
+	status, body := fetch(t, client, "GET", apiBaseURL+"/iot/v2/equipment/installations", "")
+	if status != http.StatusOK {
+		t.Fatalf("installations replay: status %d", status)
+	}
+	var topology struct {
+		Data []struct {
+			ID          float64 `json:"id"`
+			Description string  `json:"description"`
+			Gateways    []struct {
+				Serial         string  `json:"serial"`
+				InstallationID float64 `json:"installationId"`
+			} `json:"gateways"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &topology); err != nil {
+		t.Fatalf("installations replay is no valid JSON: %v", err)
+	}
+	if len(topology.Data) != 1 || len(topology.Data[0].Gateways) != 1 {
+		t.Fatalf("unexpected topology: %s", body)
+	}
+	installation := topology.Data[0]
+	gateway := installation.Gateways[0]
+	installationID := fmt.Sprintf("%.0f", installation.ID)
+	if len(installationID) != len("1234567") || gateway.InstallationID != installation.ID {
+		t.Errorf("installation ID %s not pseudonymized consistently (gateway: %.0f)", installationID, gateway.InstallationID)
+	}
+	if installation.Description != scrubRedacted {
+		t.Errorf("description not redacted: %q", installation.Description)
+	}
+	if len(gateway.Serial) != 16 || !strings.HasPrefix(gateway.Serial, "7637") {
+		t.Errorf("unexpected gateway pseudonym %q", gateway.Serial)
+	}
+
+	features := fmt.Sprintf("%s/iot/v2/features/installations/%s/gateways/%s/devices/0/features", apiBaseURL, installationID, gateway.Serial)
+	status, body = fetch(t, client, "GET", features, "")
+	if status != http.StatusOK || !strings.Contains(string(body), "heating.sensors.temperature.outside") {
+		t.Fatalf("features replay: status %d, body %s", status, body)
+	}
+	var feature struct {
+		Data []struct {
+			InstallationID string `json:"installationId"`
+			GatewayID      string `json:"gatewayId"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &feature); err != nil || len(feature.Data) != 1 {
+		t.Fatalf("features replay is no valid JSON: %v", err)
+	}
+	if feature.Data[0].InstallationID != installationID || feature.Data[0].GatewayID != gateway.Serial {
+		t.Errorf("features reference other pseudonyms than the topology: %s", body)
+	}
+
+	status, _ = fetch(t, client, "GET", apiBaseURL+featuresPath, "")
+	if status != http.StatusNotFound {
+		t.Errorf("real serials must not match a fixture, got status %d", status)
+	}
+}
+
+// TestReplayRecordedFixtures replays the checked-in capture in testdata/replay through the
+// API client, so fixtures attached to bug reports keep loading
+func TestReplayRecordedFixtures(t *testing.T) {
+	replay, err := NewReplayTransport(filepath.Join("testdata", "replay"), roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, fmt.Errorf("unexpected request to %s", req.URL)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.Len() != 2 {
+		t.Fatalf("expected 2 fixtures, got %d", replay.Len())
+	}
+	client := apiHTTPClient
+	apiHTTPClient = &http.Client{Transport: replay}
+	defer func() { apiHTTPClient = client }()
+
+	ids, installations, err := fetchInstallationIDsForAccount("replay-token")
+	if err != nil {
+		t.Fatalf("installations replay: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "9984574" {
+		t.Fatalf("unexpected installation IDs %v", ids)
+	}
+	installation := installations[ids[0]]
+	if installation.Description != scrubRedacted || installation.Address.Country != "DE" {
+		t.Errorf("unexpected installation %+v", installation)
+	}
+	if len(installation.Gateways) != 1 || installation.Gateways[0].Serial != "7637295360599518" {
+		t.Fatalf("unexpected gateways %+v", installation.Gateways)
+	}
+
+	features, err := fetchFeaturesForDeviceWithPriority(ids[0], installation.Gateways[0].Serial, "0", "replay-token", PriorityCommand)
+	if err != nil {
+		t.Fatalf("features replay: %v", err)
+	}
+	outside, ok := features.Temperatures["heating.sensors.temperature.outside"]
+	if !ok || outside.Value != 7.5 || outside.Unit != "celsius" {
+		t.Errorf("unexpected outside temperature %+v (features: %+v)", outside, features.Temperatures)
+	}
+}
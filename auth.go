@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -30,20 +31,20 @@ func testCredentials(creds *Credentials) error {
 	}
 
 	// Try to fetch installations to verify the token works
-	req, err := NewRequest("GET", "https://api.viessmann-climatesolutions.com/iot/v2/equipment/installations", nil)
+	req, err := NewRequest("GET", apiBaseURL+"/iot/v2/equipment/installations", nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+tokenResp.AccessToken)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := doAPIRequest(req)
 	if err != nil {
 		return fmt.Errorf("failed to verify token: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("API returned status %d", resp.StatusCode)
+		return apiStatusError(resp)
 	}
 
 	var result struct {
@@ -64,27 +65,93 @@ func testCredentials(creds *Credentials) error {
 	return nil
 }
 
+// tokenRefreshMargin is how long before expiry a token is proactively refreshed
+const tokenRefreshMargin = 5 * time.Minute
+
+// accountAuthLocks serializes token refreshes per account so concurrent callers
+// don't all hit the IdP at once (protected by accountsMutex)
+var accountAuthLocks = make(map[string]*sync.Mutex)
+
+// tokenUsable reports whether an access token can still be used right now
+func tokenUsable(accessToken string, expiry time.Time) bool {
+	return accessToken != "" && time.Now().Before(expiry)
+}
+
+// tokenFresh reports whether an access token is valid and not yet due for refresh
+func tokenFresh(accessToken string, expiry time.Time) bool {
+	return accessToken != "" && time.Now().Add(tokenRefreshMargin).Before(expiry)
+}
+
+// getAccountAuthLock returns the refresh lock for an account, creating it on first use
+func getAccountAuthLock(accountID string) *sync.Mutex {
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+
+	lock, ok := accountAuthLocks[accountID]
+	if !ok {
+		lock = &sync.Mutex{}
+		accountAuthLocks[accountID] = lock
+	}
+	return lock
+}
+
 // ensureAccountAuthenticated ensures a specific account is authenticated and returns its token
+// Tokens are refreshed via the refresh_token grant shortly before they expire; a full
+// login is only performed if no refresh token is available or the refresh fails.
 func ensureAccountAuthenticated(account *Account) (*AccountToken, error) {
 	accountsMutex.RLock()
 	token, exists := accountTokens[account.ID]
 	accountsMutex.RUnlock()
 
-	// Check if token is still valid
-	if exists && token.AccessToken != "" && time.Now().Before(token.TokenExpiry) {
+	// Check if token is still valid and not close to expiry
+	if exists && tokenFresh(token.AccessToken, token.TokenExpiry) {
 		return token, nil
 	}
 
-	// Need to authenticate
-	accountsMutex.Lock()
-	defer accountsMutex.Unlock()
+	lock := getAccountAuthLock(account.ID)
+	if exists && tokenUsable(token.AccessToken, token.TokenExpiry) {
+		// Token still works - if another request is already refreshing, keep using it
+		if !lock.TryLock() {
+			return token, nil
+		}
+	} else {
+		lock.Lock()
+	}
+	defer lock.Unlock()
 
-	// Double-check after acquiring write lock
+	// Double-check after acquiring the refresh lock
+	accountsMutex.RLock()
 	token, exists = accountTokens[account.ID]
-	if exists && token.AccessToken != "" && time.Now().Before(token.TokenExpiry) {
+	accountsMutex.RUnlock()
+	if exists && tokenFresh(token.AccessToken, token.TokenExpiry) {
 		return token, nil
 	}
 
+	// Try the refresh token first, keeping the known installation topology
+	if exists && token.RefreshToken != "" && len(token.InstallationIDs) > 0 {
+		tokenResp, err := RefreshAccessToken(token.RefreshToken, account.ClientID)
+		if err == nil {
+			refreshed := &AccountToken{
+				Email:           account.Email,
+				AccessToken:     tokenResp.AccessToken,
+				RefreshToken:    tokenResp.RefreshToken,
+				TokenExpiry:     time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
+				InstallationIDs: token.InstallationIDs,
+				Installations:   token.Installations,
+			}
+
+			accountsMutex.Lock()
+			accountTokens[account.ID] = refreshed
+			accountsMutex.Unlock()
+
+			persistAccountTokens()
+
+			log.Printf("Refreshed access token for account %s\n", account.Email)
+			return refreshed, nil
+		}
+		log.Printf("Token refresh failed for account %s, falling back to full login: %v\n", account.Email, err)
+	}
+
 	// Authenticate
 	tokenResp, err := AuthenticateWithViCare(account.Email, account.Password, account.ClientID)
 	if err != nil {
@@ -99,19 +166,55 @@ func ensureAccountAuthenticated(account *Account) (*AccountToken, error) {
 
 	// Store token
 	token = &AccountToken{
+		Email:           account.Email,
 		AccessToken:     tokenResp.AccessToken,
 		RefreshToken:    tokenResp.RefreshToken,
 		TokenExpiry:     time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
 		InstallationIDs: installationIDs,
 		Installations:   installations,
 	}
+
+	accountsMutex.Lock()
 	accountTokens[account.ID] = token
+	accountsMutex.Unlock()
+
+	persistAccountTokens()
 
 	log.Printf("Authenticated account %s, found %d installations\n", account.Email, len(installationIDs))
 
 	return token, nil
 }
 
+// getValidAccountToken returns the token of an already authenticated account,
+// refreshing it first if it is about to expire
+func getValidAccountToken(accountID string) (*AccountToken, bool) {
+	accountsMutex.RLock()
+	token, exists := accountTokens[accountID]
+	accountsMutex.RUnlock()
+
+	if !exists {
+		return nil, false
+	}
+	if tokenFresh(token.AccessToken, token.TokenExpiry) {
+		return token, true
+	}
+
+	account, err := GetAccount(accountID)
+	if err != nil {
+		return token, tokenUsable(token.AccessToken, token.TokenExpiry)
+	}
+
+	refreshed, err := ensureAccountAuthenticated(account)
+	if err != nil {
+		log.Printf("Failed to refresh token for account %s: %v\n", account.Email, err)
+		return token, tokenUsable(token.AccessToken, token.TokenExpiry)
+	}
+	return refreshed, true
+}
+
+// legacyAuthMutex serializes token refreshes for the legacy single-credential path
+var legacyAuthMutex sync.Mutex
+
 // ensureAuthenticated ensures the current credentials are authenticated (legacy support)
 func ensureAuthenticated() error {
 	if currentCreds == nil {
@@ -119,7 +222,14 @@ func ensureAuthenticated() error {
 	}
 
 	// Check if token is still valid
-	if accessToken != "" && time.Now().Before(tokenExpiry) {
+	if tokenFresh(accessToken, tokenExpiry) {
+		return nil
+	}
+
+	legacyAuthMutex.Lock()
+	defer legacyAuthMutex.Unlock()
+
+	if tokenFresh(accessToken, tokenExpiry) {
 		return nil
 	}
 
@@ -128,6 +238,20 @@ func ensureAuthenticated() error {
 		if err := fetchInstallationIDs(); err != nil {
 			return err
 		}
+		return nil
+	}
+
+	// Try the refresh token first
+	if refreshToken != "" {
+		tokenResp, err := RefreshAccessToken(refreshToken, currentCreds.ClientID)
+		if err == nil {
+			accessToken = tokenResp.AccessToken
+			refreshToken = tokenResp.RefreshToken
+			tokenExpiry = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+			log.Println("Successfully refreshed access token")
+			return nil
+		}
+		log.Printf("Token refresh failed, falling back to full login: %v\n", err)
 	}
 
 	// Authenticate using ViCare Authorization Code flow with PKCE
@@ -157,7 +281,7 @@ func fetchInstallationIDsForAccount(accessToken string) ([]string, map[string]*I
 		pageCount++
 
 		// Build URL with cursor and includeGateways parameter
-		baseURL := "https://api.viessmann-climatesolutions.com/iot/v2/equipment/installations"
+		baseURL := apiBaseURL + "/iot/v2/equipment/installations"
 		req, err := NewRequest("GET", baseURL, nil)
 		if err != nil {
 			return nil, nil, err
@@ -173,11 +297,17 @@ func fetchInstallationIDsForAccount(accessToken string) ([]string, map[string]*I
 
 		req.Header.Set("Authorization", "Bearer "+accessToken)
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := doAPIRequest(req)
 		if err != nil {
 			return nil, nil, err
 		}
 
+		if resp.StatusCode != http.StatusOK {
+			err := apiStatusError(resp)
+			resp.Body.Close()
+			return nil, nil, err
+		}
+
 		var rawResult struct {
 			Data   []map[string]interface{} `json:"data"`
 			Cursor *struct {
@@ -360,7 +490,7 @@ func fetchInstallationIDs() error {
 		pageCount++
 
 		// Build URL with cursor parameter
-		baseURL := "https://api.viessmann-climatesolutions.com/iot/v2/equipment/installations"
+		baseURL := apiBaseURL + "/iot/v2/equipment/installations"
 		req, err := NewRequest("GET", baseURL, nil)
 		if err != nil {
 			return err
@@ -375,11 +505,17 @@ func fetchInstallationIDs() error {
 
 		req.Header.Set("Authorization", "Bearer "+accessToken)
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := doAPIRequest(req)
 		if err != nil {
 			return err
 		}
 
+		if resp.StatusCode != http.StatusOK {
+			err := apiStatusError(resp)
+			resp.Body.Close()
+			return err
+		}
+
 		// Decode as raw JSON to handle ID type flexibility
 		var rawResult struct {
 			Data   []map[string]interface{} `json:"data"`
@@ -26,6 +26,12 @@ func BasicAuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Prometheus may scrape /metrics with METRICS_TOKEN instead of Basic Auth
+		if r.URL.Path == "/metrics" && metricsTokenValid(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		user, pass, ok := r.BasicAuth()
 
 		// Use constant-time comparison to prevent timing attacks
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// runCommand executes a one-shot CLI subcommand and returns the process exit code
+func runCommand(args []string) int {
+	switch args[0] {
+	case "backfill-sink":
+		return runBackfillSinkCommand(args[1:])
+	case "export":
+		return runExportCommand(args[1:])
+	case "import":
+		return runImportCommand(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		printCommandUsage()
+		return 2
+	}
+}
+
+func printCommandUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: vieventlog [flags] [command]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Without a command the web server is started.")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  backfill-sink   send logged temperature snapshots to the configured InfluxDB / remote-write sink")
+	fmt.Fprintln(os.Stderr, "  export          write events or temperature history as CSV, JSON Lines or Parquet")
+	fmt.Fprintln(os.Stderr, "  import          import historical temperatures or events from CSV / JSON files")
+}
+
+// openCommandDatabase opens the given database or the one from the event archive settings
+func openCommandDatabase(dbPath string) error {
+	if dbPath == "" {
+		archiveSettings, err := GetEventArchiveSettings()
+		if err != nil {
+			return fmt.Errorf("failed to load event archive settings: %v", err)
+		}
+		dbPath = archiveSettings.DatabasePath
+	}
+	if err := InitEventDatabase(dbPath); err != nil {
+		return fmt.Errorf("failed to open database %s: %v", dbPath, err)
+	}
+	return nil
+}
+
+// runBackfillSinkCommand streams historical snapshots to the configured sink
+func runBackfillSinkCommand(args []string) int {
+	fs := flag.NewFlagSet("backfill-sink", flag.ContinueOnError)
+	fromStr := fs.String("from", "", "first day to send (YYYY-MM-DD, default: first logged snapshot)")
+	toStr := fs.String("to", "", "last day to send (YYYY-MM-DD, default: last logged snapshot)")
+	dbPath := fs.String("db", "", "path to the SQLite database (default: event archive setting)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	settings, err := GetSnapshotSinkSettings()
+	if err != nil {
+		log.Printf("Failed to load snapshot sink settings: %v", err)
+		return 1
+	}
+	// The backfill works even while live export is switched off
+	settings.Enabled = true
+	if err := validateSnapshotSinkSettings(settings); err != nil {
+		log.Printf("Invalid snapshot sink settings: %v", err)
+		return 1
+	}
+
+	if err := openCommandDatabase(*dbPath); err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer CloseEventDatabase()
+
+	from, to, err := parseBackfillRange(*fromStr, *toStr)
+	if err != nil {
+		log.Printf("Invalid time range: %v", err)
+		return 1
+	}
+
+	log.Printf("Backfilling %s sink %s from %s to %s", settings.Type, settings.URL, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	started := time.Now()
+	sent, err := BackfillSnapshotSink(settings, from, to, func(day time.Time, sent int64) {
+		log.Printf("  %s done (%d snapshots sent)", day.Format("2006-01-02"), sent)
+	})
+	if err != nil {
+		log.Printf("Backfill failed after %d snapshots: %v", sent, err)
+		return 1
+	}
+
+	log.Printf("Backfill completed: %d snapshots in %s", sent, time.Since(started).Round(time.Second))
+	return 0
+}
+
+// runExportCommand writes a table export to a file or stdout
+func runExportCommand(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	table := fs.String("table", "temperatures", "table to export: events or temperatures")
+	format := fs.String("format", ExportFormatCSV, "output format: csv, jsonl or parquet")
+	columns := fs.String("columns", "", "comma-separated column list (default: all useful columns)")
+	delimiter := fs.String("delimiter", "", "CSV delimiter: a single character, comma, semicolon or tab")
+	installationID := fs.String("installation", "", "only this installation ID")
+	gatewayID := fs.String("gateway", "", "only this gateway serial")
+	deviceID := fs.String("device", "", "only this device ID")
+	fromStr := fs.String("from", "", "start (RFC3339 or YYYY-MM-DD)")
+	toStr := fs.String("to", "", "end (RFC3339 or YYYY-MM-DD, a date includes the whole day)")
+	output := fs.String("o", "", "output file (default: stdout)")
+	dbPath := fs.String("db", "", "path to the SQLite database (default: event archive setting)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	opts := ExportOptions{
+		Table:          *table,
+		Format:         strings.ToLower(*format),
+		InstallationID: *installationID,
+		GatewayID:      *gatewayID,
+		DeviceID:       *deviceID,
+	}
+	if *columns != "" {
+		opts.Columns = strings.Split(*columns, ",")
+	}
+	var err error
+	if opts.Delimiter, err = parseExportDelimiter(*delimiter); err != nil {
+		log.Print(err)
+		return 2
+	}
+	if opts.From, err = parseExportTime(*fromStr, false); err != nil {
+		log.Printf("Invalid -from: use RFC3339 or YYYY-MM-DD")
+		return 2
+	}
+	if opts.To, err = parseExportTime(*toStr, true); err != nil {
+		log.Printf("Invalid -to: use RFC3339 or YYYY-MM-DD")
+		return 2
+	}
+
+	if err := openCommandDatabase(*dbPath); err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer CloseEventDatabase()
+
+	if err := ValidateExport(&opts); err != nil {
+		log.Print(err)
+		return 2
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			log.Printf("Failed to create %s: %v", *output, err)
+			return 1
+		}
+		defer out.Close()
+	}
+
+	started := time.Now()
+	rows, err := ExportRows(out, opts)
+	if err != nil {
+		log.Printf("Export failed after %d rows: %v", rows, err)
+		return 1
+	}
+	if *output != "" {
+		if err := out.Close(); err != nil {
+			log.Printf("Failed to write %s: %v", *output, err)
+			return 1
+		}
+	}
+	log.Printf("Exported %d %s rows in %s", rows, opts.Table, time.Since(started).Round(time.Millisecond))
+	return 0
+}
+
+// runImportCommand imports one or more files and prints the report as JSON
+func runImportCommand(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	specFile := fs.String("spec", "", "JSON file with the import spec (flags below override it)")
+	kind := fs.String("kind", "", "temperatures or events (default: temperatures)")
+	preset := fs.String("preset", "", "input preset: homeassistant")
+	mapping := fs.String("map", "", "column mapping, e.g. \"Aussen=outside_temp,Vorlauf=heating_circuit_0_supply_temp\"")
+	installationID := fs.String("installation", "", "installation ID for records without one")
+	gatewayID := fs.String("gateway", "", "gateway serial for records without one")
+	deviceID := fs.String("device", "", "device ID for records without one (default 0)")
+	interval := fs.Int("interval", 0, "sample interval in minutes (default: temperature log setting)")
+	maxFill := fs.Int("max-fill", 0, "long format: hold a state for at most this many minutes (default 360)")
+	decimalComma := fs.Bool("decimal-comma", false, "numbers use a decimal comma")
+	dryRun := fs.Bool("dry-run", false, "only report what would be imported")
+	dbPath := fs.String("db", "", "path to the SQLite database (default: event archive setting)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: vieventlog import [flags] file...")
+		fs.PrintDefaults()
+		return 2
+	}
+
+	var spec ImportSpec
+	if *specFile != "" {
+		data, err := os.ReadFile(*specFile)
+		if err != nil {
+			log.Printf("Failed to read spec: %v", err)
+			return 2
+		}
+		if err := json.Unmarshal(data, &spec); err != nil {
+			log.Printf("Invalid spec %s: %v", *specFile, err)
+			return 2
+		}
+	}
+	if *kind != "" {
+		spec.Kind = *kind
+	}
+	if spec.Kind == "" {
+		spec.Kind = ImportKindTemperatures
+	}
+	if *preset != "" {
+		spec.Preset = *preset
+	}
+	if *mapping != "" {
+		if spec.Mapping == nil {
+			spec.Mapping = make(map[string]string)
+		}
+		for _, pair := range strings.Split(*mapping, ",") {
+			source, target, ok := strings.Cut(pair, "=")
+			if !ok {
+				log.Printf("Invalid mapping %q, use source=field", pair)
+				return 2
+			}
+			spec.Mapping[strings.TrimSpace(source)] = strings.TrimSpace(target)
+		}
+	}
+	if *installationID != "" {
+		spec.InstallationID = *installationID
+	}
+	if *gatewayID != "" {
+		spec.GatewayID = *gatewayID
+	}
+	if *deviceID != "" {
+		spec.DeviceID = *deviceID
+	}
+	if *interval > 0 {
+		spec.SampleInterval = *interval
+	}
+	if *maxFill > 0 {
+		spec.MaxFillMinutes = *maxFill
+	}
+	spec.DecimalComma = spec.DecimalComma || *decimalComma
+	spec.DryRun = spec.DryRun || *dryRun
+
+	if err := openCommandDatabase(*dbPath); err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer CloseEventDatabase()
+
+	exitCode := 0
+	for _, path := range fs.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Printf("Failed to open %s: %v", path, err)
+			exitCode = 1
+			continue
+		}
+		report, err := RunImport(file, spec)
+		file.Close()
+		if err != nil {
+			log.Printf("Import of %s failed: %v", path, err)
+			exitCode = 1
+			if report == nil {
+				continue
+			}
+		}
+
+		output, _ := json.MarshalIndent(map[string]interface{}{
+			"file":   path,
+			"report": report,
+		}, "", "  ")
+		fmt.Println(string(output))
+	}
+	return exitCode
+}
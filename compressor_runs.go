@@ -0,0 +1,773 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operating modes of a compressor run, from the 4/3-way valve position
+const (
+	RunModeHeating = "heating"
+	RunModeDHW     = "dhw"
+	RunModeDefrost = "defrost"
+	RunModeUnknown = "unknown" // no valve position logged
+)
+
+// Sources of a compressor run
+const (
+	RunSourceSnapshots = "snapshots" // compressor seen active in at least one snapshot
+	RunSourceCounter   = "counter"   // only the start counter rose between two inactive snapshots
+)
+
+const (
+	defaultShortRunMinutes     = 10
+	defaultMaxStartsPerHour    = 3
+	defaultMaxShortRunsPerHour = 1
+	defaultRunsDays            = 7
+	defaultCycleStatsDays      = 30
+	runGapIntervals            = 3 // a snapshot gap of more than this many sample intervals ends a run
+	compressorDevicesRefresh   = time.Hour
+)
+
+// cycleBucketBounds are the upper bounds in minutes of the run length histogram; the last bucket is open
+var cycleBucketBounds = []float64{5, 10, 20, 30, 60, 120}
+
+// CycleSettings configures what counts as short-cycling
+type CycleSettings struct {
+	ShortRunMinutes     int `json:"shortRunMinutes"`     // runs shorter than this are short runs
+	MaxStartsPerHour    int `json:"maxStartsPerHour"`    // more starts within an hour are short-cycling
+	MaxShortRunsPerHour int `json:"maxShortRunsPerHour"` // more short runs within an hour are short-cycling
+}
+
+// validateCycleSettings checks the limits
+func validateCycleSettings(settings *CycleSettings) error {
+	if settings.ShortRunMinutes < 1 || settings.ShortRunMinutes > 120 {
+		return fmt.Errorf("shortRunMinutes must be between 1 and 120")
+	}
+	if settings.MaxStartsPerHour < 1 || settings.MaxStartsPerHour > 20 {
+		return fmt.Errorf("maxStartsPerHour must be between 1 and 20")
+	}
+	if settings.MaxShortRunsPerHour < 0 || settings.MaxShortRunsPerHour > 20 {
+		return fmt.Errorf("maxShortRunsPerHour must be between 0 and 20")
+	}
+	return nil
+}
+
+// CompressorRun is one run of the compressor, reconstructed from the temperature snapshots.
+// Start and end lie halfway between the last inactive and the first active snapshot (and
+// vice versa), so durations are accurate to about one sample interval.
+type CompressorRun struct {
+	InstallationID  string    `json:"installation_id"`
+	GatewayID       string    `json:"gateway_id"`
+	DeviceID        string    `json:"device_id"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+	DurationMinutes float64   `json:"duration_minutes"` // 0 for counter runs: shorter than the sample interval
+	Starts          int       `json:"starts"`           // from the start counter; more than 1 means restarts between two snapshots
+	Samples         int       `json:"samples"`          // active snapshots
+	AvgPower        *float64  `json:"avg_power,omitempty"`
+	ElectricityWh   float64   `json:"electricity_wh"`
+	ThermalWh       float64   `json:"thermal_wh"`
+	Mode            string    `json:"mode"` // heating, dhw, defrost or unknown
+	Source          string    `json:"source"`
+	Open            bool      `json:"open"` // still running at the last snapshot
+}
+
+// short reports whether a closed run counts as short; counter runs always do
+func (r *CompressorRun) short(settings *CycleSettings) bool {
+	if r.Source == RunSourceCounter {
+		return true
+	}
+	return !r.Open && r.DurationMinutes < float64(settings.ShortRunMinutes)
+}
+
+// shortRuns returns the number of short runs a run stands for (every start of a counter run)
+func (r *CompressorRun) shortRuns(settings *CycleSettings) int {
+	switch {
+	case r.Source == RunSourceCounter:
+		return r.Starts
+	case r.short(settings):
+		return 1
+	}
+	return 0
+}
+
+// snapshotRunMode returns the operating mode of an active snapshot
+func snapshotRunMode(s *TemperatureSnapshot) string {
+	if s.ThermalPower != nil && *s.ThermalPower < 0 {
+		return RunModeDefrost // heat taken from the building to defrost the evaporator
+	}
+	if s.FourWayValve == nil || *s.FourWayValve == "" {
+		return RunModeUnknown
+	}
+	valve := strings.ToLower(*s.FourWayValve)
+	switch {
+	case strings.Contains(valve, "defrost"):
+		return RunModeDefrost
+	case valve == "domestichotwater":
+		return RunModeDHW
+	}
+	return RunModeHeating
+}
+
+// midpoint returns the time halfway between a and b
+func midpoint(a, b time.Time) time.Time {
+	return a.Add(b.Sub(a) / 2)
+}
+
+// runDetector reconstructs the runs of one device from its snapshots in time order
+type runDetector struct {
+	fallbackInterval int // minutes, for snapshots without a sample interval
+	prev             *TemperatureSnapshot
+	run              *CompressorRun
+	runStarts        int // counter increase since the snapshot before the run
+	powerSum         float64
+	powerSamples     int
+	modes            map[string]int
+	runs             []CompressorRun
+}
+
+// interval returns the sample interval of a snapshot
+func (d *runDetector) interval(s *TemperatureSnapshot) time.Duration {
+	if s.SampleInterval > 0 {
+		return time.Duration(s.SampleInterval) * time.Minute
+	}
+	return time.Duration(d.fallbackInterval) * time.Minute
+}
+
+// add processes the next snapshot
+func (d *runDetector) add(s TemperatureSnapshot) {
+	if s.CompressorActive == nil {
+		return
+	}
+	prev := d.prev
+	d.prev = &s
+	interval := d.interval(&s)
+
+	gap := prev != nil && s.Timestamp.Sub(prev.Timestamp) > runGapIntervals*interval
+	if gap && d.run != nil {
+		d.finish(prev.Timestamp.Add(d.interval(prev) / 2))
+	}
+	delta := 0
+	if prev != nil && !gap && prev.CompressorStarts != nil && s.CompressorStarts != nil && *s.CompressorStarts > *prev.CompressorStarts {
+		delta = int(math.Round(*s.CompressorStarts - *prev.CompressorStarts))
+	}
+
+	if !*s.CompressorActive {
+		switch {
+		case d.run != nil:
+			d.runStarts += delta // restarts between the last active snapshot and this one
+			d.finish(midpoint(prev.Timestamp, s.Timestamp))
+		case delta > 0:
+			// The compressor started and stopped again between two snapshots
+			d.runs = append(d.runs, CompressorRun{
+				InstallationID: s.InstallationID,
+				GatewayID:      s.GatewayID,
+				DeviceID:       s.DeviceID,
+				StartTime:      prev.Timestamp,
+				EndTime:        s.Timestamp,
+				Starts:         delta,
+				Mode:           RunModeUnknown,
+				Source:         RunSourceCounter,
+			})
+		}
+		return
+	}
+
+	if d.run == nil {
+		start := s.Timestamp
+		if prev != nil && !gap {
+			start = midpoint(prev.Timestamp, s.Timestamp)
+		}
+		d.run = &CompressorRun{
+			InstallationID: s.InstallationID,
+			GatewayID:      s.GatewayID,
+			DeviceID:       s.DeviceID,
+			StartTime:      start,
+			Source:         RunSourceSnapshots,
+		}
+		d.runStarts, d.powerSum, d.powerSamples = 0, 0, 0
+		d.modes = make(map[string]int)
+	}
+
+	r := d.run
+	d.runStarts += delta
+	r.Samples++
+	r.EndTime = s.Timestamp
+	hours := interval.Hours()
+	if s.CompressorPower != nil {
+		d.powerSum += *s.CompressorPower
+		d.powerSamples++
+		r.ElectricityWh += *s.CompressorPower * hours
+	}
+	if s.ThermalPower != nil {
+		r.ThermalWh += *s.ThermalPower * 1000 * hours
+	}
+	d.modes[snapshotRunMode(&s)]++
+}
+
+// finish closes the current run at end
+func (d *runDetector) finish(end time.Time) {
+	d.runs = append(d.runs, d.complete(end))
+	d.run = nil
+}
+
+// complete returns the current run ending at end
+func (d *runDetector) complete(end time.Time) CompressorRun {
+	r := *d.run
+	r.EndTime = end
+	r.DurationMinutes = math.Round(end.Sub(r.StartTime).Minutes()*10) / 10
+	r.Starts = d.runStarts
+	if r.Starts < 1 {
+		r.Starts = 1 // counter not logged or not yet updated
+	}
+	if d.powerSamples > 0 {
+		r.AvgPower = roundedPtr(d.powerSum/float64(d.powerSamples), 0)
+	}
+	r.ElectricityWh = math.Round(r.ElectricityWh)
+	r.ThermalWh = math.Round(r.ThermalWh)
+
+	// The mode seen most often; a valve position beats unknown snapshots
+	r.Mode = RunModeUnknown
+	best := 0
+	for _, mode := range []string{RunModeHeating, RunModeDHW, RunModeDefrost} {
+		if d.modes[mode] > best {
+			r.Mode, best = mode, d.modes[mode]
+		}
+	}
+	return r
+}
+
+// result returns the closed runs and the run still going on at the last snapshot, if any
+func (d *runDetector) result() (closed []CompressorRun, open *CompressorRun) {
+	if d.run != nil {
+		r := d.complete(d.prev.Timestamp)
+		r.Open = true
+		open = &r
+	}
+	return d.runs, open
+}
+
+// runsMutex serializes run detection of the scheduler and startup
+var runsMutex sync.Mutex
+
+// compressorDevice identifies a device with compressor data
+type compressorDevice struct{ installationID, gatewayID, deviceID string }
+
+// compressorDevices caches the device list between passes, guarded by runsMutex
+var compressorDevices struct {
+	list   []compressorDevice
+	listed time.Time
+}
+
+// UpdateCompressorRuns detects the runs in all snapshots since the last closed run of each
+// device with compressor data and replaces the open run. The first run after the upgrade
+// goes through the complete snapshot history.
+func UpdateCompressorRuns() error {
+	if !dbInitialized || eventDB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	runsMutex.Lock()
+	defer runsMutex.Unlock()
+
+	settings, err := GetTemperatureLogSettings()
+	if err != nil {
+		return err
+	}
+
+	devices, err := listCompressorDevices()
+	if err != nil {
+		return err
+	}
+	cycleSettings, err := GetCycleSettings()
+	if err != nil {
+		return err
+	}
+
+	// A failing device must not hold up run detection and alerts of the others
+	var errs []error
+	for _, d := range devices {
+		if err := updateDeviceRuns(d.installationID, d.gatewayID, d.deviceID, settings.SampleInterval); err != nil {
+			log.Printf("Error detecting compressor runs of device %s: %v", d.deviceID, err)
+			errs = append(errs, fmt.Errorf("device %s: %v", d.deviceID, err))
+			continue
+		}
+		EvaluateCycleAlerts(d.installationID, d.gatewayID, d.deviceID, cycleSettings)
+	}
+	return errors.Join(errs...)
+}
+
+// listCompressorDevices returns the devices with compressor data, the list is read again
+// from the daily rollups once an hour; runsMutex must be held
+func listCompressorDevices() ([]compressorDevice, error) {
+	if time.Since(compressorDevices.listed) < compressorDevicesRefresh {
+		return compressorDevices.list, nil
+	}
+
+	// The daily rollups are small and list every device that ever logged compressor data
+	var devices []compressorDevice
+	dbMutex.RLock()
+	rows, err := eventDB.Query(`
+		SELECT DISTINCT installation_id, gateway_id, device_id FROM ` + rollupTableDaily + `
+		WHERE runtime_minutes > 0 OR compressor_starts IS NOT NULL
+	`)
+	if err == nil {
+		for rows.Next() {
+			var d compressorDevice
+			if err = rows.Scan(&d.installationID, &d.gatewayID, &d.deviceID); err != nil {
+				break
+			}
+			devices = append(devices, d)
+		}
+		rows.Close()
+	}
+	dbMutex.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list compressor devices: %v", err)
+	}
+
+	compressorDevices.list = devices
+	compressorDevices.listed = time.Now()
+	return devices, nil
+}
+
+// updateDeviceRuns detects the runs of one device
+func updateDeviceRuns(installationID, gatewayID, deviceID string, sampleInterval int) error {
+	dbMutex.RLock()
+	from, err := firstRollupSource(eventDB, `
+		SELECT MAX(end_time) FROM compressor_runs
+		WHERE installation_id = ? AND gateway_id = ? AND device_id = ? AND open = 0
+	`, installationID, gatewayID, deviceID)
+	if err == nil && from.IsZero() {
+		from, err = firstRollupSource(eventDB, `
+			SELECT MIN(timestamp) FROM temperature_snapshots
+			WHERE installation_id = ? AND gateway_id = ? AND device_id = ?
+		`, installationID, gatewayID, deviceID)
+	}
+	dbMutex.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to find run detection start: %v", err)
+	}
+	if from.IsZero() {
+		return nil
+	}
+
+	detector := &runDetector{fallbackInterval: sampleInterval}
+	now := time.Now()
+	for chunkStart := from; chunkStart.Before(now); chunkStart = chunkStart.Add(rollupChunk) {
+		snapshots, err := GetTemperatureSnapshots(installationID, gatewayID, deviceID, chunkStart, chunkStart.Add(rollupChunk), 0)
+		if err != nil {
+			return err
+		}
+		for _, s := range snapshots {
+			// Chunk bounds are inclusive
+			if detector.prev != nil && !s.Timestamp.After(detector.prev.Timestamp) {
+				continue
+			}
+			detector.add(s)
+		}
+	}
+
+	closed, open := detector.result()
+	runs := closed
+	if open != nil {
+		runs = append(runs, *open)
+	}
+
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	tx, err := eventDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM compressor_runs WHERE installation_id = ? AND gateway_id = ? AND device_id = ? AND open = 1`,
+		installationID, gatewayID, deviceID); err != nil {
+		return fmt.Errorf("failed to delete open run: %v", err)
+	}
+	stmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO compressor_runs (
+			installation_id, gateway_id, device_id, start_time, end_time, duration_minutes, starts, samples,
+			avg_power, electricity_wh, thermal_wh, mode, source, open
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range runs {
+		if _, err := stmt.Exec(r.InstallationID, r.GatewayID, r.DeviceID,
+			r.StartTime.UTC().Format(time.RFC3339), r.EndTime.UTC().Format(time.RFC3339),
+			r.DurationMinutes, r.Starts, r.Samples, r.AvgPower, r.ElectricityWh, r.ThermalWh,
+			r.Mode, r.Source, r.Open); err != nil {
+			return fmt.Errorf("failed to save run: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if len(closed) > 100 {
+		log.Printf("Detected %d compressor runs of device %s since %s", len(closed), deviceID, from.In(DefaultLocation).Format("2006-01-02"))
+	}
+	return nil
+}
+
+// GetCompressorRuns returns the runs of a device starting in [from, to), oldest first
+func GetCompressorRuns(installationID, gatewayID, deviceID string, from, to time.Time, limit int) ([]CompressorRun, error) {
+	if !dbInitialized || eventDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	query := `
+		SELECT ` + compressorRunColumns + `
+		FROM compressor_runs
+		WHERE installation_id = ? AND gateway_id = ? AND device_id = ? AND start_time >= ? AND start_time < ?
+		ORDER BY start_time ASC
+	`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	return queryCompressorRuns(query, installationID, gatewayID, deviceID,
+		from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+}
+
+// getRunAcross returns the run of a device that started before t and ended after it, if any
+func getRunAcross(installationID, gatewayID, deviceID string, t time.Time) (*CompressorRun, error) {
+	if !dbInitialized || eventDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	runs, err := queryCompressorRuns(`
+		SELECT `+compressorRunColumns+`
+		FROM compressor_runs
+		WHERE installation_id = ? AND gateway_id = ? AND device_id = ? AND start_time < ? AND end_time > ?
+		ORDER BY start_time DESC LIMIT 1
+	`, installationID, gatewayID, deviceID, t.UTC().Format(time.RFC3339), t.UTC().Format(time.RFC3339))
+	if err != nil || len(runs) == 0 {
+		return nil, err
+	}
+	return &runs[0], nil
+}
+
+const compressorRunColumns = `installation_id, gateway_id, device_id, start_time, end_time, duration_minutes, starts, samples,
+			avg_power, electricity_wh, thermal_wh, mode, source, open`
+
+// queryCompressorRuns reads the runs selected with compressorRunColumns
+func queryCompressorRuns(query string, args ...interface{}) ([]CompressorRun, error) {
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	rows, err := eventDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query compressor runs: %v", err)
+	}
+	defer rows.Close()
+
+	runs := []CompressorRun{}
+	for rows.Next() {
+		var r CompressorRun
+		var start, end string
+		var avgPower, electricity, thermal sql.NullFloat64
+		if err := rows.Scan(&r.InstallationID, &r.GatewayID, &r.DeviceID, &start, &end, &r.DurationMinutes,
+			&r.Starts, &r.Samples, &avgPower, &electricity, &thermal, &r.Mode, &r.Source, &r.Open); err != nil {
+			return nil, fmt.Errorf("failed to scan compressor run: %v", err)
+		}
+		r.StartTime, _ = time.Parse(time.RFC3339, start)
+		r.EndTime, _ = time.Parse(time.RFC3339, end)
+		if avgPower.Valid {
+			r.AvgPower = &avgPower.Float64
+		}
+		r.ElectricityWh = electricity.Float64
+		r.ThermalWh = thermal.Float64
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// CycleModeStats sums up the runs of one operating mode
+type CycleModeStats struct {
+	Mode                string  `json:"mode"`
+	Runs                int     `json:"runs"`
+	Starts              int     `json:"starts"`
+	ShortRuns           int     `json:"short_runs"`
+	RuntimeHours        float64 `json:"runtime_hours"`
+	MeanDurationMinutes float64 `json:"mean_duration_minutes"` // closed runs seen in the snapshots
+	ElectricityKWh      float64 `json:"electricity_kwh"`
+	ThermalKWh          float64 `json:"thermal_kwh"`
+}
+
+// CycleDay is one day of the run length histogram
+type CycleDay struct {
+	Date                string  `json:"date"`
+	Runs                int     `json:"runs"`
+	Starts              int     `json:"starts"`
+	ShortRuns           int     `json:"short_runs"`
+	RuntimeHours        float64 `json:"runtime_hours"`
+	MeanDurationMinutes float64 `json:"mean_duration_minutes"`
+	MaxStartsPerHour    int     `json:"max_starts_per_hour"`
+	ShortCyclingHours   int     `json:"short_cycling_hours"`
+	Buckets             []int   `json:"buckets"` // runs per entry of bucket_labels
+}
+
+// CompressorCycleStats describes the run length distribution and short-cycling of a device
+type CompressorCycleStats struct {
+	StartTime             time.Time        `json:"start_time"`
+	EndTime               time.Time        `json:"end_time"`
+	Settings              CycleSettings    `json:"settings"`
+	Runs                  int              `json:"runs"`
+	Starts                int              `json:"starts"`
+	HiddenStarts          int              `json:"hidden_starts"` // starts not seen as a run in the snapshots
+	CounterRuns           int              `json:"counter_runs"`  // runs shorter than the sample interval
+	ShortRuns             int              `json:"short_runs"`
+	ShortRunShare         float64          `json:"short_run_share"` // percent of starts
+	RuntimeHours          float64          `json:"runtime_hours"`
+	StartsPerRuntimeHour  *float64         `json:"starts_per_runtime_hour,omitempty"`
+	MeanDurationMinutes   *float64         `json:"mean_duration_minutes,omitempty"`
+	MedianDurationMinutes *float64         `json:"median_duration_minutes,omitempty"`
+	P10DurationMinutes    *float64         `json:"p10_duration_minutes,omitempty"`
+	P90DurationMinutes    *float64         `json:"p90_duration_minutes,omitempty"`
+	MaxStartsPerHour      int              `json:"max_starts_per_hour"`
+	MaxStartsHour         string           `json:"max_starts_hour,omitempty"`
+	ShortCyclingHours     int              `json:"short_cycling_hours"` // clock hours beyond the limits
+	BucketLabels          []string         `json:"bucket_labels"`
+	Buckets               []int            `json:"buckets"` // closed runs per duration bucket
+	Modes                 []CycleModeStats `json:"modes"`
+	Days                  []CycleDay       `json:"days"`
+}
+
+// cycleBucketLabels returns the labels of the run length histogram
+func cycleBucketLabels() []string {
+	labels := make([]string, 0, len(cycleBucketBounds)+1)
+	lower := 0.0
+	for _, bound := range cycleBucketBounds {
+		labels = append(labels, fmt.Sprintf("%g-%g min", lower, bound))
+		lower = bound
+	}
+	return append(labels, fmt.Sprintf("%g+ min", lower))
+}
+
+// cycleBucket returns the histogram bucket of a duration
+func cycleBucket(minutes float64) int {
+	for i, bound := range cycleBucketBounds {
+		if minutes < bound {
+			return i
+		}
+	}
+	return len(cycleBucketBounds)
+}
+
+// percentile returns the p-th percentile of sorted values (nearest rank)
+func percentile(sorted []float64, p float64) float64 {
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// meanDuration returns the mean of durations in minutes (one decimal, 0 without runs)
+func meanDuration(durations []float64) float64 {
+	if len(durations) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, d := range durations {
+		sum += d
+	}
+	return math.Round(sum/float64(len(durations))*10) / 10
+}
+
+// hourCount counts starts and short runs within one clock hour
+type hourCount struct{ starts, shortRuns int }
+
+// exceeds reports whether an hour is beyond the short-cycling limits
+func (h hourCount) exceeds(settings *CycleSettings) bool {
+	return h.starts > settings.MaxStartsPerHour || h.shortRuns > settings.MaxShortRunsPerHour
+}
+
+// GetCompressorCycleStats computes the run length distribution, the per-mode breakdown and the
+// daily histogram of the runs starting in [from, to). Durations only use closed runs seen in the
+// snapshots; runs between two snapshots count as starts and short runs.
+func GetCompressorCycleStats(installationID, gatewayID, deviceID string, from, to time.Time, settings *CycleSettings) (*CompressorCycleStats, error) {
+	runs, err := GetCompressorRuns(installationID, gatewayID, deviceID, from, to, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &CompressorCycleStats{
+		StartTime:    from,
+		EndTime:      to,
+		Settings:     *settings,
+		BucketLabels: cycleBucketLabels(),
+		Buckets:      make([]int, len(cycleBucketBounds)+1),
+		Modes:        []CycleModeStats{},
+		Days:         []CycleDay{},
+	}
+
+	dayIndex := make(map[string]int)
+	for day := startOfDay(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		dayIndex[date] = len(stats.Days)
+		stats.Days = append(stats.Days, CycleDay{Date: date, Buckets: make([]int, len(cycleBucketBounds)+1)})
+	}
+
+	modeIndex := make(map[string]int)
+	modeDurations := make(map[string][]float64)
+	hours := make(map[time.Time]*hourCount)
+	var durations []float64
+	var runtimeMinutes float64
+	dayDurations := make(map[string][]float64)
+
+	// A run going on at from only adds its runtime inside the range, its start was earlier
+	across, err := getRunAcross(installationID, gatewayID, deviceID, from)
+	if err != nil {
+		return nil, err
+	}
+	if across != nil {
+		end := across.EndTime
+		if end.After(to) {
+			end = to
+		}
+		runMinutes := across.DurationMinutes
+		if across.Open {
+			runMinutes = across.EndTime.Sub(across.StartTime).Minutes()
+		}
+		if span := across.EndTime.Sub(across.StartTime); span > 0 {
+			runMinutes *= float64(end.Sub(from)) / float64(span)
+		}
+		runtimeMinutes += runMinutes
+
+		stats.Modes = append(stats.Modes, CycleModeStats{Mode: across.Mode, RuntimeHours: runMinutes / 60})
+		modeIndex[across.Mode] = 0
+		if di, ok := dayIndex[from.In(DefaultLocation).Format("2006-01-02")]; ok {
+			stats.Days[di].RuntimeHours += runMinutes / 60
+		}
+	}
+
+	for i := range runs {
+		r := &runs[i]
+		start := r.StartTime.In(DefaultLocation)
+		shortRuns := r.shortRuns(settings)
+		runMinutes := r.DurationMinutes
+		if r.Open {
+			runMinutes = r.EndTime.Sub(r.StartTime).Minutes()
+		}
+
+		stats.Runs++
+		stats.Starts += r.Starts
+		stats.ShortRuns += shortRuns
+		runtimeMinutes += runMinutes
+		if r.Source == RunSourceCounter {
+			stats.CounterRuns++
+			stats.HiddenStarts += r.Starts
+		} else {
+			stats.HiddenStarts += r.Starts - 1
+		}
+
+		// Local clock hour, Truncate would align to UTC and shift it in half-hour zones
+		hour := time.Date(start.Year(), start.Month(), start.Day(), start.Hour(), 0, 0, 0, DefaultLocation)
+		if hours[hour] == nil {
+			hours[hour] = &hourCount{}
+		}
+		hours[hour].starts += r.Starts
+		hours[hour].shortRuns += shortRuns
+
+		mi, ok := modeIndex[r.Mode]
+		if !ok {
+			mi = len(stats.Modes)
+			modeIndex[r.Mode] = mi
+			stats.Modes = append(stats.Modes, CycleModeStats{Mode: r.Mode})
+		}
+		mode := &stats.Modes[mi]
+		mode.Runs++
+		mode.Starts += r.Starts
+		mode.ShortRuns += shortRuns
+		mode.RuntimeHours += runMinutes / 60
+		mode.ElectricityKWh += r.ElectricityWh / 1000
+		mode.ThermalKWh += r.ThermalWh / 1000
+
+		date := start.Format("2006-01-02")
+		di, ok := dayIndex[date]
+		if !ok {
+			continue
+		}
+		day := &stats.Days[di]
+		day.Runs++
+		day.Starts += r.Starts
+		day.ShortRuns += shortRuns
+		day.RuntimeHours += runMinutes / 60
+
+		if r.Source == RunSourceCounter || r.Open {
+			continue
+		}
+		bucket := cycleBucket(r.DurationMinutes)
+		stats.Buckets[bucket]++
+		day.Buckets[bucket]++
+		durations = append(durations, r.DurationMinutes)
+		dayDurations[date] = append(dayDurations[date], r.DurationMinutes)
+		modeDurations[r.Mode] = append(modeDurations[r.Mode], r.DurationMinutes)
+	}
+
+	for hour, count := range hours {
+		if count.starts > stats.MaxStartsPerHour {
+			stats.MaxStartsPerHour = count.starts
+			stats.MaxStartsHour = hour.Format("2006-01-02 15:04")
+		}
+		exceeds := count.exceeds(settings)
+		if exceeds {
+			stats.ShortCyclingHours++
+		}
+		if di, ok := dayIndex[hour.Format("2006-01-02")]; ok {
+			day := &stats.Days[di]
+			if count.starts > day.MaxStartsPerHour {
+				day.MaxStartsPerHour = count.starts
+			}
+			if exceeds {
+				day.ShortCyclingHours++
+			}
+		}
+	}
+
+	stats.RuntimeHours = math.Round(runtimeMinutes/60*100) / 100
+	if stats.Starts > 0 {
+		stats.ShortRunShare = math.Round(float64(stats.ShortRuns)/float64(stats.Starts)*1000) / 10
+	}
+	if runtimeMinutes > 0 {
+		stats.StartsPerRuntimeHour = roundedPtr(float64(stats.Starts)/(runtimeMinutes/60), 2)
+	}
+	if len(durations) > 0 {
+		sort.Float64s(durations)
+		mean := meanDuration(durations)
+		stats.MeanDurationMinutes = &mean
+		stats.MedianDurationMinutes = roundedPtr(percentile(durations, 50), 1)
+		stats.P10DurationMinutes = roundedPtr(percentile(durations, 10), 1)
+		stats.P90DurationMinutes = roundedPtr(percentile(durations, 90), 1)
+	}
+
+	for i := range stats.Modes {
+		mode := &stats.Modes[i]
+		mode.MeanDurationMinutes = meanDuration(modeDurations[mode.Mode])
+		mode.RuntimeHours = math.Round(mode.RuntimeHours*100) / 100
+		mode.ElectricityKWh = math.Round(mode.ElectricityKWh*100) / 100
+		mode.ThermalKWh = math.Round(mode.ThermalKWh*100) / 100
+	}
+	sort.Slice(stats.Modes, func(i, j int) bool { return stats.Modes[i].Runs > stats.Modes[j].Runs })
+
+	for i := range stats.Days {
+		day := &stats.Days[i]
+		day.MeanDurationMinutes = meanDuration(dayDurations[day.Date])
+		day.RuntimeHours = math.Round(day.RuntimeHours*100) / 100
+	}
+	return stats, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Comparison periods
+const (
+	ComparisonWeek   = "week"   // this week vs last week
+	ComparisonMonth  = "month"  // this month vs the same month last year
+	ComparisonSeason = "season" // this heating season vs the previous one
+)
+
+// minDegreeDayShare is the share of days that need outside temperatures for normalization
+const minDegreeDayShare = 0.8
+
+// comparisonRanges returns the current and previous range of a period up to ref (exclusive),
+// so a ref at midnight still belongs to the day before. Both ranges cover the same elapsed
+// part of their week, month or season.
+func comparisonRanges(period string, ref time.Time) (curFrom, curTo, prevFrom, prevTo time.Time, err error) {
+	ref = ref.In(DefaultLocation)
+	last := ref.Add(-time.Nanosecond)
+	switch period {
+	case ComparisonWeek:
+		day := startOfDay(last)
+		weekday := (int(day.Weekday()) + 6) % 7 // Monday = 0
+		curFrom = day.AddDate(0, 0, -weekday)
+		return curFrom, ref, curFrom.AddDate(0, 0, -7), ref.AddDate(0, 0, -7), nil
+	case ComparisonMonth:
+		curFrom = time.Date(last.Year(), last.Month(), 1, 0, 0, 0, 0, DefaultLocation)
+		return curFrom, ref, curFrom.AddDate(-1, 0, 0), ref.AddDate(-1, 0, 0), nil
+	case ComparisonSeason:
+		curFrom = heatingSeasonStart(last)
+		return curFrom, ref, curFrom.AddDate(-1, 0, 0), ref.AddDate(-1, 0, 0), nil
+	}
+	return curFrom, curTo, prevFrom, prevTo, fmt.Errorf("invalid period %q", period)
+}
+
+// percentChange returns the change from previous to current in percent (one decimal)
+func percentChange(current, previous float64) float64 {
+	if previous == 0 {
+		return 0
+	}
+	return math.Round((current/previous-1)*1000) / 10
+}
+
+// roundedPtr rounds to the given number of decimals and returns a pointer
+func roundedPtr(value float64, decimals int) *float64 {
+	factor := math.Pow(10, float64(decimals))
+	v := math.Round(value*factor) / factor
+	return &v
+}
+
+// GetConsumptionComparison compares the consumption of a period up to ref with the previous
+// period and normalizes both with heating degree days
+func GetConsumptionComparison(installationID, gatewayID, deviceID, period string, ref time.Time, settings *DegreeDaySettings) (*ConsumptionComparisonResponse, error) {
+	curFrom, curTo, prevFrom, prevTo, err := comparisonRanges(period, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := GetConsumptionStats(installationID, gatewayID, deviceID, curFrom, curTo)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := GetConsumptionStats(installationID, gatewayID, deviceID, prevFrom, prevTo)
+	if err != nil {
+		return nil, err
+	}
+	current.Period = period
+	previous.Period = period
+
+	result := &ConsumptionComparisonResponse{
+		Period:        period,
+		Current:       *current,
+		Previous:      *previous,
+		PercentChange: percentChange(current.ElectricityKWh, previous.ElectricityKWh),
+	}
+
+	result.CurrentDegreeDays, _, err = GetHeatingDegreeDays(installationID, gatewayID, deviceID, curFrom, curTo, settings)
+	if err != nil {
+		return nil, err
+	}
+	result.PreviousDegreeDays, _, err = GetHeatingDegreeDays(installationID, gatewayID, deviceID, prevFrom, prevTo, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, prev := result.CurrentDegreeDays, result.PreviousDegreeDays
+	switch {
+	case cur.DaysWithData < cur.Days*minDegreeDayShare || prev.DaysWithData < prev.Days*minDegreeDayShare:
+		result.Warning = "outside temperatures are missing for too many days, no weather normalization"
+	case cur.HDD == 0 || prev.HDD == 0:
+		result.Warning = "no heating degree days in one of the periods, no weather normalization"
+	default:
+		curPerHDD := current.ElectricityKWh / cur.HDD
+		prevPerHDD := previous.ElectricityKWh / prev.HDD
+		result.CurrentKWhPerHDD = roundedPtr(curPerHDD, 3)
+		result.PreviousKWhPerHDD = roundedPtr(prevPerHDD, 3)
+		result.PreviousNormalizedKWh = roundedPtr(prevPerHDD*cur.HDD, 2)
+		if prevPerHDD > 0 {
+			change := percentChange(curPerHDD, prevPerHDD)
+			result.NormalizedPercentChange = &change
+		}
+		if previous.ThermalKWh > 0 {
+			change := percentChange(current.ThermalKWh/cur.HDD, previous.ThermalKWh/prev.HDD)
+			result.NormalizedThermalPercentChange = &change
+		}
+	}
+	return result, nil
+}
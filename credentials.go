@@ -11,6 +11,7 @@ const (
 	credKey        = "credentials"
 	accountsKey    = "accounts"        // New key for multiple accounts
 	activeAcctsKey = "active-accounts" // New key for active account IDs
+	tokenKeyKey    = "token-cache-key" // Encryption key for the token cache file
 )
 
 // CredentialStorage is the interface for credential persistence
@@ -20,6 +21,8 @@ type CredentialStorage interface {
 	DeleteCredentials() error
 	SaveAccounts(store *AccountStore) error
 	LoadAccounts() (*AccountStore, error)
+	SaveTokens(tokens map[string]*AccountToken) error
+	LoadTokens() (map[string]*AccountToken, error)
 }
 
 var storage CredentialStorage
@@ -91,8 +94,16 @@ type EventArchiveSettings struct {
 }
 
 type AccountStore struct {
-	Accounts             map[string]*Account   `json:"accounts"`             // Key is account ID
-	EventArchiveSettings *EventArchiveSettings `json:"eventArchiveSettings"` // Global event archive settings
+	Accounts               map[string]*Account     `json:"accounts"`                         // Key is account ID
+	EventArchiveSettings   *EventArchiveSettings   `json:"eventArchiveSettings"`             // Global event archive settings
+	AlertSettings          *AlertSettings          `json:"alertSettings,omitempty"`          // Alert rules and notification channels
+	MQTTSettings           *MQTTSettings           `json:"mqttSettings,omitempty"`           // MQTT broker and publishing options
+	SnapshotSinkSettings   *SnapshotSinkSettings   `json:"snapshotSinkSettings,omitempty"`   // InfluxDB / remote-write export
+	FeatureHistorySettings *FeatureHistorySettings `json:"featureHistorySettings,omitempty"` // Generic feature logging rules
+	DeviceLoggingSettings  *DeviceLoggingSettings  `json:"deviceLoggingSettings,omitempty"`  // Per-device temperature logging
+	TariffSettings         *TariffSettings         `json:"tariffSettings,omitempty"`         // Electricity tariffs for cost accounting
+	DegreeDaySettings      *DegreeDaySettings      `json:"degreeDaySettings,omitempty"`      // Heating degree days and energy signature
+	CycleSettings          *CycleSettings          `json:"cycleSettings,omitempty"`          // Compressor short-cycling limits
 }
 
 // SaveCredentials stores credentials using the configured storage backend
@@ -323,3 +334,245 @@ func SetEventArchiveSettings(settings *EventArchiveSettings) error {
 	store.EventArchiveSettings = settings
 	return SaveAccounts(store)
 }
+
+// --- Alert Settings Functions ---
+
+// GetAlertSettings retrieves the alert rules and notification channels
+func GetAlertSettings() (*AlertSettings, error) {
+	store, err := LoadAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	if store.AlertSettings == nil {
+		return &AlertSettings{
+			Enabled:  false,
+			Rules:    []AlertRule{},
+			Channels: []AlertChannel{},
+		}, nil
+	}
+
+	return store.AlertSettings, nil
+}
+
+// SetAlertSettings updates the alert rules and notification channels
+func SetAlertSettings(settings *AlertSettings) error {
+	store, err := LoadAccounts()
+	if err != nil {
+		return err
+	}
+
+	store.AlertSettings = settings
+	return SaveAccounts(store)
+}
+
+// --- MQTT Settings Functions ---
+
+// settingsSecretMask replaces passwords and tokens in settings returned by the API
+const settingsSecretMask = "********"
+
+// GetMQTTSettings retrieves the MQTT publisher settings
+func GetMQTTSettings() (*MQTTSettings, error) {
+	store, err := LoadAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	if store.MQTTSettings == nil {
+		return &MQTTSettings{
+			Enabled:         false,
+			Broker:          "tcp://localhost:1883",
+			TopicPrefix:     mqttDefaultTopicPrefix,
+			QoS:             0,
+			Retain:          true,
+			DiscoveryPrefix: haDefaultDiscovery,
+		}, nil
+	}
+
+	return store.MQTTSettings, nil
+}
+
+// SetMQTTSettings updates the MQTT publisher settings
+func SetMQTTSettings(settings *MQTTSettings) error {
+	store, err := LoadAccounts()
+	if err != nil {
+		return err
+	}
+
+	store.MQTTSettings = settings
+	return SaveAccounts(store)
+}
+
+// --- Snapshot Sink Settings Functions ---
+
+// GetSnapshotSinkSettings retrieves the InfluxDB / remote-write sink settings
+func GetSnapshotSinkSettings() (*SnapshotSinkSettings, error) {
+	store, err := LoadAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	if store.SnapshotSinkSettings == nil {
+		return &SnapshotSinkSettings{
+			Enabled:     false,
+			Type:        SinkTypeInfluxDB,
+			URL:         "http://localhost:8086",
+			Name:        sinkDefaultName,
+			MaxBuffered: sinkDefaultMaxBuffered,
+		}, nil
+	}
+
+	return store.SnapshotSinkSettings, nil
+}
+
+// SetSnapshotSinkSettings updates the snapshot sink settings
+func SetSnapshotSinkSettings(settings *SnapshotSinkSettings) error {
+	store, err := LoadAccounts()
+	if err != nil {
+		return err
+	}
+
+	store.SnapshotSinkSettings = settings
+	return SaveAccounts(store)
+}
+
+// GetFeatureHistorySettings retrieves the generic feature logging rules
+func GetFeatureHistorySettings() (*FeatureHistorySettings, error) {
+	store, err := LoadAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	if store.FeatureHistorySettings == nil {
+		return &FeatureHistorySettings{
+			Enabled: false,
+			Rules:   []FeatureHistoryRule{},
+		}, nil
+	}
+
+	return store.FeatureHistorySettings, nil
+}
+
+// SetFeatureHistorySettings updates the generic feature logging rules
+func SetFeatureHistorySettings(settings *FeatureHistorySettings) error {
+	store, err := LoadAccounts()
+	if err != nil {
+		return err
+	}
+
+	store.FeatureHistorySettings = settings
+	return SaveAccounts(store)
+}
+
+// GetDeviceLoggingSettings retrieves the per-device temperature logging settings
+func GetDeviceLoggingSettings() (*DeviceLoggingSettings, error) {
+	store, err := LoadAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	if store.DeviceLoggingSettings == nil {
+		return &DeviceLoggingSettings{
+			Devices: []DeviceLogConfig{},
+		}, nil
+	}
+
+	return store.DeviceLoggingSettings, nil
+}
+
+// SetDeviceLoggingSettings updates the per-device temperature logging settings
+func SetDeviceLoggingSettings(settings *DeviceLoggingSettings) error {
+	store, err := LoadAccounts()
+	if err != nil {
+		return err
+	}
+
+	store.DeviceLoggingSettings = settings
+	return SaveAccounts(store)
+}
+
+// GetTariffSettings retrieves the electricity tariffs
+func GetTariffSettings() (*TariffSettings, error) {
+	store, err := LoadAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	if store.TariffSettings == nil {
+		return &TariffSettings{
+			Tariffs: []Tariff{},
+		}, nil
+	}
+
+	return store.TariffSettings, nil
+}
+
+// SetTariffSettings updates the electricity tariffs
+func SetTariffSettings(settings *TariffSettings) error {
+	store, err := LoadAccounts()
+	if err != nil {
+		return err
+	}
+
+	store.TariffSettings = settings
+	return SaveAccounts(store)
+}
+
+// GetDegreeDaySettings retrieves the heating degree day settings
+func GetDegreeDaySettings() (*DegreeDaySettings, error) {
+	store, err := LoadAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	if store.DegreeDaySettings == nil {
+		return &DegreeDaySettings{
+			BaseTemp:          defaultDegreeDayBaseTemp,
+			HeatingLimit:      defaultHeatingLimitTemp,
+			OutlierSigma:      defaultOutlierSigma,
+			DesignOutsideTemp: defaultDesignOutsideTemp,
+		}, nil
+	}
+
+	return store.DegreeDaySettings, nil
+}
+
+// SetDegreeDaySettings updates the heating degree day settings
+func SetDegreeDaySettings(settings *DegreeDaySettings) error {
+	store, err := LoadAccounts()
+	if err != nil {
+		return err
+	}
+
+	store.DegreeDaySettings = settings
+	return SaveAccounts(store)
+}
+
+// GetCycleSettings retrieves the compressor short-cycling limits
+func GetCycleSettings() (*CycleSettings, error) {
+	store, err := LoadAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	if store.CycleSettings == nil {
+		return &CycleSettings{
+			ShortRunMinutes:     defaultShortRunMinutes,
+			MaxStartsPerHour:    defaultMaxStartsPerHour,
+			MaxShortRunsPerHour: defaultMaxShortRunsPerHour,
+		}, nil
+	}
+
+	return store.CycleSettings, nil
+}
+
+// SetCycleSettings updates the compressor short-cycling limits
+func SetCycleSettings(settings *CycleSettings) error {
+	store, err := LoadAccounts()
+	if err != nil {
+		return err
+	}
+
+	store.CycleSettings = settings
+	return SaveAccounts(store)
+}
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 
@@ -109,6 +110,51 @@ func (k *KeyringStorage) LoadAccounts() (*AccountStore, error) {
 	return &store, nil
 }
 
+// SaveTokens stores the token cache encrypted on disk; the encryption key lives in
+// the keyring since token caches with installation topology exceed keyring size limits
+func (k *KeyringStorage) SaveTokens(tokens map[string]*AccountToken) error {
+	key, err := k.tokenKey(true)
+	if err != nil {
+		return err
+	}
+	return writeTokenCache(key, tokens)
+}
+
+func (k *KeyringStorage) LoadTokens() (map[string]*AccountToken, error) {
+	key, err := k.tokenKey(false)
+	if err != nil || key == nil {
+		return nil, err
+	}
+	return readTokenCache(key)
+}
+
+// tokenKey loads the token cache key from the keyring, optionally creating it
+func (k *KeyringStorage) tokenKey(create bool) ([]byte, error) {
+	data, err := keyring.Get(serviceName, tokenKeyKey)
+	if err == nil {
+		key, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode token cache key: %w", err)
+		}
+		return key, nil
+	}
+	if err != keyring.ErrNotFound {
+		return nil, fmt.Errorf("failed to load token cache key from keyring: %w", err)
+	}
+	if !create {
+		return nil, nil
+	}
+
+	key, err := newTokenCacheKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := keyring.Set(serviceName, tokenKeyKey, base64.StdEncoding.EncodeToString(key)); err != nil {
+		return nil, fmt.Errorf("failed to save token cache key to keyring: %w", err)
+	}
+	return key, nil
+}
+
 func newCredentialStorage() CredentialStorage {
 	return &KeyringStorage{}
 }
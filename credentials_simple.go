@@ -3,6 +3,7 @@
 package main
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -155,6 +156,61 @@ func (s *SimpleStorage) LoadAccounts() (*AccountStore, error) {
 	return &AccountStore{Accounts: make(map[string]*Account)}, nil
 }
 
+// SaveTokens stores the token cache encrypted in the config directory
+func (s *SimpleStorage) SaveTokens(tokens map[string]*AccountToken) error {
+	key, err := s.tokenKey(true)
+	if err != nil {
+		return err
+	}
+	return writeTokenCache(key, tokens)
+}
+
+func (s *SimpleStorage) LoadTokens() (map[string]*AccountToken, error) {
+	key, err := s.tokenKey(false)
+	if err != nil || key == nil {
+		return nil, err
+	}
+	return readTokenCache(key)
+}
+
+// tokenKey returns the token cache key. VICARE_TOKEN_KEY (a passphrase) takes
+// precedence; otherwise a random key is kept in token.key next to accounts.json.
+func (s *SimpleStorage) tokenKey(create bool) ([]byte, error) {
+	if passphrase := os.Getenv("VICARE_TOKEN_KEY"); passphrase != "" {
+		key := sha256.Sum256([]byte(passphrase))
+		return key[:], nil
+	}
+
+	configPath := getConfigPath()
+	keyPath := filepath.Join(configPath, "token.key")
+
+	key, err := os.ReadFile(keyPath)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("invalid token key file %s", keyPath)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read token key file: %w", err)
+	}
+	if !create {
+		return nil, nil
+	}
+
+	key, err = newTokenCacheKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(configPath, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(keyPath, key, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write token key file: %w", err)
+	}
+	return key, nil
+}
+
 func getConfigPath() string {
 	// Default to /config for container use, or current dir for testing
 	if configDir := os.Getenv("VICARE_CONFIG_DIR"); configDir != "" {
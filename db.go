@@ -3,11 +3,14 @@ package main
 import (
 	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 	"strconv"
@@ -648,6 +651,262 @@ func runSchemaMigrations() error {
 		log.Println("Migration 8 completed: Optimized temperature_snapshots indices")
 	}
 
+	// Migration 9: Full-text search and filter indices for the event query API
+	if !migrationApplied("add_events_fts") {
+		log.Println("Running migration 9: Adding full-text search index for events...")
+
+		// External-content FTS5 table kept in sync with events via triggers
+		_, err := eventDB.Exec(`
+			CREATE VIRTUAL TABLE IF NOT EXISTS events_fts USING fts5(
+				human_readable, raw, error_code, error_description, feature_name,
+				content='events', content_rowid='id',
+				tokenize='unicode61 remove_diacritics 2'
+			);
+
+			CREATE TRIGGER IF NOT EXISTS events_fts_insert AFTER INSERT ON events BEGIN
+				INSERT INTO events_fts(rowid, human_readable, raw, error_code, error_description, feature_name)
+				VALUES (new.id, new.human_readable, new.raw, new.error_code, new.error_description, new.feature_name);
+			END;
+
+			CREATE TRIGGER IF NOT EXISTS events_fts_delete AFTER DELETE ON events BEGIN
+				INSERT INTO events_fts(events_fts, rowid, human_readable, raw, error_code, error_description, feature_name)
+				VALUES ('delete', old.id, old.human_readable, old.raw, old.error_code, old.error_description, old.feature_name);
+			END;
+
+			CREATE TRIGGER IF NOT EXISTS events_fts_update AFTER UPDATE ON events BEGIN
+				INSERT INTO events_fts(events_fts, rowid, human_readable, raw, error_code, error_description, feature_name)
+				VALUES ('delete', old.id, old.human_readable, old.raw, old.error_code, old.error_description, old.feature_name);
+				INSERT INTO events_fts(rowid, human_readable, raw, error_code, error_description, feature_name)
+				VALUES (new.id, new.human_readable, new.raw, new.error_code, new.error_description, new.feature_name);
+			END;
+		`)
+		if err != nil {
+			return fmt.Errorf("migration 9 failed (events_fts): %v", err)
+		}
+
+		// Index existing events
+		_, err = eventDB.Exec(`INSERT INTO events_fts(events_fts) VALUES ('rebuild')`)
+		if err != nil {
+			return fmt.Errorf("migration 9 failed (rebuild events_fts): %v", err)
+		}
+
+		// Keyset pagination over (event_timestamp, id) and common filter columns
+		_, err = eventDB.Exec(`
+			CREATE INDEX IF NOT EXISTS idx_event_ts_id ON events(event_timestamp, id);
+			CREATE INDEX IF NOT EXISTS idx_event_error_code ON events(error_code, event_timestamp);
+			CREATE INDEX IF NOT EXISTS idx_event_severity ON events(severity, event_timestamp);
+		`)
+		if err != nil {
+			return fmt.Errorf("migration 9 failed (indices): %v", err)
+		}
+
+		if err := recordMigration(9, "add_events_fts",
+			"Add FTS5 full-text index and filter indices for event queries"); err != nil {
+			return fmt.Errorf("failed to record migration 9: %v", err)
+		}
+		log.Println("Migration 9 completed: Added events_fts full-text index")
+	}
+
+	// Migration 10: Fault incidents (activation/clearing pairs of error events)
+	if !migrationApplied("add_incidents") {
+		log.Println("Running migration 10: Adding incidents table...")
+
+		_, err := eventDB.Exec(`
+			CREATE TABLE IF NOT EXISTS incidents (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				installation_id TEXT NOT NULL,
+				gateway_serial TEXT NOT NULL,
+				device_id TEXT NOT NULL,
+				model_id TEXT,
+				error_code TEXT NOT NULL,
+				error_description TEXT,
+				code_category TEXT,
+				severity TEXT,
+				start_time TEXT NOT NULL,
+				end_time TEXT,
+				duration_seconds INTEGER,
+				start_event_id INTEGER,
+				end_event_id INTEGER
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_incident_key ON incidents(installation_id, gateway_serial, device_id, error_code, start_time);
+			CREATE INDEX IF NOT EXISTS idx_incident_code ON incidents(error_code, start_time);
+			CREATE INDEX IF NOT EXISTS idx_incident_start ON incidents(start_time);
+		`)
+		if err != nil {
+			return fmt.Errorf("migration 10 failed (incidents): %v", err)
+		}
+
+		// Build incidents from already archived events
+		keys, err := rebuildAllIncidents(eventDB)
+		if err != nil {
+			return fmt.Errorf("migration 10 failed (backfill): %v", err)
+		}
+
+		if err := recordMigration(10, "add_incidents",
+			"Add incidents table built from active/inactive error events"); err != nil {
+			return fmt.Errorf("failed to record migration 10: %v", err)
+		}
+		log.Printf("Migration 10 completed: Built incidents for %d device/error code combinations", keys)
+	}
+
+	// Migration 11: Hourly and daily rollups of temperature snapshots with tiered retention
+	if !migrationApplied("add_temperature_rollups") {
+		log.Println("Running migration 11: Adding temperature rollup tables...")
+
+		if !columnExists("temperature_log_settings", "hourly_retention_days") {
+			_, err := eventDB.Exec("ALTER TABLE temperature_log_settings ADD COLUMN hourly_retention_days INTEGER NOT NULL DEFAULT 730")
+			if err != nil {
+				return fmt.Errorf("migration 11 failed (hourly retention): %v", err)
+			}
+		}
+		if !columnExists("temperature_log_settings", "daily_retention_days") {
+			_, err := eventDB.Exec("ALTER TABLE temperature_log_settings ADD COLUMN daily_retention_days INTEGER NOT NULL DEFAULT 0")
+			if err != nil {
+				return fmt.Errorf("migration 11 failed (daily retention): %v", err)
+			}
+		}
+
+		for _, table := range []string{rollupTableHourly, rollupTableDaily} {
+			if _, err := eventDB.Exec(temperatureRollupTableSQL(table)); err != nil {
+				return fmt.Errorf("migration 11 failed (%s): %v", table, err)
+			}
+		}
+
+		// The rollups themselves are built in the background by UpdateTemperatureRollups
+		if err := recordMigration(11, "add_temperature_rollups",
+			"Add hourly/daily temperature rollups and rollup retention settings"); err != nil {
+			return fmt.Errorf("failed to record migration 11: %v", err)
+		}
+		log.Println("Migration 11 completed: Added temperature rollup tables")
+	}
+
+	// Migration 12: Generic feature history (any feature/property selected by pattern rules)
+	if !migrationApplied("add_feature_history") {
+		log.Println("Running migration 12: Adding feature_history table...")
+
+		_, err := eventDB.Exec(`
+			CREATE TABLE IF NOT EXISTS feature_history (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				timestamp TEXT NOT NULL,
+				installation_id TEXT NOT NULL,
+				gateway_id TEXT NOT NULL,
+				device_id TEXT NOT NULL,
+				feature TEXT NOT NULL,
+				property TEXT NOT NULL,
+				value_type TEXT NOT NULL,
+				num_value REAL,
+				str_value TEXT,
+				unit TEXT
+			);
+
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_feature_history_unique
+				ON feature_history(installation_id, gateway_id, device_id, feature, property, timestamp);
+			CREATE INDEX IF NOT EXISTS idx_feature_history_ts ON feature_history(installation_id, timestamp);
+			CREATE INDEX IF NOT EXISTS idx_feature_history_cleanup ON feature_history(timestamp);
+		`)
+		if err != nil {
+			return fmt.Errorf("migration 12 failed (feature_history): %v", err)
+		}
+
+		if err := recordMigration(12, "add_feature_history",
+			"Add feature_history table for generic feature logging"); err != nil {
+			return fmt.Errorf("failed to record migration 12: %v", err)
+		}
+		log.Println("Migration 12 completed: Added feature_history table")
+	}
+
+	// Migration 13: Energy counters reported by the device (day/week/month values per mode)
+	if !migrationApplied("add_energy_counters") {
+		log.Println("Running migration 13: Adding energy_counters table...")
+
+		_, err := eventDB.Exec(`
+			CREATE TABLE IF NOT EXISTS energy_counters (
+				installation_id TEXT NOT NULL,
+				gateway_id TEXT NOT NULL,
+				device_id TEXT NOT NULL,
+				period TEXT NOT NULL,
+				period_start TEXT NOT NULL,
+				energy TEXT NOT NULL,
+				mode TEXT NOT NULL,
+				kwh REAL NOT NULL,
+				source TEXT NOT NULL,
+				updated_at TEXT NOT NULL,
+				PRIMARY KEY (installation_id, gateway_id, device_id, period, period_start, energy, mode)
+			);
+		`)
+		if err != nil {
+			return fmt.Errorf("migration 13 failed (energy_counters): %v", err)
+		}
+
+		if err := recordMigration(13, "add_energy_counters",
+			"Add energy_counters table for device-reported consumption and heat production"); err != nil {
+			return fmt.Errorf("failed to record migration 13: %v", err)
+		}
+		log.Println("Migration 13 completed: Added energy_counters table")
+	}
+
+	// Migration 14: Hourly prices of dynamic electricity tariffs
+	if !migrationApplied("add_electricity_prices") {
+		log.Println("Running migration 14: Adding electricity_prices table...")
+
+		_, err := eventDB.Exec(`
+			CREATE TABLE IF NOT EXISTS electricity_prices (
+				tariff TEXT NOT NULL,
+				hour_start TEXT NOT NULL,
+				price REAL NOT NULL,
+				source TEXT NOT NULL,
+				updated_at TEXT NOT NULL,
+				PRIMARY KEY (tariff, hour_start)
+			);
+		`)
+		if err != nil {
+			return fmt.Errorf("migration 14 failed (electricity_prices): %v", err)
+		}
+
+		if err := recordMigration(14, "add_electricity_prices",
+			"Add electricity_prices table for dynamic tariffs"); err != nil {
+			return fmt.Errorf("failed to record migration 14: %v", err)
+		}
+		log.Println("Migration 14 completed: Added electricity_prices table")
+	}
+
+	// Migration 15: Compressor runs reconstructed from the temperature snapshots
+	if !migrationApplied("add_compressor_runs") {
+		log.Println("Running migration 15: Adding compressor_runs table...")
+
+		_, err := eventDB.Exec(`
+			CREATE TABLE IF NOT EXISTS compressor_runs (
+				installation_id TEXT NOT NULL,
+				gateway_id TEXT NOT NULL,
+				device_id TEXT NOT NULL,
+				start_time TEXT NOT NULL,
+				end_time TEXT NOT NULL,
+				duration_minutes REAL NOT NULL,
+				starts INTEGER NOT NULL,
+				samples INTEGER NOT NULL,
+				avg_power REAL,
+				electricity_wh REAL,
+				thermal_wh REAL,
+				mode TEXT NOT NULL,
+				source TEXT NOT NULL,
+				open INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (installation_id, gateway_id, device_id, start_time)
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_compressor_runs_start ON compressor_runs(start_time);
+		`)
+		if err != nil {
+			return fmt.Errorf("migration 15 failed (compressor_runs): %v", err)
+		}
+
+		if err := recordMigration(15, "add_compressor_runs",
+			"Add compressor_runs table for cycle statistics"); err != nil {
+			return fmt.Errorf("failed to record migration 15: %v", err)
+		}
+		log.Println("Migration 15 completed: Added compressor_runs table")
+	}
+
 	return nil
 }
 
@@ -711,8 +970,25 @@ func SaveEventToDB(event *Event) error {
 
 // SaveEventsToDB batch inserts events into the database
 func SaveEventsToDB(events []Event) error {
+	newEvents, err := insertEvents(events)
+	if err != nil {
+		return err
+	}
+
+	if len(newEvents) > 0 {
+		countEventMetrics(newEvents)
+		EvaluateEventAlerts(newEvents)
+		PublishEvents(newEvents)
+	}
+
+	return nil
+}
+
+// insertEvents inserts events (deduplicated by hash) and updates incidents,
+// without triggering alerts or MQTT. Returns the events that were not archived before.
+func insertEvents(events []Event) ([]Event, error) {
 	if !dbInitialized || eventDB == nil {
-		return fmt.Errorf("database not initialized")
+		return nil, fmt.Errorf("database not initialized")
 	}
 
 	// Use a single lock and transaction for better performance
@@ -721,7 +997,7 @@ func SaveEventsToDB(events []Event) error {
 
 	tx, err := eventDB.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
 	}
 	defer tx.Rollback() // Will be no-op if committed
 
@@ -737,10 +1013,14 @@ func SaveEventsToDB(events []Event) error {
 
 	stmt, err := tx.Prepare(insertSQL)
 	if err != nil {
-		return fmt.Errorf("failed to prepare statement: %v", err)
+		return nil, fmt.Errorf("failed to prepare statement: %v", err)
 	}
 	defer stmt.Close()
 
+	// Earliest new error event per device and code, for the incident update
+	changedIncidents := make(map[incidentKey]string)
+	var newEvents []Event
+
 	for i := range events {
 		event := &events[i]
 		hash := ComputeEventHash(event)
@@ -761,7 +1041,7 @@ func SaveEventsToDB(events []Event) error {
 			activeInt = &val
 		}
 
-		_, err = stmt.Exec(
+		result, err := stmt.Exec(
 			hash,
 			event.EventTimestamp,
 			event.CreatedAt,
@@ -787,53 +1067,238 @@ func SaveEventsToDB(events []Event) error {
 
 		if err != nil {
 			log.Printf("Warning: failed to insert event: %v", err)
+			continue
 		}
+
+		// Only events that weren't archived before can change incidents or trigger alerts
+		if inserted, _ := result.RowsAffected(); inserted == 0 {
+			continue
+		}
+		newEvents = append(newEvents, *event)
+
+		if event.ErrorCode != "" && event.Active != nil {
+			key := incidentKey{event.InstallationID, event.GatewaySerial, event.DeviceID, event.ErrorCode}
+			if since, ok := changedIncidents[key]; !ok || event.EventTimestamp < since {
+				changedIncidents[key] = event.EventTimestamp
+			}
+		}
+	}
+
+	// Roll back the events too, so the next archive run inserts them again together with their incidents
+	if err := updateIncidents(tx, changedIncidents); err != nil {
+		return nil, fmt.Errorf("failed to update incidents: %v", err)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
 	}
 
-	return nil
+	return newEvents, nil
+}
+
+// EventQueryOptions filters, sorts and paginates events stored in the database
+// Empty fields are ignored. Multi-value filters match any of the given values.
+type EventQueryOptions struct {
+	StartTime      time.Time
+	EndTime        time.Time
+	InstallationID string
+	AccountID      string
+	GatewaySerial  string
+	DeviceID       string
+	ModelID        string
+	ErrorCodes     []string
+	CodeCategories []string
+	Severities     []string
+	EventTypes     []string
+	FeatureName    string
+	Active         *bool
+	Search         string // full-text search over human_readable/raw (FTS5 syntax-safe)
+	SortBy         string // timestamp (default), error_code, severity, event_type, device_id, model_id
+	Descending     bool
+	Limit          int    // 0 = no limit
+	Cursor         string // opaque keyset cursor from a previous page
+}
+
+// eventSortColumns maps sort keys to SQL expressions (NULLs are normalized for keyset comparison)
+var eventSortColumns = map[string]string{
+	"timestamp":  "e.event_timestamp",
+	"error_code": "COALESCE(e.error_code, '')",
+	"severity":   "CASE e.severity WHEN 'error' THEN 3 WHEN 'warning' THEN 2 WHEN 'info' THEN 1 ELSE 0 END",
+	"event_type": "e.event_type",
+	"device_id":  "COALESCE(e.device_id, '')",
+	"model_id":   "COALESCE(e.model_id, '')",
+}
+
+// errInvalidEventCursor is returned for malformed pagination cursors
+var errInvalidEventCursor = errors.New("invalid cursor")
+
+// eventCursor is the keyset position of the last row of a page
+type eventCursor struct {
+	Value interface{} `json:"v"`
+	ID    int64       `json:"id"`
+}
+
+// encodeEventCursor encodes a keyset position as an opaque string
+func encodeEventCursor(value interface{}, id int64) string {
+	data, _ := json.Marshal(eventCursor{Value: value, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeEventCursor decodes a cursor created by encodeEventCursor
+func decodeEventCursor(cursor string) (*eventCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidEventCursor
+	}
+	var c eventCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errInvalidEventCursor
+	}
+	return &c, nil
+}
+
+// ftsMatchQuery turns free text into a safe FTS5 query: every term becomes a
+// quoted prefix phrase, so user input can't inject FTS5 operators
+func ftsMatchQuery(search string) string {
+	var terms []string
+	for _, term := range strings.Fields(search) {
+		term = strings.ReplaceAll(term, `"`, `""`)
+		terms = append(terms, `"`+term+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// addInFilter appends "column IN (?, ...)" for a non-empty value list
+func addInFilter(conditions []string, args []interface{}, column string, values []string) ([]string, []interface{}) {
+	if len(values) == 0 {
+		return conditions, args
+	}
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		placeholders[i] = "?"
+		args = append(args, v)
+	}
+	return append(conditions, fmt.Sprintf("%s IN (%s)", column, strings.Join(placeholders, ", "))), args
 }
 
 // GetEventsFromDB retrieves events from the database with optional filters
-func GetEventsFromDB(startTime, endTime time.Time, limit int) ([]Event, error) {
+// Returns the events and a cursor for the next page (empty if there are no more rows).
+func GetEventsFromDB(opts EventQueryOptions) ([]Event, string, error) {
 	if !dbInitialized || eventDB == nil {
-		return nil, fmt.Errorf("database not initialized")
+		return nil, "", fmt.Errorf("database not initialized")
 	}
 
-	dbMutex.RLock()
-	defer dbMutex.RUnlock()
+	sortKey := opts.SortBy
+	if sortKey == "" {
+		sortKey = "timestamp"
+	}
+	sortExpr, ok := eventSortColumns[sortKey]
+	if !ok {
+		return nil, "", fmt.Errorf("invalid sort field: %s", opts.SortBy)
+	}
 
-	query := `
+	var conditions []string
+	var args []interface{}
+
+	if !opts.StartTime.IsZero() {
+		conditions = append(conditions, "e.event_timestamp >= ?")
+		args = append(args, opts.StartTime.UTC().Format(time.RFC3339))
+	}
+	if !opts.EndTime.IsZero() {
+		conditions = append(conditions, "e.event_timestamp <= ?")
+		args = append(args, opts.EndTime.UTC().Format(time.RFC3339))
+	}
+
+	for column, value := range map[string]string{
+		"e.installation_id": opts.InstallationID,
+		"e.account_id":      opts.AccountID,
+		"e.gateway_serial":  opts.GatewaySerial,
+		"e.device_id":       opts.DeviceID,
+		"e.model_id":        opts.ModelID,
+		"e.feature_name":    opts.FeatureName,
+	} {
+		if value != "" {
+			conditions = append(conditions, column+" = ?")
+			args = append(args, value)
+		}
+	}
+
+	conditions, args = addInFilter(conditions, args, "e.error_code", opts.ErrorCodes)
+	conditions, args = addInFilter(conditions, args, "e.code_category", opts.CodeCategories)
+	conditions, args = addInFilter(conditions, args, "e.severity", opts.Severities)
+	conditions, args = addInFilter(conditions, args, "e.event_type", opts.EventTypes)
+
+	if opts.Active != nil {
+		active := 0
+		if *opts.Active {
+			active = 1
+		}
+		conditions = append(conditions, "e.active = ?")
+		args = append(args, active)
+	}
+
+	if search := ftsMatchQuery(opts.Search); search != "" {
+		conditions = append(conditions, "e.id IN (SELECT rowid FROM events_fts WHERE events_fts MATCH ?)")
+		args = append(args, search)
+	}
+
+	// Keyset pagination: continue after the last row of the previous page
+	cmp := ">"
+	direction := "ASC"
+	if opts.Descending {
+		cmp = "<"
+		direction = "DESC"
+	}
+	if opts.Cursor != "" {
+		cursor, err := decodeEventCursor(opts.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s %s ? OR (%s = ? AND e.id %s ?))", sortExpr, cmp, sortExpr, cmp))
+		args = append(args, cursor.Value, cursor.Value, cursor.ID)
+	}
+
+	query := fmt.Sprintf(`
 		SELECT
-			event_timestamp, created_at, formatted_time, event_type,
-			feature_name, feature_value, device_id, model_id, gateway_serial,
-			error_code, error_description, human_readable, code_category, severity,
-			active, body, raw, installation_id, account_id, account_name
-		FROM events
-		WHERE event_timestamp >= ? AND event_timestamp <= ?
-		ORDER BY event_timestamp DESC
-	`
+			e.id, %s,
+			e.event_timestamp, e.created_at, e.formatted_time, e.event_type,
+			e.feature_name, e.feature_value, e.device_id, e.model_id, e.gateway_serial,
+			e.error_code, e.error_description, e.human_readable, e.code_category, e.severity,
+			e.active, e.body, e.raw, e.installation_id, e.account_id, e.account_name
+		FROM events e`, sortExpr)
+	if len(conditions) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf("\n\t\tORDER BY %s %s, e.id %s", sortExpr, direction, direction)
 
-	if limit > 0 {
-		query += fmt.Sprintf(" LIMIT %d", limit)
+	// Fetch one extra row to know whether another page exists
+	if opts.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", opts.Limit+1)
 	}
 
-	rows, err := eventDB.Query(query, startTime.Format(time.RFC3339), endTime.Format(time.RFC3339))
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	rows, err := eventDB.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query events: %v", err)
+		return nil, "", fmt.Errorf("failed to query events: %v", err)
 	}
 	defer rows.Close()
 
 	var events []Event
+	var lastID int64
+	var lastSortValue interface{}
+	var nextCursor string
 	for rows.Next() {
 		var event Event
 		var bodyJSON string
 		var activeInt *int
+		var id int64
+		var sortValue interface{}
 
 		err := rows.Scan(
+			&id,
+			&sortValue,
 			&event.EventTimestamp,
 			&event.CreatedAt,
 			&event.FormattedTime,
@@ -875,10 +1340,18 @@ func GetEventsFromDB(startTime, endTime time.Time, limit int) ([]Event, error) {
 			}
 		}
 
+		// The extra row only signals that another page exists
+		if opts.Limit > 0 && len(events) == opts.Limit {
+			nextCursor = encodeEventCursor(lastSortValue, lastID)
+			break
+		}
+
 		events = append(events, event)
+		lastID = id
+		lastSortValue = sortValue
 	}
 
-	return events, nil
+	return events, nextCursor, nil
 }
 
 // CleanupOldEvents removes events older than the retention period
@@ -892,7 +1365,12 @@ func CleanupOldEvents(retentionDays int) error {
 
 	cutoffTime := time.Now().AddDate(0, 0, -retentionDays)
 
-	result, err := eventDB.Exec("DELETE FROM events WHERE event_timestamp < ?", cutoffTime.Format(time.RFC3339))
+	// Activations of still open incidents are kept so the incident can be closed later
+	result, err := eventDB.Exec(`
+		DELETE FROM events
+		WHERE event_timestamp < ?
+		AND id NOT IN (SELECT start_event_id FROM incidents WHERE end_time IS NULL AND start_event_id IS NOT NULL)
+	`, cutoffTime.Format(time.RFC3339))
 	if err != nil {
 		return fmt.Errorf("failed to cleanup old events: %v", err)
 	}
@@ -902,6 +1380,17 @@ func CleanupOldEvents(retentionDays int) error {
 		log.Printf("Cleaned up %d old events (retention: %d days)", rowsAffected, retentionDays)
 	}
 
+	// Incidents cleared before the cutoff follow the event retention
+	result, err = eventDB.Exec("DELETE FROM incidents WHERE end_time IS NOT NULL AND end_time < ?", cutoffTime.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to cleanup old incidents: %v", err)
+	}
+
+	rowsAffected, _ = result.RowsAffected()
+	if rowsAffected > 0 {
+		log.Printf("Cleaned up %d old incidents (retention: %d days)", rowsAffected, retentionDays)
+	}
+
 	return nil
 }
 
@@ -950,9 +1439,25 @@ func SaveTemperatureSnapshot(snapshot *TemperatureSnapshot) error {
 		return fmt.Errorf("database not initialized")
 	}
 
+	// Use INSERT OR REPLACE to avoid duplicates based on timestamp, installation, gateway, device
 	dbMutex.Lock()
-	defer dbMutex.Unlock()
+	_, err := insertTemperatureSnapshot(eventDB, snapshot, "REPLACE")
+	dbMutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to insert temperature snapshot: %v", err)
+	}
+
+	// Consumers run after the unlock so a slow sink or broker never stalls other writers
+	EvaluateSnapshotAlerts(snapshot)
+	PublishTemperatureSnapshot(snapshot)
+	ExportSnapshot(snapshot)
 
+	return nil
+}
+
+// insertTemperatureSnapshot writes one snapshot row; conflict is the SQLite conflict
+// clause for the unique (installation, gateway, device, timestamp) index: REPLACE or IGNORE
+func insertTemperatureSnapshot(db sqlExecutor, snapshot *TemperatureSnapshot, conflict string) (sql.Result, error) {
 	// Convert bool pointers to nullable ints
 	var compressorActiveInt, circulationPumpActiveInt, dhwPumpActiveInt, internalPumpActiveInt *int
 	if snapshot.CompressorActive != nil {
@@ -984,9 +1489,8 @@ func SaveTemperatureSnapshot(snapshot *TemperatureSnapshot) error {
 		internalPumpActiveInt = &val
 	}
 
-	// Use INSERT OR REPLACE to avoid duplicates based on timestamp, installation, gateway, device
 	insertSQL := `
-		INSERT OR REPLACE INTO temperature_snapshots (
+		INSERT OR ` + conflict + ` INTO temperature_snapshots (
 			timestamp, installation_id, gateway_id, device_id, account_id, account_name,
 			sample_interval,
 			outside_temp, return_temp, supply_temp, primary_supply_temp, secondary_supply_temp,
@@ -1004,7 +1508,7 @@ func SaveTemperatureSnapshot(snapshot *TemperatureSnapshot) error {
 		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := eventDB.Exec(insertSQL,
+	return db.Exec(insertSQL,
 		snapshot.Timestamp.UTC().Format(time.RFC3339),
 		snapshot.InstallationID,
 		snapshot.GatewayID,
@@ -1059,12 +1563,6 @@ func SaveTemperatureSnapshot(snapshot *TemperatureSnapshot) error {
 		snapshot.FourWayValveTarget,
 		snapshot.PressureSupply,
 	)
-
-	if err != nil {
-		return fmt.Errorf("failed to insert temperature snapshot: %v", err)
-	}
-
-	return nil
 }
 
 // GetTemperatureSnapshots retrieves temperature snapshots from the database with optional filters
@@ -1249,6 +1747,15 @@ func CleanupOldTemperatureSnapshots(retentionDays int) error {
 
 	cutoffTime := time.Now().UTC().AddDate(0, 0, -retentionDays)
 
+	// Never delete raw snapshots that are not covered by the hourly rollups yet
+	rolledUp, err := lastRollupBucket(eventDB, rollupTableHourly)
+	if err != nil {
+		return fmt.Errorf("failed to check temperature rollups: %v", err)
+	}
+	if rolledUp.Before(cutoffTime) {
+		cutoffTime = rolledUp
+	}
+
 	result, err := eventDB.Exec("DELETE FROM temperature_snapshots WHERE timestamp < ?", cutoffTime.Format(time.RFC3339))
 	if err != nil {
 		return fmt.Errorf("failed to cleanup old temperature snapshots: %v", err)
@@ -1259,6 +1766,15 @@ func CleanupOldTemperatureSnapshots(retentionDays int) error {
 		log.Printf("Cleaned up %d old temperature snapshots (retention: %d days)", rowsAffected, retentionDays)
 	}
 
+	// Compressor runs are detected from the snapshots and expire with them
+	result, err = eventDB.Exec("DELETE FROM compressor_runs WHERE end_time < ?", cutoffTime.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to cleanup old compressor runs: %v", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+		log.Printf("Cleaned up %d old compressor runs", rowsAffected)
+	}
+
 	return nil
 }
 
@@ -1275,10 +1791,11 @@ func GetTemperatureLogSettings() (*TemperatureLogSettings, error) {
 	var enabledInt int
 
 	err := eventDB.QueryRow(`
-		SELECT enabled, sample_interval, retention_days, database_path
+		SELECT enabled, sample_interval, retention_days, hourly_retention_days, daily_retention_days, database_path
 		FROM temperature_log_settings
 		WHERE id = 1
-	`).Scan(&enabledInt, &settings.SampleInterval, &settings.RetentionDays, &settings.DatabasePath)
+	`).Scan(&enabledInt, &settings.SampleInterval, &settings.RetentionDays,
+		&settings.HourlyRetentionDays, &settings.DailyRetentionDays, &settings.DatabasePath)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to get temperature log settings: %v", err)
@@ -1304,16 +1821,17 @@ func SetTemperatureLogSettings(settings *TemperatureLogSettings) error {
 
 	_, err := eventDB.Exec(`
 		UPDATE temperature_log_settings
-		SET enabled = ?, sample_interval = ?, retention_days = ?, database_path = ?
+		SET enabled = ?, sample_interval = ?, retention_days = ?, hourly_retention_days = ?, daily_retention_days = ?, database_path = ?
 		WHERE id = 1
-	`, enabledInt, settings.SampleInterval, settings.RetentionDays, settings.DatabasePath)
+	`, enabledInt, settings.SampleInterval, settings.RetentionDays,
+		settings.HourlyRetentionDays, settings.DailyRetentionDays, settings.DatabasePath)
 
 	if err != nil {
 		return fmt.Errorf("failed to update temperature log settings: %v", err)
 	}
 
-	log.Printf("Temperature log settings updated: enabled=%v, interval=%dm, retention=%dd",
-		settings.Enabled, settings.SampleInterval, settings.RetentionDays)
+	log.Printf("Temperature log settings updated: enabled=%v, interval=%dm, retention=%dd, hourly=%dd, daily=%dd",
+		settings.Enabled, settings.SampleInterval, settings.RetentionDays, settings.HourlyRetentionDays, settings.DailyRetentionDays)
 	return nil
 }
 
@@ -1333,6 +1851,12 @@ func GetConsumptionStats(installationID, gatewayID, deviceID string, startTime,
 	}
 	fallbackInterval := settings.SampleInterval
 
+	// Longer or older ranges are summed from the hourly or daily rollups
+	resolution := chooseTemperatureResolution(eventDB, settings, startTime, endTime, consumptionRawMaxRange, consumptionHourlyMaxRange)
+	if resolution != ResolutionRaw {
+		return rollupConsumptionStats(resolution, installationID, gatewayID, deviceID, startTime, endTime)
+	}
+
 	// Query to get snapshots in time range
 	query := `
 		SELECT
@@ -1433,6 +1957,7 @@ func GetConsumptionStats(installationID, gatewayID, deviceID string, startTime,
 		AvgCOP:         avgCOP,
 		RuntimeHours:   runtimeMinutes / 60.0,
 		Samples:        samples,
+		Resolution:     ResolutionRaw,
 	}
 
 	return stats, nil
@@ -1459,6 +1984,14 @@ func GetHourlyConsumptionBreakdown(installationID, gatewayID, deviceID string, d
 	startTime := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, DefaultLocation)
 	endTime := startTime.Add(24 * time.Hour)
 
+	// Days without raw snapshots are taken from the hourly rollups
+	switch chooseTemperatureResolution(eventDB, settings, startTime, endTime, consumptionRawMaxRange, consumptionHourlyMaxRange) {
+	case ResolutionHour:
+		return rollupConsumptionBreakdown(ResolutionHour, installationID, gatewayID, deviceID, startTime, endTime)
+	case ResolutionDay:
+		return nil, fmt.Errorf("hourly data for %s is no longer retained", startTime.Format("2006-01-02"))
+	}
+
 	query := `
 		SELECT
 			STRFTIME('%H', timestamp, 'localtime') as hour,
@@ -1560,6 +2093,17 @@ func GetDailyConsumptionBreakdown(installationID, gatewayID, deviceID string, st
 	start := time.Date(startDate.Year(), startDate.Month(), startDate.Day(), 0, 0, 0, 0, DefaultLocation)
 	end := time.Date(endDate.Year(), endDate.Month(), endDate.Day(), 0, 0, 0, 0, DefaultLocation).Add(24 * time.Hour)
 
+	// Longer or older periods are taken from the daily rollups
+	if chooseTemperatureResolution(eventDB, settings, start, end, consumptionRawMaxRange, consumptionHourlyMaxRange) != ResolutionRaw {
+		dataPoints, err := rollupConsumptionBreakdown(ResolutionDay, installationID, gatewayID, deviceID, start, end)
+		for i := range dataPoints {
+			// Same day timestamps as the raw query (date at UTC midnight)
+			day := dataPoints[i].Timestamp
+			dataPoints[i].Timestamp = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+		}
+		return dataPoints, err
+	}
+
 	query := `
 		SELECT
 			DATE(timestamp, 'localtime') as day,
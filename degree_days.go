@@ -0,0 +1,182 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// VDI 3807 defaults: days with a mean outside temperature below the heating limit are heating
+// days and count base minus mean temperature (15/15 = Heizgradtage, 20/15 = Gradtagzahl)
+const (
+	defaultHeatingLimitTemp  = 15.0
+	defaultDegreeDayBaseTemp = 15.0
+	defaultOutlierSigma      = 2.5
+	defaultDesignOutsideTemp = -12.0
+)
+
+// DegreeDaySettings configures heating degree days and the energy signature
+type DegreeDaySettings struct {
+	BaseTemp          float64 `json:"baseTemp"`          // °C, reference (room) temperature
+	HeatingLimit      float64 `json:"heatingLimit"`      // °C, heating limit temperature
+	OutlierSigma      float64 `json:"outlierSigma"`      // days off the signature by more than this many standard deviations are flagged
+	DesignOutsideTemp float64 `json:"designOutsideTemp"` // °C, norm outside temperature for the design heat load
+}
+
+// validateDegreeDaySettings checks the temperature ranges
+func validateDegreeDaySettings(settings *DegreeDaySettings) error {
+	if settings.BaseTemp < 5 || settings.BaseTemp > 25 {
+		return fmt.Errorf("baseTemp must be between 5 and 25 °C")
+	}
+	if settings.HeatingLimit < 5 || settings.HeatingLimit > 25 {
+		return fmt.Errorf("heatingLimit must be between 5 and 25 °C")
+	}
+	if settings.OutlierSigma < 1 || settings.OutlierSigma > 5 {
+		return fmt.Errorf("outlierSigma must be between 1 and 5")
+	}
+	if settings.DesignOutsideTemp < -30 || settings.DesignOutsideTemp > 5 {
+		return fmt.Errorf("designOutsideTemp must be between -30 and 5 °C")
+	}
+	return nil
+}
+
+// DegreeDay is the mean outside temperature, heating degrees and energy of one local day
+type DegreeDay struct {
+	Date            string  `json:"date"` // YYYY-MM-DD
+	MeanOutsideTemp float64 `json:"mean_outside_temp"`
+	HDD             float64 `json:"hdd"`
+	CoveredHours    float64 `json:"covered_hours"` // logged hours with outside temperature
+	ElectricityKWh  float64 `json:"electricity_kwh"`
+	ThermalKWh      float64 `json:"thermal_kwh"`
+}
+
+// DegreeDaySummary sums the heating degree days of a time range
+type DegreeDaySummary struct {
+	Base         float64 `json:"base"`          // °C
+	HeatingLimit float64 `json:"heating_limit"` // °C
+	HDD          float64 `json:"hdd"`
+	HeatingDays  float64 `json:"heating_days"`   // days below the heating limit
+	Days         float64 `json:"days"`           // days in the range (partial days count pro rata)
+	DaysWithData float64 `json:"days_with_data"` // of these, days with enough outside temperatures
+}
+
+// heatingDegrees returns the heating degrees of a day with the given mean temperature for
+// the base temperature and heating limit of the settings
+func heatingDegrees(meanTemp float64, settings *DegreeDaySettings) float64 {
+	if meanTemp >= settings.HeatingLimit {
+		return 0
+	}
+	return math.Max(settings.BaseTemp-meanTemp, 0)
+}
+
+// roundDegrees rounds temperatures and degree days to one decimal
+func roundDegrees(value float64) float64 {
+	return math.Round(value*10) / 10
+}
+
+// GetDailyOutsideTemps returns the mean outside temperature and energy of each local day in
+// [from, to) from the daily rollups. HDD is left at zero.
+func GetDailyOutsideTemps(installationID, gatewayID, deviceID string, from, to time.Time) ([]DegreeDay, error) {
+	if !dbInitialized || eventDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	rows, err := eventDB.Query(`
+		SELECT bucket_start, outside_temp_avg, COALESCE(covered_minutes, 0),
+			COALESCE(electricity_wh, 0), COALESCE(thermal_wh, 0)
+		FROM `+rollupTableDaily+`
+		WHERE installation_id = ?
+			AND gateway_id = ?
+			AND device_id = ?
+			AND bucket_start >= ?
+			AND bucket_start < ?
+			AND outside_temp_avg IS NOT NULL
+		ORDER BY bucket_start ASC
+	`, installationID, gatewayID, deviceID,
+		startOfDay(from).UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query daily outside temperatures: %v", err)
+	}
+	defer rows.Close()
+
+	var days []DegreeDay
+	for rows.Next() {
+		var bucketStr string
+		var mean sql.NullFloat64
+		var coveredMinutes, electricityWh, thermalWh float64
+		if err := rows.Scan(&bucketStr, &mean, &coveredMinutes, &electricityWh, &thermalWh); err != nil {
+			log.Printf("Warning: failed to scan daily outside temperature: %v", err)
+			continue
+		}
+		bucket, err := time.Parse(time.RFC3339, bucketStr)
+		if err != nil {
+			continue
+		}
+		days = append(days, DegreeDay{
+			Date:            bucket.In(DefaultLocation).Format("2006-01-02"),
+			MeanOutsideTemp: mean.Float64,
+			CoveredHours:    coveredMinutes / 60.0,
+			ElectricityKWh:  electricityWh / 1000.0,
+			ThermalKWh:      thermalWh / 1000.0,
+		})
+	}
+	return days, rows.Err()
+}
+
+// GetHeatingDegreeDays returns the heating degree days of [from, to) for the base temperature
+// and heating limit of the settings. Days only partly inside the range count pro rata; a day
+// needs outside temperatures for at least half of its part of the range.
+func GetHeatingDegreeDays(installationID, gatewayID, deviceID string, from, to time.Time, settings *DegreeDaySettings) (*DegreeDaySummary, []DegreeDay, error) {
+	days, err := GetDailyOutsideTemps(installationID, gatewayID, deviceID, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	byDate := make(map[string]DegreeDay, len(days))
+	for _, d := range days {
+		byDate[d.Date] = d
+	}
+
+	summary := &DegreeDaySummary{Base: settings.BaseTemp, HeatingLimit: settings.HeatingLimit}
+	var result []DegreeDay
+	for day := startOfDay(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		start, end := day, next
+		if from.After(start) {
+			start = from
+		}
+		if to.Before(end) {
+			end = to
+		}
+		share := end.Sub(start).Hours() / next.Sub(day).Hours()
+		summary.Days += share
+
+		d, ok := byDate[day.Format("2006-01-02")]
+		if !ok || d.CoveredHours < end.Sub(start).Hours()/2 {
+			continue
+		}
+		d.HDD = heatingDegrees(d.MeanOutsideTemp, settings)
+		summary.DaysWithData += share
+		summary.HDD += d.HDD * share
+		if d.MeanOutsideTemp < settings.HeatingLimit {
+			summary.HeatingDays += share
+		}
+
+		d.MeanOutsideTemp = roundDegrees(d.MeanOutsideTemp)
+		d.HDD = roundDegrees(d.HDD)
+		d.CoveredHours = math.Round(d.CoveredHours*100) / 100
+		d.ElectricityKWh = math.Round(d.ElectricityKWh*1000) / 1000
+		d.ThermalKWh = math.Round(d.ThermalKWh*1000) / 1000
+		result = append(result, d)
+	}
+
+	summary.HDD = roundDegrees(summary.HDD)
+	summary.HeatingDays = math.Round(summary.HeatingDays*100) / 100
+	summary.Days = math.Round(summary.Days*100) / 100
+	summary.DaysWithData = math.Round(summary.DaysWithData*100) / 100
+	return summary, result, nil
+}
@@ -0,0 +1,603 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Device classes used for temperature logging. SmartClimate devices use the
+// categories of categorizeDevice (climate_sensors, radiator_thermostats, ...).
+const (
+	DeviceClassHeating            = "heating"
+	DeviceClassVentilation        = "ventilation"
+	DeviceClassElectricityStorage = "electricity_storage"
+	DeviceClassOther              = "other"
+
+	defaultDeviceLogInterval = 15 // minutes between two samples of a non-heating device
+)
+
+// deviceLogField maps one feature property to a history field. A "*" in Feature
+// matches one name segment (e.g. the room number) and is copied into Field.
+type deviceLogField struct {
+	Field    string
+	Feature  string
+	Property string
+}
+
+// deviceLogClassOrder fixes the lookup order of the profiles below
+var deviceLogClassOrder = []string{
+	DeviceClassVentilation,
+	DeviceClassElectricityStorage,
+	"climate_sensors",
+	"radiator_thermostats",
+	"floor_thermostats",
+	"room_control",
+	"repeaters",
+}
+
+// deviceLogProfiles defines what is logged per device class. Heating devices
+// are logged into temperature_snapshots instead.
+var deviceLogProfiles = map[string][]deviceLogField{
+	DeviceClassVentilation: {
+		{"supply_temp", "ventilation.sensors.temperature.supply", "value"},
+		{"extract_temp", "ventilation.sensors.temperature.extract", "value"},
+		{"exhaust_temp", "ventilation.sensors.temperature.exhaust", "value"},
+		{"outside_temp", "ventilation.sensors.temperature.outside", "value"},
+		{"supply_humidity", "ventilation.sensors.humidity.supply", "value"},
+		{"extract_humidity", "ventilation.sensors.humidity.extract", "value"},
+		{"exhaust_humidity", "ventilation.sensors.humidity.exhaust", "value"},
+		{"outdoor_humidity", "ventilation.sensors.humidity.outdoor", "value"},
+		{"volume_flow_input", "ventilation.volumeFlow.current.input", "value"},
+		{"volume_flow_output", "ventilation.volumeFlow.current.output", "value"},
+		{"fan_*_speed", "ventilation.fan.*", "current"},
+		{"bypass_position", "ventilation.bypass.position", "value"},
+		{"heat_recovery", "ventilation.heating.recovery", "value"},
+		{"ventilation_level", "ventilation.operating.state", "level"},
+		{"operating_mode", "ventilation.operating.modes.active", "value"},
+		{"filter_runtime", "ventilation.filter.runtime", "value"},
+	},
+	DeviceClassElectricityStorage: {
+		{"state_of_charge", "ess.stateOfCharge", "value"},
+		{"battery_power", "ess.power", "value"},
+		{"inverter_ac_power", "ess.inverter.ac.power", "value"},
+		{"pv_power", "photovoltaic.production.current", "value"},
+		{"grid_power", "pcc.transfer.power.exchange", "value"},
+		{"ambient_temp", "ess.sensors.temperature.ambient", "value"},
+		{"battery_charged_total", "ess.transfer.charge.cumulated", "value"},
+		{"battery_discharged_total", "ess.transfer.discharge.cumulated", "value"},
+		{"pv_production_total", "photovoltaic.production.cumulated", "value"},
+		{"grid_consumption_total", "pcc.transfer.consumption.total", "value"},
+		{"grid_feed_in_total", "pcc.transfer.feedIn.total", "value"},
+	},
+	"climate_sensors": {
+		{"temperature", "device.sensors.temperature", "value"},
+		{"humidity", "device.sensors.humidity", "value"},
+		{"battery", "device.power.battery", "level"},
+		{"lqi", "device.zigbee.lqi", "strength"},
+	},
+	"radiator_thermostats": {
+		{"temperature", "device.sensors.temperature", "value"},
+		{"setpoint", "trv.temperature", "value"},
+		{"valve_position", "trv.valve.position", "position"},
+		{"battery", "device.power.battery", "level"},
+		{"lqi", "device.zigbee.lqi", "strength"},
+	},
+	"floor_thermostats": {
+		{"supply_temp", "fht.sensors.temperature.supply", "value"},
+		{"temperature", "device.sensors.temperature", "value"},
+		{"humidity", "device.sensors.humidity", "value"},
+		{"operating_mode", "fht.operating.modes.active", "value"},
+		{"lqi", "device.zigbee.lqi", "strength"},
+	},
+	"room_control": {
+		{"room_*_temperature", "rooms.*.sensors.temperature", "value"},
+		{"room_*_humidity", "rooms.*.sensors.humidity", "value"},
+		{"room_*_setpoint", "rooms.*.temperature.levels.normal.perceived", "temperature"},
+		{"room_*_window_open", "rooms.*.sensors.window.openState", "value"},
+	},
+	"repeaters": {
+		{"lqi", "device.zigbee.lqi", "strength"},
+	},
+}
+
+// DeviceLoggingSettings enables temperature logging per device.
+// Device "0" of a heating gateway is always covered by the temperature log itself.
+type DeviceLoggingSettings struct {
+	Devices []DeviceLogConfig `json:"devices"`
+}
+
+// DeviceLogConfig overrides the logging defaults of one device: device "0" of
+// ventilation and storage gateways is logged by default, all other devices are not.
+type DeviceLogConfig struct {
+	InstallationID string `json:"installationId"`
+	GatewayID      string `json:"gatewayId"`
+	DeviceID       string `json:"deviceId"`
+	Enabled        bool   `json:"enabled"`
+	Interval       int    `json:"interval,omitempty"` // minutes, 0 = 15 (never below the sample interval)
+}
+
+// DeviceLogDevice describes a discovered device and its logging state
+type DeviceLogDevice struct {
+	InstallationID string   `json:"installationId"`
+	GatewayID      string   `json:"gatewayId"`
+	DeviceID       string   `json:"deviceId"`
+	DeviceType     string   `json:"deviceType"`
+	ModelID        string   `json:"modelId"`
+	Class          string   `json:"class"`
+	Fields         []string `json:"fields"`      // history fields of the logging profile
+	Loggable       bool     `json:"loggable"`    // false for devices without a profile
+	Enabled        bool     `json:"enabled"`     // logged by its profile (or as snapshot for heating)
+	Interval       int      `json:"interval"`    // effective interval in minutes
+	CallsPerDay    int      `json:"callsPerDay"` // estimated feature requests per 24 hours
+}
+
+// deviceLogClass returns the logging class of a device. Device "0" without a
+// known device type is treated as heating device, as before.
+func deviceLogClass(deviceID, deviceType, modelID string) string {
+	switch {
+	case deviceType == "heating":
+		return DeviceClassHeating
+	case deviceType == "electricityStorage":
+		return DeviceClassElectricityStorage
+	}
+	if category := categorizeDevice(deviceType, modelID); category != "" {
+		return category
+	}
+	if isVitoventDevice(deviceType, modelID) {
+		return DeviceClassVentilation
+	}
+	if deviceID == "0" {
+		return DeviceClassHeating
+	}
+	return DeviceClassOther
+}
+
+// deviceLogKey identifies a device in the settings and the due tracking
+func deviceLogKey(installationID, gatewayID, deviceID string) string {
+	return fmt.Sprintf("%s:%s:%s", installationID, gatewayID, deviceID)
+}
+
+// deviceLogConfig returns the configuration of a device or its defaults
+func deviceLogConfig(settings *DeviceLoggingSettings, installationID, gatewayID, deviceID string) DeviceLogConfig {
+	if settings != nil {
+		for _, cfg := range settings.Devices {
+			if cfg.InstallationID == installationID && cfg.GatewayID == gatewayID && cfg.DeviceID == deviceID {
+				return cfg
+			}
+		}
+	}
+	return DeviceLogConfig{
+		InstallationID: installationID,
+		GatewayID:      gatewayID,
+		DeviceID:       deviceID,
+		Enabled:        deviceID == "0",
+	}
+}
+
+// effectiveDeviceLogInterval applies the default and the sample interval as lower bound
+func effectiveDeviceLogInterval(cfg DeviceLogConfig, sampleInterval int) int {
+	interval := cfg.Interval
+	if interval == 0 {
+		interval = defaultDeviceLogInterval
+	}
+	if interval < sampleInterval {
+		interval = sampleInterval
+	}
+	return interval
+}
+
+// validateDeviceLoggingSettings checks IDs and intervals
+func validateDeviceLoggingSettings(settings *DeviceLoggingSettings) error {
+	seen := make(map[string]bool)
+	for i, cfg := range settings.Devices {
+		if cfg.InstallationID == "" || cfg.GatewayID == "" || cfg.DeviceID == "" {
+			return fmt.Errorf("device %d: installationId, gatewayId and deviceId are required", i+1)
+		}
+		if cfg.Interval != 0 && (cfg.Interval < 1 || cfg.Interval > 1440) {
+			return fmt.Errorf("device %s: interval must be 0 (default) or between 1 and 1440 minutes", cfg.DeviceID)
+		}
+		key := deviceLogKey(cfg.InstallationID, cfg.GatewayID, cfg.DeviceID)
+		if seen[key] {
+			return fmt.Errorf("device %s is configured twice", key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// deviceLogCallBudget is the part of the daily API limit temperature logging may use
+// (the limiter keeps the rest free for the dashboard, commands and the event archive)
+func deviceLogCallBudget() int {
+	return int(float64(apiLimit24Hr) * (1 - apiPriorityPolicies[PriorityTemperature].reserve))
+}
+
+// listDeviceLogDevices returns all devices of the active accounts with their logging state
+// and the estimated API calls of the temperature logging job per device
+func listDeviceLogDevices(settings *TemperatureLogSettings, logSettings *DeviceLoggingSettings, historySettings *FeatureHistorySettings) ([]DeviceLogDevice, error) {
+	activeAccounts, err := GetActiveAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []DeviceLogDevice{}
+	seen := make(map[string]bool)
+	for _, account := range activeAccounts {
+		token, err := ensureAccountAuthenticated(account)
+		if err != nil {
+			log.Printf("Failed to authenticate account %s: %v", account.Email, err)
+			continue
+		}
+		devices = appendLogDevices(devices, seen, token, settings, logSettings, historySettings)
+	}
+	return devices, nil
+}
+
+// appendLogDevices adds the devices of an account's installations not seen yet
+func appendLogDevices(devices []DeviceLogDevice, seen map[string]bool, token *AccountToken, settings *TemperatureLogSettings, logSettings *DeviceLoggingSettings, historySettings *FeatureHistorySettings) []DeviceLogDevice {
+	for _, installationID := range token.InstallationIDs {
+		installation, ok := token.Installations[installationID]
+		if !ok {
+			continue
+		}
+		for _, gateway := range installation.Gateways {
+			for _, device := range gateway.Devices {
+				key := deviceLogKey(installationID, gateway.Serial, device.DeviceID)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				devices = append(devices, describeLogDevice(settings, logSettings, historySettings, installationID, gateway.Serial, device))
+			}
+		}
+	}
+	return devices
+}
+
+// describeLogDevice builds the logging state of one device
+func describeLogDevice(settings *TemperatureLogSettings, logSettings *DeviceLoggingSettings, historySettings *FeatureHistorySettings, installationID, gatewayID string, device GatewayDevice) DeviceLogDevice {
+	d := DeviceLogDevice{
+		InstallationID: installationID,
+		GatewayID:      gatewayID,
+		DeviceID:       device.DeviceID,
+		DeviceType:     device.DeviceType,
+		ModelID:        device.ModelID,
+		Class:          deviceLogClass(device.DeviceID, device.DeviceType, device.ModelID),
+		Fields:         []string{},
+	}
+
+	// The job fetches a device at the shortest interval any of its uses needs
+	interval := 0
+	if d.Class == DeviceClassHeating {
+		d.Loggable = device.DeviceID == "0"
+		d.Enabled = d.Loggable
+		if d.Enabled {
+			d.Interval = settings.SampleInterval
+			interval = d.Interval
+		}
+	} else if profile, ok := deviceLogProfiles[d.Class]; ok {
+		for _, field := range profile {
+			d.Fields = append(d.Fields, field.Field)
+		}
+		cfg := deviceLogConfig(logSettings, installationID, gatewayID, device.DeviceID)
+		d.Loggable = true
+		d.Enabled = cfg.Enabled
+		d.Interval = effectiveDeviceLogInterval(cfg, settings.SampleInterval)
+		if d.Enabled {
+			interval = d.Interval
+		}
+	}
+	if len(featureHistoryPatterns(historySettings, installationID, gatewayID, device.DeviceID)) > 0 {
+		interval = settings.SampleInterval
+	}
+
+	if interval > 0 {
+		d.CallsPerDay = (1440 + interval - 1) / interval
+	}
+	return d
+}
+
+// sumDeviceLogCalls adds up the estimated daily calls
+func sumDeviceLogCalls(devices []DeviceLogDevice) int {
+	total := 0
+	for _, d := range devices {
+		total += d.CallsPerDay
+	}
+	return total
+}
+
+var (
+	deviceLogMutex    sync.Mutex
+	deviceLogLast     = make(map[string]time.Time) // last logged sample per device key
+	deviceLogTopology string                       // device keys the call budget was last checked for
+)
+
+// checkDeviceLogBudget estimates the daily API calls again when the devices of the
+// authenticated accounts changed, the settings handler only checks the budget on save
+func checkDeviceLogBudget(settings *TemperatureLogSettings, logSettings *DeviceLoggingSettings, historySettings *FeatureHistorySettings) {
+	accountsMutex.RLock()
+	devices := []DeviceLogDevice{}
+	seen := make(map[string]bool)
+	for _, token := range accountTokens {
+		devices = appendLogDevices(devices, seen, token, settings, logSettings, historySettings)
+	}
+	accountsMutex.RUnlock()
+
+	keys := make([]string, 0, len(devices))
+	for _, d := range devices {
+		keys = append(keys, deviceLogKey(d.InstallationID, d.GatewayID, d.DeviceID))
+	}
+	sort.Strings(keys)
+	topology := strings.Join(keys, ",")
+
+	deviceLogMutex.Lock()
+	changed := topology != deviceLogTopology
+	deviceLogTopology = topology
+	deviceLogMutex.Unlock()
+	if !changed {
+		return
+	}
+
+	if calls, budget := sumDeviceLogCalls(devices), deviceLogCallBudget(); calls > budget {
+		log.Printf("Warning: device list changed, temperature logging of %d devices needs an estimated %d API calls per day, above its budget of %d; increase the intervals or disable devices", len(devices), calls, budget)
+	}
+}
+
+// dueDeviceLogProfile returns the logging profile of a device when it is enabled and its
+// interval bucket has not been logged yet, nil otherwise
+func dueDeviceLogProfile(logSettings *DeviceLoggingSettings, sampleInterval int, installationID, gatewayID, deviceID, class string, now time.Time) []deviceLogField {
+	profile, ok := deviceLogProfiles[class]
+	if !ok {
+		return nil
+	}
+	cfg := deviceLogConfig(logSettings, installationID, gatewayID, deviceID)
+	if !cfg.Enabled {
+		return nil
+	}
+
+	// Intervals are aligned to the clock, so ticker jitter does not skip a sample
+	interval := time.Duration(effectiveDeviceLogInterval(cfg, sampleInterval)) * time.Minute
+	deviceLogMutex.Lock()
+	defer deviceLogMutex.Unlock()
+	last, ok := deviceLogLast[deviceLogKey(installationID, gatewayID, deviceID)]
+	if ok && !now.Truncate(interval).After(last.Truncate(interval)) {
+		return nil
+	}
+	return profile
+}
+
+// markDeviceLogged records a logged sample for the due check
+func markDeviceLogged(installationID, gatewayID, deviceID string, timestamp time.Time) {
+	deviceLogMutex.Lock()
+	defer deviceLogMutex.Unlock()
+	deviceLogLast[deviceLogKey(installationID, gatewayID, deviceID)] = timestamp
+}
+
+// matchDeviceLogField returns the history field name if the feature matches the profile entry
+func matchDeviceLogField(field deviceLogField, feature string) (string, bool) {
+	prefix, suffix, wildcard := strings.Cut(field.Feature, "*")
+	if !wildcard {
+		return field.Field, feature == field.Feature
+	}
+	if !strings.HasPrefix(feature, prefix) || !strings.HasSuffix(feature, suffix) || len(feature) <= len(prefix)+len(suffix) {
+		return "", false
+	}
+	segment := feature[len(prefix) : len(feature)-len(suffix)]
+	if strings.Contains(segment, ".") {
+		return "", false
+	}
+	return strings.Replace(field.Field, "*", segment, 1), true
+}
+
+// extractDeviceLogPoints collects the profile properties of a device as feature history points
+func extractDeviceLogPoints(features *DeviceFeatures, profile []deviceLogField, installationID, gatewayID, deviceID string, timestamp time.Time) []FeatureHistoryPoint {
+	if features == nil {
+		return nil
+	}
+
+	var points []FeatureHistoryPoint
+	for _, feature := range features.RawFeatures {
+		for _, field := range profile {
+			if _, ok := matchDeviceLogField(field, feature.Feature); !ok {
+				continue
+			}
+			point := FeatureHistoryPoint{
+				Timestamp:      timestamp,
+				InstallationID: installationID,
+				GatewayID:      gatewayID,
+				DeviceID:       deviceID,
+				Feature:        feature.Feature,
+				Property:       field.Property,
+			}
+			if setFeatureHistoryValue(&point, feature.Properties[field.Property]) {
+				points = append(points, point)
+			}
+		}
+	}
+	return points
+}
+
+// deviceHistoryField maps a stored feature property back to its profile field name
+func deviceHistoryField(feature, property string) (string, bool) {
+	for _, class := range deviceLogClassOrder {
+		for _, field := range deviceLogProfiles[class] {
+			if field.Property != property {
+				continue
+			}
+			if name, ok := matchDeviceLogField(field, feature); ok {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// DeviceHistoryResult holds device history rows with one column per profile field
+type DeviceHistoryResult struct {
+	Rows   []map[string]interface{}
+	Fields []string
+	Units  map[string]string
+}
+
+// DeviceHistoryResolution picks raw values for short ranges and hourly or daily
+// averages for longer ones, using the limits of the temperature charts
+func DeviceHistoryResolution(startTime, endTime time.Time) string {
+	span := endTime.Sub(startTime)
+	switch {
+	case span <= dataRawMaxRange:
+		return ResolutionRaw
+	case span <= dataHourlyMaxRange:
+		return ResolutionHour
+	default:
+		return ResolutionDay
+	}
+}
+
+// GetDeviceHistory returns the logged profile fields of a device as rows per timestamp.
+// Hourly and daily rows hold averages; booleans become the share of true samples and
+// text values are only returned at raw resolution.
+func GetDeviceHistory(resolution, installationID, gatewayID, deviceID string, startTime, endTime time.Time, limit int) (*DeviceHistoryResult, error) {
+	if !dbInitialized || eventDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	q := FeatureHistoryQuery{
+		InstallationID: installationID,
+		GatewayID:      gatewayID,
+		DeviceID:       deviceID,
+		StartTime:      startTime,
+		EndTime:        endTime,
+	}
+	where, args := featureHistoryWhere(q)
+
+	bucket := "timestamp"
+	value := "num_value, str_value"
+	if resolution != ResolutionRaw {
+		// Days are combined from the hourly averages in local time below
+		bucket = "STRFTIME('%Y-%m-%dT%H:00:00Z', timestamp)"
+		value = "AVG(num_value), NULL"
+		where += " AND num_value IS NOT NULL"
+	}
+	query := `
+		SELECT ` + bucket + ` AS bucket, gateway_id, device_id, feature, property, MAX(value_type), MAX(unit), ` + value + `, COUNT(*)
+		FROM feature_history
+		WHERE ` + where + `
+		GROUP BY bucket, gateway_id, device_id, feature, property
+		ORDER BY bucket ASC, gateway_id, device_id`
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	rows, err := eventDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device history: %v", err)
+	}
+	defer rows.Close()
+
+	type accumulator struct {
+		sum     float64
+		samples int64
+	}
+	result := &DeviceHistoryResult{Rows: []map[string]interface{}{}, Fields: []string{}, Units: make(map[string]string)}
+	fieldSeen := make(map[string]bool)
+	rowIndex := make(map[string]int)
+	sums := make(map[string]*accumulator)
+
+	for rows.Next() {
+		var bucketStr, gw, dev, feature, property, valueType string
+		var unit, str *string
+		var num *float64
+		var samples int64
+		if err := rows.Scan(&bucketStr, &gw, &dev, &feature, &property, &valueType, &unit, &num, &str, &samples); err != nil {
+			log.Printf("Warning: failed to scan device history row: %v", err)
+			continue
+		}
+		field, ok := deviceHistoryField(feature, property)
+		if !ok {
+			continue
+		}
+
+		ts, _ := time.Parse(time.RFC3339, bucketStr)
+		if resolution == ResolutionDay {
+			ts = startOfDay(ts).UTC()
+		}
+		rowKey := gw + ":" + dev + ":" + ts.Format(time.RFC3339)
+		idx, exists := rowIndex[rowKey]
+		if !exists {
+			if limit > 0 && len(result.Rows) >= limit {
+				break
+			}
+			idx = len(result.Rows)
+			rowIndex[rowKey] = idx
+			result.Rows = append(result.Rows, map[string]interface{}{
+				"timestamp":       ts,
+				"installation_id": installationID,
+				"gateway_id":      gw,
+				"device_id":       dev,
+			})
+		}
+
+		switch {
+		case resolution == ResolutionDay && num != nil:
+			// Weight the hourly averages by their sample count
+			acc := sums[rowKey+":"+field]
+			if acc == nil {
+				acc = &accumulator{}
+				sums[rowKey+":"+field] = acc
+			}
+			acc.sum += *num * float64(samples)
+			acc.samples += samples
+			result.Rows[idx][field] = acc.sum / float64(acc.samples)
+		case resolution == ResolutionRaw && valueType == "boolean" && num != nil:
+			result.Rows[idx][field] = *num != 0
+		case num != nil:
+			result.Rows[idx][field] = *num
+		case str != nil:
+			result.Rows[idx][field] = *str
+		default:
+			continue
+		}
+
+		if !fieldSeen[field] {
+			fieldSeen[field] = true
+			result.Fields = append(result.Fields, field)
+		}
+		if unit != nil && *unit != "" {
+			result.Units[field] = *unit
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating device history: %v", err)
+	}
+
+	sort.Strings(result.Fields)
+	return result, nil
+}
+
+// lookupDeviceLogClass finds the class of a device in the cached installations of the
+// authenticated accounts, it never logs in or calls the API
+func lookupDeviceLogClass(installationID, gatewayID, deviceID string) string {
+	accountsMutex.RLock()
+	defer accountsMutex.RUnlock()
+
+	for _, token := range accountTokens {
+		installation, ok := token.Installations[installationID]
+		if !ok {
+			continue
+		}
+		for _, gateway := range installation.Gateways {
+			if gatewayID != "" && gateway.Serial != gatewayID {
+				continue
+			}
+			for _, device := range gateway.Devices {
+				if device.DeviceID == deviceID {
+					return deviceLogClass(device.DeviceID, device.DeviceType, device.ModelID)
+				}
+			}
+		}
+	}
+	return ""
+}
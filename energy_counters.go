@@ -0,0 +1,462 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// Energy kinds and operating modes of the device energy counters
+const (
+	EnergyElectricity = "electricity"
+	EnergyHeat        = "heat"
+
+	ModeTotal   = "total"
+	ModeHeating = "heating"
+	ModeDHW     = "dhw"
+	ModeCooling = "cooling"
+)
+
+// Periods of the stored device counters
+const (
+	CounterPeriodDay   = "day"
+	CounterPeriodWeek  = "week"
+	CounterPeriodMonth = "month"
+)
+
+// Sources of seasonal performance values
+const (
+	SPFSourceCounters  = "device_counters" // day/week/month values reported by the device
+	SPFSourceSnapshots = "snapshots"       // integrated compressor and thermal power of the temperature log
+	SPFSourceMixed     = "mixed"           // season with months from both sources
+	SPFSourceNone      = "none"
+)
+
+// heatingSeasonStartMonth starts the heating year (July to June), so a season holds one
+// complete winter and the summer DHW months of the same year
+const heatingSeasonStartMonth = time.July
+
+// energyCounterKind is the energy and mode a counter feature reports
+type energyCounterKind struct {
+	energy string
+	mode   string
+}
+
+// energyCounterFeatures are the day/week/month array features of heat pumps
+var energyCounterFeatures = map[string]energyCounterKind{
+	"heating.power.consumption.total":   {EnergyElectricity, ModeTotal},
+	"heating.power.consumption.heating": {EnergyElectricity, ModeHeating},
+	"heating.power.consumption.dhw":     {EnergyElectricity, ModeDHW},
+	"heating.power.consumption.cooling": {EnergyElectricity, ModeCooling},
+	"heating.heat.production":           {EnergyHeat, ModeTotal},
+	"heating.heat.production.heating":   {EnergyHeat, ModeHeating},
+	"heating.heat.production.dhw":       {EnergyHeat, ModeDHW},
+	"heating.heat.production.cooling":   {EnergyHeat, ModeCooling},
+}
+
+// energySummaryFeatures report currentDay, currentMonth and lastMonth instead of arrays
+// (used where a device has no array feature for the same counter)
+var energySummaryFeatures = map[string]energyCounterKind{
+	"heating.power.consumption.summary.heating": {EnergyElectricity, ModeHeating},
+	"heating.power.consumption.summary.dhw":     {EnergyElectricity, ModeDHW},
+	"heating.power.consumption.summary.cooling": {EnergyElectricity, ModeCooling},
+	"heating.heat.production.summary.heating":   {EnergyHeat, ModeHeating},
+	"heating.heat.production.summary.dhw":       {EnergyHeat, ModeDHW},
+	"heating.heat.production.summary.cooling":   {EnergyHeat, ModeCooling},
+}
+
+// EnergyCounterValue is the energy of one counter in one day, week or month
+type EnergyCounterValue struct {
+	Period      string    `json:"period"`
+	PeriodStart time.Time `json:"period_start"` // local start of the day, ISO week or month
+	Energy      string    `json:"energy"`
+	Mode        string    `json:"mode"`
+	KWh         float64   `json:"kwh"`
+	Source      string    `json:"source"` // feature the value was read from
+}
+
+// energyCounterArray returns the values of an array property (index 0 = current period)
+func energyCounterArray(property interface{}) []float64 {
+	prop, ok := property.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	switch values := prop["value"].(type) {
+	case []float64:
+		return values
+	case []interface{}:
+		result := make([]float64, 0, len(values))
+		for _, v := range values {
+			f, ok := v.(float64)
+			if !ok {
+				return nil
+			}
+			result = append(result, f)
+		}
+		return result
+	}
+	return nil
+}
+
+// extractEnergyCounters reads the device's own energy counters. The arrays start with the
+// current (partial) period; the device counts in local time like DefaultLocation. Around
+// midnight nothing is read, as the device may not have moved its arrays on yet.
+func extractEnergyCounters(features *DeviceFeatures, now time.Time) []EnergyCounterValue {
+	if features == nil {
+		return nil
+	}
+
+	local := now.In(DefaultLocation)
+	if minutes := local.Hour()*60 + local.Minute(); minutes < 15 || minutes >= 23*60+55 {
+		return nil
+	}
+	day := startOfDay(local)
+	week := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	month := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, DefaultLocation)
+
+	periodStart := func(period string, index int) time.Time {
+		switch period {
+		case CounterPeriodDay:
+			return day.AddDate(0, 0, -index)
+		case CounterPeriodWeek:
+			return week.AddDate(0, 0, -7*index)
+		default:
+			return month.AddDate(0, -index, 0)
+		}
+	}
+
+	// Array values replace summary values of the same counter
+	values := make(map[string]EnergyCounterValue)
+	add := func(kind energyCounterKind, period string, index int, kwh float64, source string) {
+		v := EnergyCounterValue{
+			Period:      period,
+			PeriodStart: periodStart(period, index),
+			Energy:      kind.energy,
+			Mode:        kind.mode,
+			KWh:         kwh,
+			Source:      source,
+		}
+		values[fmt.Sprintf("%s|%s|%s|%s", period, v.PeriodStart.Format("2006-01-02"), kind.energy, kind.mode)] = v
+	}
+
+	for _, feature := range features.RawFeatures {
+		kind, ok := energySummaryFeatures[feature.Feature]
+		if !ok {
+			continue
+		}
+		summaries := []struct {
+			property string
+			period   string
+			index    int
+		}{
+			{"currentDay", CounterPeriodDay, 0},
+			{"currentMonth", CounterPeriodMonth, 0},
+			{"lastMonth", CounterPeriodMonth, 1},
+		}
+		for _, s := range summaries {
+			prop, ok := feature.Properties[s.property].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if kwh, ok := prop["value"].(float64); ok {
+				add(kind, s.period, s.index, kwh, feature.Feature)
+			}
+		}
+	}
+
+	for _, feature := range features.RawFeatures {
+		kind, ok := energyCounterFeatures[feature.Feature]
+		if !ok {
+			continue
+		}
+		for _, period := range []string{CounterPeriodDay, CounterPeriodWeek, CounterPeriodMonth} {
+			for i, kwh := range energyCounterArray(feature.Properties[period]) {
+				add(kind, period, i, kwh, feature.Feature)
+			}
+		}
+	}
+
+	result := make([]EnergyCounterValue, 0, len(values))
+	for _, v := range values {
+		result = append(result, v)
+	}
+	return result
+}
+
+// SaveEnergyCounters stores the counter values of a device, updating changed values only
+func SaveEnergyCounters(installationID, gatewayID, deviceID string, values []EnergyCounterValue) error {
+	if !dbInitialized || eventDB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	tx, err := eventDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO energy_counters (
+			installation_id, gateway_id, device_id, period, period_start, energy, mode, kwh, source, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (installation_id, gateway_id, device_id, period, period_start, energy, mode)
+		DO UPDATE SET kwh = excluded.kwh, source = excluded.source, updated_at = excluded.updated_at
+		WHERE kwh != excluded.kwh OR source != excluded.source
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare energy counter insert: %v", err)
+	}
+	defer stmt.Close()
+
+	updated := time.Now().UTC().Format(time.RFC3339)
+	for _, v := range values {
+		_, err := stmt.Exec(installationID, gatewayID, deviceID, v.Period, v.PeriodStart.Format("2006-01-02"),
+			v.Energy, v.Mode, v.KWh, v.Source, updated)
+		if err != nil {
+			return fmt.Errorf("failed to insert energy counter: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetEnergyCounters returns the stored counter values of one period type in [from, to)
+func GetEnergyCounters(installationID, gatewayID, deviceID, period string, from, to time.Time) ([]EnergyCounterValue, error) {
+	if !dbInitialized || eventDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	rows, err := eventDB.Query(`
+		SELECT period_start, energy, mode, kwh, source
+		FROM energy_counters
+		WHERE installation_id = ? AND gateway_id = ? AND device_id = ? AND period = ?
+			AND period_start >= ? AND period_start < ?
+		ORDER BY period_start, energy, mode
+	`, installationID, gatewayID, deviceID, period,
+		from.In(DefaultLocation).Format("2006-01-02"), to.In(DefaultLocation).Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query energy counters: %v", err)
+	}
+	defer rows.Close()
+
+	var values []EnergyCounterValue
+	for rows.Next() {
+		v := EnergyCounterValue{Period: period}
+		var start string
+		if err := rows.Scan(&start, &v.Energy, &v.Mode, &v.KWh, &v.Source); err != nil {
+			log.Printf("Warning: failed to scan energy counter: %v", err)
+			continue
+		}
+		v.PeriodStart, _ = time.ParseInLocation("2006-01-02", start, DefaultLocation)
+		values = append(values, v)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating energy counters: %v", err)
+	}
+	return values, nil
+}
+
+// SPFModeValues is the energy balance of one operating mode
+type SPFModeValues struct {
+	ElectricityKWh float64  `json:"electricity_kwh"`
+	HeatKWh        float64  `json:"heat_kwh"`
+	SPF            *float64 `json:"spf,omitempty"` // heat / electricity, missing without consumption
+}
+
+// SPFPeriod is the seasonal performance of a month or a heating season
+type SPFPeriod struct {
+	Period    string                    `json:"period"` // "2026-01" or "2025/26"
+	StartTime time.Time                 `json:"start_time"`
+	EndTime   time.Time                 `json:"end_time"`
+	Complete  bool                      `json:"complete"` // the period has ended
+	Source    string                    `json:"source"`
+	Months    int                       `json:"months,omitempty"`  // seasons: months with data
+	Modes     map[string]*SPFModeValues `json:"modes"`             // total, heating, dhw, cooling
+	AvgCOP    float64                   `json:"avg_cop,omitempty"` // snapshots only: mean of the instantaneous COP, for comparison
+}
+
+// SPFReport holds monthly and seasonal performance factors of a device
+type SPFReport struct {
+	InstallationID   string      `json:"installation_id"`
+	GatewayID        string      `json:"gateway_id"`
+	DeviceID         string      `json:"device_id"`
+	SeasonStartMonth int         `json:"season_start_month"`
+	Months           []SPFPeriod `json:"months"`
+	Seasons          []SPFPeriod `json:"seasons"`
+}
+
+// heatingSeasonStart returns the start of the heating season containing t
+func heatingSeasonStart(t time.Time) time.Time {
+	t = t.In(DefaultLocation)
+	year := t.Year()
+	if t.Month() < heatingSeasonStartMonth {
+		year--
+	}
+	return time.Date(year, heatingSeasonStartMonth, 1, 0, 0, 0, 0, DefaultLocation)
+}
+
+// heatingSeasonLabel names a season like "2025/26"
+func heatingSeasonLabel(start time.Time) string {
+	return fmt.Sprintf("%d/%02d", start.Year(), (start.Year()+1)%100)
+}
+
+// setSPF computes the performance factor of each mode
+func setSPF(modes map[string]*SPFModeValues) {
+	for _, m := range modes {
+		m.SPF = nil
+		if m.ElectricityKWh > 0 {
+			spf := math.Round(m.HeatKWh/m.ElectricityKWh*100) / 100
+			m.SPF = &spf
+		}
+	}
+}
+
+// counterModes turns the month counters into mode balances. Totals missing on the device
+// are summed from the modes; it returns nil unless both electricity and heat are known.
+func counterModes(values []EnergyCounterValue) map[string]*SPFModeValues {
+	energies := map[string]map[string]float64{EnergyElectricity: {}, EnergyHeat: {}}
+	for _, v := range values {
+		energies[v.Energy][v.Mode] = v.KWh
+	}
+	for _, byMode := range energies {
+		if len(byMode) == 0 {
+			return nil
+		}
+		if _, ok := byMode[ModeTotal]; !ok {
+			total := 0.0
+			for _, kwh := range byMode {
+				total += kwh
+			}
+			byMode[ModeTotal] = total
+		}
+	}
+
+	// Modes are only reported where both energies are known
+	modes := make(map[string]*SPFModeValues)
+	for mode, electricity := range energies[EnergyElectricity] {
+		heat, ok := energies[EnergyHeat][mode]
+		if !ok {
+			continue
+		}
+		modes[mode] = &SPFModeValues{ElectricityKWh: electricity, HeatKWh: heat}
+	}
+	return modes
+}
+
+// GetSeasonalPerformance computes energy-weighted performance factors per month and heating
+// season for the months in [from, to). Months use the device counters where they are stored
+// and otherwise the integrated snapshots (total only, the snapshots carry no operating mode).
+func GetSeasonalPerformance(installationID, gatewayID, deviceID string, from, to time.Time) (*SPFReport, error) {
+	from = from.In(DefaultLocation)
+	from = time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, DefaultLocation)
+	now := time.Now()
+
+	counters, err := GetEnergyCounters(installationID, gatewayID, deviceID, CounterPeriodMonth, from, to)
+	if err != nil {
+		return nil, err
+	}
+	countersByMonth := make(map[string][]EnergyCounterValue)
+	for _, v := range counters {
+		key := v.PeriodStart.Format("2006-01")
+		countersByMonth[key] = append(countersByMonth[key], v)
+	}
+
+	report := &SPFReport{
+		InstallationID:   installationID,
+		GatewayID:        gatewayID,
+		DeviceID:         deviceID,
+		SeasonStartMonth: int(heatingSeasonStartMonth),
+		Months:           []SPFPeriod{},
+		Seasons:          []SPFPeriod{},
+	}
+
+	for start := from; start.Before(to) && start.Before(now); start = start.AddDate(0, 1, 0) {
+		end := start.AddDate(0, 1, 0)
+		month := SPFPeriod{
+			Period:    start.Format("2006-01"),
+			StartTime: start,
+			EndTime:   end,
+			Complete:  !end.After(now),
+			Source:    SPFSourceNone,
+			Modes:     map[string]*SPFModeValues{},
+		}
+
+		if modes := counterModes(countersByMonth[month.Period]); modes != nil {
+			month.Source = SPFSourceCounters
+			month.Modes = modes
+		} else {
+			queryEnd := end
+			if queryEnd.After(now) {
+				queryEnd = now
+			}
+			stats, err := GetConsumptionStats(installationID, gatewayID, deviceID, start, queryEnd)
+			if err != nil {
+				return nil, err
+			}
+			if stats.Samples > 0 {
+				month.Source = SPFSourceSnapshots
+				month.Modes[ModeTotal] = &SPFModeValues{ElectricityKWh: stats.ElectricityKWh, HeatKWh: stats.ThermalKWh}
+				month.AvgCOP = stats.AvgCOP
+			}
+		}
+		setSPF(month.Modes)
+		report.Months = append(report.Months, month)
+	}
+
+	// Seasons sum their months; a mode is only shown when every month with data reports it
+	for i := 0; i < len(report.Months); {
+		seasonStart := heatingSeasonStart(report.Months[i].StartTime)
+		seasonEnd := seasonStart.AddDate(1, 0, 0)
+		season := SPFPeriod{
+			Period:    heatingSeasonLabel(seasonStart),
+			StartTime: seasonStart,
+			EndTime:   seasonEnd,
+			Complete:  !seasonEnd.After(now),
+			Source:    SPFSourceNone,
+			Modes:     map[string]*SPFModeValues{},
+		}
+		modeMonths := make(map[string]int)
+		for ; i < len(report.Months) && report.Months[i].StartTime.Before(seasonEnd); i++ {
+			month := report.Months[i]
+			if month.Source == SPFSourceNone {
+				continue
+			}
+			season.Months++
+			switch season.Source {
+			case SPFSourceNone:
+				season.Source = month.Source
+			case month.Source:
+			default:
+				season.Source = SPFSourceMixed
+			}
+			for mode, values := range month.Modes {
+				if season.Modes[mode] == nil {
+					season.Modes[mode] = &SPFModeValues{}
+				}
+				season.Modes[mode].ElectricityKWh += values.ElectricityKWh
+				season.Modes[mode].HeatKWh += values.HeatKWh
+				modeMonths[mode]++
+			}
+		}
+		for mode, count := range modeMonths {
+			if count < season.Months {
+				delete(season.Modes, mode)
+			}
+		}
+		setSPF(season.Modes)
+		report.Seasons = append(report.Seasons, season)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Energies an energy signature can be computed for
+const (
+	SignatureThermal     = "thermal"     // heat produced: the building's heat demand
+	SignatureElectricity = "electricity" // electricity consumed by the heat pump
+)
+
+const (
+	minSignatureDays          = 10  // heating days needed for a regression
+	minSignatureCoverageHours = 20  // logged hours a day needs to be used
+	minBaseLoadDays           = 5   // days without heating needed for the base load
+	minOutlierDeviation       = 0.1 // outliers also deviate by at least this share of the predicted energy
+)
+
+// EnergySignaturePoint is one day of the energy signature
+type EnergySignaturePoint struct {
+	Date            string   `json:"date"`
+	MeanOutsideTemp float64  `json:"mean_outside_temp"`
+	HDD             float64  `json:"hdd"`
+	KWh             float64  `json:"kwh"`
+	PredictedKWh    *float64 `json:"predicted_kwh,omitempty"`
+	Residual        *float64 `json:"residual,omitempty"`
+	HeatingDay      bool     `json:"heating_day"` // below the heating limit, used for the regression
+	Outlier         bool     `json:"outlier"`
+}
+
+// EnergySignature is the regression of daily energy on heating degree days
+// ("Energiekennlinie"): kWh = intercept + slope × HDD
+type EnergySignature struct {
+	Energy         string                 `json:"energy"` // thermal or electricity
+	StartTime      time.Time              `json:"start_time"`
+	EndTime        time.Time              `json:"end_time"`
+	Base           float64                `json:"base"`
+	HeatingLimit   float64                `json:"heating_limit"`
+	Days           int                    `json:"days"`                          // heating days used for the regression
+	Outliers       int                    `json:"outliers"`                      // heating days off the signature
+	Slope          *float64               `json:"slope,omitempty"`               // kWh per degree day
+	Intercept      *float64               `json:"intercept,omitempty"`           // kWh per day at zero degree days
+	BaseLoad       *float64               `json:"base_load_kwh,omitempty"`       // kWh per day on days without heating, e.g. DHW
+	R2             *float64               `json:"r2,omitempty"`                  // coefficient of determination
+	ResidualStdDev *float64               `json:"residual_std_dev,omitempty"`    // kWh per day
+	HeatLossWPerK  *float64               `json:"heat_loss_w_per_k,omitempty"`   // thermal: heat-loss coefficient of the building
+	BalancePoint   *float64               `json:"balance_point,omitempty"`       // °C, outside temperature without heating demand
+	DesignHeatLoad *float64               `json:"design_heat_load_kw,omitempty"` // thermal: heat load at the design outside temperature
+	DesignTemp     float64                `json:"design_outside_temp"`
+	Points         []EnergySignaturePoint `json:"points"`
+	Warning        string                 `json:"warning,omitempty"`
+}
+
+// linearFit is a least-squares line through points
+type linearFit struct {
+	slope, intercept, r2, stdDev float64
+}
+
+// fitLine fits y = intercept + slope × x; ok is false for fewer than three points or no spread in x
+func fitLine(xs, ys []float64) (linearFit, bool) {
+	n := float64(len(xs))
+	if len(xs) < 3 {
+		return linearFit{}, false
+	}
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+	var sxx, sxy, syy float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 {
+		return linearFit{}, false
+	}
+
+	fit := linearFit{slope: sxy / sxx}
+	fit.intercept = meanY - fit.slope*meanX
+	var ssRes float64
+	for i := range xs {
+		r := ys[i] - (fit.intercept + fit.slope*xs[i])
+		ssRes += r * r
+	}
+	if syy > 0 {
+		fit.r2 = 1 - ssRes/syy
+	}
+	fit.stdDev = math.Sqrt(ssRes / (n - 2))
+	return fit, true
+}
+
+// GetEnergySignature fits the daily energy of complete days in [from, to) against their
+// heating degree days. Days off the line by more than outlierSigma standard deviations (and
+// 10 % of the predicted energy) are flagged and left out of a second fit, so single outages or guests do not skew the result.
+func GetEnergySignature(installationID, gatewayID, deviceID, energy string, from, to time.Time, settings *DegreeDaySettings) (*EnergySignature, error) {
+	if energy != SignatureThermal && energy != SignatureElectricity {
+		return nil, fmt.Errorf("invalid energy %q", energy)
+	}
+
+	_, days, err := GetHeatingDegreeDays(installationID, gatewayID, deviceID, from, to, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	sig := &EnergySignature{
+		Energy:       energy,
+		StartTime:    from,
+		EndTime:      to,
+		Base:         settings.BaseTemp,
+		HeatingLimit: settings.HeatingLimit,
+		DesignTemp:   settings.DesignOutsideTemp,
+		Points:       []EnergySignaturePoint{},
+	}
+
+	var heating []int // indices of heating days in Points
+	for _, d := range days {
+		if d.CoveredHours < minSignatureCoverageHours {
+			continue
+		}
+		kwh := d.ThermalKWh
+		if energy == SignatureElectricity {
+			kwh = d.ElectricityKWh
+		}
+		point := EnergySignaturePoint{
+			Date:            d.Date,
+			MeanOutsideTemp: d.MeanOutsideTemp,
+			HDD:             d.HDD,
+			KWh:             kwh,
+			HeatingDay:      d.MeanOutsideTemp < settings.HeatingLimit && d.HDD > 0,
+		}
+		if point.HeatingDay {
+			heating = append(heating, len(sig.Points))
+		}
+		sig.Points = append(sig.Points, point)
+	}
+
+	sig.Days = len(heating)
+	if len(heating) < minSignatureDays {
+		sig.Warning = fmt.Sprintf("%d complete heating days, at least %d are needed", len(heating), minSignatureDays)
+		return sig, nil
+	}
+
+	fitPoints := func(use func(i int) bool) (linearFit, bool) {
+		var xs, ys []float64
+		for _, i := range heating {
+			if use(i) {
+				xs = append(xs, sig.Points[i].HDD)
+				ys = append(ys, sig.Points[i].KWh)
+			}
+		}
+		return fitLine(xs, ys)
+	}
+
+	fit, ok := fitPoints(func(int) bool { return true })
+	if !ok {
+		sig.Warning = "degree days do not vary, no regression possible"
+		return sig, nil
+	}
+	outliers := func(fit linearFit) int {
+		count := 0
+		for _, i := range heating {
+			p := &sig.Points[i]
+			predicted := fit.intercept + fit.slope*p.HDD
+			deviation := math.Abs(p.KWh - predicted)
+			p.Outlier = deviation > settings.OutlierSigma*fit.stdDev && deviation > minOutlierDeviation*math.Abs(predicted)
+			if p.Outlier {
+				count++
+			}
+		}
+		return count
+	}
+	if n := outliers(fit); n > 0 && len(heating)-n >= minSignatureDays {
+		if refit, ok := fitPoints(func(i int) bool { return !sig.Points[i].Outlier }); ok {
+			fit = refit
+		}
+	}
+	sig.Outliers = outliers(fit)
+
+	for _, i := range heating {
+		p := &sig.Points[i]
+		predicted := fit.intercept + fit.slope*p.HDD
+		p.PredictedKWh = roundedPtr(predicted, 2)
+		p.Residual = roundedPtr(p.KWh-predicted, 2)
+	}
+
+	sig.Slope = roundedPtr(fit.slope, 3)
+	sig.Intercept = roundedPtr(fit.intercept, 2)
+	sig.R2 = roundedPtr(fit.r2, 3)
+	sig.ResidualStdDev = roundedPtr(fit.stdDev, 2)
+	if fit.slope <= 0 {
+		sig.Warning = "energy does not rise with the degree days, check the logged data"
+		return sig, nil
+	}
+
+	// The intercept also holds the base load (DHW, standby), which goes on without heating.
+	// It is taken from the days above the heating limit; what is left of the intercept is
+	// heating at zero degree days.
+	var heatingOffset float64
+	if baseLoad, ok := signatureBaseLoad(sig.Points, settings.HeatingLimit); ok {
+		sig.BaseLoad = roundedPtr(baseLoad, 2)
+		heatingOffset = fit.intercept - baseLoad
+		// slope × (base - T) + heatingOffset is zero at the balance point
+		sig.BalancePoint = roundedPtr(settings.BaseTemp+heatingOffset/fit.slope, 1)
+	} else if sig.Warning == "" {
+		sig.Warning = fmt.Sprintf("fewer than %d complete days without heating, base load and balance point are unknown", minBaseLoadDays)
+	}
+	if energy == SignatureThermal {
+		// slope is kWh per Kelvin and day: × 1000 / 24 gives W/K
+		sig.HeatLossWPerK = roundedPtr(fit.slope*1000/24, 0)
+		sig.DesignHeatLoad = roundedPtr((fit.slope*(settings.BaseTemp-settings.DesignOutsideTemp)+heatingOffset)/24, 2)
+	}
+	return sig, nil
+}
+
+// signatureBaseLoad returns the mean energy of the complete days at or above the heating limit
+func signatureBaseLoad(points []EnergySignaturePoint, heatingLimit float64) (float64, bool) {
+	var sum float64
+	days := 0
+	for _, p := range points {
+		if p.MeanOutsideTemp >= heatingLimit {
+			sum += p.KWh
+			days++
+		}
+	}
+	if days < minBaseLoadDays {
+		return 0, false
+	}
+	return sum / float64(days), true
+}
@@ -118,6 +118,10 @@ func RestartEventArchiveScheduler() error {
 func archiveEventsJob() {
 	log.Println("Running event archive job...")
 
+	if schedulerPausedByThrottle("event archive job") {
+		return
+	}
+
 	// Get settings
 	settings, err := GetEventArchiveSettings()
 	if err != nil {
@@ -130,8 +134,12 @@ func archiveEventsJob() {
 		return
 	}
 
+	started := time.Now()
+	failed := true
+	defer func() { recordJobRun("event_archive", started, failed) }()
+
 	// Fetch events from API (using default 7 days)
-	events, err := fetchEvents(7)
+	events, err := fetchEventsWithPriority(7, PriorityArchive)
 	if err != nil {
 		log.Printf("Error fetching events: %v", err)
 		return
@@ -151,6 +159,8 @@ func archiveEventsJob() {
 		return
 	}
 
+	failed = false
+
 	// Log statistics
 	count, _ := GetEventCount()
 	oldest, _ := GetOldestEventTimestamp()
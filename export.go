@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Export formats
+const (
+	ExportFormatCSV     = "csv"
+	ExportFormatJSONL   = "jsonl"
+	ExportFormatParquet = "parquet"
+)
+
+const (
+	// exportChunkSize is the number of rows read per query; the database lock
+	// is released between chunks so archiving and logging continue during exports
+	exportChunkSize = 5000
+
+	// exportParquetRowGroupSize bounds the rows buffered by the Parquet writer
+	exportParquetRowGroupSize = 16 * 1024 * 1024
+)
+
+// exportTable describes an exportable database table
+type exportTable struct {
+	table          string   // SQL table name
+	timeColumn     string   // column used for the time range and ordering
+	gatewayColumn  string   // column holding the gateway serial
+	defaultExclude []string // columns left out unless requested explicitly
+}
+
+// exportTables maps the public table names to their database tables
+var exportTables = map[string]exportTable{
+	"events": {
+		table:          "events",
+		timeColumn:     "event_timestamp",
+		gatewayColumn:  "gateway_serial",
+		defaultExclude: []string{"id", "hash", "body", "raw", "indexed_at"},
+	},
+	"temperatures": {
+		table:          "temperature_snapshots",
+		timeColumn:     "timestamp",
+		gatewayColumn:  "gateway_id",
+		defaultExclude: []string{"id"},
+	},
+}
+
+// ExportOptions selects the rows and columns of an export
+type ExportOptions struct {
+	Table          string   // events or temperatures
+	Format         string   // csv, jsonl or parquet
+	Columns        []string // empty = default column set of the table
+	Delimiter      rune     // CSV field separator (default ',')
+	InstallationID string
+	GatewayID      string
+	DeviceID       string
+	From           time.Time
+	To             time.Time
+}
+
+// exportColumn is a table column with its SQLite type affinity
+type exportColumn struct {
+	name     string
+	affinity string // INTEGER, REAL or TEXT
+}
+
+// exportRowWriter writes rows in one output format
+type exportRowWriter interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// getExportColumns returns the columns of a table in schema order
+func getExportColumns(table string) ([]exportColumn, error) {
+	if !dbInitialized || eventDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	rows, err := eventDB.Query("SELECT name, type FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []exportColumn
+	for rows.Next() {
+		var name, declType string
+		if err := rows.Scan(&name, &declType); err != nil {
+			return nil, err
+		}
+		affinity := "TEXT"
+		switch declType = strings.ToUpper(declType); {
+		case strings.Contains(declType, "INT"):
+			affinity = "INTEGER"
+		case strings.Contains(declType, "REAL"), strings.Contains(declType, "FLOA"), strings.Contains(declType, "DOUB"):
+			affinity = "REAL"
+		}
+		columns = append(columns, exportColumn{name: name, affinity: affinity})
+	}
+	return columns, rows.Err()
+}
+
+// resolveExportColumns validates the requested columns or returns the default set
+func resolveExportColumns(opts *ExportOptions) (exportTable, []exportColumn, error) {
+	table, ok := exportTables[opts.Table]
+	if !ok {
+		return table, nil, fmt.Errorf("unknown table %q (use events or temperatures)", opts.Table)
+	}
+
+	available, err := getExportColumns(table.table)
+	if err != nil {
+		return table, nil, err
+	}
+
+	if len(opts.Columns) == 0 {
+		var columns []exportColumn
+		for _, column := range available {
+			if !containsString(table.defaultExclude, column.name) {
+				columns = append(columns, column)
+			}
+		}
+		return table, columns, nil
+	}
+
+	byName := make(map[string]exportColumn, len(available))
+	for _, column := range available {
+		byName[column.name] = column
+	}
+	var columns []exportColumn
+	for _, name := range opts.Columns {
+		column, ok := byName[strings.TrimSpace(name)]
+		if !ok {
+			return table, nil, fmt.Errorf("unknown column %q for %s", name, opts.Table)
+		}
+		columns = append(columns, column)
+	}
+	return table, columns, nil
+}
+
+// ValidateExport checks the options before any output is written
+func ValidateExport(opts *ExportOptions) error {
+	switch opts.Format {
+	case ExportFormatCSV, ExportFormatJSONL, ExportFormatParquet:
+	default:
+		return fmt.Errorf("unknown format %q (use csv, jsonl or parquet)", opts.Format)
+	}
+	if !opts.From.IsZero() && !opts.To.IsZero() && opts.To.Before(opts.From) {
+		return fmt.Errorf("to must not be before from")
+	}
+	_, _, err := resolveExportColumns(opts)
+	return err
+}
+
+// ExportRows streams the selected rows to w and returns the number of rows written.
+// Rows are read in chunks of exportChunkSize, so memory use does not grow with the range.
+func ExportRows(w io.Writer, opts ExportOptions) (int64, error) {
+	if err := ValidateExport(&opts); err != nil {
+		return 0, err
+	}
+	table, columns, err := resolveExportColumns(&opts)
+	if err != nil {
+		return 0, err
+	}
+
+	buffered := bufio.NewWriterSize(w, 64*1024)
+	var rowWriter exportRowWriter
+	switch opts.Format {
+	case ExportFormatCSV:
+		rowWriter, err = newCSVExportWriter(buffered, columns, opts.Delimiter)
+	case ExportFormatJSONL:
+		rowWriter = &jsonlExportWriter{w: buffered, columns: columns}
+	case ExportFormatParquet:
+		rowWriter, err = newParquetExportWriter(buffered, columns, table.timeColumn)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.name
+	}
+
+	var written int64
+	var lastTime string
+	var lastID int64
+	for {
+		chunk, err := readExportChunk(table, names, opts, lastTime, lastID)
+		if err != nil {
+			return written, err
+		}
+		for _, row := range chunk {
+			if err := rowWriter.WriteRow(row.values); err != nil {
+				return written, err
+			}
+			written++
+		}
+		if len(chunk) < exportChunkSize {
+			break
+		}
+		lastTime, lastID = chunk[len(chunk)-1].time, chunk[len(chunk)-1].id
+	}
+
+	if err := rowWriter.Close(); err != nil {
+		return written, err
+	}
+	return written, buffered.Flush()
+}
+
+// exportRow is one row of a chunk with its keyset position
+type exportRow struct {
+	time   string
+	id     int64
+	values []interface{}
+}
+
+// readExportChunk reads the next chunk after the keyset position (lastTime, lastID)
+func readExportChunk(table exportTable, columns []string, opts ExportOptions, lastTime string, lastID int64) ([]exportRow, error) {
+	if !dbInitialized || eventDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	var conditions []string
+	var args []interface{}
+
+	if !opts.From.IsZero() {
+		conditions = append(conditions, table.timeColumn+" >= ?")
+		args = append(args, opts.From.UTC().Format(time.RFC3339))
+	}
+	if !opts.To.IsZero() {
+		conditions = append(conditions, table.timeColumn+" <= ?")
+		args = append(args, opts.To.UTC().Format(time.RFC3339))
+	}
+	for column, value := range map[string]string{
+		"installation_id":   opts.InstallationID,
+		table.gatewayColumn: opts.GatewayID,
+		"device_id":         opts.DeviceID,
+	} {
+		if value != "" {
+			conditions = append(conditions, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	if lastTime != "" {
+		conditions = append(conditions, fmt.Sprintf("(%[1]s > ? OR (%[1]s = ? AND id > ?))", table.timeColumn))
+		args = append(args, lastTime, lastTime, lastID)
+	}
+
+	query := fmt.Sprintf("SELECT %s, id, %s FROM %s", table.timeColumn, strings.Join(columns, ", "), table.table)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s ASC, id ASC LIMIT %d", table.timeColumn, exportChunkSize)
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	rows, err := eventDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %v", table.table, err)
+	}
+	defer rows.Close()
+
+	var chunk []exportRow
+	for rows.Next() {
+		row := exportRow{values: make([]interface{}, len(columns))}
+		dest := make([]interface{}, len(columns)+2)
+		dest[0], dest[1] = &row.time, &row.id
+		for i := range row.values {
+			dest[i+2] = &row.values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, value := range row.values {
+			if b, ok := value.([]byte); ok {
+				row.values[i] = string(b)
+			}
+		}
+		chunk = append(chunk, row)
+	}
+	return chunk, rows.Err()
+}
+
+// formatExportValue renders a value for text formats (nil = empty)
+func formatExportValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// csvExportWriter writes a header line and one record per row
+type csvExportWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVExportWriter(w io.Writer, columns []exportColumn, delimiter rune) (*csvExportWriter, error) {
+	cw := csv.NewWriter(w)
+	if delimiter != 0 {
+		cw.Comma = delimiter
+	}
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+	if err := cw.Write(header); err != nil {
+		return nil, err
+	}
+	return &csvExportWriter{w: cw, record: make([]string, len(columns))}, nil
+}
+
+func (c *csvExportWriter) WriteRow(values []interface{}) error {
+	for i, value := range values {
+		c.record[i] = formatExportValue(value)
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvExportWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonlExportWriter writes one JSON object per line, keeping the column order
+type jsonlExportWriter struct {
+	w       io.Writer
+	columns []exportColumn
+	line    []byte
+}
+
+func (j *jsonlExportWriter) WriteRow(values []interface{}) error {
+	line := append(j.line[:0], '{')
+	for i, value := range values {
+		if i > 0 {
+			line = append(line, ',')
+		}
+		line = strconv.AppendQuote(line, j.columns[i].name)
+		line = append(line, ':')
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		line = append(line, encoded...)
+	}
+	line = append(line, '}', '\n')
+	j.line = line
+	_, err := j.w.Write(line)
+	return err
+}
+
+func (j *jsonlExportWriter) Close() error {
+	return nil
+}
+
+// parquetExportWriter writes a Snappy-compressed Parquet file; the time column
+// becomes a TIMESTAMP_MILLIS column, all other columns keep their SQLite affinity
+type parquetExportWriter struct {
+	pw        *writer.CSVWriter
+	columns   []exportColumn
+	timeIndex int
+}
+
+func newParquetExportWriter(w io.Writer, columns []exportColumn, timeColumn string) (*parquetExportWriter, error) {
+	timeIndex := -1
+	metadata := make([]string, len(columns))
+	for i, column := range columns {
+		switch {
+		case column.name == timeColumn:
+			timeIndex = i
+			metadata[i] = fmt.Sprintf("name=%s, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL", column.name)
+		case column.affinity == "INTEGER":
+			metadata[i] = fmt.Sprintf("name=%s, type=INT64, repetitiontype=OPTIONAL", column.name)
+		case column.affinity == "REAL":
+			metadata[i] = fmt.Sprintf("name=%s, type=DOUBLE, repetitiontype=OPTIONAL", column.name)
+		default:
+			metadata[i] = fmt.Sprintf("name=%s, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL", column.name)
+		}
+	}
+
+	pw, err := writer.NewCSVWriterFromWriter(metadata, w, 1)
+	if err != nil {
+		return nil, err
+	}
+	pw.RowGroupSize = exportParquetRowGroupSize
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	return &parquetExportWriter{pw: pw, columns: columns, timeIndex: timeIndex}, nil
+}
+
+func (p *parquetExportWriter) WriteRow(values []interface{}) error {
+	record := make([]interface{}, len(values))
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		if i == p.timeIndex {
+			t, err := time.Parse(time.RFC3339, formatExportValue(value))
+			if err != nil {
+				continue
+			}
+			record[i] = t.UnixMilli()
+			continue
+		}
+		switch p.columns[i].affinity {
+		case "INTEGER":
+			switch v := value.(type) {
+			case int64:
+				record[i] = v
+			case float64:
+				record[i] = int64(v)
+			}
+		case "REAL":
+			switch v := value.(type) {
+			case float64:
+				record[i] = v
+			case int64:
+				record[i] = float64(v)
+			}
+		default:
+			record[i] = formatExportValue(value)
+		}
+	}
+	return p.pw.Write(record)
+}
+
+func (p *parquetExportWriter) Close() error {
+	return p.pw.WriteStop()
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FeatureHistorySettings selects Viessmann features that are logged generically,
+// independent of the fixed temperature_snapshots columns
+type FeatureHistorySettings struct {
+	Enabled bool                 `json:"enabled"`
+	Rules   []FeatureHistoryRule `json:"rules"`
+}
+
+// FeatureHistoryRule logs the features matching one of its patterns on the selected devices.
+// Empty IDs match everything. Devices other than "0" are only fetched for rules naming them.
+type FeatureHistoryRule struct {
+	InstallationID string   `json:"installationId,omitempty"`
+	GatewayID      string   `json:"gatewayId,omitempty"`
+	DeviceID       string   `json:"deviceId,omitempty"`
+	Features       []string `json:"features"` // exact names or patterns, e.g. heating.condensors.*.sensors.temperature.liquid
+}
+
+// FeatureHistoryPoint is one logged property value of a feature
+type FeatureHistoryPoint struct {
+	Timestamp      time.Time `json:"timestamp"`
+	InstallationID string    `json:"installation_id"`
+	GatewayID      string    `json:"gateway_id"`
+	DeviceID       string    `json:"device_id"`
+	Feature        string    `json:"feature"`
+	Property       string    `json:"property"`
+	ValueType      string    `json:"value_type"` // number, string or boolean
+	NumValue       *float64  `json:"num_value,omitempty"`
+	StrValue       *string   `json:"str_value,omitempty"`
+	BoolValue      *bool     `json:"bool_value,omitempty"`
+	Unit           string    `json:"unit,omitempty"`
+}
+
+// FeatureHistorySeries describes one logged feature property
+type FeatureHistorySeries struct {
+	InstallationID string    `json:"installation_id"`
+	GatewayID      string    `json:"gateway_id"`
+	DeviceID       string    `json:"device_id"`
+	Feature        string    `json:"feature"`
+	Property       string    `json:"property"`
+	ValueType      string    `json:"value_type"`
+	Unit           string    `json:"unit,omitempty"`
+	Count          int64     `json:"count"`
+	First          time.Time `json:"first"`
+	Last           time.Time `json:"last"`
+}
+
+// validateFeatureHistorySettings checks the rule patterns
+func validateFeatureHistorySettings(settings *FeatureHistorySettings) error {
+	for i, rule := range settings.Rules {
+		if len(rule.Features) == 0 {
+			return fmt.Errorf("rule %d has no features", i+1)
+		}
+		for _, pattern := range rule.Features {
+			if strings.TrimSpace(pattern) == "" {
+				return fmt.Errorf("rule %d has an empty feature pattern", i+1)
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %d: invalid feature pattern %q", i+1, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// featureHistoryPatterns returns the feature patterns configured for a device.
+// For devices other than "0" only rules naming the device explicitly count.
+func featureHistoryPatterns(settings *FeatureHistorySettings, installationID, gatewayID, deviceID string) []string {
+	if settings == nil || !settings.Enabled {
+		return nil
+	}
+
+	var patterns []string
+	for _, rule := range settings.Rules {
+		if rule.InstallationID != "" && rule.InstallationID != installationID {
+			continue
+		}
+		if rule.GatewayID != "" && rule.GatewayID != gatewayID {
+			continue
+		}
+		if rule.DeviceID != deviceID && (rule.DeviceID != "" || deviceID != "0") {
+			continue
+		}
+		patterns = append(patterns, rule.Features...)
+	}
+	return patterns
+}
+
+// matchFeaturePattern reports whether a feature name matches one of the patterns
+func matchFeaturePattern(patterns []string, feature string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, feature); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// extractFeatureHistory turns the scalar properties of all matching features into history points
+func extractFeatureHistory(features *DeviceFeatures, patterns []string, installationID, gatewayID, deviceID string, timestamp time.Time) []FeatureHistoryPoint {
+	if features == nil || len(patterns) == 0 {
+		return nil
+	}
+
+	var points []FeatureHistoryPoint
+	for _, feature := range features.RawFeatures {
+		if !matchFeaturePattern(patterns, feature.Feature) {
+			continue
+		}
+
+		// Sorted property names keep the insert order stable
+		names := make([]string, 0, len(feature.Properties))
+		for name := range feature.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			point := FeatureHistoryPoint{
+				Timestamp:      timestamp,
+				InstallationID: installationID,
+				GatewayID:      gatewayID,
+				DeviceID:       deviceID,
+				Feature:        feature.Feature,
+				Property:       name,
+			}
+			if setFeatureHistoryValue(&point, feature.Properties[name]) {
+				points = append(points, point)
+			}
+		}
+	}
+	return points
+}
+
+// setFeatureHistoryValue copies value and unit of a feature property into the point.
+// Arrays and objects (e.g. statistics per day) are not logged.
+func setFeatureHistoryValue(point *FeatureHistoryPoint, property interface{}) bool {
+	prop, ok := property.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	if unit, ok := prop["unit"].(string); ok {
+		point.Unit = unit
+	}
+
+	switch v := prop["value"].(type) {
+	case float64:
+		point.ValueType = "number"
+		point.NumValue = &v
+	case int:
+		f := float64(v)
+		point.ValueType = "number"
+		point.NumValue = &f
+	case bool:
+		point.ValueType = "boolean"
+		point.BoolValue = &v
+	case string:
+		point.ValueType = "string"
+		point.StrValue = &v
+	default:
+		return false
+	}
+	return true
+}
+
+// SaveFeatureHistory stores history points in one transaction
+func SaveFeatureHistory(points []FeatureHistoryPoint) error {
+	if !dbInitialized || eventDB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	if len(points) == 0 {
+		return nil
+	}
+
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	tx, err := eventDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO feature_history (
+			timestamp, installation_id, gateway_id, device_id, feature, property,
+			value_type, num_value, str_value, unit
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare feature history insert: %v", err)
+	}
+	defer stmt.Close()
+
+	for _, p := range points {
+		// Booleans are stored as 0/1 in num_value
+		num := p.NumValue
+		if p.BoolValue != nil {
+			b := 0.0
+			if *p.BoolValue {
+				b = 1
+			}
+			num = &b
+		}
+		_, err := stmt.Exec(p.Timestamp.UTC().Format(time.RFC3339), p.InstallationID, p.GatewayID, p.DeviceID,
+			p.Feature, p.Property, p.ValueType, num, p.StrValue, p.Unit)
+		if err != nil {
+			return fmt.Errorf("failed to insert feature history: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// FeatureHistoryQuery filters feature history points
+type FeatureHistoryQuery struct {
+	InstallationID string
+	GatewayID      string
+	DeviceID       string
+	Feature        string // exact name or pattern with *
+	Property       string
+	StartTime      time.Time
+	EndTime        time.Time
+	Limit          int
+}
+
+// featureHistoryWhere builds the WHERE clause shared by the point and series queries
+func featureHistoryWhere(q FeatureHistoryQuery) (string, []interface{}) {
+	where := "installation_id = ? AND timestamp >= ? AND timestamp <= ?"
+	args := []interface{}{q.InstallationID, q.StartTime.UTC().Format(time.RFC3339), q.EndTime.UTC().Format(time.RFC3339)}
+	if q.GatewayID != "" {
+		where += " AND gateway_id = ?"
+		args = append(args, q.GatewayID)
+	}
+	if q.DeviceID != "" {
+		where += " AND device_id = ?"
+		args = append(args, q.DeviceID)
+	}
+	if q.Feature != "" {
+		if strings.ContainsAny(q.Feature, "*?") {
+			where += " AND feature GLOB ?"
+		} else {
+			where += " AND feature = ?"
+		}
+		args = append(args, q.Feature)
+	}
+	if q.Property != "" {
+		where += " AND property = ?"
+		args = append(args, q.Property)
+	}
+	return where, args
+}
+
+// GetFeatureHistory retrieves logged feature values ordered by time
+func GetFeatureHistory(q FeatureHistoryQuery) ([]FeatureHistoryPoint, error) {
+	if !dbInitialized || eventDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	where, args := featureHistoryWhere(q)
+	query := `
+		SELECT timestamp, installation_id, gateway_id, device_id, feature, property,
+			value_type, num_value, str_value, unit
+		FROM feature_history
+		WHERE ` + where + `
+		ORDER BY timestamp ASC, feature ASC, property ASC`
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+
+	rows, err := eventDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feature history: %v", err)
+	}
+	defer rows.Close()
+
+	var points []FeatureHistoryPoint
+	for rows.Next() {
+		var p FeatureHistoryPoint
+		var timestampStr string
+		var unit *string
+		if err := rows.Scan(&timestampStr, &p.InstallationID, &p.GatewayID, &p.DeviceID, &p.Feature, &p.Property,
+			&p.ValueType, &p.NumValue, &p.StrValue, &unit); err != nil {
+			log.Printf("Warning: failed to scan feature history row: %v", err)
+			continue
+		}
+		p.Timestamp, _ = time.Parse(time.RFC3339, timestampStr)
+		if unit != nil {
+			p.Unit = *unit
+		}
+		if p.ValueType == "boolean" && p.NumValue != nil {
+			b := *p.NumValue != 0
+			p.BoolValue = &b
+			p.NumValue = nil
+		}
+		points = append(points, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating feature history: %v", err)
+	}
+	return points, nil
+}
+
+// GetFeatureHistorySeries lists the logged feature properties with their time range
+func GetFeatureHistorySeries(q FeatureHistoryQuery) ([]FeatureHistorySeries, error) {
+	if !dbInitialized || eventDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	where, args := featureHistoryWhere(q)
+	rows, err := eventDB.Query(`
+		SELECT installation_id, gateway_id, device_id, feature, property,
+			MAX(value_type), MAX(unit), COUNT(*), MIN(timestamp), MAX(timestamp)
+		FROM feature_history
+		WHERE `+where+`
+		GROUP BY installation_id, gateway_id, device_id, feature, property
+		ORDER BY gateway_id, device_id, feature, property`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feature history series: %v", err)
+	}
+	defer rows.Close()
+
+	var series []FeatureHistorySeries
+	for rows.Next() {
+		var s FeatureHistorySeries
+		var unit *string
+		var first, last string
+		if err := rows.Scan(&s.InstallationID, &s.GatewayID, &s.DeviceID, &s.Feature, &s.Property,
+			&s.ValueType, &unit, &s.Count, &first, &last); err != nil {
+			log.Printf("Warning: failed to scan feature history series: %v", err)
+			continue
+		}
+		if unit != nil {
+			s.Unit = *unit
+		}
+		s.First, _ = time.Parse(time.RFC3339, first)
+		s.Last, _ = time.Parse(time.RFC3339, last)
+		series = append(series, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating feature history series: %v", err)
+	}
+	return series, nil
+}
+
+// CleanupOldFeatureHistory removes feature history older than the retention period
+func CleanupOldFeatureHistory(retentionDays int) error {
+	if !dbInitialized || eventDB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	cutoffTime := time.Now().UTC().AddDate(0, 0, -retentionDays)
+	result, err := eventDB.Exec("DELETE FROM feature_history WHERE timestamp < ?", cutoffTime.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to cleanup old feature history: %v", err)
+	}
+
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+		log.Printf("Cleaned up %d old feature history values (retention: %d days)", rowsAffected, retentionDays)
+	}
+	return nil
+}
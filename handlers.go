@@ -368,6 +368,7 @@ func accountUpdateHandler(w http.ResponseWriter, r *http.Request) {
 	accountsMutex.Lock()
 	delete(accountTokens, existing.ID)
 	accountsMutex.Unlock()
+	persistAccountTokens()
 
 	// Clear cache to force refresh
 	fetchMutex.Lock()
@@ -412,6 +413,7 @@ func accountDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	accountsMutex.Lock()
 	delete(accountTokens, req.ID)
 	accountsMutex.Unlock()
+	persistAccountTokens()
 
 	log.Printf("Account deleted: %s\n", req.ID)
 
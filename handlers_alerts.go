@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// maskAlertSecrets returns a copy of the settings with passwords, tokens and webhook header
+// values (Authorization, API keys) hidden
+func maskAlertSecrets(settings *AlertSettings) AlertSettings {
+	masked := *settings
+	masked.Channels = make([]AlertChannel, len(settings.Channels))
+	for i, ch := range settings.Channels {
+		if ch.Password != "" {
+			ch.Password = alertSecretMask
+		}
+		if ch.Token != "" {
+			ch.Token = alertSecretMask
+		}
+		if len(ch.Headers) > 0 {
+			headers := make(map[string]string, len(ch.Headers))
+			for name, value := range ch.Headers {
+				if value != "" {
+					value = alertSecretMask
+				}
+				headers[name] = value
+			}
+			ch.Headers = headers
+		}
+		masked.Channels[i] = ch
+	}
+	return masked
+}
+
+// restoreAlertSecrets keeps stored secrets for channels submitted with masked values
+func restoreAlertSecrets(settings, old *AlertSettings) {
+	oldChannels := make(map[string]AlertChannel)
+	for _, ch := range old.Channels {
+		oldChannels[ch.ID] = ch
+	}
+	for i := range settings.Channels {
+		ch := &settings.Channels[i]
+		if ch.Password == alertSecretMask {
+			ch.Password = oldChannels[ch.ID].Password
+		}
+		if ch.Token == alertSecretMask {
+			ch.Token = oldChannels[ch.ID].Token
+		}
+		for name, value := range ch.Headers {
+			if value == alertSecretMask {
+				ch.Headers[name] = oldChannels[ch.ID].Headers[name]
+			}
+		}
+	}
+}
+
+// alertSettingsGetHandler handles GET /api/alerts/settings
+func alertSettingsGetHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := GetAlertSettings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(maskAlertSecrets(settings))
+}
+
+// alertSettingsSetHandler handles POST /api/alerts/settings/set
+func alertSettingsSetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var settings AlertSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if settings.Rules == nil {
+		settings.Rules = []AlertRule{}
+	}
+	if settings.Channels == nil {
+		settings.Channels = []AlertChannel{}
+	}
+
+	if err := validateAlertSettings(&settings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	oldSettings, err := GetAlertSettings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	restoreAlertSecrets(&settings, oldSettings)
+
+	if err := SetAlertSettings(&settings); err != nil {
+		http.Error(w, "Failed to save settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	alerts.applySettings(&settings)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"message":  "Alert settings updated successfully",
+		"settings": maskAlertSecrets(&settings),
+	})
+}
+
+// alertTestHandler handles POST /api/alerts/test
+// Sends a test notification through the channel given as {"channelId": "..."}
+func alertTestHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ChannelID string `json:"channelId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	settings, err := GetAlertSettings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i := range settings.Channels {
+		ch := &settings.Channels[i]
+		if ch.ID != req.ChannelID {
+			continue
+		}
+
+		err := sendAlertNotification(ch, AlertNotification{
+			RuleID:    "test",
+			RuleName:  "Test",
+			Status:    AlertStatusTest,
+			Subject:   "test",
+			Title:     "ViEventLog test notification",
+			Message:   "This is a test notification from ViEventLog.",
+			Severity:  "info",
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Test notification sent",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   "Channel not found",
+	})
+}
+
+// alertStatusHandler handles GET /api/alerts/status
+// Returns firing and pending alerts plus the recent notification history
+func alertStatusHandler(w http.ResponseWriter, r *http.Request) {
+	active, history := alerts.Status()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"active":  active,
+		"history": history,
+	})
+}
@@ -2,11 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -52,7 +54,11 @@ func eventsHandler(w http.ResponseWriter, r *http.Request) {
 		endTime := time.Now()
 		startTime := endTime.AddDate(0, 0, -days)
 
-		dbEvents, err := GetEventsFromDB(startTime, endTime, 0)
+		dbEvents, _, err := GetEventsFromDB(EventQueryOptions{
+			StartTime:  startTime,
+			EndTime:    endTime,
+			Descending: true,
+		})
 		if err != nil {
 			log.Printf("Warning: failed to fetch events from DB: %v", err)
 			allEvents = apiEvents
@@ -123,10 +129,130 @@ func sortEventsByTimestamp(events []Event) {
 	}
 }
 
+// eventsQueryHandler handles GET /api/events/query
+// Queries archived events with filters, full-text search (q), sorting and
+// keyset pagination (pass nextCursor from the previous response as cursor)
+func eventsQueryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	q := r.URL.Query()
+
+	writeError := func(status int, msg string) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   msg,
+		})
+	}
+
+	// splitList parses comma-separated filter values
+	splitList := func(key string) []string {
+		var values []string
+		for _, v := range strings.Split(q.Get(key), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		return values
+	}
+
+	opts := EventQueryOptions{
+		InstallationID: q.Get("installationId"),
+		AccountID:      q.Get("accountId"),
+		GatewaySerial:  q.Get("gatewaySerial"),
+		DeviceID:       q.Get("deviceId"),
+		ModelID:        q.Get("modelId"),
+		ErrorCodes:     splitList("errorCode"),
+		CodeCategories: splitList("category"),
+		Severities:     splitList("severity"),
+		EventTypes:     splitList("eventType"),
+		FeatureName:    q.Get("featureName"),
+		Search:         q.Get("q"),
+		SortBy:         q.Get("sort"),
+		Descending:     q.Get("order") != "asc",
+		Limit:          100,
+		Cursor:         q.Get("cursor"),
+	}
+
+	if activeStr := q.Get("active"); activeStr != "" {
+		active, err := strconv.ParseBool(activeStr)
+		if err != nil {
+			writeError(http.StatusBadRequest, "Invalid active value. Use true or false")
+			return
+		}
+		opts.Active = &active
+	}
+
+	// Time range accepts RFC3339 timestamps or dates (YYYY-MM-DD, local time)
+	parseTime := func(value string) (time.Time, error) {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, nil
+		}
+		return time.ParseInLocation("2006-01-02", value, DefaultLocation)
+	}
+	if fromStr := q.Get("from"); fromStr != "" {
+		from, err := parseTime(fromStr)
+		if err != nil {
+			writeError(http.StatusBadRequest, "Invalid from format. Use RFC3339 or YYYY-MM-DD")
+			return
+		}
+		opts.StartTime = from
+	}
+	if toStr := q.Get("to"); toStr != "" {
+		to, err := parseTime(toStr)
+		if err != nil {
+			writeError(http.StatusBadRequest, "Invalid to format. Use RFC3339 or YYYY-MM-DD")
+			return
+		}
+		// A plain date includes the whole day
+		if len(toStr) == len("2006-01-02") {
+			to = to.Add(24*time.Hour - time.Second)
+		}
+		opts.EndTime = to
+	}
+
+	if limitStr := q.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			writeError(http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		if limit > 1000 {
+			limit = 1000
+		}
+		opts.Limit = limit
+	}
+
+	if _, ok := eventSortColumns[opts.SortBy]; opts.SortBy != "" && !ok {
+		writeError(http.StatusBadRequest, "Invalid sort field. Use timestamp, error_code, severity, event_type, device_id or model_id")
+		return
+	}
+
+	events, nextCursor, err := GetEventsFromDB(opts)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errInvalidEventCursor) {
+			status = http.StatusBadRequest
+		}
+		writeError(status, err.Error())
+		return
+	}
+	if events == nil {
+		events = []Event{}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"events":     events,
+		"count":      len(events),
+		"nextCursor": nextCursor,
+	})
+}
+
 // statusHandler handles GET /api/status
 // Returns connection status, device count, and cache statistics
 func statusHandler(w http.ResponseWriter, r *http.Request) {
-	status := StatusResponse{}
+	rateLimit := apiLimiter.Status()
+	status := StatusResponse{RateLimit: &rateLimit, APIThrottle: getAPIThrottleStatus()}
 
 	// Get active accounts
 	activeAccounts, err := GetActiveAccounts()
@@ -1163,3 +1289,216 @@ func HandleConsumptionStats(w http.ResponseWriter, r *http.Request) {
 		"stats":   stats,
 	})
 }
+
+// HandleSeasonalPerformance returns energy-weighted performance factors (JAZ/SCOP) per month
+// and heating season. Query: installationId, gatewaySerial, deviceId, and either seasons
+// (number of heating seasons up to now, default 2) or from/to (YYYY-MM, inclusive).
+func HandleSeasonalPerformance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	installationID := r.URL.Query().Get("installationId")
+	gatewaySerial := r.URL.Query().Get("gatewaySerial")
+	deviceID := r.URL.Query().Get("deviceId")
+	if installationID == "" || gatewaySerial == "" || deviceID == "" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Missing required parameters: installationId, gatewaySerial, deviceId",
+		})
+		return
+	}
+
+	now := time.Now().In(DefaultLocation)
+	to := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, DefaultLocation).AddDate(0, 1, 0)
+	from := heatingSeasonStart(now).AddDate(-1, 0, 0)
+
+	fromStr := r.URL.Query().Get("from")
+	toStr := r.URL.Query().Get("to")
+	if fromStr != "" || toStr != "" {
+		fromMonth, errFrom := time.ParseInLocation("2006-01", fromStr, DefaultLocation)
+		toMonth, errTo := time.ParseInLocation("2006-01", toStr, DefaultLocation)
+		if errFrom != nil || errTo != nil || toMonth.Before(fromMonth) {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "Invalid from/to month. Use YYYY-MM with from <= to",
+			})
+			return
+		}
+		from, to = fromMonth, toMonth.AddDate(0, 1, 0)
+	} else if seasonsStr := r.URL.Query().Get("seasons"); seasonsStr != "" {
+		seasons, err := strconv.Atoi(seasonsStr)
+		if err != nil || seasons < 1 || seasons > 10 {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "Invalid seasons parameter (must be 1-10)",
+			})
+			return
+		}
+		from = heatingSeasonStart(now).AddDate(1-seasons, 0, 0)
+	}
+
+	report, err := GetSeasonalPerformance(installationID, gatewaySerial, deviceID, from, to)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Failed to calculate seasonal performance: " + err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"spf":     report,
+	})
+}
+
+// HandleElectricityCosts returns the electricity cost of a device per hour, day or month,
+// priced with the configured tariffs. Query: installationId, gatewaySerial, deviceId,
+// period (hour, day or month; default day), from/to (YYYY-MM-DD, inclusive; default:
+// current month, hour: today). The range ends at the current time at the latest.
+func HandleElectricityCosts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	installationID := r.URL.Query().Get("installationId")
+	gatewaySerial := r.URL.Query().Get("gatewaySerial")
+	deviceID := r.URL.Query().Get("deviceId")
+	if installationID == "" || gatewaySerial == "" || deviceID == "" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Missing required parameters: installationId, gatewaySerial, deviceId",
+		})
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	switch period {
+	case "":
+		period = CostPeriodDay
+	case CostPeriodHour, CostPeriodDay, CostPeriodMonth:
+	default:
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Invalid period. Use: hour, day, month",
+		})
+		return
+	}
+
+	now := time.Now().In(DefaultLocation).Truncate(time.Second)
+	startTime := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, DefaultLocation)
+	if period == CostPeriodHour {
+		startTime = startOfDay(now)
+	}
+	endTime := now
+
+	fromStr := r.URL.Query().Get("from")
+	toStr := r.URL.Query().Get("to")
+	if fromStr != "" {
+		if toStr == "" {
+			toStr = fromStr
+		}
+		fromDate, errFrom := time.ParseInLocation("2006-01-02", fromStr, DefaultLocation)
+		toDate, errTo := time.ParseInLocation("2006-01-02", toStr, DefaultLocation)
+		if errFrom != nil || errTo != nil || toDate.Before(fromDate) {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "Invalid from/to date. Use YYYY-MM-DD with from <= to",
+			})
+			return
+		}
+		startTime = fromDate
+		if end := toDate.AddDate(0, 0, 1); end.Before(endTime) {
+			endTime = end
+		}
+	}
+	if !startTime.Before(endTime) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "The range starts in the future",
+		})
+		return
+	}
+
+	report, err := GetElectricityCosts(installationID, gatewaySerial, deviceID, period, startTime, endTime)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Failed to calculate costs: " + err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"costs":   report,
+	})
+}
+
+// HandleConsumptionComparison compares the consumption of this week, month or heating season
+// with the previous week, the same month last year or the previous season, normalized with
+// heating degree days. Query: installationId, gatewaySerial, deviceId, period (week, month or
+// season; default week), date (YYYY-MM-DD, compares up to the end of that day; default now),
+// hddBase and hddLimit (°C, default: degree day settings).
+func HandleConsumptionComparison(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	installationID := r.URL.Query().Get("installationId")
+	gatewaySerial := r.URL.Query().Get("gatewaySerial")
+	deviceID := r.URL.Query().Get("deviceId")
+	if installationID == "" || gatewaySerial == "" || deviceID == "" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Missing required parameters: installationId, gatewaySerial, deviceId",
+		})
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	switch period {
+	case "":
+		period = ComparisonWeek
+	case ComparisonWeek, ComparisonMonth, ComparisonSeason:
+	default:
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Invalid period. Use: week, month, season",
+		})
+		return
+	}
+
+	ref := time.Now().In(DefaultLocation).Truncate(time.Second)
+	if dateStr := r.URL.Query().Get("date"); dateStr != "" {
+		date, err := time.ParseInLocation("2006-01-02", dateStr, DefaultLocation)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "Invalid date format. Use YYYY-MM-DD",
+			})
+			return
+		}
+		if end := date.AddDate(0, 0, 1); end.Before(ref) {
+			ref = end
+		}
+	}
+
+	settings, err := degreeDayQuerySettings(r)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	comparison, err := GetConsumptionComparison(installationID, gatewaySerial, deviceID, period, ref, settings)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Failed to compare consumption: " + err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"comparison": comparison,
+	})
+}
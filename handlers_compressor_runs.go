@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// handleCycleSettings handles GET /api/compressor/cycles/settings
+func handleCycleSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	settings, err := GetCycleSettings()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// handleSetCycleSettings handles POST /api/compressor/cycles/settings/set
+func handleSetCycleSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Fields missing in the request keep their current value
+	settings, err := GetCycleSettings()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(settings); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateCycleSettings(settings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := SetCycleSettings(settings); err != nil {
+		http.Error(w, "Failed to save settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Cycle settings updated successfully",
+	})
+}
+
+// HandleCompressorRuns lists the reconstructed compressor runs. Query: installationId,
+// gatewaySerial, deviceId, from/to (YYYY-MM-DD, default: last 7 days), limit.
+func HandleCompressorRuns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	installationID := r.URL.Query().Get("installationId")
+	gatewaySerial := r.URL.Query().Get("gatewaySerial")
+	deviceID := r.URL.Query().Get("deviceId")
+	if installationID == "" || gatewaySerial == "" || deviceID == "" {
+		writeConsumptionError(w, "Missing required parameters: installationId, gatewaySerial, deviceId")
+		return
+	}
+
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			writeConsumptionError(w, "invalid limit")
+			return
+		}
+		limit = parsed
+	}
+	from, to, err := parseDayRange(r, startOfDay(time.Now()).AddDate(0, 0, -defaultRunsDays))
+	if err != nil {
+		writeConsumptionError(w, err.Error())
+		return
+	}
+
+	runs, err := GetCompressorRuns(installationID, gatewaySerial, deviceID, from, to, limit)
+	if err != nil {
+		writeConsumptionError(w, "Failed to get compressor runs: "+err.Error())
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"runs":    runs,
+	})
+}
+
+// HandleCompressorCycles returns the run length distribution, short-cycling hours, the
+// breakdown by mode and the daily run length histogram. Query: installationId,
+// gatewaySerial, deviceId, from/to (YYYY-MM-DD, default: last 30 days).
+func HandleCompressorCycles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	installationID := r.URL.Query().Get("installationId")
+	gatewaySerial := r.URL.Query().Get("gatewaySerial")
+	deviceID := r.URL.Query().Get("deviceId")
+	if installationID == "" || gatewaySerial == "" || deviceID == "" {
+		writeConsumptionError(w, "Missing required parameters: installationId, gatewaySerial, deviceId")
+		return
+	}
+
+	from, to, err := parseDayRange(r, startOfDay(time.Now()).AddDate(0, 0, -defaultCycleStatsDays))
+	if err != nil {
+		writeConsumptionError(w, err.Error())
+		return
+	}
+	settings, err := GetCycleSettings()
+	if err != nil {
+		writeConsumptionError(w, "Failed to get cycle settings: "+err.Error())
+		return
+	}
+
+	stats, err := GetCompressorCycleStats(installationID, gatewaySerial, deviceID, from, to, settings)
+	if err != nil {
+		writeConsumptionError(w, "Failed to calculate cycle statistics: "+err.Error())
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"cycles":  stats,
+	})
+}
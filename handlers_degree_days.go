@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// handleDegreeDaySettings handles GET /api/consumption/degree-days/settings
+func handleDegreeDaySettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	settings, err := GetDegreeDaySettings()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// handleSetDegreeDaySettings handles POST /api/consumption/degree-days/settings/set
+func handleSetDegreeDaySettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Fields missing in the request keep their current value
+	settings, err := GetDegreeDaySettings()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(settings); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateDegreeDaySettings(settings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := SetDegreeDaySettings(settings); err != nil {
+		http.Error(w, "Failed to save settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Degree day settings updated successfully",
+	})
+}
+
+// degreeDayQuerySettings returns the degree day settings, overridden by the hddBase and
+// hddLimit query parameters
+func degreeDayQuerySettings(r *http.Request) (*DegreeDaySettings, error) {
+	stored, err := GetDegreeDaySettings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get degree day settings: %v", err)
+	}
+	settings := *stored
+
+	for param, target := range map[string]*float64{"hddBase": &settings.BaseTemp, "hddLimit": &settings.HeatingLimit} {
+		if value := r.URL.Query().Get(param); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed < 5 || parsed > 25 {
+				return nil, fmt.Errorf("invalid %s (must be 5-25 °C)", param)
+			}
+			*target = parsed
+		}
+	}
+	return &settings, nil
+}
+
+// parseDayRange reads from/to (YYYY-MM-DD, inclusive) and returns [from, to) capped at now
+func parseDayRange(r *http.Request, defaultFrom time.Time) (time.Time, time.Time, error) {
+	now := time.Now().In(DefaultLocation).Truncate(time.Second)
+	from, to := defaultFrom, now
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		t, err := time.ParseInLocation("2006-01-02", fromStr, DefaultLocation)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from date format, use YYYY-MM-DD")
+		}
+		from = t
+	}
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		t, err := time.ParseInLocation("2006-01-02", toStr, DefaultLocation)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to date format, use YYYY-MM-DD")
+		}
+		if end := t.AddDate(0, 0, 1); end.Before(to) {
+			to = end
+		}
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to and not in the future")
+	}
+	return from, to, nil
+}
+
+// writeConsumptionError writes an error response in the format of the consumption API
+func writeConsumptionError(w http.ResponseWriter, msg string) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   msg,
+	})
+}
+
+// HandleDegreeDays returns the daily heating degree days with energy and their sum.
+// Query: installationId, gatewaySerial, deviceId, from/to (YYYY-MM-DD, default: current
+// heating season), hddBase and hddLimit (°C, default: degree day settings).
+func HandleDegreeDays(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	installationID := r.URL.Query().Get("installationId")
+	gatewaySerial := r.URL.Query().Get("gatewaySerial")
+	deviceID := r.URL.Query().Get("deviceId")
+	if installationID == "" || gatewaySerial == "" || deviceID == "" {
+		writeConsumptionError(w, "Missing required parameters: installationId, gatewaySerial, deviceId")
+		return
+	}
+
+	settings, err := degreeDayQuerySettings(r)
+	if err != nil {
+		writeConsumptionError(w, err.Error())
+		return
+	}
+	from, to, err := parseDayRange(r, heatingSeasonStart(time.Now()))
+	if err != nil {
+		writeConsumptionError(w, err.Error())
+		return
+	}
+
+	summary, days, err := GetHeatingDegreeDays(installationID, gatewaySerial, deviceID, from, to, settings)
+	if err != nil {
+		writeConsumptionError(w, "Failed to calculate degree days: "+err.Error())
+		return
+	}
+	if days == nil {
+		days = []DegreeDay{}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"summary": summary,
+		"days":    days,
+	})
+}
+
+// HandleEnergySignature returns the energy signature (daily kWh vs heating degree days)
+// with heat-loss coefficient, balance point and outlier days. Query: installationId,
+// gatewaySerial, deviceId, energy (thermal or electricity, default thermal), from/to
+// (YYYY-MM-DD, default: last 365 days), hddBase and hddLimit.
+func HandleEnergySignature(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	installationID := r.URL.Query().Get("installationId")
+	gatewaySerial := r.URL.Query().Get("gatewaySerial")
+	deviceID := r.URL.Query().Get("deviceId")
+	if installationID == "" || gatewaySerial == "" || deviceID == "" {
+		writeConsumptionError(w, "Missing required parameters: installationId, gatewaySerial, deviceId")
+		return
+	}
+
+	energy := r.URL.Query().Get("energy")
+	switch energy {
+	case "":
+		energy = SignatureThermal
+	case SignatureThermal, SignatureElectricity:
+	default:
+		writeConsumptionError(w, "Invalid energy. Use: thermal, electricity")
+		return
+	}
+
+	settings, err := degreeDayQuerySettings(r)
+	if err != nil {
+		writeConsumptionError(w, err.Error())
+		return
+	}
+	from, to, err := parseDayRange(r, startOfDay(time.Now()).AddDate(0, 0, -365))
+	if err != nil {
+		writeConsumptionError(w, err.Error())
+		return
+	}
+
+	signature, err := GetEnergySignature(installationID, gatewaySerial, deviceID, energy, from, to, settings)
+	if err != nil {
+		writeConsumptionError(w, "Failed to calculate energy signature: "+err.Error())
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"signature": signature,
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// deviceLoggingState loads all settings needed to describe the logged devices
+func deviceLoggingState(logSettings *DeviceLoggingSettings) ([]DeviceLogDevice, error) {
+	settings, err := GetTemperatureLogSettings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get temperature log settings: %v", err)
+	}
+	historySettings, err := GetFeatureHistorySettings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feature history settings: %v", err)
+	}
+	return listDeviceLogDevices(settings, logSettings, historySettings)
+}
+
+// handleDeviceLoggingSettings handles GET /api/temperature-log/devices
+// Lists all devices with their logging class, profile fields, interval and estimated API calls
+func handleDeviceLoggingSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	logSettings, err := GetDeviceLoggingSettings()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	devices, err := deviceLoggingState(logSettings)
+	if err != nil {
+		log.Printf("Error listing devices for logging: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"devices":          devices,
+		"settings":         logSettings,
+		"callsPerDay":      sumDeviceLogCalls(devices),
+		"callBudgetPerDay": deviceLogCallBudget(),
+		"defaultInterval":  defaultDeviceLogInterval,
+	})
+}
+
+// handleSetDeviceLoggingSettings handles POST /api/temperature-log/devices/set
+// Changes that would raise the estimated API calls above the temperature logging
+// budget are rejected; reducing the load is always possible.
+func handleSetDeviceLoggingSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var settings DeviceLoggingSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if settings.Devices == nil {
+		settings.Devices = []DeviceLogConfig{}
+	}
+
+	if err := validateDeviceLoggingSettings(&settings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	current, err := GetDeviceLoggingSettings()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+	before, err := deviceLoggingState(current)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	after, err := deviceLoggingState(&settings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Devices without a logging profile cannot be enabled
+	for _, d := range after {
+		cfg := deviceLogConfig(&settings, d.InstallationID, d.GatewayID, d.DeviceID)
+		if cfg.Enabled && !d.Loggable {
+			http.Error(w, fmt.Sprintf("Device %s (%s) has no logging profile, use feature history rules instead", d.DeviceID, d.Class), http.StatusBadRequest)
+			return
+		}
+	}
+
+	callsBefore, callsAfter, budget := sumDeviceLogCalls(before), sumDeviceLogCalls(after), deviceLogCallBudget()
+	if callsAfter > budget && callsAfter > callsBefore {
+		http.Error(w, fmt.Sprintf("Estimated %d API calls per day exceed the temperature logging budget of %d, increase the intervals or disable devices", callsAfter, budget), http.StatusBadRequest)
+		return
+	}
+
+	if err := SetDeviceLoggingSettings(&settings); err != nil {
+		http.Error(w, "Failed to save settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"message":     "Device logging settings updated successfully",
+		"callsPerDay": callsAfter,
+	})
+}
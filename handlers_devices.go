@@ -2,12 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strings"
-	"time"
 )
 
 // Device Settings Handlers
@@ -370,13 +370,7 @@ func dhwModeSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate mode
-	validModes := map[string]bool{
-		"efficient":               true,
-		"efficientWithMinComfort": true,
-		"balanced":                true,
-		"off":                     true,
-	}
-	if !validModes[req.Mode] {
+	if !dhwModes[req.Mode] {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -386,9 +380,7 @@ func dhwModeSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get access token for the account
-	accountsMutex.RLock()
-	token, exists := accountTokens[req.AccountID]
-	accountsMutex.RUnlock()
+	token, exists := getValidAccountToken(req.AccountID)
 
 	if !exists {
 		w.Header().Set("Content-Type", "application/json")
@@ -399,58 +391,11 @@ func dhwModeSetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Build Viessmann API URL
-	url := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/heating.dhw.operating.modes.active/commands/setMode",
-		req.InstallationID, req.GatewaySerial, req.DeviceID)
-
-	// Prepare request body
-	requestBody := map[string]string{
-		"mode": req.Mode,
-	}
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to create request: " + err.Error(),
-		})
-		return
-	}
-
-	// Make API call
-	client := &http.Client{Timeout: 30 * time.Second}
-	httpReq, err := NewRequest(http.MethodPost, url, strings.NewReader(string(jsonBody)))
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to create request: " + err.Error(),
-		})
-		return
-	}
-
-	httpReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to call Viessmann API: " + err.Error(),
-		})
-		return
-	}
-	defer resp.Body.Close()
-
-	// Check response status
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		log.Printf("Viessmann API error: status=%d, body=%s", resp.StatusCode, string(bodyBytes))
+	if err := setDHWMode(token, req.InstallationID, req.GatewaySerial, req.DeviceID, req.Mode); err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   fmt.Sprintf("Viessmann API returned status %d: %s", resp.StatusCode, string(bodyBytes)),
+			"error":   commandErrorMessage(err),
 		})
 		return
 	}
@@ -469,6 +414,24 @@ func dhwModeSetHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// dhwModes lists the hot water operating modes accepted by the setMode command
+var dhwModes = map[string]bool{
+	"efficient":               true,
+	"efficientWithMinComfort": true,
+	"balanced":                true,
+	"off":                     true,
+}
+
+// setDHWMode sends the setMode command of the hot water operating mode to the Viessmann API
+func setDHWMode(token *AccountToken, installationID, gatewaySerial, deviceID, mode string) error {
+	if !dhwModes[mode] {
+		return fmt.Errorf("invalid mode %q, must be one of: efficient, efficientWithMinComfort, balanced, off", mode)
+	}
+
+	return sendFeatureCommand(token, installationID, gatewaySerial, deviceID,
+		"heating.dhw.operating.modes.active", "setMode", map[string]interface{}{"mode": mode})
+}
+
 func dhwTemperatureSetHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -503,9 +466,7 @@ func dhwTemperatureSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get access token for the account
-	accountsMutex.RLock()
-	token, exists := accountTokens[req.AccountID]
-	accountsMutex.RUnlock()
+	token, exists := getValidAccountToken(req.AccountID)
 
 	if !exists {
 		w.Header().Set("Content-Type", "application/json")
@@ -516,58 +477,11 @@ func dhwTemperatureSetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Build Viessmann API URL
-	url := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/heating.dhw.temperature.main/commands/setTargetTemperature",
-		req.InstallationID, req.GatewaySerial, req.DeviceID)
-
-	// Prepare request body
-	requestBody := map[string]int{
-		"temperature": int(req.Temperature),
-	}
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
+	if err := setDHWTemperature(token, req.InstallationID, req.GatewaySerial, req.DeviceID, req.Temperature); err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   "Failed to create request: " + err.Error(),
-		})
-		return
-	}
-
-	// Make API call
-	client := &http.Client{Timeout: 30 * time.Second}
-	httpReq, err := NewRequest(http.MethodPost, url, strings.NewReader(string(jsonBody)))
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to create request: " + err.Error(),
-		})
-		return
-	}
-
-	httpReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to call Viessmann API: " + err.Error(),
-		})
-		return
-	}
-	defer resp.Body.Close()
-
-	// Check response status
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		log.Printf("Viessmann API error: status=%d, body=%s", resp.StatusCode, string(bodyBytes))
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   fmt.Sprintf("Viessmann API returned status %d: %s", resp.StatusCode, string(bodyBytes)),
+			"error":   commandErrorMessage(err),
 		})
 		return
 	}
@@ -586,6 +500,13 @@ func dhwTemperatureSetHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// setDHWTemperature sends the setTargetTemperature command of the main hot water
+// temperature to the Viessmann API. The API only accepts whole degrees.
+func setDHWTemperature(token *AccountToken, installationID, gatewaySerial, deviceID string, temperature float64) error {
+	return sendFeatureCommand(token, installationID, gatewaySerial, deviceID,
+		"heating.dhw.temperature.main", "setTargetTemperature", map[string]interface{}{"temperature": int(temperature)})
+}
+
 func dhwTemperature2SetHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -620,9 +541,7 @@ func dhwTemperature2SetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get access token for the account
-	accountsMutex.RLock()
-	token, exists := accountTokens[req.AccountID]
-	accountsMutex.RUnlock()
+	token, exists := getValidAccountToken(req.AccountID)
 
 	if !exists {
 		w.Header().Set("Content-Type", "application/json")
@@ -634,7 +553,7 @@ func dhwTemperature2SetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Build Viessmann API URL
-	url := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/heating.dhw.temperature.temp2/commands/setTargetTemperature",
+	url := apiBaseURL + fmt.Sprintf("/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/heating.dhw.temperature.temp2/commands/setTargetTemperature",
 		req.InstallationID, req.GatewaySerial, req.DeviceID)
 
 	// Prepare request body
@@ -652,7 +571,6 @@ func dhwTemperature2SetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Make API call
-	client := &http.Client{Timeout: 30 * time.Second}
 	httpReq, err := NewRequest(http.MethodPost, url, strings.NewReader(string(jsonBody)))
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -666,7 +584,7 @@ func dhwTemperature2SetHandler(w http.ResponseWriter, r *http.Request) {
 	httpReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := client.Do(httpReq)
+	resp, err := doAPIRequest(httpReq)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -753,9 +671,7 @@ func dhwHysteresisSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get access token for the account
-	accountsMutex.RLock()
-	token, exists := accountTokens[req.AccountID]
-	accountsMutex.RUnlock()
+	token, exists := getValidAccountToken(req.AccountID)
 
 	if !exists {
 		w.Header().Set("Content-Type", "application/json")
@@ -767,7 +683,7 @@ func dhwHysteresisSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Build Viessmann API URL
-	url := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/heating.dhw.temperature.hysteresis/commands/%s",
+	url := apiBaseURL + fmt.Sprintf("/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/heating.dhw.temperature.hysteresis/commands/%s",
 		req.InstallationID, req.GatewaySerial, req.DeviceID, command)
 
 	// Prepare request body
@@ -785,7 +701,6 @@ func dhwHysteresisSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Make API call
-	client := &http.Client{Timeout: 30 * time.Second}
 	httpReq, err := NewRequest(http.MethodPost, url, strings.NewReader(string(jsonBody)))
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -799,7 +714,7 @@ func dhwHysteresisSetHandler(w http.ResponseWriter, r *http.Request) {
 	httpReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := client.Do(httpReq)
+	resp, err := doAPIRequest(httpReq)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -869,9 +784,7 @@ func dhwOneTimeChargeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get access token for the account
-	accountsMutex.RLock()
-	token, exists := accountTokens[req.AccountID]
-	accountsMutex.RUnlock()
+	token, exists := getValidAccountToken(req.AccountID)
 
 	if !exists {
 		w.Header().Set("Content-Type", "application/json")
@@ -882,56 +795,11 @@ func dhwOneTimeChargeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Build Viessmann API URL
-	url := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/heating.dhw.oneTimeCharge/commands/activate",
-		req.InstallationID, req.GatewaySerial, req.DeviceID)
-
-	// Prepare empty request body
-	requestBody := map[string]interface{}{}
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
+	if err := activateDHWOneTimeCharge(token, req.InstallationID, req.GatewaySerial, req.DeviceID); err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   "Failed to create request: " + err.Error(),
-		})
-		return
-	}
-
-	// Make API call
-	client := &http.Client{Timeout: 30 * time.Second}
-	httpReq, err := NewRequest(http.MethodPost, url, strings.NewReader(string(jsonBody)))
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to create request: " + err.Error(),
-		})
-		return
-	}
-
-	httpReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to call Viessmann API: " + err.Error(),
-		})
-		return
-	}
-	defer resp.Body.Close()
-
-	// Check response status
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		log.Printf("Viessmann API error: status=%d, body=%s", resp.StatusCode, string(bodyBytes))
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   fmt.Sprintf("Viessmann API returned status %d: %s", resp.StatusCode, string(bodyBytes)),
+			"error":   commandErrorMessage(err),
 		})
 		return
 	}
@@ -950,6 +818,12 @@ func dhwOneTimeChargeHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// activateDHWOneTimeCharge sends the activate command of the hot water one-time charge to the Viessmann API
+func activateDHWOneTimeCharge(token *AccountToken, installationID, gatewaySerial, deviceID string) error {
+	return sendFeatureCommand(token, installationID, gatewaySerial, deviceID,
+		"heating.dhw.oneTimeCharge", "activate", map[string]interface{}{})
+}
+
 // Heating Control Handlers
 
 func heatingCurveSetHandler(w http.ResponseWriter, r *http.Request) {
@@ -988,9 +862,7 @@ func heatingCurveSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get access token for the account
-	accountsMutex.RLock()
-	token, exists := accountTokens[req.AccountID]
-	accountsMutex.RUnlock()
+	token, exists := getValidAccountToken(req.AccountID)
 
 	if !exists {
 		w.Header().Set("Content-Type", "application/json")
@@ -1001,75 +873,100 @@ func heatingCurveSetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Build Viessmann API URL
-	url := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/heating.circuits.%d.heating.curve/commands/setCurve",
-		req.InstallationID, req.GatewaySerial, req.DeviceID, req.Circuit)
-
-	// Prepare request body - shift as int, slope as float rounded to 1 decimal
-	requestBody := map[string]interface{}{
-		"shift": req.Shift,
-		"slope": float64(int(req.Slope*10+0.5)) / 10, // Round to 1 decimal
-	}
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
+	if err := setHeatingCurve(token, req.InstallationID, req.GatewaySerial, req.DeviceID, req.Circuit, req.Shift, req.Slope); err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   "Failed to create request: " + err.Error(),
+			"error":   commandErrorMessage(err),
 		})
 		return
 	}
 
-	// Make API call
-	client := &http.Client{Timeout: 30 * time.Second}
+	log.Printf("Heating curve changed to shift=%d, slope=%.1f for device %s (account: %s)", req.Shift, req.Slope, req.DeviceID, req.AccountID)
+
+	// Clear features cache to force refresh
+	featuresCacheMutex.Lock()
+	cacheKey := fmt.Sprintf("%s:%s:%s", req.InstallationID, req.GatewaySerial, req.DeviceID)
+	delete(featuresCache, cacheKey)
+	featuresCacheMutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// setHeatingCurve sends the setCurve command of a heating circuit to the Viessmann API
+func setHeatingCurve(token *AccountToken, installationID, gatewaySerial, deviceID string, circuit, shift int, slope float64) error {
+	// Shift as int, slope as float rounded to 1 decimal
+	return sendFeatureCommand(token, installationID, gatewaySerial, deviceID,
+		fmt.Sprintf("heating.circuits.%d.heating.curve", circuit), "setCurve", map[string]interface{}{
+			"shift": shift,
+			"slope": float64(int(slope*10+0.5)) / 10, // Round to 1 decimal
+		})
+}
+
+// Errors of sendFeatureCommand, wrapped together with their cause
+var (
+	errCommandMarshal = errors.New("failed to marshal request")
+	errCommandRequest = errors.New("failed to create request")
+	errCommandCall    = errors.New("failed to call Viessmann API")
+)
+
+// commandStatusError is returned by sendFeatureCommand when the Viessmann API rejects a command
+type commandStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *commandStatusError) Error() string {
+	return fmt.Sprintf("Viessmann API returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// sendFeatureCommand executes a command of a device feature via the Viessmann API
+func sendFeatureCommand(token *AccountToken, installationID, gatewaySerial, deviceID, feature, command string, body map[string]interface{}) error {
+	url := apiBaseURL + fmt.Sprintf("/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/%s/commands/%s",
+		installationID, gatewaySerial, deviceID, feature, command)
+
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errCommandMarshal, err)
+	}
+
 	httpReq, err := NewRequest(http.MethodPost, url, strings.NewReader(string(jsonBody)))
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to create request: " + err.Error(),
-		})
-		return
+		return fmt.Errorf("%w: %v", errCommandRequest, err)
 	}
 
 	httpReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := client.Do(httpReq)
+	resp, err := doAPIRequest(httpReq)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to call Viessmann API: " + err.Error(),
-		})
-		return
+		return fmt.Errorf("%w: %v", errCommandCall, err)
 	}
 	defer resp.Body.Close()
 
-	// Check response status
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		log.Printf("Viessmann API error: status=%d, body=%s", resp.StatusCode, string(bodyBytes))
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   fmt.Sprintf("Viessmann API returned status %d: %s", resp.StatusCode, string(bodyBytes)),
-		})
-		return
+		return &commandStatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
 	}
+	return nil
+}
 
-	log.Printf("Heating curve changed to shift=%d, slope=%.1f for device %s (account: %s)", req.Shift, req.Slope, req.DeviceID, req.AccountID)
-
-	// Clear features cache to force refresh
-	featuresCacheMutex.Lock()
-	cacheKey := fmt.Sprintf("%s:%s:%s", req.InstallationID, req.GatewaySerial, req.DeviceID)
-	delete(featuresCache, cacheKey)
-	featuresCacheMutex.Unlock()
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-	})
+// commandErrorMessage maps an error of sendFeatureCommand to the message
+// reported by the heating and hot water control handlers
+func commandErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, errCommandMarshal):
+		return "Failed to create request" + strings.TrimPrefix(err.Error(), errCommandMarshal.Error())
+	case errors.Is(err, errCommandRequest):
+		return "Failed to create request" + strings.TrimPrefix(err.Error(), errCommandRequest.Error())
+	case errors.Is(err, errCommandCall):
+		return "Failed to call Viessmann API" + strings.TrimPrefix(err.Error(), errCommandCall.Error())
+	}
+	return err.Error()
 }
 
 func heatingModeSetHandler(w http.ResponseWriter, r *http.Request) {
@@ -1107,13 +1004,7 @@ func heatingModeSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate mode
-	validModes := map[string]bool{
-		"heating":        true,
-		"standby":        true,
-		"cooling":        true,
-		"heatingCooling": true,
-	}
-	if !validModes[req.Mode] {
+	if !heatingModes[req.Mode] {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -1123,9 +1014,7 @@ func heatingModeSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get access token for the account
-	accountsMutex.RLock()
-	token, exists := accountTokens[req.AccountID]
-	accountsMutex.RUnlock()
+	token, exists := getValidAccountToken(req.AccountID)
 
 	if !exists {
 		w.Header().Set("Content-Type", "application/json")
@@ -1136,58 +1025,11 @@ func heatingModeSetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Build Viessmann API URL
-	url := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/heating.circuits.%d.operating.modes.active/commands/setMode",
-		req.InstallationID, req.GatewaySerial, req.DeviceID, req.Circuit)
-
-	// Prepare request body
-	requestBody := map[string]string{
-		"mode": req.Mode,
-	}
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
+	if err := setHeatingMode(token, req.InstallationID, req.GatewaySerial, req.DeviceID, req.Circuit, req.Mode); err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   "Failed to create request: " + err.Error(),
-		})
-		return
-	}
-
-	// Make API call
-	client := &http.Client{Timeout: 30 * time.Second}
-	httpReq, err := NewRequest(http.MethodPost, url, strings.NewReader(string(jsonBody)))
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to create request: " + err.Error(),
-		})
-		return
-	}
-
-	httpReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to call Viessmann API: " + err.Error(),
-		})
-		return
-	}
-	defer resp.Body.Close()
-
-	// Check response status
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		log.Printf("Viessmann API error: status=%d, body=%s", resp.StatusCode, string(bodyBytes))
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   fmt.Sprintf("Viessmann API returned status %d: %s", resp.StatusCode, string(bodyBytes)),
+			"error":   commandErrorMessage(err),
 		})
 		return
 	}
@@ -1206,6 +1048,24 @@ func heatingModeSetHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// heatingModes lists the heating circuit operating modes accepted by the setMode command
+var heatingModes = map[string]bool{
+	"heating":        true,
+	"standby":        true,
+	"cooling":        true,
+	"heatingCooling": true,
+}
+
+// setHeatingMode sends the setMode command of a heating circuit to the Viessmann API
+func setHeatingMode(token *AccountToken, installationID, gatewaySerial, deviceID string, circuit int, mode string) error {
+	if !heatingModes[mode] {
+		return fmt.Errorf("invalid mode %q, must be one of: heating, standby, cooling, heatingCooling", mode)
+	}
+
+	return sendFeatureCommand(token, installationID, gatewaySerial, deviceID,
+		fmt.Sprintf("heating.circuits.%d.operating.modes.active", circuit), "setMode", map[string]interface{}{"mode": mode})
+}
+
 func supplyTempMaxSetHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -1241,9 +1101,7 @@ func supplyTempMaxSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get access token for the account
-	accountsMutex.RLock()
-	token, exists := accountTokens[req.AccountID]
-	accountsMutex.RUnlock()
+	token, exists := getValidAccountToken(req.AccountID)
 
 	if !exists {
 		w.Header().Set("Content-Type", "application/json")
@@ -1255,7 +1113,7 @@ func supplyTempMaxSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Build Viessmann API URL - NOTE: using v2 API!
-	url := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/heating.circuits.%d.temperature.levels/commands/setMax",
+	url := apiBaseURL + fmt.Sprintf("/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/heating.circuits.%d.temperature.levels/commands/setMax",
 		req.InstallationID, req.GatewaySerial, req.DeviceID, req.Circuit)
 
 	// Prepare request body
@@ -1273,7 +1131,6 @@ func supplyTempMaxSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Make API call
-	client := &http.Client{Timeout: 30 * time.Second}
 	httpReq, err := NewRequest(http.MethodPost, url, strings.NewReader(string(jsonBody)))
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1287,7 +1144,7 @@ func supplyTempMaxSetHandler(w http.ResponseWriter, r *http.Request) {
 	httpReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := client.Do(httpReq)
+	resp, err := doAPIRequest(httpReq)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -1393,9 +1250,7 @@ func roomTempSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get access token for the account
-	accountsMutex.RLock()
-	token, exists := accountTokens[req.AccountID]
-	accountsMutex.RUnlock()
+	token, exists := getValidAccountToken(req.AccountID)
 
 	if !exists {
 		w.Header().Set("Content-Type", "application/json")
@@ -1407,7 +1262,7 @@ func roomTempSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Build Viessmann API URL
-	url := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/heating.circuits.%d.operating.programs.%s/commands/setTemperature",
+	url := apiBaseURL + fmt.Sprintf("/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/heating.circuits.%d.operating.programs.%s/commands/setTemperature",
 		req.InstallationID, req.GatewaySerial, req.DeviceID, req.Circuit, req.Program)
 
 	// Prepare request body
@@ -1425,7 +1280,6 @@ func roomTempSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Make API call
-	client := &http.Client{Timeout: 30 * time.Second}
 	httpReq, err := NewRequest(http.MethodPost, url, strings.NewReader(string(jsonBody)))
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1439,7 +1293,7 @@ func roomTempSetHandler(w http.ResponseWriter, r *http.Request) {
 	httpReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := client.Do(httpReq)
+	resp, err := doAPIRequest(httpReq)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -1527,9 +1381,7 @@ func noiseReductionModeSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get access token for the account
-	accountsMutex.RLock()
-	token, exists := accountTokens[req.AccountID]
-	accountsMutex.RUnlock()
+	token, exists := getValidAccountToken(req.AccountID)
 
 	if !exists {
 		w.Header().Set("Content-Type", "application/json")
@@ -1541,7 +1393,7 @@ func noiseReductionModeSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Build Viessmann API URL
-	url := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/heating.noise.reduction.operating.programs.active/commands/setMode",
+	url := apiBaseURL + fmt.Sprintf("/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/heating.noise.reduction.operating.programs.active/commands/setMode",
 		req.InstallationID, req.GatewaySerial, req.DeviceID)
 
 	// Prepare request body
@@ -1559,7 +1411,6 @@ func noiseReductionModeSetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Make API call
-	client := &http.Client{Timeout: 30 * time.Second}
 	httpReq, err := NewRequest(http.MethodPost, url, strings.NewReader(string(jsonBody)))
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1573,7 +1424,7 @@ func noiseReductionModeSetHandler(w http.ResponseWriter, r *http.Request) {
 	httpReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := client.Do(httpReq)
+	resp, err := doAPIRequest(httpReq)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -1644,9 +1495,7 @@ func fanRingToggleHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get access token for the account
-	accountsMutex.RLock()
-	token, exists := accountTokens[req.AccountID]
-	accountsMutex.RUnlock()
+	token, exists := getValidAccountToken(req.AccountID)
 
 	if !exists {
 		w.Header().Set("Content-Type", "application/json")
@@ -1658,7 +1507,7 @@ func fanRingToggleHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Build Viessmann API URL
-	url := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/heating.heater.fanRing/commands/setActive",
+	url := apiBaseURL + fmt.Sprintf("/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/heating.heater.fanRing/commands/setActive",
 		req.InstallationID, req.GatewaySerial, req.DeviceID)
 
 	// Prepare request body
@@ -1676,7 +1525,6 @@ func fanRingToggleHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Make API call
-	client := &http.Client{Timeout: 30 * time.Second}
 	httpReq, err := NewRequest(http.MethodPost, url, strings.NewReader(string(jsonBody)))
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -1690,7 +1538,7 @@ func fanRingToggleHandler(w http.ResponseWriter, r *http.Request) {
 	httpReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := client.Do(httpReq)
+	resp, err := doAPIRequest(httpReq)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
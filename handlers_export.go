@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// exportContentTypes maps export formats to HTTP content types
+var exportContentTypes = map[string]string{
+	ExportFormatCSV:     "text/csv; charset=utf-8",
+	ExportFormatJSONL:   "application/x-ndjson",
+	ExportFormatParquet: "application/vnd.apache.parquet",
+}
+
+// exportEventsHandler handles GET /api/export/events
+func exportEventsHandler(w http.ResponseWriter, r *http.Request) {
+	handleExport(w, r, "events")
+}
+
+// exportTemperaturesHandler handles GET /api/export/temperatures
+func exportTemperaturesHandler(w http.ResponseWriter, r *http.Request) {
+	handleExport(w, r, "temperatures")
+}
+
+// handleExport streams a table as CSV, JSON Lines or Parquet download
+// Query: format, columns (comma-separated), delimiter, installationId, gatewayId, deviceId, from, to
+func handleExport(w http.ResponseWriter, r *http.Request, table string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !dbInitialized {
+		http.Error(w, "Database is not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	opts, err := parseExportQuery(r.URL.Query(), table)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := ValidateExport(&opts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", exportContentTypes[opts.Format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exportFileName(opts)))
+
+	started := time.Now()
+	rows, err := ExportRows(w, opts)
+	if err != nil {
+		// Headers are already sent, so the client only sees a truncated file
+		log.Printf("Export of %s failed after %d rows: %v", table, rows, err)
+		return
+	}
+	log.Printf("Exported %d %s rows as %s in %s", rows, table, opts.Format, time.Since(started).Round(time.Millisecond))
+}
+
+// parseExportQuery builds export options from query parameters.
+// from/to accept RFC3339 timestamps or dates (YYYY-MM-DD, local time; to includes the whole day).
+func parseExportQuery(q url.Values, table string) (ExportOptions, error) {
+	opts := ExportOptions{
+		Table:          table,
+		Format:         strings.ToLower(q.Get("format")),
+		InstallationID: q.Get("installationId"),
+		GatewayID:      q.Get("gatewayId"),
+		DeviceID:       q.Get("deviceId"),
+	}
+	if opts.Format == "" {
+		opts.Format = ExportFormatCSV
+	}
+	if opts.GatewayID == "" {
+		opts.GatewayID = q.Get("gatewaySerial")
+	}
+	if columns := q.Get("columns"); columns != "" {
+		opts.Columns = strings.Split(columns, ",")
+	}
+
+	delimiter, err := parseExportDelimiter(q.Get("delimiter"))
+	if err != nil {
+		return opts, err
+	}
+	opts.Delimiter = delimiter
+
+	if opts.From, err = parseExportTime(q.Get("from"), false); err != nil {
+		return opts, fmt.Errorf("invalid from: use RFC3339 or YYYY-MM-DD")
+	}
+	if opts.To, err = parseExportTime(q.Get("to"), true); err != nil {
+		return opts, fmt.Errorf("invalid to: use RFC3339 or YYYY-MM-DD")
+	}
+	return opts, nil
+}
+
+// parseExportDelimiter accepts a single character or the names comma, semicolon and tab
+func parseExportDelimiter(value string) (rune, error) {
+	switch value {
+	case "", "comma":
+		return ',', nil
+	case "semicolon":
+		return ';', nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	runes := []rune(value)
+	if len(runes) != 1 || runes[0] == '"' || runes[0] == '\r' || runes[0] == '\n' {
+		return 0, fmt.Errorf("invalid delimiter %q", value)
+	}
+	return runes[0], nil
+}
+
+// parseExportTime parses RFC3339 or YYYY-MM-DD; a date used as upper bound covers the whole day
+func parseExportTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, DefaultLocation)
+	if err != nil {
+		return t, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	return t, nil
+}
+
+// exportFileName returns a download name like vieventlog-temperatures-20240101-20241231.csv
+func exportFileName(opts ExportOptions) string {
+	name := "vieventlog-" + opts.Table
+	if opts.InstallationID != "" {
+		name += "-" + opts.InstallationID
+	}
+	if !opts.From.IsZero() {
+		name += "-" + opts.From.In(DefaultLocation).Format("20060102")
+	}
+	if !opts.To.IsZero() {
+		name += "-" + opts.To.In(DefaultLocation).Format("20060102")
+	}
+	return name + "." + opts.Format
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// featureHistorySettingsGetHandler handles GET /api/feature-history/settings
+func featureHistorySettingsGetHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := GetFeatureHistorySettings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// featureHistorySettingsSetHandler handles POST /api/feature-history/settings/set
+// The rules take effect with the next temperature logging run.
+func featureHistorySettingsSetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var settings FeatureHistorySettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if settings.Rules == nil {
+		settings.Rules = []FeatureHistoryRule{}
+	}
+
+	if err := validateFeatureHistorySettings(&settings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := SetFeatureHistorySettings(&settings); err != nil {
+		http.Error(w, "Failed to save settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Feature history settings updated successfully",
+	})
+}
+
+// parseFeatureHistoryQuery reads installationId, gatewayId, deviceId, feature, property and
+// the time range (hours or startTime/endTime, default: last 24 hours)
+func parseFeatureHistoryQuery(values url.Values) (FeatureHistoryQuery, error) {
+	q := FeatureHistoryQuery{
+		InstallationID: values.Get("installationId"),
+		GatewayID:      values.Get("gatewayId"),
+		DeviceID:       values.Get("deviceId"),
+		Feature:        values.Get("feature"),
+		Property:       values.Get("property"),
+		EndTime:        time.Now().UTC(),
+	}
+	if q.InstallationID == "" {
+		return q, fmt.Errorf("installationId parameter is required")
+	}
+
+	if hoursParam := values.Get("hours"); hoursParam != "" {
+		hours, err := strconv.Atoi(hoursParam)
+		if err != nil || hours < 1 || hours > 87600 {
+			return q, fmt.Errorf("invalid hours parameter (must be 1-87600)")
+		}
+		q.StartTime = q.EndTime.Add(-time.Duration(hours) * time.Hour)
+		return q, nil
+	}
+
+	q.StartTime = q.EndTime.Add(-24 * time.Hour)
+	if startTimeStr := values.Get("startTime"); startTimeStr != "" {
+		t, err := time.Parse(time.RFC3339, startTimeStr)
+		if err != nil {
+			return q, fmt.Errorf("invalid startTime format (use RFC3339)")
+		}
+		q.StartTime = t
+	}
+	if endTimeStr := values.Get("endTime"); endTimeStr != "" {
+		t, err := time.Parse(time.RFC3339, endTimeStr)
+		if err != nil {
+			return q, fmt.Errorf("invalid endTime format (use RFC3339)")
+		}
+		q.EndTime = t
+	}
+	return q, nil
+}
+
+// featureHistoryDataHandler handles GET /api/feature-history/data
+// Query: installationId (required), gatewayId, deviceId, feature (name or pattern with *),
+// property, hours or startTime/endTime, limit (default 50000, max 100000)
+func featureHistoryDataHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q, err := parseFeatureHistoryQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	q.Limit = 50000
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsedLimit, err := strconv.Atoi(limitParam)
+		if err == nil && parsedLimit > 0 && parsedLimit <= 100000 {
+			q.Limit = parsedLimit
+		}
+	}
+
+	points, err := GetFeatureHistory(q)
+	if err != nil {
+		log.Printf("Error fetching feature history: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to fetch data: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if points == nil {
+		points = []FeatureHistoryPoint{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"installationId": q.InstallationID,
+		"startTime":      q.StartTime.Format(time.RFC3339),
+		"endTime":        q.EndTime.Format(time.RFC3339),
+		"count":          len(points),
+		"limit":          q.Limit,
+		"data":           points,
+	})
+}
+
+// featureHistorySeriesHandler handles GET /api/feature-history/series
+// Lists the logged feature properties per device with count and time range (same filters as data)
+func featureHistorySeriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q, err := parseFeatureHistoryQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series, err := GetFeatureHistorySeries(q)
+	if err != nil {
+		log.Printf("Error fetching feature history series: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to fetch series: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if series == nil {
+		series = []FeatureHistorySeries{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"installationId": q.InstallationID,
+		"series":         series,
+	})
+}
@@ -9,9 +9,10 @@ import (
 )
 
 type healthResponse struct {
-	Status   string `json:"status"`
-	Database string `json:"database"`
-	Error    string `json:"error,omitempty"`
+	Status   string            `json:"status"`
+	Database string            `json:"database"`
+	Error    string            `json:"error,omitempty"`
+	API      APIThrottleStatus `json:"api"`
 }
 
 // healthHandler reports application health. If the event database is
@@ -29,7 +30,7 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	if !initialized || db == nil {
 		// Database not in use (archiving and temperature logging disabled)
 		// is a valid state, treat as healthy.
-		_ = json.NewEncoder(w).Encode(healthResponse{Status: "ok", Database: "not_initialized"})
+		_ = json.NewEncoder(w).Encode(healthResponse{Status: "ok", Database: "not_initialized", API: getAPIThrottleStatus()})
 		return
 	}
 
@@ -48,7 +49,7 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_ = json.NewEncoder(w).Encode(healthResponse{Status: "ok", Database: "writable"})
+	_ = json.NewEncoder(w).Encode(healthResponse{Status: "ok", Database: "writable", API: getAPIThrottleStatus()})
 }
 
 func writeHealthFailure(w http.ResponseWriter, stage string, err error) {
@@ -58,5 +59,6 @@ func writeHealthFailure(w http.ResponseWriter, stage string, err error) {
 		Status:   "unhealthy",
 		Database: "write_failed",
 		Error:    err.Error(),
+		API:      getAPIThrottleStatus(),
 	})
 }
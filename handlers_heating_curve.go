@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseHourWindow parses a local hour window like "6-22"; empty is the whole day
+func parseHourWindow(value string) (HourWindow, error) {
+	if value == "" {
+		return HourWindow{}, nil
+	}
+	fromStr, toStr, ok := strings.Cut(value, "-")
+	from, errFrom := strconv.Atoi(fromStr)
+	to, errTo := strconv.Atoi(toStr)
+	if !ok || errFrom != nil || errTo != nil || from < 0 || from > 23 || to < 0 || to > 24 {
+		return HourWindow{}, fmt.Errorf("invalid hours, use e.g. 6-22")
+	}
+	return HourWindow{From: from, To: to % 24}, nil
+}
+
+// heatingCurveConfigFor reads the current heating curve of a circuit through the features cache
+func heatingCurveConfigFor(accountID, installationID, gatewaySerial, deviceID string, circuit int) (*HeatingCurveConfig, error) {
+	if accountID == "" {
+		accountID = accountIDForInstallation(installationID)
+	}
+	token, exists := getValidAccountToken(accountID)
+	if !exists {
+		return nil, fmt.Errorf("Account not found or not authenticated")
+	}
+	features, err := fetchFeaturesWithCache(installationID, gatewaySerial, deviceID, token.AccessToken)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch features: %v", err)
+	}
+	return ReadHeatingCurveConfig(features, circuit)
+}
+
+// HandleHeatingCurveAnalysis compares the configured heating curve with the measured supply and
+// room temperatures and recommends a slope and shift. Query: installationId, gatewaySerial,
+// deviceId, accountId (default: the account of the installation), circuit (default 0),
+// from/to (YYYY-MM-DD, default: last 60 days), hours (local hours like 6-22, default all day).
+func HandleHeatingCurveAnalysis(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	installationID := r.URL.Query().Get("installationId")
+	gatewaySerial := r.URL.Query().Get("gatewaySerial")
+	deviceID := r.URL.Query().Get("deviceId")
+	if installationID == "" || gatewaySerial == "" || deviceID == "" {
+		writeConsumptionError(w, "Missing required parameters: installationId, gatewaySerial, deviceId")
+		return
+	}
+
+	circuit := 0
+	if value := r.URL.Query().Get("circuit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 || parsed > 3 {
+			writeConsumptionError(w, "invalid circuit (must be 0-3)")
+			return
+		}
+		circuit = parsed
+	}
+	window, err := parseHourWindow(r.URL.Query().Get("hours"))
+	if err != nil {
+		writeConsumptionError(w, err.Error())
+		return
+	}
+	from, to, err := parseDayRange(r, startOfDay(time.Now()).AddDate(0, 0, -defaultCurveAnalysisDays))
+	if err != nil {
+		writeConsumptionError(w, err.Error())
+		return
+	}
+	settings, err := GetDegreeDaySettings()
+	if err != nil {
+		writeConsumptionError(w, "Failed to get degree day settings: "+err.Error())
+		return
+	}
+
+	config, err := heatingCurveConfigFor(r.URL.Query().Get("accountId"), installationID, gatewaySerial, deviceID, circuit)
+	if err != nil {
+		writeConsumptionError(w, err.Error())
+		return
+	}
+
+	analysis, err := GetHeatingCurveAnalysis(installationID, gatewaySerial, deviceID, config, from, to, window, settings)
+	if err != nil {
+		writeConsumptionError(w, "Failed to analyse heating curve: "+err.Error())
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"analysis": analysis,
+	})
+}
+
+// heatingCurveApplyHandler handles POST /api/heating/curve/apply
+// Without confirm it only returns the supply temperatures of the current and the new curve;
+// with confirm the curve is set through the same command as /api/heating/curve/set.
+func heatingCurveApplyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		AccountID      string  `json:"accountId"`
+		InstallationID string  `json:"installationId"`
+		GatewaySerial  string  `json:"gatewaySerial"`
+		DeviceID       string  `json:"deviceId"`
+		Circuit        int     `json:"circuit"`
+		Shift          int     `json:"shift"`
+		Slope          float64 `json:"slope"`
+		Confirm        bool    `json:"confirm"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeConsumptionError(w, "Invalid request: "+err.Error())
+		return
+	}
+	if req.InstallationID == "" || req.GatewaySerial == "" || req.DeviceID == "" {
+		writeConsumptionError(w, "installationId, gatewaySerial, deviceId are required")
+		return
+	}
+	if req.Circuit < 0 || req.Circuit > 3 {
+		writeConsumptionError(w, "invalid circuit (must be 0-3)")
+		return
+	}
+	if req.Slope < heatingCurveSlopeMin || req.Slope > heatingCurveSlopeMax || req.Shift < heatingCurveShiftMin || req.Shift > heatingCurveShiftMax {
+		writeConsumptionError(w, fmt.Sprintf("slope must be %.1f-%.1f and shift %d-%d", heatingCurveSlopeMin, heatingCurveSlopeMax, heatingCurveShiftMin, heatingCurveShiftMax))
+		return
+	}
+	// The device only accepts whole steps of the slope, don't preview a curve it can't set
+	if steps := req.Slope / heatingCurveSlopeStep; math.Abs(steps-math.Round(steps)) > 1e-6 {
+		writeConsumptionError(w, fmt.Sprintf("slope must be a multiple of %.1f", heatingCurveSlopeStep))
+		return
+	}
+	if req.AccountID == "" {
+		req.AccountID = accountIDForInstallation(req.InstallationID)
+	}
+
+	config, err := heatingCurveConfigFor(req.AccountID, req.InstallationID, req.GatewaySerial, req.DeviceID, req.Circuit)
+	if err != nil {
+		writeConsumptionError(w, err.Error())
+		return
+	}
+	next := HeatingCurve{Slope: req.Slope, Shift: float64(req.Shift)}
+	preview := []HeatingCurveChange{}
+	for _, outside := range []float64{-10, -5, 0, 5, 10} {
+		current := config.targetSupply(config.Curve, outside)
+		target := config.targetSupply(next, outside)
+		preview = append(preview, HeatingCurveChange{
+			OutsideTemp: outside,
+			Current:     roundDegrees(current),
+			Recommended: roundDegrees(target),
+			Change:      roundDegrees(target - current),
+		})
+	}
+
+	if !req.Confirm {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"applied": false,
+			"current": config.Curve,
+			"preview": preview,
+		})
+		return
+	}
+
+	token, exists := getValidAccountToken(req.AccountID)
+	if !exists {
+		writeConsumptionError(w, "Account not found or not authenticated")
+		return
+	}
+	if err := setHeatingCurve(token, req.InstallationID, req.GatewaySerial, req.DeviceID, req.Circuit, req.Shift, req.Slope); err != nil {
+		writeConsumptionError(w, commandErrorMessage(err))
+		return
+	}
+
+	log.Printf("Heating curve of circuit %d changed from shift=%g, slope=%.1f to shift=%d, slope=%.1f for device %s (account: %s)",
+		req.Circuit, config.Curve.Shift, config.Curve.Slope, req.Shift, req.Slope, req.DeviceID, req.AccountID)
+
+	// Clear features cache to force refresh
+	featuresCacheMutex.Lock()
+	cacheKey := fmt.Sprintf("%s:%s:%s", req.InstallationID, req.GatewaySerial, req.DeviceID)
+	delete(featuresCache, cacheKey)
+	featuresCacheMutex.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"applied":  true,
+		"previous": config.Curve,
+		"preview":  preview,
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// importMaxMemory is the part of an upload kept in memory; larger files are buffered on disk
+const importMaxMemory = 32 << 20
+
+// importHandler handles POST /api/import (multipart form)
+// Fields: spec (ImportSpec as JSON), file (CSV or JSON). dryRun=true in the query only reports.
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	writeError := func(status int, msg string) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   msg,
+		})
+	}
+
+	if r.Method != http.MethodPost {
+		writeError(http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !dbInitialized {
+		writeError(http.StatusServiceUnavailable, "Database is not initialized")
+		return
+	}
+
+	if err := r.ParseMultipartForm(importMaxMemory); err != nil {
+		writeError(http.StatusBadRequest, "Expected multipart form with spec and file: "+err.Error())
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	var spec ImportSpec
+	if err := json.Unmarshal([]byte(r.FormValue("spec")), &spec); err != nil {
+		writeError(http.StatusBadRequest, "Invalid spec: "+err.Error())
+		return
+	}
+	if r.URL.Query().Get("dryRun") == "true" {
+		spec.DryRun = true
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(http.StatusBadRequest, "Missing file: "+err.Error())
+		return
+	}
+	defer file.Close()
+
+	report, err := RunImport(file, spec)
+	if err != nil {
+		writeError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !report.DryRun {
+		log.Printf("Imported %s from %s: %d inserted, %d duplicates, %d rows skipped",
+			report.Kind, header.Filename, report.Inserted, report.Duplicates, report.RowsSkipped)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"report":  report,
+	})
+}
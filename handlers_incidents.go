@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// incidentsHandler handles GET /api/incidents
+// Returns fault incidents (activation to clearing) and per-code statistics
+// (occurrences, downtime, MTTR, MTBF) for the selected devices and time range
+func incidentsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	q := r.URL.Query()
+
+	writeError := func(status int, msg string) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(IncidentsResponse{
+			Success:    false,
+			Error:      msg,
+			Incidents:  []Incident{},
+			Statistics: []IncidentCodeStats{},
+		})
+	}
+
+	if !dbInitialized {
+		writeError(http.StatusServiceUnavailable, "Event archive is not enabled")
+		return
+	}
+
+	opts := IncidentQueryOptions{
+		InstallationID: q.Get("installationId"),
+		GatewaySerial:  q.Get("gatewaySerial"),
+		DeviceID:       q.Get("deviceId"),
+	}
+	for _, code := range strings.Split(q.Get("errorCode"), ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			opts.ErrorCodes = append(opts.ErrorCodes, code)
+		}
+	}
+
+	if openStr := q.Get("open"); openStr != "" {
+		open, err := strconv.ParseBool(openStr)
+		if err != nil {
+			writeError(http.StatusBadRequest, "Invalid open value. Use true or false")
+			return
+		}
+		opts.Open = &open
+	}
+
+	// Time range: days=N (default 365) or from/to as YYYY-MM-DD
+	days := 365
+	if daysStr := q.Get("days"); daysStr != "" {
+		d, err := strconv.Atoi(daysStr)
+		if err != nil || d < 1 {
+			writeError(http.StatusBadRequest, "Invalid days value")
+			return
+		}
+		days = d
+	}
+	opts.StartTime = time.Now().AddDate(0, 0, -days)
+
+	if fromStr := q.Get("from"); fromStr != "" {
+		from, err := time.ParseInLocation("2006-01-02", fromStr, DefaultLocation)
+		if err != nil {
+			writeError(http.StatusBadRequest, "Invalid from date format. Use YYYY-MM-DD")
+			return
+		}
+		opts.StartTime = from
+	}
+	if toStr := q.Get("to"); toStr != "" {
+		to, err := time.ParseInLocation("2006-01-02", toStr, DefaultLocation)
+		if err != nil {
+			writeError(http.StatusBadRequest, "Invalid to date format. Use YYYY-MM-DD")
+			return
+		}
+		opts.EndTime = to.Add(24*time.Hour - time.Second)
+	}
+
+	incidents, err := GetIncidents(opts)
+	if err != nil {
+		writeError(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Statistics cover all matching incidents, the list can be shortened
+	stats := computeIncidentStats(incidents)
+	if limitStr := q.Get("limit"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit >= 0 && limit < len(incidents) {
+			incidents = incidents[:limit]
+		}
+	}
+
+	json.NewEncoder(w).Encode(IncidentsResponse{
+		Success:    true,
+		Incidents:  incidents,
+		Statistics: stats,
+	})
+}
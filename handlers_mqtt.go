@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// mqttSettingsGetHandler handles GET /api/mqtt/settings
+func mqttSettingsGetHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := GetMQTTSettings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	masked := *settings
+	if masked.Password != "" {
+		masked.Password = settingsSecretMask
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(masked)
+}
+
+// mqttSettingsSetHandler handles POST /api/mqtt/settings/set
+// Saves the settings and reconnects the publisher
+func mqttSettingsSetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var settings MQTTSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	oldSettings, err := GetMQTTSettings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if settings.Password == settingsSecretMask {
+		settings.Password = oldSettings.Password
+	}
+
+	if err := validateMQTTSettings(&settings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := SetMQTTSettings(&settings); err != nil {
+		http.Error(w, "Failed to save settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := RestartMQTTPublisher(); err != nil {
+		log.Printf("Warning: failed to restart MQTT publisher: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "MQTT settings updated successfully",
+	})
+}
+
+// mqttStatusHandler handles GET /api/mqtt/status
+func mqttStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GetMQTTStatus())
+}
@@ -441,7 +441,7 @@ func setRoomTemperatureHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Build API URL
 	// Format: /installations/{id}/gateways/{gateway}/devices/RoomControl-1/features/rooms.{roomId}.temperature.levels.normal.perceived/commands/setTemperature
-	url := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/features/installations/%s/gateways/%s/devices/RoomControl-1/features/rooms.%d.temperature.levels.normal.perceived/commands/setTemperature",
+	url := apiBaseURL + fmt.Sprintf("/iot/v2/features/installations/%s/gateways/%s/devices/RoomControl-1/features/rooms.%d.temperature.levels.normal.perceived/commands/setTemperature",
 		req.InstallationID, req.GatewaySerial, req.RoomID)
 
 	// Create request body
@@ -472,7 +472,7 @@ func setRoomTemperatureHandler(w http.ResponseWriter, r *http.Request) {
 	apiReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
 	apiReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(apiReq)
+	resp, err := doAPIRequest(apiReq)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -412,7 +413,7 @@ func trvSetTemperatureHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate temperature range (typical range for TRVs)
-	if req.Temperature < 5 || req.Temperature > 30 {
+	if !validTRVTemperature(req.Temperature) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -443,57 +444,11 @@ func trvSetTemperatureHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Build API URL (ZigBee devices use v1 API)
-	url := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/trv.temperature/commands/setTargetTemperature",
-		req.InstallationID, req.GatewaySerial, req.DeviceID)
-
-	// Prepare request body
-	commandBody := map[string]interface{}{
-		"temperature": req.Temperature,
-	}
-
-	bodyBytes, err := json.Marshal(commandBody)
-	if err != nil {
+	if err := setTRVTemperature(token, req.InstallationID, req.GatewaySerial, req.DeviceID, req.Temperature); err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   "Failed to marshal request: " + err.Error(),
-		})
-		return
-	}
-
-	// Create HTTP request
-	httpReq, err := NewRequest("POST", url, strings.NewReader(string(bodyBytes)))
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to create request: " + err.Error(),
-		})
-		return
-	}
-
-	httpReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	// Execute request
-	client := &http.Client{}
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "API request failed: " + err.Error(),
-		})
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   fmt.Sprintf("API returned status %d", resp.StatusCode),
+			"error":   featureCommandErrorMessage(err),
 		})
 		return
 	}
@@ -512,6 +467,38 @@ func trvSetTemperatureHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// validTRVTemperature reports whether a target temperature lies in the typical range for TRVs
+func validTRVTemperature(temperature float64) bool {
+	return temperature >= 5 && temperature <= 30
+}
+
+// setTRVTemperature sends the setTargetTemperature command of a TRV to the Viessmann API
+func setTRVTemperature(token *AccountToken, installationID, gatewaySerial, deviceID string, temperature float64) error {
+	if !validTRVTemperature(temperature) {
+		return fmt.Errorf("temperature must be between 5°C and 30°C")
+	}
+
+	return sendFeatureCommand(token, installationID, gatewaySerial, deviceID,
+		"trv.temperature", "setTargetTemperature", map[string]interface{}{"temperature": temperature})
+}
+
+// featureCommandErrorMessage maps an error of sendFeatureCommand to the message
+// reported by the smart climate and ventilation handlers
+func featureCommandErrorMessage(err error) string {
+	var statusErr *commandStatusError
+	switch {
+	case errors.Is(err, errCommandMarshal):
+		return "Failed to marshal request" + strings.TrimPrefix(err.Error(), errCommandMarshal.Error())
+	case errors.Is(err, errCommandRequest):
+		return "Failed to create request" + strings.TrimPrefix(err.Error(), errCommandRequest.Error())
+	case errors.Is(err, errCommandCall):
+		return "API request failed" + strings.TrimPrefix(err.Error(), errCommandCall.Error())
+	case errors.As(err, &statusErr):
+		return fmt.Sprintf("API returned status %d", statusErr.StatusCode)
+	}
+	return err.Error()
+}
+
 // DeviceSetNameRequest represents the request to set device name
 type DeviceSetNameRequest struct {
 	AccountID      string `json:"accountId"`
@@ -644,7 +631,7 @@ func childLockToggleHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Build API URL (ZigBee devices use v1 API)
-	url := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/trv.childLock/commands/%s",
+	url := apiBaseURL + fmt.Sprintf("/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/trv.childLock/commands/%s",
 		req.InstallationID, req.GatewaySerial, req.DeviceID, command)
 
 	// Create HTTP request (empty body for these commands)
@@ -662,8 +649,7 @@ func childLockToggleHandler(w http.ResponseWriter, r *http.Request) {
 	httpReq.Header.Set("Content-Type", "application/json")
 
 	// Execute request
-	client := &http.Client{}
-	resp, err := client.Do(httpReq)
+	resp, err := doAPIRequest(httpReq)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// maskSnapshotSinkSecrets returns a copy of the settings with token and password hidden
+func maskSnapshotSinkSecrets(settings *SnapshotSinkSettings) SnapshotSinkSettings {
+	masked := *settings
+	if masked.Token != "" {
+		masked.Token = settingsSecretMask
+	}
+	if masked.Password != "" {
+		masked.Password = settingsSecretMask
+	}
+	return masked
+}
+
+// snapshotSinkSettingsGetHandler handles GET /api/snapshot-sink/settings
+func snapshotSinkSettingsGetHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := GetSnapshotSinkSettings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(maskSnapshotSinkSecrets(settings))
+}
+
+// snapshotSinkSettingsSetHandler handles POST /api/snapshot-sink/settings/set
+// Saves the settings and restarts the sink
+func snapshotSinkSettingsSetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var settings SnapshotSinkSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	oldSettings, err := GetSnapshotSinkSettings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if settings.Token == settingsSecretMask {
+		settings.Token = oldSettings.Token
+	}
+	if settings.Password == settingsSecretMask {
+		settings.Password = oldSettings.Password
+	}
+
+	if err := validateSnapshotSinkSettings(&settings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := SetSnapshotSinkSettings(&settings); err != nil {
+		http.Error(w, "Failed to save settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := RestartSnapshotSink(); err != nil {
+		log.Printf("Warning: failed to restart snapshot sink: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Snapshot sink settings updated successfully",
+	})
+}
+
+// snapshotSinkStatusHandler handles GET /api/snapshot-sink/status
+func snapshotSinkStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GetSnapshotSinkStatus())
+}
+
+// snapshotSinkBackfillHandler handles POST /api/snapshot-sink/backfill?from=YYYY-MM-DD&to=YYYY-MM-DD
+// Streams historical snapshots to the sink in the background; progress is shown in the status
+func snapshotSinkBackfillHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	writeError := func(status int, msg string) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   msg,
+		})
+	}
+
+	if r.Method != http.MethodPost {
+		writeError(http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !dbInitialized {
+		writeError(http.StatusServiceUnavailable, "Database is not initialized")
+		return
+	}
+
+	settings, err := GetSnapshotSinkSettings()
+	if err != nil {
+		writeError(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !settings.Enabled {
+		writeError(http.StatusBadRequest, "Snapshot sink is not enabled")
+		return
+	}
+
+	from, to, err := parseBackfillRange(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		writeError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := sink.startBackfill(settings, from, to); err != nil {
+		writeError(http.StatusConflict, err.Error())
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Backfill started",
+		"from":    from.Format("2006-01-02"),
+		"to":      to.Format("2006-01-02"),
+	})
+}
+
+// parseBackfillRange parses optional YYYY-MM-DD bounds, defaulting to all logged snapshots
+func parseBackfillRange(fromStr, toStr string) (time.Time, time.Time, error) {
+	from, to, err := getSnapshotTimeRange()
+	if err != nil {
+		return from, to, err
+	}
+
+	if fromStr != "" {
+		if from, err = time.ParseInLocation("2006-01-02", fromStr, DefaultLocation); err != nil {
+			return from, to, fmt.Errorf("invalid from date, use YYYY-MM-DD")
+		}
+	}
+	if toStr != "" {
+		if to, err = time.ParseInLocation("2006-01-02", toStr, DefaultLocation); err != nil {
+			return from, to, fmt.Errorf("invalid to date, use YYYY-MM-DD")
+		}
+	}
+	if to.Before(from) {
+		return from, to, fmt.Errorf("to must not be before from")
+	}
+	return from, to, nil
+}
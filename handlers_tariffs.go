@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TariffPriceStatus describes the stored prices of a dynamic tariff
+type TariffPriceStatus struct {
+	Tariff    string `json:"tariff"`
+	LastFetch string `json:"lastFetch,omitempty"`
+	LastError string `json:"lastError,omitempty"`
+	PricedTo  string `json:"pricedTo,omitempty"` // start of the last stored hour
+}
+
+// findTariff returns the tariff with the given name
+func findTariff(settings *TariffSettings, name string) (Tariff, bool) {
+	for _, t := range settings.Tariffs {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Tariff{}, false
+}
+
+// handleTariffSettings handles GET /api/tariffs/settings
+// Returns the tariffs and the price status of dynamic tariffs
+func handleTariffSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	settings, err := GetTariffSettings()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	status := []TariffPriceStatus{}
+	for _, t := range settings.Tariffs {
+		if t.Type != TariffDynamic {
+			continue
+		}
+		s := TariffPriceStatus{Tariff: t.Name}
+		lastFetch, lastError := tariffPriceStatus(t.Name)
+		if !lastFetch.IsZero() {
+			s.LastFetch = lastFetch.UTC().Format(time.RFC3339)
+		}
+		s.LastError = lastError
+		if dbInitialized {
+			now := time.Now()
+			if prices, err := GetElectricityPrices(t.Name, now.Add(-time.Hour), now.AddDate(0, 0, 3)); err == nil && len(prices) > 0 {
+				s.PricedTo = prices[len(prices)-1].HourStart.UTC().Format(time.RFC3339)
+			}
+		}
+		status = append(status, s)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tariffs":      settings.Tariffs,
+		"priceStatus":  status,
+		"defaultPrice": defaultElectricityPrice,
+	})
+}
+
+// handleSetTariffSettings handles POST /api/tariffs/settings/set
+func handleSetTariffSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var settings TariffSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if settings.Tariffs == nil {
+		settings.Tariffs = []Tariff{}
+	}
+
+	if err := validateTariffSettings(&settings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := SetTariffSettings(&settings); err != nil {
+		http.Error(w, "Failed to save settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Tariff settings updated successfully",
+	})
+}
+
+// handleTariffPrices handles GET /api/tariffs/prices
+// Query: tariff (required), from/to (YYYY-MM-DD, inclusive, default today and tomorrow)
+func handleTariffPrices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("tariff")
+	if name == "" {
+		http.Error(w, "tariff parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	from := startOfDay(time.Now())
+	to := from.AddDate(0, 0, 2)
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		t, err := time.ParseInLocation("2006-01-02", fromStr, DefaultLocation)
+		if err != nil {
+			http.Error(w, "Invalid from date format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		from, to = t, t.AddDate(0, 0, 1)
+	}
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		t, err := time.ParseInLocation("2006-01-02", toStr, DefaultLocation)
+		if err != nil || t.Before(from) {
+			http.Error(w, "Invalid to date. Use YYYY-MM-DD, not before from", http.StatusBadRequest)
+			return
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+
+	prices, err := GetElectricityPrices(name, from, to)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch prices: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if prices == nil {
+		prices = []ElectricityPrice{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tariff": name,
+		"from":   from.Format(time.RFC3339),
+		"to":     to.Format(time.RFC3339),
+		"prices": prices,
+	})
+}
+
+// handleImportTariffPrices handles POST /api/tariffs/prices/import
+// Query: tariff (a dynamic tariff), unit (default: the tariff's sourceUnit), decimalComma=true.
+// Body: multipart form with a file field, or the CSV/JSON data itself.
+func handleImportTariffPrices(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	writeError := func(status int, msg string) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   msg,
+		})
+	}
+
+	if r.Method != http.MethodPost {
+		writeError(http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !dbInitialized {
+		writeError(http.StatusServiceUnavailable, "Database is not initialized")
+		return
+	}
+
+	settings, err := GetTariffSettings()
+	if err != nil {
+		writeError(http.StatusInternalServerError, "Failed to get settings: "+err.Error())
+		return
+	}
+	tariff, ok := findTariff(settings, r.URL.Query().Get("tariff"))
+	if !ok || tariff.Type != TariffDynamic {
+		writeError(http.StatusBadRequest, "tariff must name a dynamic tariff")
+		return
+	}
+	unit := tariff.SourceUnit
+	if u := r.URL.Query().Get("unit"); u != "" {
+		unit = u
+	}
+
+	var body io.Reader = r.Body
+	source := "upload"
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(importMaxMemory); err != nil {
+			writeError(http.StatusBadRequest, "Invalid multipart form: "+err.Error())
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			writeError(http.StatusBadRequest, "Missing file: "+err.Error())
+			return
+		}
+		defer file.Close()
+		body, source = file, header.Filename
+	}
+
+	report, err := ImportElectricityPrices(body, tariff.Name, unit, source, r.URL.Query().Get("decimalComma") == "true")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+			"report":  report,
+		})
+		return
+	}
+
+	log.Printf("Imported %d hourly prices for tariff %s from %s", report.Hours, tariff.Name, source)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"report":  report,
+	})
+}
+
+// handleRefreshTariffPrices handles POST /api/tariffs/prices/refresh?tariff=...
+// Fetches the prices of a dynamic tariff from its source URL now
+func handleRefreshTariffPrices(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	settings, err := GetTariffSettings()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+	tariff, ok := findTariff(settings, r.URL.Query().Get("tariff"))
+	if !ok || tariff.Type != TariffDynamic || tariff.SourceURL == "" {
+		http.Error(w, "tariff must name a dynamic tariff with a source URL", http.StatusBadRequest)
+		return
+	}
+
+	report, err := FetchElectricityPrices(tariff)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+			"report":  report,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"report":  report,
+	})
+}
@@ -35,7 +35,14 @@ func handleSetTemperatureLogSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var settings TemperatureLogSettings
+	// Start from the stored settings so clients that omit the rollup retention keep it
+	current, err := GetTemperatureLogSettings()
+	if err != nil {
+		log.Printf("Error getting temperature log settings: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to get settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+	settings := *current
 	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
@@ -52,13 +59,23 @@ func handleSetTemperatureLogSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Rollups are built from the finer level, so they must be kept at least as long (0 = forever)
+	if settings.HourlyRetentionDays != 0 && settings.HourlyRetentionDays < settings.RetentionDays {
+		http.Error(w, "Hourly retention must be 0 (forever) or at least the raw retention", http.StatusBadRequest)
+		return
+	}
+	if settings.DailyRetentionDays != 0 && (settings.HourlyRetentionDays == 0 || settings.DailyRetentionDays < settings.HourlyRetentionDays) {
+		http.Error(w, "Daily retention must be 0 (forever) or at least the hourly retention", http.StatusBadRequest)
+		return
+	}
+
 	// Use default database path if not provided
 	if settings.DatabasePath == "" {
 		settings.DatabasePath = filepath.Join(getDefaultConfigDir(), "viessmann_events.db")
 	}
 
 	// Save settings
-	err := SetTemperatureLogSettings(&settings)
+	err = SetTemperatureLogSettings(&settings)
 	if err != nil {
 		log.Printf("Error saving temperature log settings: %v", err)
 		http.Error(w, fmt.Sprintf("Failed to save settings: %v", err), http.StatusInternalServerError)
@@ -104,20 +121,29 @@ func handleTemperatureLogStats(w http.ResponseWriter, r *http.Request) {
 		totalSnapshots = 0
 	}
 
+	hourlyRollups, dailyRollups, err := GetTemperatureRollupCounts()
+	if err != nil {
+		log.Printf("Error getting rollup counts: %v", err)
+	}
+
 	usage10min, usage24hr := getAPIUsage()
 	limit10min, limit24hr := GetAPIRateLimits()
 
 	stats := TemperatureLogStatsResponse{
-		Enabled:          settings.Enabled,
-		SchedulerRunning: IsTemperatureSchedulerRunning(),
-		TotalSnapshots:   totalSnapshots,
-		SampleInterval:   settings.SampleInterval,
-		RetentionDays:    settings.RetentionDays,
-		DatabasePath:     settings.DatabasePath,
-		APIUsage10Min:    usage10min,
-		APIUsage24Hr:     usage24hr,
-		APILimit10Min:    limit10min,
-		APILimit24Hr:     limit24hr,
+		Enabled:             settings.Enabled,
+		SchedulerRunning:    IsTemperatureSchedulerRunning(),
+		TotalSnapshots:      totalSnapshots,
+		HourlyRollups:       hourlyRollups,
+		DailyRollups:        dailyRollups,
+		SampleInterval:      settings.SampleInterval,
+		RetentionDays:       settings.RetentionDays,
+		HourlyRetentionDays: settings.HourlyRetentionDays,
+		DailyRetentionDays:  settings.DailyRetentionDays,
+		DatabasePath:        settings.DatabasePath,
+		APIUsage10Min:       usage10min,
+		APIUsage24Hr:        usage24hr,
+		APILimit10Min:       limit10min,
+		APILimit24Hr:        limit24hr,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -125,6 +151,9 @@ func handleTemperatureLogStats(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleTemperatureLogData handles GET /api/temperature-log/data
+// resolution=auto (default) returns raw snapshots for short ranges and hourly or daily
+// rollups for longer or older ranges; raw, hour and day force a resolution.
+// Devices other than the heating device "0" return their logging profile fields per timestamp.
 func handleTemperatureLogData(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -194,23 +223,96 @@ func handleTemperatureLogData(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Fetch data from database
-	snapshots, err := GetTemperatureSnapshots(installationID, gatewayID, deviceID, startTime, endTime, limit)
-	if err != nil {
-		log.Printf("Error fetching temperature snapshots: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to fetch data: %v", err), http.StatusInternalServerError)
+	// Ventilation, storage and SmartClimate devices are logged into the feature history
+	if deviceID != "" && (deviceID != "0" || gatewayID != "") {
+		class := lookupDeviceLogClass(installationID, gatewayID, deviceID)
+		if class != DeviceClassHeating && (deviceID != "0" || class != "") {
+			handleDeviceHistoryData(w, r, installationID, gatewayID, deviceID, class, startTime, endTime, limit)
+			return
+		}
+	}
+
+	resolution := r.URL.Query().Get("resolution")
+	switch resolution {
+	case "", "auto":
+		resolution, err = TemperatureDataResolution(startTime, endTime)
+		if err != nil {
+			log.Printf("Error choosing temperature data resolution: %v", err)
+			http.Error(w, fmt.Sprintf("Failed to fetch data: %v", err), http.StatusInternalServerError)
+			return
+		}
+	case ResolutionRaw, ResolutionHour, ResolutionDay:
+	default:
+		http.Error(w, "Invalid resolution parameter (auto, raw, hour or day)", http.StatusBadRequest)
 		return
 	}
 
+	// Fetch data from database
+	var data interface{}
+	var count int
+	if resolution == ResolutionRaw {
+		snapshots, err := GetTemperatureSnapshots(installationID, gatewayID, deviceID, startTime, endTime, limit)
+		if err != nil {
+			log.Printf("Error fetching temperature snapshots: %v", err)
+			http.Error(w, fmt.Sprintf("Failed to fetch data: %v", err), http.StatusInternalServerError)
+			return
+		}
+		data, count = snapshots, len(snapshots)
+	} else {
+		rollups, err := GetTemperatureRollups(resolution, installationID, gatewayID, deviceID, startTime, endTime, limit)
+		if err != nil {
+			log.Printf("Error fetching temperature rollups: %v", err)
+			http.Error(w, fmt.Sprintf("Failed to fetch data: %v", err), http.StatusInternalServerError)
+			return
+		}
+		data, count = rollups, len(rollups)
+	}
+
 	// Return data as JSON
 	w.Header().Set("Content-Type", "application/json")
 	response := map[string]interface{}{
 		"installationId": installationID,
 		"startTime":      startTime.Format(time.RFC3339),
 		"endTime":        endTime.Format(time.RFC3339),
-		"count":          len(snapshots),
+		"resolution":     resolution,
+		"count":          count,
 		"limit":          limit,
-		"data":           snapshots,
+		"data":           data,
 	}
 	json.NewEncoder(w).Encode(response)
 }
+
+// handleDeviceHistoryData answers /api/temperature-log/data for non-heating devices
+func handleDeviceHistoryData(w http.ResponseWriter, r *http.Request, installationID, gatewayID, deviceID, class string, startTime, endTime time.Time, limit int) {
+	resolution := r.URL.Query().Get("resolution")
+	switch resolution {
+	case "", "auto":
+		resolution = DeviceHistoryResolution(startTime, endTime)
+	case ResolutionRaw, ResolutionHour, ResolutionDay:
+	default:
+		http.Error(w, "Invalid resolution parameter (auto, raw, hour or day)", http.StatusBadRequest)
+		return
+	}
+
+	history, err := GetDeviceHistory(resolution, installationID, gatewayID, deviceID, startTime, endTime, limit)
+	if err != nil {
+		log.Printf("Error fetching device history: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to fetch data: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"installationId": installationID,
+		"deviceId":       deviceID,
+		"deviceClass":    class,
+		"startTime":      startTime.Format(time.RFC3339),
+		"endTime":        endTime.Format(time.RFC3339),
+		"resolution":     resolution,
+		"fields":         history.Fields,
+		"units":          history.Units,
+		"count":          len(history.Rows),
+		"limit":          limit,
+		"data":           history.Rows,
+	})
+}
@@ -599,15 +599,7 @@ func vitoventOperatingModeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate mode
-	validModes := []string{"permanent", "ventilation", "sensorOverride", "sensorDriven"}
-	modeValid := false
-	for _, m := range validModes {
-		if req.Mode == m {
-			modeValid = true
-			break
-		}
-	}
-	if !modeValid {
+	if !containsString(ventilationModes, req.Mode) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -638,57 +630,11 @@ func vitoventOperatingModeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Build API URL for ventilation device
-	url := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/ventilation.operating.modes.active/commands/setMode",
-		req.InstallationID, req.GatewaySerial, req.DeviceID)
-
-	// Prepare request body
-	commandBody := map[string]interface{}{
-		"mode": req.Mode,
-	}
-
-	bodyBytes, err := json.Marshal(commandBody)
-	if err != nil {
+	if err := setVentilationMode(token, req.InstallationID, req.GatewaySerial, req.DeviceID, req.Mode); err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   "Failed to marshal request: " + err.Error(),
-		})
-		return
-	}
-
-	// Create HTTP request
-	httpReq, err := NewRequest("POST", url, strings.NewReader(string(bodyBytes)))
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to create request: " + err.Error(),
-		})
-		return
-	}
-
-	httpReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	// Execute request
-	client := &http.Client{}
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "API request failed: " + err.Error(),
-		})
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   fmt.Sprintf("API returned status %d", resp.StatusCode),
+			"error":   featureCommandErrorMessage(err),
 		})
 		return
 	}
@@ -707,6 +653,19 @@ func vitoventOperatingModeHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// ventilationModes lists the ventilation operating modes accepted by the setMode command
+var ventilationModes = []string{"permanent", "ventilation", "sensorOverride", "sensorDriven"}
+
+// setVentilationMode sends the setMode command of the ventilation operating mode to the Viessmann API
+func setVentilationMode(token *AccountToken, installationID, gatewaySerial, deviceID, mode string) error {
+	if !containsString(ventilationModes, mode) {
+		return fmt.Errorf("invalid mode: %s", mode)
+	}
+
+	return sendFeatureCommand(token, installationID, gatewaySerial, deviceID,
+		"ventilation.operating.modes.active", "setMode", map[string]interface{}{"mode": mode})
+}
+
 // VitoventQuickModeRequest represents the request to activate/deactivate a quick mode
 type VitoventQuickModeRequest struct {
 	AccountID      string `json:"accountId"`
@@ -781,7 +740,7 @@ func vitoventQuickModeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Build API URL
-	url := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/ventilation.quickmodes.%s/commands/%s",
+	url := apiBaseURL + fmt.Sprintf("/iot/v2/features/installations/%s/gateways/%s/devices/%s/features/ventilation.quickmodes.%s/commands/%s",
 		req.InstallationID, req.GatewaySerial, req.DeviceID, req.Mode, command)
 
 	// Create HTTP request (empty body for these commands)
@@ -799,8 +758,7 @@ func vitoventQuickModeHandler(w http.ResponseWriter, r *http.Request) {
 	httpReq.Header.Set("Content-Type", "application/json")
 
 	// Execute request
-	client := &http.Client{}
-	resp, err := client.Do(httpReq)
+	resp, err := doAPIRequest(httpReq)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
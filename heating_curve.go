@@ -0,0 +1,646 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Limits of the setCurve command of a heating circuit
+const (
+	heatingCurveSlopeMin  = 0.2
+	heatingCurveSlopeMax  = 3.5
+	heatingCurveSlopeStep = 0.1
+	heatingCurveShiftMin  = -13
+	heatingCurveShiftMax  = 40
+)
+
+const (
+	defaultCurveRoomSetpoint = 20.0 // °C, if the circuit has no normal program temperature
+	defaultCurveAnalysisDays = 60
+	curveRuntimeShare        = 0.5 // share of an hour the compressor has to run for its supply temperature to count
+	minCurveHours            = 24  // heating hours needed to fit the effective curve
+	minCurveOutsideSpread    = 3.0 // K between the coldest and the warmest heating hour of a fit
+	curveBinWidth            = 5.0 // K, outside temperature bins of the room analysis
+	minCurveBinHours         = 6   // hours a room needs in a bin
+	minCurveSlopeSpread      = 8.0 // K between the outside temperatures of the bins to change the slope
+	minCurveRoomLift         = 3.0 // K, bins with rooms barely warmer than outside say nothing about the curve
+	curveRoomTolerance       = 0.5 // K, rooms within this deviation from their setpoint are fine
+	curveElectricityPerK     = 2.5 // %, rule of thumb for the electricity saved per Kelvin lower supply temperature
+	curveOutsideMin          = -20 // °C, range of the curve points
+	curveOutsideMax          = 20
+)
+
+// Room states of the heating curve analysis
+const (
+	RoomOK          = "ok"
+	RoomOverheated  = "overheated"
+	RoomUnderheated = "underheated"
+	RoomNoData      = "insufficient_data" // fewer hours than needed for a statement
+)
+
+// Sources of room temperatures
+const (
+	RoomSourceRoomControl   = "room_control"   // rooms.N of a room control
+	RoomSourceClimateSensor = "climate_sensor" // Zigbee climate sensor, compared with the circuit setpoint
+)
+
+// heatingCurveShape returns how far a curve with slope 1 and shift 0 lifts the supply
+// temperature above the room setpoint at the given outside temperature
+func heatingCurveShape(roomSetpoint, outside float64) float64 {
+	dar := outside - roomSetpoint
+	return -dar * (1.4347 + 0.021*dar + 247.9e-6*dar*dar)
+}
+
+// heatingCurveSupplyTemp returns the target supply temperature of a Viessmann
+// heating curve for the given slope (Neigung), shift (Niveau), room setpoint and
+// outside temperature
+func heatingCurveSupplyTemp(slope, shift, roomSetpoint, outside float64) float64 {
+	return roomSetpoint + shift + slope*heatingCurveShape(roomSetpoint, outside)
+}
+
+// HeatingCurve is the slope (Neigung) and shift (Niveau) of a heating circuit
+type HeatingCurve struct {
+	Slope float64 `json:"slope"`
+	Shift float64 `json:"shift"`
+}
+
+// HeatingCurveConfig is the configured curve of a circuit with the setpoint and limits it works with
+type HeatingCurveConfig struct {
+	Circuit      int          `json:"circuit"`
+	Curve        HeatingCurve `json:"curve"`
+	RoomSetpoint float64      `json:"room_setpoint"`        // °C, temperature of the normal program
+	MinSupply    *float64     `json:"min_supply,omitempty"` // °C, temperature levels of the circuit
+	MaxSupply    *float64     `json:"max_supply,omitempty"`
+}
+
+// targetSupply returns the supply temperature a curve asks for, limited by the temperature levels
+func (c *HeatingCurveConfig) targetSupply(curve HeatingCurve, outside float64) float64 {
+	target := heatingCurveSupplyTemp(curve.Slope, curve.Shift, c.RoomSetpoint, outside)
+	if c.MinSupply != nil && target < *c.MinSupply {
+		target = *c.MinSupply
+	}
+	if c.MaxSupply != nil && target > *c.MaxSupply {
+		target = *c.MaxSupply
+	}
+	return target
+}
+
+// limited reports whether the temperature levels cut the configured curve at an outside temperature
+func (c *HeatingCurveConfig) limited(outside float64) bool {
+	return c.targetSupply(c.Curve, outside) != heatingCurveSupplyTemp(c.Curve.Slope, c.Curve.Shift, c.RoomSetpoint, outside)
+}
+
+// featureNumber reads a numeric property of a raw feature
+func featureNumber(features *DeviceFeatures, feature, property string) (float64, bool) {
+	for _, f := range features.RawFeatures {
+		if f.Feature != feature {
+			continue
+		}
+		if prop, ok := f.Properties[property].(map[string]interface{}); ok {
+			if value, ok := prop["value"].(float64); ok {
+				return value, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// ReadHeatingCurveConfig reads the heating curve, normal setpoint and temperature levels of a circuit
+func ReadHeatingCurveConfig(features *DeviceFeatures, circuit int) (*HeatingCurveConfig, error) {
+	prefix := fmt.Sprintf("heating.circuits.%d", circuit)
+	config := &HeatingCurveConfig{Circuit: circuit, RoomSetpoint: defaultCurveRoomSetpoint}
+
+	slope, okSlope := featureNumber(features, prefix+".heating.curve", "slope")
+	shift, okShift := featureNumber(features, prefix+".heating.curve", "shift")
+	if !okSlope || !okShift {
+		return nil, fmt.Errorf("heating circuit %d has no heating curve", circuit)
+	}
+	config.Curve = HeatingCurve{Slope: slope, Shift: shift}
+
+	if setpoint, ok := featureNumber(features, prefix+".operating.programs.normal", "temperature"); ok {
+		config.RoomSetpoint = setpoint
+	}
+	if min, ok := featureNumber(features, prefix+".temperature.levels", "min"); ok {
+		config.MinSupply = &min
+	}
+	if max, ok := featureNumber(features, prefix+".temperature.levels", "max"); ok {
+		config.MaxSupply = &max
+	}
+	return config, nil
+}
+
+// HourWindow limits an analysis to the local hours [From, To); From == To is the whole day
+type HourWindow struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// contains reports whether the local hour of t lies in the window; windows may wrap midnight
+func (w HourWindow) contains(t time.Time) bool {
+	h := t.In(DefaultLocation).Hour()
+	switch {
+	case w.From == w.To:
+		return true
+	case w.From < w.To:
+		return h >= w.From && h < w.To
+	default:
+		return h >= w.From || h < w.To
+	}
+}
+
+// circuitSupplyTemp returns the supply temperature of a heating circuit
+func circuitSupplyTemp(s *TemperatureSnapshot, circuit int) *float64 {
+	switch circuit {
+	case 0:
+		return s.HeatingCircuit0SupplyTemp
+	case 1:
+		return s.HeatingCircuit1SupplyTemp
+	case 2:
+		return s.HeatingCircuit2SupplyTemp
+	case 3:
+		return s.HeatingCircuit3SupplyTemp
+	}
+	return nil
+}
+
+// HeatingCurvePoint compares the curves at one outside temperature
+type HeatingCurvePoint struct {
+	OutsideTemp    float64  `json:"outside_temp"`
+	Configured     float64  `json:"configured"`
+	Effective      *float64 `json:"effective,omitempty"` // fitted to the measured supply temperatures
+	Recommended    *float64 `json:"recommended,omitempty"`
+	MeasuredSupply *float64 `json:"measured_supply,omitempty"` // mean of the heating hours within ±0.5 K
+	Hours          int      `json:"hours"`
+}
+
+// RoomCurveBin is the mean deviation of a room from its setpoint in one outside temperature bin
+type RoomCurveBin struct {
+	OutsideFrom        float64  `json:"outside_from"`
+	OutsideTo          float64  `json:"outside_to"`
+	MeanOutsideTemp    float64  `json:"mean_outside_temp"`
+	MeanRoomTemp       float64  `json:"mean_room_temp"`
+	Setpoint           float64  `json:"setpoint"`
+	Deviation          float64  `json:"deviation"` // K, room minus setpoint
+	Hours              int      `json:"hours"`
+	Status             string   `json:"status"`
+	PredictedDeviation *float64 `json:"predicted_deviation,omitempty"` // with the recommended curve
+}
+
+// RoomCurveAnalysis is how warm one room got at the different outside temperatures
+type RoomCurveAnalysis struct {
+	GatewayID string         `json:"gateway_id"`
+	DeviceID  string         `json:"device_id"`
+	Room      string         `json:"room,omitempty"` // room index of a room control
+	Source    string         `json:"source"`
+	Hours     int            `json:"hours"`
+	Deviation float64        `json:"deviation"` // K, mean over the bins with enough hours
+	Status    string         `json:"status"`
+	Bins      []RoomCurveBin `json:"bins"`
+}
+
+// HeatingCurveChange is the target supply temperature of the current and the recommended curve
+type HeatingCurveChange struct {
+	OutsideTemp float64 `json:"outside_temp"`
+	Current     float64 `json:"current"`
+	Recommended float64 `json:"recommended"`
+	Change      float64 `json:"change"`
+}
+
+// HeatingCurveRecommendation is a new slope and shift with its predicted effect
+type HeatingCurveRecommendation struct {
+	Slope                    float64              `json:"slope"`
+	Shift                    int                  `json:"shift"`
+	Changed                  bool                 `json:"changed"`
+	Reason                   string               `json:"reason"`
+	Supply                   []HeatingCurveChange `json:"supply"`
+	ElectricityChangePercent *float64             `json:"electricity_change_percent,omitempty"` // rough estimate over the analysed heating hours
+}
+
+// HeatingCurveAnalysis compares the configured heating curve with the measured supply and room temperatures
+type HeatingCurveAnalysis struct {
+	StartTime       time.Time                   `json:"start_time"`
+	EndTime         time.Time                   `json:"end_time"`
+	Hours           HourWindow                  `json:"hours"`
+	HeatingLimit    float64                     `json:"heating_limit"`
+	Config          HeatingCurveConfig          `json:"config"`
+	HeatingHours    int                         `json:"heating_hours"` // hours below the heating limit
+	CurveHours      int                         `json:"curve_hours"`   // of these, hours used to fit the effective curve
+	Effective       *HeatingCurve               `json:"effective,omitempty"`
+	EffectiveR2     *float64                    `json:"effective_r2,omitempty"`
+	EffectiveStdDev *float64                    `json:"effective_std_dev,omitempty"` // K
+	Curve           []HeatingCurvePoint         `json:"curve"`
+	Rooms           []RoomCurveAnalysis         `json:"rooms"`
+	Recommendation  *HeatingCurveRecommendation `json:"recommendation,omitempty"`
+	Warnings        []string                    `json:"warnings,omitempty"`
+}
+
+// roomStatus classifies a deviation from the setpoint
+func roomStatus(deviation float64) string {
+	switch {
+	case deviation > curveRoomTolerance:
+		return RoomOverheated
+	case deviation < -curveRoomTolerance:
+		return RoomUnderheated
+	}
+	return RoomOK
+}
+
+// roomTempResponse returns how much a room warms up per Kelvin of supply temperature. With
+// heat output and heat loss both linear in their temperature differences it is
+// (room - outside) / (supply - outside).
+func roomTempResponse(roomTemp, supply, outside float64) float64 {
+	if supply-outside <= 0 {
+		return 0
+	}
+	return (roomTemp - outside) / (supply - outside)
+}
+
+// GetHeatingCurveAnalysis fits the effective heating curve to the hourly supply temperatures of
+// [from, to), compares the room temperatures with their setpoints per outside temperature bin
+// and recommends a slope and shift. Only hours below the heating limit and inside the hour
+// window are used; for the effective curve the compressor must have run for half of the hour.
+func GetHeatingCurveAnalysis(installationID, gatewayID, deviceID string, config *HeatingCurveConfig, from, to time.Time, window HourWindow, settings *DegreeDaySettings) (*HeatingCurveAnalysis, error) {
+	rollups, err := GetTemperatureRollups(ResolutionHour, installationID, gatewayID, deviceID, from, to, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	analysis := &HeatingCurveAnalysis{
+		StartTime:    from,
+		EndTime:      to,
+		Hours:        window,
+		HeatingLimit: settings.HeatingLimit,
+		Config:       *config,
+		Rooms:        []RoomCurveAnalysis{},
+	}
+
+	// Devices without compressor (gas boilers) heat whenever the curve asks for it
+	hasRuntime := false
+	for _, r := range rollups {
+		if r.RuntimeMinutes > 0 {
+			hasRuntime = true
+			break
+		}
+	}
+
+	type supplyBin struct {
+		sum   float64
+		hours int
+	}
+	outsideByHour := make(map[int64]float64)
+	measured := make(map[int]*supplyBin)
+	var xs, ys, heatingOutside []float64
+	minOutside, maxOutside := math.Inf(1), math.Inf(-1)
+	for _, r := range rollups {
+		if r.OutsideTemp == nil || *r.OutsideTemp >= settings.HeatingLimit || !window.contains(r.Timestamp) {
+			continue
+		}
+		outside := *r.OutsideTemp
+		outsideByHour[r.Timestamp.Unix()] = outside
+		heatingOutside = append(heatingOutside, outside)
+
+		supply := circuitSupplyTemp(&r.TemperatureSnapshot, config.Circuit)
+		if supply == nil || r.CoveredMinutes <= 0 || config.limited(outside) {
+			continue
+		}
+		if hasRuntime && r.RuntimeMinutes < curveRuntimeShare*r.CoveredMinutes {
+			continue
+		}
+		xs = append(xs, heatingCurveShape(config.RoomSetpoint, outside))
+		ys = append(ys, *supply-config.RoomSetpoint)
+		minOutside = math.Min(minOutside, outside)
+		maxOutside = math.Max(maxOutside, outside)
+
+		key := int(math.Round(outside))
+		if measured[key] == nil {
+			measured[key] = &supplyBin{}
+		}
+		measured[key].sum += *supply
+		measured[key].hours++
+	}
+	analysis.HeatingHours = len(heatingOutside)
+	analysis.CurveHours = len(xs)
+
+	// supply - setpoint = shift + slope × shape is linear in slope and shift
+	switch {
+	case len(xs) < minCurveHours:
+		analysis.Warnings = append(analysis.Warnings, fmt.Sprintf("%d hours with running heating, at least %d are needed for the effective curve", len(xs), minCurveHours))
+	case maxOutside-minOutside < minCurveOutsideSpread:
+		analysis.Warnings = append(analysis.Warnings, "outside temperatures vary too little for the effective curve")
+	default:
+		if fit, ok := fitLine(xs, ys); ok {
+			analysis.Effective = &HeatingCurve{Slope: *roundedPtr(fit.slope, 2), Shift: *roundedPtr(fit.intercept, 1)}
+			analysis.EffectiveR2 = roundedPtr(fit.r2, 3)
+			analysis.EffectiveStdDev = roundedPtr(fit.stdDev, 2)
+		}
+	}
+
+	rooms, err := collectCurveRooms(installationID, from, to, outsideByHour, config)
+	if err != nil {
+		return nil, err
+	}
+	analysis.Rooms = rooms
+	if len(rooms) == 0 {
+		analysis.Warnings = append(analysis.Warnings, "no room temperatures logged, enable device logging of the room control or climate sensors")
+	}
+
+	analysis.Recommendation = recommendHeatingCurve(config, analysis.Effective, rooms, heatingOutside)
+	if analysis.Recommendation == nil && len(rooms) > 0 {
+		analysis.Warnings = append(analysis.Warnings, fmt.Sprintf("rooms need at least %d hours in an outside temperature bin for a recommendation", minCurveBinHours))
+	}
+
+	for t := curveOutsideMin; t <= curveOutsideMax; t++ {
+		outside := float64(t)
+		point := HeatingCurvePoint{
+			OutsideTemp: outside,
+			Configured:  roundDegrees(config.targetSupply(config.Curve, outside)),
+		}
+		if analysis.Effective != nil {
+			point.Effective = roundedPtr(heatingCurveSupplyTemp(analysis.Effective.Slope, analysis.Effective.Shift, config.RoomSetpoint, outside), 1)
+		}
+		if rec := analysis.Recommendation; rec != nil {
+			point.Recommended = roundedPtr(config.targetSupply(HeatingCurve{Slope: rec.Slope, Shift: float64(rec.Shift)}, outside), 1)
+		}
+		if bin := measured[t]; bin != nil {
+			point.MeasuredSupply = roundedPtr(bin.sum/float64(bin.hours), 1)
+			point.Hours = bin.hours
+		}
+		analysis.Curve = append(analysis.Curve, point)
+	}
+	return analysis, nil
+}
+
+// collectCurveRooms averages the logged room temperatures of an installation per room and
+// outside temperature bin. Rooms of a room control are compared with their own setpoint,
+// climate sensors with the normal setpoint of the circuit; hours with an open window are skipped.
+func collectCurveRooms(installationID string, from, to time.Time, outsideByHour map[int64]float64, config *HeatingCurveConfig) ([]RoomCurveAnalysis, error) {
+	history, err := GetDeviceHistory(ResolutionHour, installationID, "", "", from, to, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	type roomKey struct{ gatewayID, deviceID, room string }
+	type binSums struct {
+		outside, room, setpoint float64
+		hours                   int
+	}
+	sums := make(map[roomKey]map[float64]*binSums)
+	sources := make(map[roomKey]string)
+	classes := make(map[string]string)
+
+	add := func(key roomKey, source string, outside, temp, setpoint float64) {
+		bins := sums[key]
+		if bins == nil {
+			bins = make(map[float64]*binSums)
+			sums[key] = bins
+			sources[key] = source
+		}
+		start := math.Floor(outside/curveBinWidth) * curveBinWidth
+		bin := bins[start]
+		if bin == nil {
+			bin = &binSums{}
+			bins[start] = bin
+		}
+		bin.outside += outside
+		bin.room += temp
+		bin.setpoint += setpoint
+		bin.hours++
+	}
+
+	for _, row := range history.Rows {
+		ts, _ := row["timestamp"].(time.Time)
+		outside, ok := outsideByHour[ts.Unix()]
+		if !ok {
+			continue
+		}
+		gw, _ := row["gateway_id"].(string)
+		dev, _ := row["device_id"].(string)
+		class, known := classes[gw+":"+dev]
+		if !known {
+			class = lookupDeviceLogClass(installationID, gw, dev)
+			classes[gw+":"+dev] = class
+		}
+
+		switch class {
+		case "room_control":
+			for field, value := range row {
+				room := strings.TrimSuffix(strings.TrimPrefix(field, "room_"), "_temperature")
+				if room == field || !strings.HasSuffix(field, "_temperature") {
+					continue
+				}
+				temp, ok := value.(float64)
+				if !ok {
+					continue
+				}
+				if open, ok := row["room_"+room+"_window_open"].(float64); ok && open > 0 {
+					continue
+				}
+				setpoint := config.RoomSetpoint
+				if v, ok := row["room_"+room+"_setpoint"].(float64); ok {
+					setpoint = v
+				}
+				add(roomKey{gw, dev, room}, RoomSourceRoomControl, outside, temp, setpoint)
+			}
+		case "climate_sensors":
+			if temp, ok := row["temperature"].(float64); ok {
+				add(roomKey{gw, dev, ""}, RoomSourceClimateSensor, outside, temp, config.RoomSetpoint)
+			}
+		}
+	}
+
+	keys := make([]roomKey, 0, len(sums))
+	for key := range sums {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.gatewayID != b.gatewayID {
+			return a.gatewayID < b.gatewayID
+		}
+		if a.deviceID != b.deviceID {
+			return a.deviceID < b.deviceID
+		}
+		return a.room < b.room
+	})
+
+	rooms := make([]RoomCurveAnalysis, 0, len(keys))
+	for _, key := range keys {
+		room := RoomCurveAnalysis{GatewayID: key.gatewayID, DeviceID: key.deviceID, Room: key.room, Source: sources[key], Bins: []RoomCurveBin{}}
+		starts := make([]float64, 0, len(sums[key]))
+		for start := range sums[key] {
+			starts = append(starts, start)
+		}
+		sort.Float64s(starts)
+
+		var weighted float64
+		var used int
+		for _, start := range starts {
+			s := sums[key][start]
+			n := float64(s.hours)
+			bin := RoomCurveBin{
+				OutsideFrom:     start,
+				OutsideTo:       start + curveBinWidth,
+				MeanOutsideTemp: roundDegrees(s.outside / n),
+				MeanRoomTemp:    roundDegrees(s.room / n),
+				Setpoint:        roundDegrees(s.setpoint / n),
+				Deviation:       roundDegrees((s.room - s.setpoint) / n),
+				Hours:           s.hours,
+			}
+			room.Hours += s.hours
+			if s.hours < minCurveBinHours {
+				bin.Status = RoomNoData
+				room.Bins = append(room.Bins, bin)
+				continue
+			}
+			bin.Status = roomStatus(bin.Deviation)
+			weighted += (s.room - s.setpoint)
+			used += s.hours
+			room.Bins = append(room.Bins, bin)
+		}
+		room.Status = RoomNoData
+		if used > 0 {
+			room.Deviation = roundDegrees(weighted / float64(used))
+			room.Status = roomStatus(room.Deviation)
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, nil
+}
+
+// recommendHeatingCurve fits slope and shift so that the room needing the most heat reaches its
+// setpoint in every outside temperature bin. A deviation that is the same in all bins changes
+// the shift, one that depends on the outside temperature also the slope. Returns nil without
+// bins with enough hours. The room response uses the effective curve if there is one, as it is
+// what the radiators actually get.
+func recommendHeatingCurve(config *HeatingCurveConfig, effective *HeatingCurve, rooms []RoomCurveAnalysis, heatingOutside []float64) *HeatingCurveRecommendation {
+	delivered := func(outside float64) float64 {
+		if effective != nil {
+			return heatingCurveSupplyTemp(effective.Slope, effective.Shift, config.RoomSetpoint, outside)
+		}
+		return config.targetSupply(config.Curve, outside)
+	}
+
+	// The neediest room of each bin decides; other rooms are throttled by their valves
+	needed := make(map[float64]RoomCurveBin)
+	for _, room := range rooms {
+		for _, bin := range room.Bins {
+			if bin.Hours < minCurveBinHours || bin.MeanRoomTemp-bin.MeanOutsideTemp < minCurveRoomLift {
+				continue
+			}
+			if current, ok := needed[bin.OutsideFrom]; !ok || bin.Deviation < current.Deviation {
+				needed[bin.OutsideFrom] = bin
+			}
+		}
+	}
+	if len(needed) == 0 {
+		return nil
+	}
+
+	// Target supply temperatures of the bins as curve points (shape, supply - setpoint)
+	var xs, ys, ws []float64
+	minOutside, maxOutside := math.Inf(1), math.Inf(-1)
+	coldest, warmest := RoomCurveBin{}, RoomCurveBin{}
+	withinTolerance := true
+	for _, bin := range needed {
+		outside := bin.MeanOutsideTemp
+		supply := config.targetSupply(config.Curve, outside)
+		change := 0.0
+		if math.Abs(bin.Deviation) > curveRoomTolerance {
+			withinTolerance = false
+			if response := roomTempResponse(bin.MeanRoomTemp, delivered(outside), outside); response > 0 {
+				change = -bin.Deviation / response
+			}
+		}
+		xs = append(xs, heatingCurveShape(config.RoomSetpoint, outside))
+		ys = append(ys, supply+change-config.RoomSetpoint)
+		ws = append(ws, float64(bin.Hours))
+		if outside < minOutside {
+			minOutside, coldest = outside, bin
+		}
+		if outside > maxOutside {
+			maxOutside, warmest = outside, bin
+		}
+	}
+
+	// Weighted least squares; the slope stays unless the bins span enough outside temperatures
+	var sumW, meanX, meanY float64
+	for i := range xs {
+		sumW += ws[i]
+		meanX += ws[i] * xs[i]
+		meanY += ws[i] * ys[i]
+	}
+	meanX /= sumW
+	meanY /= sumW
+	slope := config.Curve.Slope
+	if maxOutside-minOutside >= minCurveSlopeSpread {
+		var sxx, sxy float64
+		for i := range xs {
+			sxx += ws[i] * (xs[i] - meanX) * (xs[i] - meanX)
+			sxy += ws[i] * (xs[i] - meanX) * (ys[i] - meanY)
+		}
+		if sxx > 0 {
+			slope = sxy / sxx
+		}
+	}
+	slope = math.Max(heatingCurveSlopeMin, math.Min(heatingCurveSlopeMax, math.Round(slope*10)/10))
+	shift := int(math.Round(meanY - slope*meanX))
+	if shift < heatingCurveShiftMin {
+		shift = heatingCurveShiftMin
+	}
+	if shift > heatingCurveShiftMax {
+		shift = heatingCurveShiftMax
+	}
+
+	rec := &HeatingCurveRecommendation{
+		Slope:   slope,
+		Shift:   shift,
+		Changed: slope != config.Curve.Slope || float64(shift) != config.Curve.Shift,
+	}
+	switch {
+	case !rec.Changed && withinTolerance:
+		rec.Reason = fmt.Sprintf("the room needing the most heat is within %.1f K of its setpoint", curveRoomTolerance)
+	case !rec.Changed:
+		rec.Reason = "the needed change is smaller than one step of slope and shift"
+	case slope != config.Curve.Slope:
+		rec.Reason = fmt.Sprintf("the deviation depends on the outside temperature (%+.1f K at %.0f °C, %+.1f K at %.0f °C): slope %.1f → %.1f, shift %g → %d",
+			coldest.Deviation, coldest.MeanOutsideTemp, warmest.Deviation, warmest.MeanOutsideTemp, config.Curve.Slope, slope, config.Curve.Shift, shift)
+	default:
+		rec.Reason = fmt.Sprintf("the rooms deviate by about the same amount at all outside temperatures: shift %g → %d", config.Curve.Shift, shift)
+	}
+
+	recommended := HeatingCurve{Slope: slope, Shift: float64(shift)}
+	for _, outside := range []float64{-10, -5, 0, 5, 10} {
+		current := config.targetSupply(config.Curve, outside)
+		next := config.targetSupply(recommended, outside)
+		rec.Supply = append(rec.Supply, HeatingCurveChange{
+			OutsideTemp: outside,
+			Current:     roundDegrees(current),
+			Recommended: roundDegrees(next),
+			Change:      roundDegrees(next - current),
+		})
+	}
+
+	if len(heatingOutside) > 0 {
+		var change float64
+		for _, outside := range heatingOutside {
+			change += config.targetSupply(recommended, outside) - config.targetSupply(config.Curve, outside)
+		}
+		rec.ElectricityChangePercent = roundedPtr(change/float64(len(heatingOutside))*curveElectricityPerK, 1)
+	}
+
+	for r := range rooms {
+		for b := range rooms[r].Bins {
+			bin := &rooms[r].Bins[b]
+			if bin.Hours < minCurveBinHours {
+				continue
+			}
+			change := config.targetSupply(recommended, bin.MeanOutsideTemp) - config.targetSupply(config.Curve, bin.MeanOutsideTemp)
+			response := roomTempResponse(bin.MeanRoomTemp, delivered(bin.MeanOutsideTemp), bin.MeanOutsideTemp)
+			bin.PredictedDeviation = roundedPtr(bin.Deviation+change*response, 1)
+		}
+	}
+	return rec
+}
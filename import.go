@@ -0,0 +1,1110 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Import kinds and presets
+const (
+	ImportKindTemperatures = "temperatures"
+	ImportKindEvents       = "events"
+
+	// ImportPresetHomeAssistant reads Home Assistant history exports
+	// (CSV from the history panel or JSON from /api/history/period)
+	ImportPresetHomeAssistant = "homeassistant"
+)
+
+const (
+	importBatchSize       = 1000
+	importMaxReportErrors = 20
+	importDefaultMaxFill  = 360 // minutes
+)
+
+// ImportSpec describes how external records map onto snapshots or events
+type ImportSpec struct {
+	Kind           string            `json:"kind"`                     // temperatures or events
+	Format         string            `json:"format,omitempty"`         // csv or json (array, {"data": [...]} or JSON Lines)
+	Preset         string            `json:"preset,omitempty"`         // homeassistant
+	Delimiter      string            `json:"delimiter,omitempty"`      // CSV delimiter (default: detected from the header)
+	DecimalComma   bool              `json:"decimalComma,omitempty"`   // numbers use ',' as decimal separator
+	TimeColumn     string            `json:"timeColumn,omitempty"`     // default: detected (timestamp, time, date, ...)
+	TimeFormat     string            `json:"timeFormat,omitempty"`     // Go layout, default: RFC3339, common date formats or Unix time
+	TimeZone       string            `json:"timeZone,omitempty"`       // zone for timestamps without offset (default Europe/Berlin)
+	Mapping        map[string]string `json:"mapping,omitempty"`        // source column or entity -> target field ("" ignores it)
+	EntityColumn   string            `json:"entityColumn,omitempty"`   // long format: column naming the series (e.g. entity_id)
+	ValueColumn    string            `json:"valueColumn,omitempty"`    // long format: column holding the value (e.g. state)
+	InstallationID string            `json:"installationId,omitempty"` // defaults for records without these columns
+	GatewayID      string            `json:"gatewayId,omitempty"`
+	DeviceID       string            `json:"deviceId,omitempty"`
+	AccountID      string            `json:"accountId,omitempty"`
+	AccountName    string            `json:"accountName,omitempty"`
+	SampleInterval int               `json:"sampleInterval,omitempty"` // minutes, default: temperature log setting
+	MaxFillMinutes int               `json:"maxFillMinutes,omitempty"` // long format: how long a state is held at most (default 360)
+	DryRun         bool              `json:"dryRun,omitempty"`
+}
+
+// ImportReport summarizes an import or a dry run
+type ImportReport struct {
+	DryRun         bool           `json:"dryRun"`
+	Kind           string         `json:"kind"`
+	RowsRead       int            `json:"rowsRead"`
+	RowsSkipped    int            `json:"rowsSkipped"`
+	Records        int            `json:"records"`    // events, or snapshots after merging into sample intervals
+	Duplicates     int            `json:"duplicates"` // already archived or repeated in the input
+	Inserted       int            `json:"inserted"`   // dry run: would be inserted
+	From           string         `json:"from,omitempty"`
+	To             string         `json:"to,omitempty"`
+	SampleInterval int            `json:"sampleInterval,omitempty"`
+	Fields         map[string]int `json:"fields"`             // values per target field (events: per event type)
+	Unmapped       []string       `json:"unmapped,omitempty"` // source columns or entities that were ignored
+	Errors         []string       `json:"errors,omitempty"`   // first row errors
+	Warning        string         `json:"warning,omitempty"`
+}
+
+func (r *ImportReport) rowError(row int, format string, args ...interface{}) {
+	r.RowsSkipped++
+	if len(r.Errors) < importMaxReportErrors {
+		r.Errors = append(r.Errors, fmt.Sprintf("row %d: %s", row, fmt.Sprintf(format, args...)))
+	}
+}
+
+func (r *ImportReport) valueError(row int, column, value string) {
+	if len(r.Errors) < importMaxReportErrors {
+		r.Errors = append(r.Errors, fmt.Sprintf("row %d: invalid value %q for %s", row, value, column))
+	}
+}
+
+func (r *ImportReport) addRange(t time.Time) {
+	ts := t.UTC().Format(time.RFC3339)
+	if r.From == "" || ts < r.From {
+		r.From = ts
+	}
+	if ts > r.To {
+		r.To = ts
+	}
+}
+
+// importRecord is one input row; raw is set for JSON objects
+type importRecord struct {
+	row    int
+	values map[string]string
+	raw    map[string]interface{}
+}
+
+// normalizeImportName makes column and field names comparable: "Outside_Temp" == "outsidetemp"
+func normalizeImportName(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "", " ", "", ".", "").Replace(strings.TrimSpace(name)))
+}
+
+// importTimeColumns are tried in order when no time column is configured
+var importTimeColumns = []string{"timestamp", "eventtimestamp", "time", "datetime", "date", "zeit", "zeitstempel", "datum", "lastchanged", "lastupdated", "createdat"}
+
+// importTimeLayouts are tried in order when no time format is configured
+var importTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"01/02/2006 15:04:05",
+	"2006-01-02",
+	"02.01.2006",
+}
+
+// applyImportDefaults fills in preset values and validates the spec
+func applyImportDefaults(spec *ImportSpec) error {
+	switch spec.Kind {
+	case ImportKindTemperatures, ImportKindEvents:
+	default:
+		return fmt.Errorf("unknown kind %q (use temperatures or events)", spec.Kind)
+	}
+
+	switch spec.Preset {
+	case "":
+	case ImportPresetHomeAssistant:
+		if spec.Kind != ImportKindTemperatures {
+			return fmt.Errorf("the homeassistant preset only imports temperatures")
+		}
+		if spec.EntityColumn == "" {
+			spec.EntityColumn = "entity_id"
+		}
+		if spec.ValueColumn == "" {
+			spec.ValueColumn = "state"
+		}
+		if spec.TimeColumn == "" {
+			spec.TimeColumn = "last_changed"
+		}
+	default:
+		return fmt.Errorf("unknown preset %q", spec.Preset)
+	}
+
+	if (spec.EntityColumn == "") != (spec.ValueColumn == "") {
+		return fmt.Errorf("entityColumn and valueColumn must be set together")
+	}
+	if spec.EntityColumn != "" && len(spec.Mapping) == 0 {
+		return fmt.Errorf("a mapping from entities to fields is required for long-format data")
+	}
+	if spec.Format != "" && spec.Format != "csv" && spec.Format != "json" {
+		return fmt.Errorf("unknown format %q (use csv or json)", spec.Format)
+	}
+	if len([]rune(spec.Delimiter)) > 1 {
+		return fmt.Errorf("delimiter must be a single character")
+	}
+
+	if spec.Kind == ImportKindTemperatures {
+		for source, target := range spec.Mapping {
+			if target != "" && snapshotImportField(target) == "" {
+				return fmt.Errorf("mapping %q: unknown snapshot field %q", source, target)
+			}
+		}
+		if spec.SampleInterval <= 0 {
+			spec.SampleInterval = 5
+			if settings, err := GetTemperatureLogSettings(); err == nil && settings.SampleInterval > 0 {
+				spec.SampleInterval = settings.SampleInterval
+			}
+		}
+		if spec.MaxFillMinutes <= 0 {
+			spec.MaxFillMinutes = importDefaultMaxFill
+		}
+		if spec.MaxFillMinutes < spec.SampleInterval {
+			spec.MaxFillMinutes = spec.SampleInterval
+		}
+	} else {
+		for source, target := range spec.Mapping {
+			if target != "" && eventImportFields[normalizeImportName(target)] == nil {
+				return fmt.Errorf("mapping %q: unknown event field %q", source, target)
+			}
+		}
+	}
+	return nil
+}
+
+// RunImport reads records from r and imports them into the archive (or only reports in dry-run mode)
+func RunImport(r io.Reader, spec ImportSpec) (*ImportReport, error) {
+	if !dbInitialized || eventDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	if err := applyImportDefaults(&spec); err != nil {
+		return nil, err
+	}
+
+	location := DefaultLocation
+	if spec.TimeZone != "" {
+		loc, err := time.LoadLocation(spec.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q", spec.TimeZone)
+		}
+		location = loc
+	}
+
+	report := &ImportReport{DryRun: spec.DryRun, Kind: spec.Kind, Fields: make(map[string]int)}
+	parser := &importParser{spec: &spec, report: report, location: location, unmapped: make(map[string]bool)}
+
+	var err error
+	if spec.Kind == ImportKindEvents {
+		err = parser.importEvents(r)
+	} else {
+		report.SampleInterval = spec.SampleInterval
+		err = parser.importSnapshots(r)
+	}
+	if err != nil {
+		return report, err
+	}
+
+	// Imported history must show up in the hourly/daily rollups too
+	if spec.Kind == ImportKindTemperatures && report.Inserted > 0 && !report.DryRun {
+		from, _ := time.Parse(time.RFC3339, report.From)
+		to, _ := time.Parse(time.RFC3339, report.To)
+		if err := RebuildTemperatureRollups(from, to); err != nil {
+			log.Printf("Warning: failed to update temperature rollups after import: %v", err)
+		}
+	}
+
+	report.Warning = importRetentionWarning(report)
+
+	for name := range parser.unmapped {
+		report.Unmapped = append(report.Unmapped, name)
+	}
+	sort.Strings(report.Unmapped)
+	return report, nil
+}
+
+// importRetentionWarning warns when imported records are older than the retention period,
+// because the next cleanup would delete them again
+func importRetentionWarning(report *ImportReport) string {
+	from, err := time.Parse(time.RFC3339, report.From)
+	if err != nil {
+		return ""
+	}
+
+	retentionDays := 0
+	if report.Kind == ImportKindEvents {
+		if settings, err := GetEventArchiveSettings(); err == nil {
+			retentionDays = settings.RetentionDays
+		}
+	} else if settings, err := GetTemperatureLogSettings(); err == nil {
+		retentionDays = settings.RetentionDays
+	}
+	if retentionDays <= 0 || from.After(time.Now().AddDate(0, 0, -retentionDays)) {
+		return ""
+	}
+	if report.Kind != ImportKindEvents {
+		return fmt.Sprintf("records start %s, but raw snapshots are kept for %d days; older ones are reduced to hourly/daily rollups by the next cleanup",
+			from.Format("2006-01-02"), retentionDays)
+	}
+	return fmt.Sprintf("records start %s, but the retention period is %d days; increase it or older records are removed by the next cleanup",
+		from.Format("2006-01-02"), retentionDays)
+}
+
+// importParser holds the state of one import run
+type importParser struct {
+	spec       *ImportSpec
+	report     *ImportReport
+	location   *time.Location
+	timeColumn string
+	unmapped   map[string]bool
+}
+
+// readRecords calls fn for every CSV row or JSON object of the input
+func (p *importParser) readRecords(r io.Reader, fn func(rec importRecord) error) error {
+	reader := bufio.NewReader(r)
+	format := p.spec.Format
+	if format == "" {
+		first, err := peekFirstByte(reader)
+		if err != nil {
+			return err
+		}
+		format = "csv"
+		if first == '[' || first == '{' {
+			format = "json"
+		}
+	}
+	if format == "json" {
+		return p.readJSONRecords(reader, fn)
+	}
+	return p.readCSVRecords(reader, fn)
+}
+
+// peekFirstByte returns the first non-whitespace byte (after an optional BOM)
+func peekFirstByte(reader *bufio.Reader) (byte, error) {
+	if bom, err := reader.Peek(3); err == nil && bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+		reader.Discard(3)
+	}
+	for i := 1; ; i++ {
+		data, err := reader.Peek(i)
+		if len(data) < i {
+			if err == nil {
+				err = io.EOF
+			}
+			return 0, fmt.Errorf("empty input: %v", err)
+		}
+		if c := data[i-1]; c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			return c, nil
+		}
+	}
+}
+
+func (p *importParser) readCSVRecords(reader *bufio.Reader, fn func(rec importRecord) error) error {
+	if bom, err := reader.Peek(3); err == nil && bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+		reader.Discard(3)
+	}
+
+	delimiter := ','
+	if p.spec.Delimiter != "" {
+		delimiter = []rune(p.spec.Delimiter)[0]
+	} else if headerLine, _ := reader.Peek(4096); len(headerLine) > 0 {
+		// Detect the delimiter from the header line
+		line := string(headerLine)
+		if i := strings.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i]
+		}
+		best := 0
+		for _, candidate := range []rune{',', ';', '\t'} {
+			if n := strings.Count(line, string(candidate)); n > best {
+				best, delimiter = n, candidate
+			}
+		}
+	}
+
+	cr := csv.NewReader(reader)
+	cr.Comma = delimiter
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read CSV header: %v", err)
+	}
+	columns := append([]string(nil), header...)
+
+	for row := 2; ; row++ {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			p.report.RowsRead++
+			p.report.rowError(row, "%v", err)
+			continue
+		}
+		values := make(map[string]string, len(columns))
+		for i, column := range columns {
+			if i < len(fields) {
+				values[column] = strings.TrimSpace(fields[i])
+			}
+		}
+		if err := fn(importRecord{row: row, values: values}); err != nil {
+			return err
+		}
+	}
+}
+
+// readJSONRecords accepts an array of objects (also nested, like Home Assistant history),
+// an object with a "data" array (Viessmann API responses) or JSON Lines
+func (p *importParser) readJSONRecords(reader *bufio.Reader, fn func(rec importRecord) error) error {
+	row := 0
+	var emit func(value interface{}) error
+	emit = func(value interface{}) error {
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				if err := emit(item); err != nil {
+					return err
+				}
+			}
+		case map[string]interface{}:
+			if data, ok := v["data"].([]interface{}); ok {
+				return emit(data)
+			}
+			row++
+			values := make(map[string]string, len(v))
+			for key, field := range v {
+				switch f := field.(type) {
+				case nil:
+				case string:
+					values[key] = strings.TrimSpace(f)
+				case float64:
+					values[key] = strconv.FormatFloat(f, 'f', -1, 64)
+				case bool:
+					values[key] = strconv.FormatBool(f)
+				default:
+					encoded, _ := json.Marshal(f)
+					values[key] = string(encoded)
+				}
+			}
+			return fn(importRecord{row: row, values: values, raw: v})
+		default:
+			row++
+			p.report.RowsRead++
+			p.report.rowError(row, "expected a JSON object")
+		}
+		return nil
+	}
+
+	dec := json.NewDecoder(reader)
+	dec.UseNumber()
+	for {
+		var value interface{}
+		if err := dec.Decode(&value); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("invalid JSON after %d records: %v", row, err)
+		}
+		if err := emit(jsonNumbersToFloat(value)); err != nil {
+			return err
+		}
+	}
+}
+
+// jsonNumbersToFloat converts json.Number values (from UseNumber) back to float64
+func jsonNumbersToFloat(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = jsonNumbersToFloat(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = jsonNumbersToFloat(v[key])
+		}
+	}
+	return value
+}
+
+// recordTime finds and parses the timestamp of a record
+func (p *importParser) recordTime(rec importRecord) (time.Time, string, error) {
+	if p.timeColumn == "" {
+		if p.spec.TimeColumn != "" {
+			p.timeColumn = p.spec.TimeColumn
+		} else {
+			for _, candidate := range importTimeColumns {
+				for column := range rec.values {
+					if normalizeImportName(column) == candidate {
+						p.timeColumn = column
+						break
+					}
+				}
+				if p.timeColumn != "" {
+					break
+				}
+			}
+		}
+		if p.timeColumn == "" {
+			return time.Time{}, "", fmt.Errorf("no time column found, set timeColumn")
+		}
+	}
+
+	value := rec.values[p.timeColumn]
+	if value == "" {
+		return time.Time{}, "", fmt.Errorf("missing %s", p.timeColumn)
+	}
+	t, err := parseImportTime(value, p.spec.TimeFormat, p.location)
+	return t, value, err
+}
+
+// parseImportTime parses a timestamp with the given layout, common layouts or Unix seconds/milliseconds
+func parseImportTime(value, layout string, location *time.Location) (time.Time, error) {
+	if layout != "" {
+		return time.ParseInLocation(layout, value, location)
+	}
+	for _, l := range importTimeLayouts {
+		if t, err := time.ParseInLocation(l, value, location); err == nil {
+			return t, nil
+		}
+	}
+	if n, err := strconv.ParseFloat(value, 64); err == nil && n > 0 {
+		if n > 1e12 {
+			return time.UnixMilli(int64(n)), nil
+		}
+		return time.Unix(int64(n), 0), nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", value)
+}
+
+// parseImportNumber parses a number, honoring the decimal comma setting and trailing units
+func (p *importParser) parseImportNumber(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if i := strings.IndexAny(value, " °%"); i > 0 {
+		value = value[:i]
+	}
+	if p.spec.DecimalComma {
+		value = strings.ReplaceAll(strings.ReplaceAll(value, ".", ""), ",", ".")
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	return f, err == nil
+}
+
+// parseImportBool accepts true/false, on/off, 1/0 and their German counterparts
+func parseImportBool(value string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "on", "1", "yes", "an", "ein", "ja", "active", "aktiv":
+		return true, true
+	case "false", "off", "0", "no", "aus", "nein", "inactive", "inaktiv":
+		return false, true
+	}
+	return false, false
+}
+
+// isImportNullValue reports placeholders used for missing values
+func isImportNullValue(value string) bool {
+	switch strings.ToLower(value) {
+	case "", "unavailable", "unknown", "none", "null", "nan", "-", "--":
+		return true
+	}
+	return false
+}
+
+// ---------------------------------------------------------------------------
+// Temperature snapshots
+// ---------------------------------------------------------------------------
+
+// snapshotImportFields maps normalized json names of TemperatureSnapshot value fields to their index
+var snapshotImportFields = func() map[string]int {
+	fields := make(map[string]int)
+	t := reflect.TypeOf(TemperatureSnapshot{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Type.Kind() != reflect.Ptr {
+			continue
+		}
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		fields[normalizeImportName(name)] = i
+	}
+	return fields
+}()
+
+// snapshotImportIdentity are the identifying snapshot columns that can come from the input
+var snapshotImportIdentity = map[string]string{
+	"installationid": "installation_id",
+	"gatewayid":      "gateway_id",
+	"gatewayserial":  "gateway_id",
+	"deviceid":       "device_id",
+	"accountid":      "account_id",
+	"accountname":    "account_name",
+}
+
+// snapshotImportField returns the json name of a snapshot field, or "" if unknown
+func snapshotImportField(name string) string {
+	normalized := normalizeImportName(name)
+	if i, ok := snapshotImportFields[normalized]; ok {
+		return strings.Split(reflect.TypeOf(TemperatureSnapshot{}).Field(i).Tag.Get("json"), ",")[0]
+	}
+	return snapshotImportIdentity[normalized]
+}
+
+// snapshotTarget returns the target field for a source column or entity ("" = ignore)
+func (p *importParser) snapshotTarget(source string) string {
+	if target, ok := p.spec.Mapping[source]; ok {
+		return snapshotImportField(target)
+	}
+	if p.spec.EntityColumn != "" {
+		return ""
+	}
+	return snapshotImportField(source)
+}
+
+// snapshotKey identifies one merged snapshot
+type snapshotKey struct {
+	installationID, gatewayID, deviceID string
+	timestamp                           int64
+}
+
+// setSnapshotValue stores a parsed value in the snapshot field named by target
+func (p *importParser) setSnapshotValue(snapshot *TemperatureSnapshot, target, value string) bool {
+	index, ok := snapshotImportFields[normalizeImportName(target)]
+	if !ok {
+		return false
+	}
+	field := reflect.ValueOf(snapshot).Elem().Field(index)
+	switch field.Type().Elem().Kind() {
+	case reflect.Float64:
+		f, ok := p.parseImportNumber(value)
+		if !ok {
+			return false
+		}
+		field.Set(reflect.ValueOf(&f))
+	case reflect.Bool:
+		b, ok := parseImportBool(value)
+		if !ok {
+			// numeric states like compressor speed > 0 count as active
+			f, isNumber := p.parseImportNumber(value)
+			if !isNumber {
+				return false
+			}
+			b = f != 0
+		}
+		field.Set(reflect.ValueOf(&b))
+	case reflect.String:
+		s := value
+		field.Set(reflect.ValueOf(&s))
+	default:
+		return false
+	}
+	return true
+}
+
+// gridTime aligns t to the sample interval grid used by the temperature scheduler
+func (p *importParser) gridTime(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute)
+	return t.Add(-time.Duration(t.Minute()%p.spec.SampleInterval) * time.Minute)
+}
+
+// importSnapshots builds snapshots from wide rows (one column per field) or long rows
+// (one row per entity and state change), merges them into the sample interval grid
+// and inserts the ones that are not archived yet
+func (p *importParser) importSnapshots(r io.Reader) error {
+	snapshots := make(map[snapshotKey]*TemperatureSnapshot)
+
+	// Long format: state changes per series, resampled onto the grid afterwards
+	type stateChange struct {
+		row   int
+		at    time.Time
+		value string
+	}
+	type seriesKey struct {
+		installationID, gatewayID, deviceID, field string
+	}
+	changes := make(map[seriesKey][]stateChange)
+
+	err := p.readRecords(r, func(rec importRecord) error {
+		p.report.RowsRead++
+		t, _, err := p.recordTime(rec)
+		if err != nil {
+			p.report.rowError(rec.row, "%v", err)
+			return nil
+		}
+
+		identity := map[string]string{
+			"installation_id": p.spec.InstallationID,
+			"gateway_id":      p.spec.GatewayID,
+			"device_id":       p.spec.DeviceID,
+			"account_id":      p.spec.AccountID,
+			"account_name":    p.spec.AccountName,
+		}
+		for column, value := range rec.values {
+			if target, ok := snapshotImportIdentity[normalizeImportName(column)]; ok && value != "" {
+				identity[target] = value
+			}
+		}
+		if identity["installation_id"] == "" {
+			p.report.rowError(rec.row, "no installation ID (set installationId)")
+			return nil
+		}
+		if identity["device_id"] == "" {
+			identity["device_id"] = "0"
+		}
+
+		if p.spec.EntityColumn != "" {
+			entity := rec.values[p.spec.EntityColumn]
+			target := p.snapshotTarget(entity)
+			if target == "" {
+				if _, ignored := p.spec.Mapping[entity]; !ignored && entity != "" {
+					p.unmapped[entity] = true
+				}
+				p.report.RowsSkipped++
+				return nil
+			}
+			key := seriesKey{identity["installation_id"], identity["gateway_id"], identity["device_id"], target}
+			changes[key] = append(changes[key], stateChange{rec.row, t, rec.values[p.spec.ValueColumn]})
+			return nil
+		}
+
+		key := snapshotKey{identity["installation_id"], identity["gateway_id"], identity["device_id"], p.gridTime(t).Unix()}
+		snapshot, exists := snapshots[key]
+		if !exists {
+			snapshot = &TemperatureSnapshot{
+				Timestamp:      p.gridTime(t),
+				InstallationID: identity["installation_id"],
+				GatewayID:      identity["gateway_id"],
+				DeviceID:       identity["device_id"],
+				AccountID:      identity["account_id"],
+				AccountName:    identity["account_name"],
+				SampleInterval: p.spec.SampleInterval,
+			}
+		}
+
+		set := 0
+		for column, value := range rec.values {
+			if column == p.timeColumn {
+				continue
+			}
+			target := p.snapshotTarget(column)
+			if target == "" {
+				if _, ignored := p.spec.Mapping[column]; !ignored {
+					p.unmapped[column] = true
+				}
+				continue
+			}
+			if _, isIdentity := snapshotImportIdentity[normalizeImportName(target)]; isIdentity || isImportNullValue(value) {
+				continue
+			}
+			// The first sample of an interval wins, like the scheduler's single sample
+			index := snapshotImportFields[normalizeImportName(target)]
+			if !reflect.ValueOf(snapshot).Elem().Field(index).IsNil() {
+				continue
+			}
+			if p.setSnapshotValue(snapshot, target, value) {
+				p.report.Fields[target]++
+				set++
+			} else {
+				p.report.valueError(rec.row, column, value)
+			}
+		}
+		if set == 0 && !exists {
+			p.report.rowError(rec.row, "no mapped values")
+			return nil
+		}
+		snapshots[key] = snapshot
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Resample state changes: every grid point gets the last known state of its series
+	// (forward fill) until the next change, at most maxFillMinutes. Unavailable/unknown
+	// states end the fill, so outages stay empty; the last state only covers its interval.
+	step := time.Duration(p.spec.SampleInterval) * time.Minute
+	maxFill := time.Duration(p.spec.MaxFillMinutes) * time.Minute
+	for key, series := range changes {
+		sort.SliceStable(series, func(i, j int) bool { return series[i].at.Before(series[j].at) })
+		for i, change := range series {
+			if isImportNullValue(change.value) {
+				continue
+			}
+			var probe TemperatureSnapshot
+			if !p.setSnapshotValue(&probe, key.field, change.value) {
+				p.report.RowsSkipped++
+				p.report.valueError(change.row, key.field, change.value)
+				continue
+			}
+
+			until := change.at.Add(step)
+			if i+1 < len(series) {
+				until = change.at.Add(maxFill)
+				if series[i+1].at.Before(until) {
+					until = series[i+1].at
+				}
+			}
+			at := p.gridTime(change.at)
+			if at.Before(change.at) {
+				at = at.Add(step)
+			}
+			for ; at.Before(until); at = at.Add(step) {
+				sk := snapshotKey{key.installationID, key.gatewayID, key.deviceID, at.Unix()}
+				snapshot, exists := snapshots[sk]
+				if !exists {
+					snapshot = &TemperatureSnapshot{
+						Timestamp:      at,
+						InstallationID: key.installationID,
+						GatewayID:      key.gatewayID,
+						DeviceID:       key.deviceID,
+						AccountID:      p.spec.AccountID,
+						AccountName:    p.spec.AccountName,
+						SampleInterval: p.spec.SampleInterval,
+					}
+					snapshots[sk] = snapshot
+				}
+				p.setSnapshotValue(snapshot, key.field, change.value)
+				p.report.Fields[key.field]++
+			}
+		}
+	}
+
+	// Insert in time order, skipping intervals that already have a snapshot
+	ordered := make([]*TemperatureSnapshot, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		ordered = append(ordered, snapshot)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if !ordered[i].Timestamp.Equal(ordered[j].Timestamp) {
+			return ordered[i].Timestamp.Before(ordered[j].Timestamp)
+		}
+		return ordered[i].DeviceID < ordered[j].DeviceID
+	})
+	p.report.Records = len(ordered)
+
+	existing, err := p.existingSnapshotTimes(ordered)
+	if err != nil {
+		return err
+	}
+
+	var batch []*TemperatureSnapshot
+	for _, snapshot := range ordered {
+		key := snapshotKey{snapshot.InstallationID, snapshot.GatewayID, snapshot.DeviceID, snapshot.Timestamp.Unix()}
+		if existing[key] {
+			p.report.Duplicates++
+			continue
+		}
+		p.report.addRange(snapshot.Timestamp)
+		if p.spec.DryRun {
+			p.report.Inserted++
+			continue
+		}
+		batch = append(batch, snapshot)
+		if len(batch) >= importBatchSize {
+			if err := p.insertSnapshotBatch(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	return p.insertSnapshotBatch(batch)
+}
+
+// existingSnapshotTimes returns the (device, interval) keys among the snapshots that are already archived.
+// Logged snapshots are only truncated to the minute, so they are keyed by their grid interval.
+func (p *importParser) existingSnapshotTimes(snapshots []*TemperatureSnapshot) (map[snapshotKey]bool, error) {
+	step := time.Duration(p.spec.SampleInterval) * time.Minute
+	type deviceKey struct{ installationID, gatewayID, deviceID string }
+	ranges := make(map[deviceKey][2]time.Time)
+	for _, s := range snapshots {
+		key := deviceKey{s.InstallationID, s.GatewayID, s.DeviceID}
+		r, ok := ranges[key]
+		if !ok || s.Timestamp.Before(r[0]) {
+			r[0] = s.Timestamp
+		}
+		if !ok || s.Timestamp.After(r[1]) {
+			r[1] = s.Timestamp
+		}
+		ranges[key] = r
+	}
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	existing := make(map[snapshotKey]bool)
+	for key, r := range ranges {
+		rows, err := eventDB.Query(`
+			SELECT timestamp FROM temperature_snapshots
+			WHERE installation_id = ? AND COALESCE(gateway_id, '') = ? AND COALESCE(device_id, '') = ?
+				AND timestamp >= ? AND timestamp < ?`,
+			key.installationID, key.gatewayID, key.deviceID,
+			r[0].UTC().Format(time.RFC3339), r[1].Add(step).UTC().Format(time.RFC3339))
+		if err != nil {
+			return nil, fmt.Errorf("failed to query existing snapshots: %v", err)
+		}
+		for rows.Next() {
+			var ts string
+			if err := rows.Scan(&ts); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if t, err := time.Parse(time.RFC3339, ts); err == nil {
+				existing[snapshotKey{key.installationID, key.gatewayID, key.deviceID, p.gridTime(t).Unix()}] = true
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return existing, nil
+}
+
+// insertSnapshotBatch inserts snapshots in one transaction; existing rows are kept
+func (p *importParser) insertSnapshotBatch(batch []*TemperatureSnapshot) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	tx, err := eventDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, snapshot := range batch {
+		result, err := insertTemperatureSnapshot(tx, snapshot, "IGNORE")
+		if err != nil {
+			return fmt.Errorf("failed to insert snapshot at %s: %v", snapshot.Timestamp.Format(time.RFC3339), err)
+		}
+		if inserted, _ := result.RowsAffected(); inserted > 0 {
+			p.report.Inserted++
+		} else {
+			p.report.Duplicates++
+		}
+	}
+	return tx.Commit()
+}
+
+// ---------------------------------------------------------------------------
+// Events
+// ---------------------------------------------------------------------------
+
+// eventImportFields sets Event fields from normalized column names (json tags and database columns)
+var eventImportFields = map[string]func(e *Event, value string){
+	"eventtimestamp":   func(e *Event, v string) { e.EventTimestamp = v },
+	"createdat":        func(e *Event, v string) { e.CreatedAt = v },
+	"formattedtime":    func(e *Event, v string) { e.FormattedTime = v },
+	"eventtype":        func(e *Event, v string) { e.EventType = v },
+	"gatewayserial":    func(e *Event, v string) { e.GatewaySerial = v },
+	"gatewayid":        func(e *Event, v string) { e.GatewaySerial = v },
+	"errorcode":        func(e *Event, v string) { e.ErrorCode = v },
+	"errordescription": func(e *Event, v string) { e.ErrorDescription = v },
+	"humanreadable":    func(e *Event, v string) { e.HumanReadable = v },
+	"codecategory":     func(e *Event, v string) { e.CodeCategory = v },
+	"severity":         func(e *Event, v string) { e.Severity = v },
+	"deviceid":         func(e *Event, v string) { e.DeviceID = v },
+	"modelid":          func(e *Event, v string) { e.ModelID = v },
+	"installationid":   func(e *Event, v string) { e.InstallationID = v },
+	"accountid":        func(e *Event, v string) { e.AccountID = v },
+	"accountname":      func(e *Event, v string) { e.AccountName = v },
+	"featurename":      func(e *Event, v string) { e.FeatureName = v },
+	"featurevalue":     func(e *Event, v string) { e.FeatureValue = v },
+	"raw":              func(e *Event, v string) { e.Raw = v },
+	"active": func(e *Event, v string) {
+		if b, ok := parseImportBool(v); ok {
+			e.Active = &b
+		}
+	},
+	"body": func(e *Event, v string) {
+		var body map[string]interface{}
+		if json.Unmarshal([]byte(v), &body) == nil {
+			e.Body = body
+		}
+	},
+}
+
+// eventFromRecord builds an event from a raw API event (with body) or a flat row
+func (p *importParser) eventFromRecord(rec importRecord) (Event, error) {
+	var event Event
+	if _, hasBody := rec.raw["body"].(map[string]interface{}); hasBody {
+		if _, ok := rec.raw["eventTimestamp"]; ok {
+			// Raw Viessmann API event, e.g. a saved /events-history response
+			event = processEvent(rec.raw)
+		}
+	}
+	if event.EventTimestamp == "" {
+		for column, value := range rec.values {
+			name := normalizeImportName(column)
+			if target, ok := p.spec.Mapping[column]; ok {
+				name = normalizeImportName(target)
+			}
+			if set := eventImportFields[name]; set != nil {
+				if value != "" {
+					set(&event, value)
+				}
+			} else if target, ok := p.spec.Mapping[column]; !ok || target != "" {
+				p.unmapped[column] = true
+			}
+		}
+	}
+
+	if event.EventTimestamp == "" {
+		t, _, err := p.recordTime(rec)
+		if err != nil {
+			return event, err
+		}
+		event.EventTimestamp = t.UTC().Format(time.RFC3339)
+	} else if _, err := time.Parse(time.RFC3339, event.EventTimestamp); err != nil {
+		// Keep RFC3339 timestamps unchanged so hashes match events fetched from the API
+		t, err := parseImportTime(event.EventTimestamp, p.spec.TimeFormat, p.location)
+		if err != nil {
+			return event, err
+		}
+		event.EventTimestamp = t.UTC().Format(time.RFC3339)
+	}
+
+	if event.InstallationID == "" {
+		event.InstallationID = p.spec.InstallationID
+	}
+	if event.InstallationID == "" {
+		return event, fmt.Errorf("no installation ID (set installationId)")
+	}
+	if event.GatewaySerial == "" {
+		event.GatewaySerial = p.spec.GatewayID
+	}
+	if event.DeviceID == "" {
+		event.DeviceID = p.spec.DeviceID
+	}
+	if event.DeviceID == "" {
+		event.DeviceID = "0"
+	}
+	if event.AccountID == "" {
+		event.AccountID = p.spec.AccountID
+	}
+	if event.AccountName == "" {
+		event.AccountName = p.spec.AccountName
+	}
+	if event.CreatedAt == "" {
+		event.CreatedAt = event.EventTimestamp
+	}
+	if event.FormattedTime == "" {
+		event.FormattedTime = event.EventTimestamp
+	}
+	if event.ErrorCode != "" {
+		if event.EventType == "" {
+			event.EventType = "device-error"
+		}
+		if event.HumanReadable == "" {
+			event.HumanReadable = getErrorDescription(event.ErrorCode)
+		}
+		if event.CodeCategory == "" {
+			event.CodeCategory = getCodeCategory(event.ErrorCode)
+		}
+		if event.Severity == "" {
+			event.Severity = getSeverity(event.ErrorCode)
+		}
+	}
+	if event.EventType == "" {
+		return event, fmt.Errorf("no event type or error code")
+	}
+	if event.Raw == "" {
+		if rec.raw != nil {
+			if raw, err := json.MarshalIndent(rec.raw, "", "  "); err == nil {
+				event.Raw = string(raw)
+			}
+		} else if raw, err := json.MarshalIndent(rec.values, "", "  "); err == nil {
+			event.Raw = string(raw)
+		}
+	}
+	return event, nil
+}
+
+// importEvents builds events, drops those whose hash is already archived and inserts the rest
+func (p *importParser) importEvents(r io.Reader) error {
+	seen := make(map[string]bool)
+	var batch []Event
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		newEvents, err := insertEvents(batch)
+		if err != nil {
+			return err
+		}
+		p.report.Inserted += len(newEvents)
+		p.report.Duplicates += len(batch) - len(newEvents)
+		batch = batch[:0]
+		return nil
+	}
+
+	err := p.readRecords(r, func(rec importRecord) error {
+		p.report.RowsRead++
+		event, err := p.eventFromRecord(rec)
+		if err != nil {
+			p.report.rowError(rec.row, "%v", err)
+			return nil
+		}
+		p.report.Records++
+
+		hash := ComputeEventHash(&event)
+		if seen[hash] {
+			p.report.Duplicates++
+			return nil
+		}
+		seen[hash] = true
+
+		if t, err := time.Parse(time.RFC3339, event.EventTimestamp); err == nil {
+			p.report.addRange(t)
+		}
+		p.report.Fields[event.EventType]++
+
+		if p.spec.DryRun {
+			var exists bool
+			dbMutex.RLock()
+			err := eventDB.QueryRow("SELECT EXISTS(SELECT 1 FROM events WHERE hash = ?)", hash).Scan(&exists)
+			dbMutex.RUnlock()
+			if err != nil {
+				return fmt.Errorf("failed to check for duplicates: %v", err)
+			}
+			if exists {
+				p.report.Duplicates++
+			} else {
+				p.report.Inserted++
+			}
+			return nil
+		}
+
+		batch = append(batch, event)
+		if len(batch) >= importBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
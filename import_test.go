@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// heldStateHistory holds 5.5 °C for three hours, then 7 °C until the sensor drops out
+const heldStateHistory = `entity_id,state,last_changed
+sensor.outside,5.5,2026-01-10T10:02:00Z
+sensor.outside,7,2026-01-10T13:02:00Z
+sensor.outside,unavailable,2026-01-10T13:20:00Z
+`
+
+// importedOutsideTemps returns the imported outside temperatures of a device by grid time
+func importedOutsideTemps(t *testing.T, deviceID string) map[string]float64 {
+	t.Helper()
+	snapshots, err := GetTemperatureSnapshots("1", "", deviceID,
+		time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 11, 0, 0, 0, 0, time.UTC), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	temps := make(map[string]float64)
+	for _, s := range snapshots {
+		if s.OutsideTemp == nil {
+			t.Fatalf("snapshot at %s without outside temperature", s.Timestamp)
+		}
+		temps[s.Timestamp.UTC().Format("15:04")] = *s.OutsideTemp
+	}
+	return temps
+}
+
+func TestImportHoldsStateUntilNextChange(t *testing.T) {
+	t.Setenv("VICARE_CONFIG_DIR", t.TempDir())
+	if err := InitEventDatabase(filepath.Join(t.TempDir(), "events.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseEventDatabase()
+
+	for _, tc := range []struct {
+		deviceID string
+		maxFill  int
+		held     int // grid points with 5.5 °C from 10:15 on
+	}{
+		{deviceID: "0", held: 12},             // default: held until the change at 13:02
+		{deviceID: "1", maxFill: 60, held: 4}, // capped: 10:15 to 11:00
+	} {
+		spec := ImportSpec{
+			Kind:           ImportKindTemperatures,
+			Preset:         ImportPresetHomeAssistant,
+			Mapping:        map[string]string{"sensor.outside": "outside_temp"},
+			InstallationID: "1",
+			DeviceID:       tc.deviceID,
+			SampleInterval: 15,
+			MaxFillMinutes: tc.maxFill,
+		}
+		report, err := RunImport(strings.NewReader(heldStateHistory), spec)
+		if err != nil {
+			t.Fatalf("device %s: %v", tc.deviceID, err)
+		}
+		if report.Inserted != tc.held+1 {
+			t.Errorf("device %s: inserted %d snapshots, want %d", tc.deviceID, report.Inserted, tc.held+1)
+		}
+
+		want := map[string]float64{"13:15": 7}
+		at := time.Date(2026, 1, 10, 10, 15, 0, 0, time.UTC)
+		for i := 0; i < tc.held; i++ {
+			want[at.Format("15:04")] = 5.5
+			at = at.Add(15 * time.Minute)
+		}
+		got := importedOutsideTemps(t, tc.deviceID)
+		if len(got) != len(want) {
+			t.Errorf("device %s: got %d grid points %v, want %d", tc.deviceID, len(got), got, len(want))
+		}
+		for grid, temp := range want {
+			if got[grid] != temp {
+				t.Errorf("device %s: outside temperature at %s = %v, want %v", tc.deviceID, grid, got[grid], temp)
+			}
+		}
+	}
+}
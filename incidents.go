@@ -0,0 +1,366 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Fault incidents pair an error's activation event (active=true) with the
+// event that clears it (active=false). They are derived from the events table
+// and rebuilt per device and error code whenever new events arrive, so events
+// archived out of order still end up in the right incident.
+
+// incidentKey identifies the fault of one error code on one device
+type incidentKey struct {
+	installationID string
+	gatewaySerial  string
+	deviceID       string
+	errorCode      string
+}
+
+// sqlExecutor is implemented by *sql.DB and *sql.Tx
+type sqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// incidentEvent is the part of an archived event needed to build incidents
+type incidentEvent struct {
+	id               int64
+	timestamp        string
+	active           bool
+	modelID          string
+	errorDescription string
+	codeCategory     string
+	severity         string
+}
+
+// updateIncidents rebuilds the incidents affected by newly stored events
+// changed maps each key to the timestamp of its earliest new event
+func updateIncidents(db sqlExecutor, changed map[incidentKey]string) error {
+	for key, since := range changed {
+		if err := rebuildIncidents(db, key, since); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildIncidents replays the events of one key from the first incident that
+// can be affected by events at or after since ("" rebuilds everything)
+func rebuildIncidents(db sqlExecutor, key incidentKey, since string) error {
+	keyArgs := []interface{}{key.installationID, key.gatewaySerial, key.deviceID, key.errorCode}
+	keyCondition := "installation_id = ? AND gateway_serial = ? AND device_id = ? AND error_code = ?"
+
+	replayFrom := since
+	if since != "" {
+		// Open incidents and incidents ending after the new events may change
+		var firstAffected sql.NullString
+		err := db.QueryRow(
+			"SELECT MIN(start_time) FROM incidents WHERE "+keyCondition+" AND (end_time IS NULL OR end_time >= ?)",
+			append(keyArgs, since)...,
+		).Scan(&firstAffected)
+		if err != nil {
+			return fmt.Errorf("failed to query incidents: %v", err)
+		}
+		if firstAffected.Valid && firstAffected.String < replayFrom {
+			replayFrom = firstAffected.String
+		}
+	}
+
+	if _, err := db.Exec("DELETE FROM incidents WHERE "+keyCondition+" AND start_time >= ?", append(keyArgs, replayFrom)...); err != nil {
+		return fmt.Errorf("failed to delete incidents: %v", err)
+	}
+
+	rows, err := db.Query(`
+		SELECT id, event_timestamp, active, COALESCE(model_id, ''), COALESCE(error_description, ''),
+			COALESCE(code_category, ''), COALESCE(severity, '')
+		FROM events
+		WHERE `+keyCondition+` AND active IS NOT NULL AND event_timestamp >= ?
+		ORDER BY event_timestamp ASC, id ASC
+	`, append(keyArgs, replayFrom)...)
+	if err != nil {
+		return fmt.Errorf("failed to query events for incidents: %v", err)
+	}
+
+	var events []incidentEvent
+	for rows.Next() {
+		var e incidentEvent
+		var active int
+		if err := rows.Scan(&e.id, &e.timestamp, &active, &e.modelID, &e.errorDescription, &e.codeCategory, &e.severity); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan event: %v", err)
+		}
+		e.active = active == 1
+		events = append(events, e)
+	}
+	rows.Close()
+
+	insertSQL := `
+		INSERT INTO incidents (
+			installation_id, gateway_serial, device_id, model_id, error_code,
+			error_description, code_category, severity,
+			start_time, end_time, duration_seconds, start_event_id, end_event_id
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	// Repeated activations extend the open incident, clearings without a
+	// known activation (e.g. before the archive started) are ignored
+	var open *incidentEvent
+	for i := range events {
+		e := &events[i]
+		if e.active {
+			if open == nil {
+				open = e
+			}
+			continue
+		}
+		if open == nil {
+			continue
+		}
+
+		_, err := db.Exec(insertSQL,
+			key.installationID, key.gatewaySerial, key.deviceID, open.modelID, key.errorCode,
+			open.errorDescription, open.codeCategory, open.severity,
+			open.timestamp, e.timestamp, incidentDuration(open.timestamp, e.timestamp), open.id, e.id,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert incident: %v", err)
+		}
+		open = nil
+	}
+
+	if open != nil {
+		_, err := db.Exec(insertSQL,
+			key.installationID, key.gatewaySerial, key.deviceID, open.modelID, key.errorCode,
+			open.errorDescription, open.codeCategory, open.severity,
+			open.timestamp, nil, nil, open.id, nil,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert incident: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// rebuildAllIncidents recreates the incidents table from all archived events
+func rebuildAllIncidents(db sqlExecutor) (int, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT installation_id, gateway_serial, device_id, error_code
+		FROM events
+		WHERE error_code IS NOT NULL AND error_code != '' AND active IS NOT NULL
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query incident keys: %v", err)
+	}
+
+	var keys []incidentKey
+	for rows.Next() {
+		var installationID, gatewaySerial, deviceID sql.NullString
+		var key incidentKey
+		if err := rows.Scan(&installationID, &gatewaySerial, &deviceID, &key.errorCode); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan incident key: %v", err)
+		}
+		key.installationID = installationID.String
+		key.gatewaySerial = gatewaySerial.String
+		key.deviceID = deviceID.String
+		keys = append(keys, key)
+	}
+	rows.Close()
+
+	if _, err := db.Exec("DELETE FROM incidents"); err != nil {
+		return 0, fmt.Errorf("failed to clear incidents: %v", err)
+	}
+	for _, key := range keys {
+		if err := rebuildIncidents(db, key, ""); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// incidentDuration returns the seconds between two event timestamps
+func incidentDuration(start, end string) int64 {
+	startTime, err1 := time.Parse(time.RFC3339, start)
+	endTime, err2 := time.Parse(time.RFC3339, end)
+	if err1 != nil || err2 != nil || endTime.Before(startTime) {
+		return 0
+	}
+	return int64(endTime.Sub(startTime).Seconds())
+}
+
+// IncidentQueryOptions filters incidents; empty fields are ignored
+type IncidentQueryOptions struct {
+	StartTime      time.Time // incidents still active at or after this time
+	EndTime        time.Time // incidents started at or before this time
+	InstallationID string
+	GatewaySerial  string
+	DeviceID       string
+	ErrorCodes     []string
+	Open           *bool
+}
+
+// GetIncidents returns incidents matching the filter, newest first
+func GetIncidents(opts IncidentQueryOptions) ([]Incident, error) {
+	if !dbInitialized || eventDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	var conditions []string
+	var args []interface{}
+
+	if !opts.StartTime.IsZero() {
+		conditions = append(conditions, "(end_time IS NULL OR end_time >= ?)")
+		args = append(args, opts.StartTime.UTC().Format(time.RFC3339))
+	}
+	if !opts.EndTime.IsZero() {
+		conditions = append(conditions, "start_time <= ?")
+		args = append(args, opts.EndTime.UTC().Format(time.RFC3339))
+	}
+	for column, value := range map[string]string{
+		"installation_id": opts.InstallationID,
+		"gateway_serial":  opts.GatewaySerial,
+		"device_id":       opts.DeviceID,
+	} {
+		if value != "" {
+			conditions = append(conditions, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	conditions, args = addInFilter(conditions, args, "error_code", opts.ErrorCodes)
+	if opts.Open != nil {
+		if *opts.Open {
+			conditions = append(conditions, "end_time IS NULL")
+		} else {
+			conditions = append(conditions, "end_time IS NOT NULL")
+		}
+	}
+
+	query := `
+		SELECT id, installation_id, gateway_serial, device_id, COALESCE(model_id, ''), error_code,
+			COALESCE(error_description, ''), COALESCE(code_category, ''), COALESCE(severity, ''),
+			start_time, end_time, duration_seconds
+		FROM incidents`
+	if len(conditions) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conditions, " AND ")
+	}
+	query += "\n\t\tORDER BY start_time DESC, id DESC"
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	rows, err := eventDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incidents: %v", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	incidents := []Incident{}
+	for rows.Next() {
+		var inc Incident
+		var endTime sql.NullString
+		var duration sql.NullInt64
+		err := rows.Scan(
+			&inc.ID, &inc.InstallationID, &inc.GatewaySerial, &inc.DeviceID, &inc.ModelID, &inc.ErrorCode,
+			&inc.ErrorDescription, &inc.CodeCategory, &inc.Severity,
+			&inc.StartTime, &endTime, &duration,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan incident: %v", err)
+		}
+
+		if endTime.Valid {
+			inc.EndTime = endTime.String
+			inc.DurationSeconds = duration.Int64
+		} else {
+			inc.Open = true
+			inc.DurationSeconds = incidentDuration(inc.StartTime, now.UTC().Format(time.RFC3339))
+		}
+		incidents = append(incidents, inc)
+	}
+
+	return incidents, nil
+}
+
+// computeIncidentStats aggregates incidents per error code
+// MTTR is the mean duration of cleared incidents, MTBF the mean time between
+// an incident's clearing and the next activation of the same code on the same device.
+func computeIncidentStats(incidents []Incident) []IncidentCodeStats {
+	byCode := make(map[string][]Incident)
+	for _, inc := range incidents {
+		byCode[inc.ErrorCode] = append(byCode[inc.ErrorCode], inc)
+	}
+
+	stats := make([]IncidentCodeStats, 0, len(byCode))
+	for code, list := range byCode {
+		s := IncidentCodeStats{
+			ErrorCode:   code,
+			Occurrences: len(list),
+		}
+
+		byDevice := make(map[string][]Incident)
+		var repairSeconds int64
+		var cleared int
+		for _, inc := range list {
+			s.TotalDowntimeSeconds += inc.DurationSeconds
+			if inc.Open {
+				s.OpenCount++
+			} else {
+				repairSeconds += inc.DurationSeconds
+				cleared++
+			}
+			if s.FirstOccurrence == "" || inc.StartTime < s.FirstOccurrence {
+				s.FirstOccurrence = inc.StartTime
+			}
+			if inc.StartTime >= s.LastOccurrence {
+				s.LastOccurrence = inc.StartTime
+				s.ErrorDescription = inc.ErrorDescription
+				s.Severity = inc.Severity
+			}
+			device := inc.InstallationID + "|" + inc.GatewaySerial + "|" + inc.DeviceID
+			byDevice[device] = append(byDevice[device], inc)
+		}
+		s.Devices = len(byDevice)
+		if cleared > 0 {
+			s.MTTRSeconds = float64(repairSeconds) / float64(cleared)
+		}
+
+		var uptimeSeconds int64
+		var gaps int
+		for _, deviceIncidents := range byDevice {
+			sort.Slice(deviceIncidents, func(i, j int) bool {
+				return deviceIncidents[i].StartTime < deviceIncidents[j].StartTime
+			})
+			for i := 1; i < len(deviceIncidents); i++ {
+				prev := deviceIncidents[i-1]
+				if prev.Open {
+					continue
+				}
+				uptimeSeconds += incidentDuration(prev.EndTime, deviceIncidents[i].StartTime)
+				gaps++
+			}
+		}
+		if gaps > 0 {
+			s.MTBFSeconds = float64(uptimeSeconds) / float64(gaps)
+		}
+
+		stats = append(stats, s)
+	}
+
+	// Most frequent faults first
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Occurrences != stats[j].Occurrences {
+			return stats[i].Occurrences > stats[j].Occurrences
+		}
+		return stats[i].ErrorCode < stats[j].ErrorCode
+	})
+
+	return stats
+}
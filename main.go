@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"embed"
+	"flag"
 	"fmt"
 	"log"
 	"net"
@@ -26,6 +27,8 @@ var staticFS embed.FS
 const (
 	// Viessmann API constants
 	defaultClientSecret = "8ad97aceb92c5892e102b093c7c083fa"
+	defaultAPIBaseURL   = "https://api.viessmann-climatesolutions.com"
+	defaultIAMBaseURL   = "https://iam.viessmann-climatesolutions.com"
 )
 
 var (
@@ -34,6 +37,10 @@ var (
 	commit  = "unknown"
 	date    = "unknown"
 
+	// API endpoints - override to point the app at a staging instance or local mock
+	apiBaseURL = strings.TrimRight(getEnv("VICARE_API_BASE_URL", defaultAPIBaseURL), "/")
+	iamBaseURL = strings.TrimRight(getEnv("VICARE_IAM_BASE_URL", defaultIAMBaseURL), "/")
+
 	// Configuration - will be loaded from keyring or env
 	currentCreds *Credentials // Legacy support
 
@@ -55,6 +62,14 @@ var (
 	tokenExpiry  time.Time
 )
 
+// setAPIBaseURLs points all request builders at new API and IAM base URLs
+func setAPIBaseURLs(api, iam string) {
+	apiBaseURL = strings.TrimRight(api, "/")
+	iamBaseURL = strings.TrimRight(iam, "/")
+	authorizeURL = iamBaseURL + "/idp/v3/authorize"
+	tokenURL = iamBaseURL + "/idp/v3/token"
+}
+
 // tryBindAddress versucht auf der angegebenen Adresse zu binden.
 // Wenn der Port belegt ist, wird Port+1 versucht (max 1x Retry).
 // Gibt die finale Bind-Adresse und den lokalen URL-Präfix für den Benutzer zurück.
@@ -105,9 +120,36 @@ func main() {
 	_, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	simulate := flag.Bool("simulate", false, "run against the built-in Viessmann API simulator instead of the real API")
+	flag.Parse()
+
+	// Subcommands run once and exit without starting the web server
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args()))
+	}
+
+	// Simulator mode: serve a fake API locally and use an in-memory demo account
+	if simulatorEnabled(*simulate) {
+		storage = newSimulatorStorage()
+		simURL, err := StartSimulator(getEnv("VICARE_SIM_ADDRESS", "127.0.0.1:0"))
+		if err != nil {
+			log.Fatalf("Failed to start API simulator: %v", err)
+		}
+		setAPIBaseURLs(simURL, simURL)
+		log.Printf("Simulator mode enabled - API simulator listening on %s\n", simURL)
+	}
+
+	// Optional recording/replay of API traffic (VICARE_RECORD_DIR / VICARE_REPLAY_DIR)
+	if err := installAPITrafficCapture(); err != nil {
+		log.Fatalf("Failed to set up API traffic capture: %v", err)
+	}
+
 	// Initialize account management
 	accountTokens = make(map[string]*AccountToken)
 
+	// Resume from cached tokens to avoid a login burst on restart
+	restoreAccountTokens()
+
 	// Try to load credentials from keyring first
 	loadStoredCredentials()
 
@@ -161,13 +203,17 @@ func main() {
 
 	// Heating curve control
 	http.HandleFunc("/api/heating/curve/set", heatingCurveSetHandler)
+	http.HandleFunc("/api/heating/curve/analysis", HandleHeatingCurveAnalysis)
+	http.HandleFunc("/api/heating/curve/apply", heatingCurveApplyHandler)
 	http.HandleFunc("/api/heating/mode/set", heatingModeSetHandler)
 	http.HandleFunc("/api/heating/supplyTempMax/set", supplyTempMaxSetHandler)
 	http.HandleFunc("/api/heating/roomTemp/set", roomTempSetHandler)
 
 	// Data endpoints
 	http.HandleFunc("/api/events", eventsHandler)
+	http.HandleFunc("/api/events/query", eventsQueryHandler)
 	http.HandleFunc("/api/status", statusHandler)
+	http.HandleFunc("/api/rate-limit", rateLimitHandler)
 	http.HandleFunc("/api/devices", devicesHandler)
 	http.HandleFunc("/api/features", featuresHandler)
 
@@ -202,19 +248,75 @@ func main() {
 	http.HandleFunc("/api/event-archive/settings", eventArchiveSettingsGetHandler)
 	http.HandleFunc("/api/event-archive/settings/set", eventArchiveSettingsSetHandler)
 	http.HandleFunc("/api/event-archive/stats", eventArchiveStatsHandler)
+	http.HandleFunc("/api/incidents", incidentsHandler)
+
+	// Alerting endpoints
+	http.HandleFunc("/api/alerts/settings", alertSettingsGetHandler)
+	http.HandleFunc("/api/alerts/settings/set", alertSettingsSetHandler)
+	http.HandleFunc("/api/alerts/test", alertTestHandler)
+	http.HandleFunc("/api/alerts/status", alertStatusHandler)
+
+	// MQTT endpoints
+	http.HandleFunc("/api/mqtt/settings", mqttSettingsGetHandler)
+	http.HandleFunc("/api/mqtt/settings/set", mqttSettingsSetHandler)
+	http.HandleFunc("/api/mqtt/status", mqttStatusHandler)
+
+	// Snapshot sink endpoints (InfluxDB / Prometheus remote write)
+	http.HandleFunc("/api/snapshot-sink/settings", snapshotSinkSettingsGetHandler)
+	http.HandleFunc("/api/snapshot-sink/settings/set", snapshotSinkSettingsSetHandler)
+	http.HandleFunc("/api/snapshot-sink/status", snapshotSinkStatusHandler)
+	http.HandleFunc("/api/snapshot-sink/backfill", snapshotSinkBackfillHandler)
+
+	// Export endpoints (CSV / JSON Lines / Parquet downloads)
+	http.HandleFunc("/api/export/events", exportEventsHandler)
+	http.HandleFunc("/api/export/temperatures", exportTemperaturesHandler)
+
+	// Import endpoint (historical CSV / JSON data)
+	http.HandleFunc("/api/import", importHandler)
 
 	// Temperature log endpoints
 	http.HandleFunc("/api/temperature-log/settings", handleTemperatureLogSettings)
 	http.HandleFunc("/api/temperature-log/settings/set", handleSetTemperatureLogSettings)
 	http.HandleFunc("/api/temperature-log/stats", handleTemperatureLogStats)
 	http.HandleFunc("/api/temperature-log/data", handleTemperatureLogData)
+	http.HandleFunc("/api/temperature-log/devices", handleDeviceLoggingSettings)
+	http.HandleFunc("/api/temperature-log/devices/set", handleSetDeviceLoggingSettings)
+
+	// Generic feature history endpoints
+	http.HandleFunc("/api/feature-history/settings", featureHistorySettingsGetHandler)
+	http.HandleFunc("/api/feature-history/settings/set", featureHistorySettingsSetHandler)
+	http.HandleFunc("/api/feature-history/data", featureHistoryDataHandler)
+	http.HandleFunc("/api/feature-history/series", featureHistorySeriesHandler)
 
 	// Consumption statistics endpoint
 	http.HandleFunc("/api/consumption/stats", HandleConsumptionStats)
+	http.HandleFunc("/api/consumption/spf", HandleSeasonalPerformance)
+	http.HandleFunc("/api/consumption/costs", HandleElectricityCosts)
+	http.HandleFunc("/api/consumption/compare", HandleConsumptionComparison)
+	http.HandleFunc("/api/consumption/degree-days", HandleDegreeDays)
+	http.HandleFunc("/api/consumption/degree-days/settings", handleDegreeDaySettings)
+	http.HandleFunc("/api/consumption/degree-days/settings/set", handleSetDegreeDaySettings)
+	http.HandleFunc("/api/consumption/signature", HandleEnergySignature)
+
+	// Compressor run and short-cycling endpoints
+	http.HandleFunc("/api/compressor/runs", HandleCompressorRuns)
+	http.HandleFunc("/api/compressor/cycles", HandleCompressorCycles)
+	http.HandleFunc("/api/compressor/cycles/settings", handleCycleSettings)
+	http.HandleFunc("/api/compressor/cycles/settings/set", handleSetCycleSettings)
+
+	// Electricity tariff endpoints
+	http.HandleFunc("/api/tariffs/settings", handleTariffSettings)
+	http.HandleFunc("/api/tariffs/settings/set", handleSetTariffSettings)
+	http.HandleFunc("/api/tariffs/prices", handleTariffPrices)
+	http.HandleFunc("/api/tariffs/prices/import", handleImportTariffPrices)
+	http.HandleFunc("/api/tariffs/prices/refresh", handleRefreshTariffPrices)
 
 	// Health check endpoint (verifies DB writability for Kubernetes probes)
 	http.HandleFunc("/health", healthHandler)
 
+	// Prometheus metrics endpoint
+	http.HandleFunc("/metrics", metricsHandler)
+
 	// Start event archive scheduler if enabled
 	go func() {
 		// Small delay to ensure everything is initialized
@@ -230,6 +332,44 @@ func main() {
 		if err != nil {
 			log.Printf("Temperature scheduler initialization: %v", err)
 		}
+
+		// Start alert engine
+		err = StartAlertEngine()
+		if err != nil {
+			log.Printf("Alert engine initialization: %v", err)
+		}
+
+		// Connect MQTT publisher if enabled
+		err = StartMQTTPublisher()
+		if err != nil {
+			log.Printf("MQTT publisher initialization: %v", err)
+		}
+
+		// Start snapshot sink if configured
+		err = StartSnapshotSink()
+		if err != nil {
+			log.Printf("Snapshot sink initialization: %v", err)
+		}
+
+		// Fetch dynamic electricity prices from their source URLs
+		if dbInitialized {
+			err = StartTariffPriceRefresher()
+			if err != nil {
+				log.Printf("Tariff price refresher initialization: %v", err)
+			}
+		}
+
+		// Bring temperature rollups and compressor runs up to date (builds them from the existing history after an upgrade)
+		if dbInitialized {
+			err = UpdateTemperatureRollups()
+			if err != nil {
+				log.Printf("Temperature rollup update: %v", err)
+			}
+			err = UpdateCompressorRuns()
+			if err != nil {
+				log.Printf("Compressor run detection: %v", err)
+			}
+		}
 	}()
 
 	// Get bind address from environment, with backward compatibility for PORT
@@ -280,6 +420,18 @@ func main() {
 	log.Println("Stopping temperature scheduler...")
 	StopTemperatureScheduler()
 
+	log.Println("Stopping alert engine...")
+	StopAlertEngine()
+
+	log.Println("Stopping MQTT publisher...")
+	StopMQTTPublisher()
+
+	log.Println("Stopping snapshot sink...")
+	StopSnapshotSink()
+
+	log.Println("Stopping tariff price refresher...")
+	StopTariffPriceRefresher()
+
 	// Give schedulers time to finish current operations
 	time.Sleep(500 * time.Millisecond)
 
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Prometheus exporter for device telemetry and application health.
+// The text exposition format is written directly to avoid a client library dependency.
+
+// metricsSnapshotMaxAge hides devices that stopped reporting
+const metricsSnapshotMaxAge = 24 * time.Hour
+
+// jobStats tracks runs of a background job
+type jobStats struct {
+	runs         int64
+	failures     int64
+	lastDuration time.Duration
+	lastSuccess  time.Time
+}
+
+var (
+	jobMetricsMutex sync.Mutex
+	jobMetrics      = make(map[string]*jobStats)
+
+	featuresCacheHits   atomic.Int64
+	featuresCacheMisses atomic.Int64
+
+	eventMetricsMutex sync.Mutex
+	eventMetrics      = make(map[[3]string]int64) // code_category, severity, error_code -> new events
+)
+
+// recordJobRun records the duration and outcome of a scheduler run
+func recordJobRun(job string, started time.Time, failed bool) {
+	jobMetricsMutex.Lock()
+	defer jobMetricsMutex.Unlock()
+
+	stats, ok := jobMetrics[job]
+	if !ok {
+		stats = &jobStats{}
+		jobMetrics[job] = stats
+	}
+	stats.runs++
+	stats.lastDuration = time.Since(started)
+	if failed {
+		stats.failures++
+	} else {
+		stats.lastSuccess = time.Now()
+	}
+}
+
+// countEventMetrics counts newly archived events
+func countEventMetrics(events []Event) {
+	eventMetricsMutex.Lock()
+	defer eventMetricsMutex.Unlock()
+
+	for i := range events {
+		eventMetrics[[3]string{events[i].CodeCategory, events[i].Severity, events[i].ErrorCode}]++
+	}
+}
+
+// metricsWriter writes the Prometheus text format
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+func (m *metricsWriter) family(name, typ, help string) {
+	fmt.Fprintf(&m.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes one sample, labels are given as name/value pairs
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	m.buf.WriteString(name)
+	if len(labels) > 0 {
+		m.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.buf.WriteByte(',')
+			}
+			fmt.Fprintf(&m.buf, "%s=\"%s\"", labels[i], metricsLabelEscaper.Replace(labels[i+1]))
+		}
+		m.buf.WriteByte('}')
+	}
+	m.buf.WriteByte(' ')
+	m.buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	m.buf.WriteByte('\n')
+}
+
+var metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricsTokenValid checks the bearer token configured with METRICS_TOKEN
+func metricsTokenValid(r *http.Request) bool {
+	token := os.Getenv("METRICS_TOKEN")
+	if token == "" {
+		return false
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// metricsHandler handles GET /metrics
+// If METRICS_TOKEN is set, a matching bearer token is required (and replaces Basic Auth)
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if os.Getenv("METRICS_TOKEN") != "" && !metricsTokenValid(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ViEventLog metrics"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	m := &metricsWriter{}
+	writeAPIMetrics(m)
+	writeJobMetrics(m)
+	writeCacheMetrics(m)
+	writeTokenMetrics(m)
+	writeEventMetrics(m)
+	if dbInitialized {
+		if err := writeDatabaseMetrics(m); err != nil {
+			log.Printf("Metrics: failed to read database metrics: %v", err)
+		}
+		if err := writeSnapshotMetrics(m); err != nil {
+			log.Printf("Metrics: failed to read temperature snapshots: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(m.buf.Bytes())
+}
+
+func writeAPIMetrics(m *metricsWriter) {
+	status := apiLimiter.Status()
+
+	m.family("vieventlog_api_calls", "gauge", "Viessmann API calls in the sliding window")
+	m.sample("vieventlog_api_calls", float64(status.Used10Min), "window", "10m")
+	m.sample("vieventlog_api_calls", float64(status.Used24Hr), "window", "24h")
+
+	m.family("vieventlog_api_limit", "gauge", "Viessmann API call limit for the window")
+	m.sample("vieventlog_api_limit", float64(status.Limit10Min), "window", "10m")
+	m.sample("vieventlog_api_limit", float64(status.Limit24Hr), "window", "24h")
+
+	m.family("vieventlog_api_budget_remaining", "gauge", "Remaining tokens in the rate limiter bucket")
+	m.sample("vieventlog_api_budget_remaining", float64(status.Remaining10Min), "window", "10m")
+	m.sample("vieventlog_api_budget_remaining", float64(status.Remaining24Hr), "window", "24h")
+
+	priorities := make([]string, 0, len(status.Priorities))
+	for p := range status.Priorities {
+		priorities = append(priorities, p)
+	}
+	sort.Strings(priorities)
+
+	m.family("vieventlog_api_requests_total", "counter", "API requests handled by the rate limiter by priority and outcome")
+	for _, p := range priorities {
+		state := status.Priorities[p]
+		m.sample("vieventlog_api_requests_total", float64(state.Allowed), "priority", p, "outcome", "allowed")
+		m.sample("vieventlog_api_requests_total", float64(state.Deferred), "priority", p, "outcome", "deferred")
+		m.sample("vieventlog_api_requests_total", float64(state.Dropped), "priority", p, "outcome", "dropped")
+	}
+
+	throttled := 0.0
+	if apiThrottledError() != nil {
+		throttled = 1
+	}
+	m.family("vieventlog_api_throttled", "gauge", "1 while the Viessmann API rate-limits this client")
+	m.sample("vieventlog_api_throttled", throttled)
+}
+
+func writeJobMetrics(m *metricsWriter) {
+	jobMetricsMutex.Lock()
+	defer jobMetricsMutex.Unlock()
+
+	jobs := make([]string, 0, len(jobMetrics))
+	for job := range jobMetrics {
+		jobs = append(jobs, job)
+	}
+	sort.Strings(jobs)
+
+	m.family("vieventlog_job_runs_total", "counter", "Scheduler job runs")
+	for _, job := range jobs {
+		m.sample("vieventlog_job_runs_total", float64(jobMetrics[job].runs), "job", job)
+	}
+	m.family("vieventlog_job_failures_total", "counter", "Scheduler job runs that failed")
+	for _, job := range jobs {
+		m.sample("vieventlog_job_failures_total", float64(jobMetrics[job].failures), "job", job)
+	}
+	m.family("vieventlog_job_duration_seconds", "gauge", "Duration of the last scheduler job run")
+	for _, job := range jobs {
+		m.sample("vieventlog_job_duration_seconds", jobMetrics[job].lastDuration.Seconds(), "job", job)
+	}
+	m.family("vieventlog_job_last_success_timestamp_seconds", "gauge", "Time of the last successful scheduler job run")
+	for _, job := range jobs {
+		if !jobMetrics[job].lastSuccess.IsZero() {
+			m.sample("vieventlog_job_last_success_timestamp_seconds", float64(jobMetrics[job].lastSuccess.Unix()), "job", job)
+		}
+	}
+
+	running := func(b bool) float64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	m.family("vieventlog_scheduler_running", "gauge", "1 if the scheduler is running")
+	m.sample("vieventlog_scheduler_running", running(IsSchedulerRunning()), "job", "event_archive")
+	m.sample("vieventlog_scheduler_running", running(IsTemperatureSchedulerRunning()), "job", "temperature_log")
+}
+
+func writeCacheMetrics(m *metricsWriter) {
+	m.family("vieventlog_features_cache_requests_total", "counter", "Feature cache lookups by result")
+	m.sample("vieventlog_features_cache_requests_total", float64(featuresCacheHits.Load()), "result", "hit")
+	m.sample("vieventlog_features_cache_requests_total", float64(featuresCacheMisses.Load()), "result", "miss")
+
+	featuresCacheMutex.RLock()
+	entries := len(featuresCache)
+	featuresCacheMutex.RUnlock()
+	m.family("vieventlog_features_cache_entries", "gauge", "Devices in the feature cache")
+	m.sample("vieventlog_features_cache_entries", float64(entries))
+}
+
+func writeTokenMetrics(m *metricsWriter) {
+	accountsMutex.RLock()
+	defer accountsMutex.RUnlock()
+
+	accounts := make([]string, 0, len(accountTokens))
+	for accountID := range accountTokens {
+		accounts = append(accounts, accountID)
+	}
+	sort.Strings(accounts)
+
+	m.family("vieventlog_token_expiry_timestamp_seconds", "gauge", "Expiry time of the access token per account")
+	for _, accountID := range accounts {
+		if expiry := accountTokens[accountID].TokenExpiry; !expiry.IsZero() {
+			m.sample("vieventlog_token_expiry_timestamp_seconds", float64(expiry.Unix()), "account", accountID)
+		}
+	}
+}
+
+func writeEventMetrics(m *metricsWriter) {
+	eventMetricsMutex.Lock()
+	defer eventMetricsMutex.Unlock()
+
+	keys := make([][3]string, 0, len(eventMetrics))
+	for key := range eventMetrics {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.Join(keys[i][:], "\x00") < strings.Join(keys[j][:], "\x00")
+	})
+
+	m.family("vieventlog_events_total", "counter", "Newly archived events")
+	for _, key := range keys {
+		m.sample("vieventlog_events_total", float64(eventMetrics[key]),
+			"code_category", key[0], "severity", key[1], "error_code", key[2])
+	}
+}
+
+func writeDatabaseMetrics(m *metricsWriter) error {
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	var pageCount, pageSize int64
+	if err := eventDB.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return err
+	}
+	if err := eventDB.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return err
+	}
+	m.family("vieventlog_database_size_bytes", "gauge", "Size of the SQLite database")
+	m.sample("vieventlog_database_size_bytes", float64(pageCount*pageSize))
+
+	m.family("vieventlog_archived_events", "gauge", "Events in the archive by category and severity")
+	rows, err := eventDB.Query(`SELECT COALESCE(code_category, ''), COALESCE(severity, ''), COUNT(*)
+		FROM events GROUP BY 1, 2 ORDER BY 1, 2`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var category, severity string
+		var count int64
+		if err := rows.Scan(&category, &severity, &count); err != nil {
+			return err
+		}
+		m.sample("vieventlog_archived_events", float64(count), "code_category", category, "severity", severity)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var snapshots int64
+	if err := eventDB.QueryRow("SELECT COUNT(*) FROM temperature_snapshots").Scan(&snapshots); err != nil {
+		return err
+	}
+	m.family("vieventlog_temperature_snapshots", "gauge", "Temperature snapshots in the database")
+	m.sample("vieventlog_temperature_snapshots", float64(snapshots))
+	return nil
+}
+
+// latestSnapshots returns the most recent snapshot of every device
+func latestSnapshots() ([]TemperatureSnapshot, error) {
+	type deviceKey struct{ installationID, gatewayID, deviceID, timestamp string }
+
+	dbMutex.RLock()
+	rows, err := eventDB.Query(`SELECT installation_id, gateway_id, device_id, MAX(timestamp)
+		FROM temperature_snapshots WHERE timestamp >= ?
+		GROUP BY installation_id, gateway_id, device_id`,
+		time.Now().Add(-metricsSnapshotMaxAge).UTC().Format(time.RFC3339))
+	if err != nil {
+		dbMutex.RUnlock()
+		return nil, err
+	}
+	var devices []deviceKey
+	for rows.Next() {
+		var d deviceKey
+		if err := rows.Scan(&d.installationID, &d.gatewayID, &d.deviceID, &d.timestamp); err != nil {
+			rows.Close()
+			dbMutex.RUnlock()
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	rows.Close()
+	dbMutex.RUnlock()
+
+	var snapshots []TemperatureSnapshot
+	for _, d := range devices {
+		ts, err := time.Parse(time.RFC3339, d.timestamp)
+		if err != nil {
+			continue
+		}
+		latest, err := GetTemperatureSnapshots(d.installationID, d.gatewayID, d.deviceID, ts, ts, 1)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, latest...)
+	}
+	return snapshots, nil
+}
+
+// writeSnapshotMetrics exports every numeric and boolean TemperatureSnapshot field
+// of the latest snapshot per device as a gauge
+func writeSnapshotMetrics(m *metricsWriter) error {
+	snapshots, err := latestSnapshots()
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	labels := func(s *TemperatureSnapshot) []string {
+		return []string{"installation_id", s.InstallationID, "gateway_id", s.GatewayID, "device_id", s.DeviceID}
+	}
+
+	m.family("vieventlog_snapshot_timestamp_seconds", "gauge", "Time of the latest temperature snapshot")
+	for i := range snapshots {
+		m.sample("vieventlog_snapshot_timestamp_seconds", float64(snapshots[i].Timestamp.Unix()), labels(&snapshots[i])...)
+	}
+
+	floatType := reflect.TypeOf((*float64)(nil))
+	boolType := reflect.TypeOf((*bool)(nil))
+	t := reflect.TypeOf(TemperatureSnapshot{})
+	for f := 0; f < t.NumField(); f++ {
+		field := t.Field(f)
+		if field.Type != floatType && field.Type != boolType {
+			continue
+		}
+		name := "vieventlog_" + strings.Split(field.Tag.Get("json"), ",")[0]
+
+		headerWritten := false
+		for i := range snapshots {
+			value := reflect.ValueOf(&snapshots[i]).Elem().Field(f)
+			if value.IsNil() {
+				continue
+			}
+			if !headerWritten {
+				m.family(name, "gauge", "Latest "+strings.Split(field.Tag.Get("json"), ",")[0]+" from the temperature log")
+				headerWritten = true
+			}
+
+			v := 0.0
+			if field.Type == floatType {
+				v = value.Elem().Float()
+			} else if value.Elem().Bool() {
+				v = 1
+			}
+			m.sample(name, v, labels(&snapshots[i])...)
+		}
+	}
+	return nil
+}
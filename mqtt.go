@@ -0,0 +1,399 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MQTT publisher for live feature values and archived events.
+// Feature values are published whenever fresh data is fetched from the API
+// (temperature scheduler or dashboard), so MQTT never causes extra API calls.
+//
+// Topics:
+//   <prefix>/status                                      online/offline (retained, last will)
+//   <prefix>/<installation>/<gateway>/<device>/<feature> {"value":..,"unit":..,"type":..,"timestamp":..}
+//   <prefix>/<installation>/<gateway>/<device>/snapshot  logged temperature snapshot as JSON
+//   <prefix>/<installation>/<gateway>/events             archived event as JSON
+//
+// Home Assistant discovery and command topics are handled in mqtt_homeassistant.go.
+
+const (
+	mqttDefaultTopicPrefix = "vieventlog"
+	haDefaultDiscovery     = "homeassistant"
+	mqttPublishTimeout     = 10 * time.Second
+)
+
+// MQTTSettings holds the broker connection and publishing options
+type MQTTSettings struct {
+	Enabled        bool   `json:"enabled"`
+	Broker         string `json:"broker"` // tcp://host:1883, ssl://host:8883, ws://host:9001/mqtt
+	ClientID       string `json:"clientId"`
+	Username       string `json:"username,omitempty"`
+	Password       string `json:"password,omitempty"`
+	TopicPrefix    string `json:"topicPrefix"`
+	QoS            byte   `json:"qos"`          // 0, 1 or 2
+	Retain         bool   `json:"retain"`       // retain feature values
+	RetainEvents   bool   `json:"retainEvents"` // retain the last event per gateway
+	TLSInsecure    bool   `json:"tlsInsecure,omitempty"`
+	CACertFile     string `json:"caCertFile,omitempty"`
+	ClientCertFile string `json:"clientCertFile,omitempty"`
+	ClientKeyFile  string `json:"clientKeyFile,omitempty"`
+
+	// Home Assistant MQTT discovery
+	HomeAssistant         bool   `json:"homeAssistant"`
+	DiscoveryPrefix       string `json:"discoveryPrefix"`
+	HomeAssistantControls bool   `json:"homeAssistantControls"` // accept commands from HA
+}
+
+// MQTTStatus is returned by /api/mqtt/status
+type MQTTStatus struct {
+	Enabled       bool   `json:"enabled"`
+	Connected     bool   `json:"connected"`
+	Broker        string `json:"broker,omitempty"`
+	Published     int64  `json:"published"`
+	LastPublished string `json:"lastPublished,omitempty"`
+	LastError     string `json:"lastError,omitempty"`
+}
+
+type mqttPublisher struct {
+	mu            sync.Mutex
+	client        mqtt.Client
+	settings      *MQTTSettings
+	lastValues    map[string]string // topic -> last payload without timestamp
+	haAnnounced   map[string]bool   // discovery config topics already published
+	published     int64
+	lastPublished time.Time
+	lastError     string
+}
+
+var mqttPub = &mqttPublisher{
+	lastValues:  make(map[string]string),
+	haAnnounced: make(map[string]bool),
+}
+
+// StartMQTTPublisher connects to the broker if MQTT is enabled
+func StartMQTTPublisher() error {
+	settings, err := GetMQTTSettings()
+	if err != nil {
+		return err
+	}
+	if !settings.Enabled {
+		log.Println("MQTT publishing is disabled")
+		return nil
+	}
+
+	opts, err := mqttClientOptions(settings)
+	if err != nil {
+		return err
+	}
+
+	mqttPub.mu.Lock()
+	defer mqttPub.mu.Unlock()
+
+	if mqttPub.client != nil {
+		return nil
+	}
+
+	client := mqtt.NewClient(opts)
+	mqttPub.client = client
+	mqttPub.settings = settings
+	mqttPub.lastValues = make(map[string]string)
+	mqttPub.haAnnounced = make(map[string]bool)
+	mqttPub.lastError = ""
+
+	// Connect in the background; paho keeps retrying until the broker is reachable
+	client.Connect()
+	log.Printf("MQTT publisher started (broker: %s, prefix: %s)", settings.Broker, settings.TopicPrefix)
+	return nil
+}
+
+// StopMQTTPublisher publishes the offline status and disconnects
+func StopMQTTPublisher() {
+	mqttPub.mu.Lock()
+	defer mqttPub.mu.Unlock()
+
+	if mqttPub.client == nil {
+		return
+	}
+
+	if mqttPub.client.IsConnected() {
+		token := mqttPub.client.Publish(mqttPub.settings.TopicPrefix+"/status", mqttPub.settings.QoS, true, "offline")
+		token.WaitTimeout(2 * time.Second)
+	}
+	mqttPub.client.Disconnect(250)
+	mqttPub.client = nil
+	log.Println("MQTT publisher stopped")
+}
+
+// RestartMQTTPublisher reconnects with new settings
+func RestartMQTTPublisher() error {
+	StopMQTTPublisher()
+	return StartMQTTPublisher()
+}
+
+// mqttClientOptions builds the paho client options from the settings
+func mqttClientOptions(settings *MQTTSettings) (*mqtt.ClientOptions, error) {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(settings.Broker)
+	opts.SetClientID(settings.ClientID)
+	opts.SetUsername(settings.Username)
+	opts.SetPassword(settings.Password)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	opts.SetConnectRetryInterval(30 * time.Second)
+	opts.SetMaxReconnectInterval(5 * time.Minute)
+	opts.SetWill(settings.TopicPrefix+"/status", "offline", settings.QoS, true)
+
+	opts.SetOnConnectHandler(func(c mqtt.Client) {
+		log.Printf("MQTT connected to %s", settings.Broker)
+		c.Publish(settings.TopicPrefix+"/status", settings.QoS, true, "online")
+
+		// Republish everything after a reconnect so retained values are current
+		mqttPub.mu.Lock()
+		mqttPub.lastValues = make(map[string]string)
+		mqttPub.haAnnounced = make(map[string]bool)
+		mqttPub.mu.Unlock()
+
+		if settings.HomeAssistant {
+			subscribeHomeAssistant(c, settings)
+		}
+	})
+	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
+		log.Printf("MQTT connection lost: %v", err)
+		mqttPub.recordError(err)
+	})
+
+	if strings.HasPrefix(settings.Broker, "ssl://") || strings.HasPrefix(settings.Broker, "tls://") ||
+		strings.HasPrefix(settings.Broker, "mqtts://") || strings.HasPrefix(settings.Broker, "wss://") {
+		tlsConfig, err := mqttTLSConfig(settings)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	return opts, nil
+}
+
+// mqttTLSConfig loads the optional CA and client certificates
+func mqttTLSConfig(settings *MQTTSettings) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: settings.TLSInsecure}
+
+	if settings.CACertFile != "" {
+		caCert, err := os.ReadFile(settings.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in %s", settings.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if settings.ClientCertFile != "" || settings.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(settings.ClientCertFile, settings.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// publish sends a message in the background and records the result
+func (p *mqttPublisher) publish(topic string, retained bool, payload []byte) {
+	p.mu.Lock()
+	client, settings := p.client, p.settings
+	p.mu.Unlock()
+
+	if client == nil || !client.IsConnected() {
+		return
+	}
+
+	token := client.Publish(topic, settings.QoS, retained, payload)
+	go func() {
+		if !token.WaitTimeout(mqttPublishTimeout) {
+			p.recordError(fmt.Errorf("publish to %s timed out", topic))
+			return
+		}
+		if err := token.Error(); err != nil {
+			p.recordError(err)
+			return
+		}
+		p.mu.Lock()
+		p.published++
+		p.lastPublished = time.Now()
+		p.mu.Unlock()
+	}()
+}
+
+func (p *mqttPublisher) recordError(err error) {
+	p.mu.Lock()
+	p.lastError = err.Error()
+	p.mu.Unlock()
+}
+
+// active returns the current settings if the publisher is connected
+func (p *mqttPublisher) active() *MQTTSettings {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client == nil || !p.client.IsConnected() {
+		return nil
+	}
+	return p.settings
+}
+
+// mqttTopicLevel makes an ID safe to use as a single topic level
+func mqttTopicLevel(s string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(s)
+}
+
+// PublishDeviceFeatures publishes all parsed feature values of a device.
+// Values are only sent when they changed since the last publish.
+func PublishDeviceFeatures(df *DeviceFeatures) {
+	settings := mqttPub.active()
+	if settings == nil || df == nil {
+		return
+	}
+
+	base := strings.Join([]string{
+		settings.TopicPrefix,
+		mqttTopicLevel(df.InstallationID),
+		mqttTopicLevel(df.GatewayID),
+		mqttTopicLevel(df.DeviceID),
+	}, "/")
+	timestamp := df.LastUpdate.Format(time.RFC3339)
+
+	for _, group := range []map[string]FeatureValue{df.Temperatures, df.OperatingModes, df.DHW, df.Circuits, df.Other} {
+		for name, value := range group {
+			if value.Value == nil {
+				continue
+			}
+
+			topic := base + "/" + mqttTopicLevel(name)
+			current, err := json.Marshal(value)
+			if err != nil {
+				continue
+			}
+
+			mqttPub.mu.Lock()
+			unchanged := mqttPub.lastValues[topic] == string(current)
+			mqttPub.lastValues[topic] = string(current)
+			mqttPub.mu.Unlock()
+			if unchanged {
+				continue
+			}
+
+			payload, err := json.Marshal(map[string]interface{}{
+				"value":     value.Value,
+				"unit":      value.Unit,
+				"type":      value.Type,
+				"timestamp": timestamp,
+			})
+			if err != nil {
+				continue
+			}
+			mqttPub.publish(topic, settings.Retain, payload)
+		}
+	}
+
+	if settings.HomeAssistant {
+		announceHomeAssistantControls(settings, df)
+	}
+}
+
+// PublishEvents publishes newly archived events
+func PublishEvents(events []Event) {
+	settings := mqttPub.active()
+	if settings == nil {
+		return
+	}
+
+	for i := range events {
+		payload, err := json.Marshal(events[i])
+		if err != nil {
+			continue
+		}
+		topic := strings.Join([]string{
+			settings.TopicPrefix,
+			mqttTopicLevel(events[i].InstallationID),
+			mqttTopicLevel(events[i].GatewaySerial),
+			"events",
+		}, "/")
+		mqttPub.publish(topic, settings.RetainEvents, payload)
+	}
+}
+
+// GetMQTTStatus returns the connection state and publish counters
+func GetMQTTStatus() MQTTStatus {
+	mqttPub.mu.Lock()
+	defer mqttPub.mu.Unlock()
+
+	status := MQTTStatus{
+		Enabled:   mqttPub.client != nil,
+		Published: mqttPub.published,
+		LastError: mqttPub.lastError,
+	}
+	if mqttPub.client != nil {
+		status.Connected = mqttPub.client.IsConnected()
+		status.Broker = mqttPub.settings.Broker
+	}
+	if !mqttPub.lastPublished.IsZero() {
+		status.LastPublished = mqttPub.lastPublished.Format(time.RFC3339)
+	}
+	return status
+}
+
+// validateMQTTSettings checks the settings and fills in defaults
+func validateMQTTSettings(settings *MQTTSettings) error {
+	if settings.TopicPrefix == "" {
+		settings.TopicPrefix = mqttDefaultTopicPrefix
+	}
+	settings.TopicPrefix = strings.TrimSuffix(settings.TopicPrefix, "/")
+	if strings.ContainsAny(settings.TopicPrefix, "+#") {
+		return fmt.Errorf("topicPrefix must not contain wildcards")
+	}
+	if settings.ClientID == "" {
+		settings.ClientID = "vieventlog-" + randomHex(4)
+	}
+	if settings.DiscoveryPrefix == "" {
+		settings.DiscoveryPrefix = haDefaultDiscovery
+	}
+	settings.DiscoveryPrefix = strings.TrimSuffix(settings.DiscoveryPrefix, "/")
+	if strings.ContainsAny(settings.DiscoveryPrefix, "+#") {
+		return fmt.Errorf("discoveryPrefix must not contain wildcards")
+	}
+	if settings.QoS > 2 {
+		return fmt.Errorf("qos must be 0, 1 or 2")
+	}
+	if !settings.Enabled {
+		return nil
+	}
+
+	validScheme := false
+	for _, scheme := range []string{"tcp://", "mqtt://", "ssl://", "tls://", "mqtts://", "ws://", "wss://"} {
+		if strings.HasPrefix(settings.Broker, scheme) {
+			validScheme = true
+			break
+		}
+	}
+	if !validScheme {
+		return fmt.Errorf("broker must be a URL like tcp://host:1883 or ssl://host:8883")
+	}
+	if _, err := mqttClientOptions(settings); err != nil {
+		return err
+	}
+	return nil
+}
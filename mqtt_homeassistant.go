@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Home Assistant MQTT discovery.
+// Sensors are announced for the TemperatureSnapshot fields a device reports and
+// read their state from <prefix>/<installation>/<gateway>/<device>/snapshot.
+// Controls are announced for the features a device exposes, use the feature topic
+// as state and receive commands on <prefix>/<installation>/<gateway>/<device>/set/<control>.
+// Commands use the same command functions as the web UI handlers, so they get the
+// same validation and rate limiting.
+
+// haSensor describes a sensor entity backed by a TemperatureSnapshot field
+type haSensor struct {
+	field       string // TemperatureSnapshot JSON field
+	name        string
+	unit        string
+	deviceClass string
+	icon        string
+}
+
+var haSensors = []haSensor{
+	{field: "outside_temp", name: "Outside temperature", unit: "°C", deviceClass: "temperature"},
+	{field: "heating_circuit_0_supply_temp", name: "Supply temperature", unit: "°C", deviceClass: "temperature"},
+	{field: "return_temp", name: "Return temperature", unit: "°C", deviceClass: "temperature"},
+	{field: "dhw_temp", name: "DHW temperature", unit: "°C", deviceClass: "temperature"},
+	{field: "hp_primary_circuit_supply_temp", name: "Air intake temperature", unit: "°C", deviceClass: "temperature"},
+	{field: "cop", name: "COP", icon: "mdi:heat-pump"},
+	{field: "compressor_power", name: "Compressor power", unit: "W", deviceClass: "power"},
+	{field: "thermal_power", name: "Thermal power", unit: "kW", deviceClass: "power"},
+	{field: "compressor_speed", name: "Compressor speed", icon: "mdi:speedometer"},
+	{field: "pressure_supply", name: "Water pressure", unit: "bar", deviceClass: "pressure"},
+}
+
+// haControl describes a control entity mapped to an existing device command
+type haControl struct {
+	key       string // last level of the command topic
+	feature   string // feature that must exist on the device and provides the state
+	component string // select, number or button
+	name      string
+	icon      string
+	options   []string
+	min, max  float64
+	step      float64
+	// command sends the command for a payload to the device
+	command func(token *AccountToken, installationID, gatewaySerial, deviceID, payload string) error
+}
+
+var haControls = func() []haControl {
+	parseTemperature := func(payload string) (float64, error) {
+		temperature, err := strconv.ParseFloat(strings.TrimSpace(payload), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid temperature %q", payload)
+		}
+		return temperature, nil
+	}
+
+	controls := []haControl{
+		{
+			key:       "dhw_mode",
+			feature:   "heating.dhw.operating.modes.active",
+			component: "select",
+			name:      "DHW mode",
+			icon:      "mdi:water-boiler",
+			options:   []string{"efficient", "efficientWithMinComfort", "balanced", "off"},
+			command: func(token *AccountToken, installationID, gatewaySerial, deviceID, payload string) error {
+				return setDHWMode(token, installationID, gatewaySerial, deviceID, payload)
+			},
+		},
+		{
+			key:       "dhw_temperature",
+			feature:   "heating.dhw.temperature.main",
+			component: "number",
+			name:      "DHW target temperature",
+			icon:      "mdi:thermometer-water",
+			min:       10,
+			max:       60,
+			step:      1,
+			command: func(token *AccountToken, installationID, gatewaySerial, deviceID, payload string) error {
+				temperature, err := parseTemperature(payload)
+				if err != nil {
+					return err
+				}
+				return setDHWTemperature(token, installationID, gatewaySerial, deviceID, temperature)
+			},
+		},
+		{
+			key:       "dhw_one_time_charge",
+			feature:   "heating.dhw.oneTimeCharge",
+			component: "button",
+			name:      "DHW one-time charge",
+			icon:      "mdi:water-plus",
+			command: func(token *AccountToken, installationID, gatewaySerial, deviceID, payload string) error {
+				return activateDHWOneTimeCharge(token, installationID, gatewaySerial, deviceID)
+			},
+		},
+		{
+			key:       "ventilation_mode",
+			feature:   "ventilation.operating.modes.active",
+			component: "select",
+			name:      "Ventilation mode",
+			icon:      "mdi:fan",
+			options:   []string{"permanent", "ventilation", "sensorOverride", "sensorDriven"},
+			command: func(token *AccountToken, installationID, gatewaySerial, deviceID, payload string) error {
+				return setVentilationMode(token, installationID, gatewaySerial, deviceID, payload)
+			},
+		},
+		{
+			key:       "trv_temperature",
+			feature:   "trv.temperature",
+			component: "number",
+			name:      "Target temperature",
+			icon:      "mdi:thermostat",
+			min:       5,
+			max:       30,
+			step:      0.5,
+			command: func(token *AccountToken, installationID, gatewaySerial, deviceID, payload string) error {
+				temperature, err := parseTemperature(payload)
+				if err != nil {
+					return err
+				}
+				return setTRVTemperature(token, installationID, gatewaySerial, deviceID, temperature)
+			},
+		},
+	}
+
+	for circuit := 0; circuit < 4; circuit++ {
+		controls = append(controls, haControl{
+			key:       fmt.Sprintf("heating_mode_%d", circuit),
+			feature:   fmt.Sprintf("heating.circuits.%d.operating.modes.active", circuit),
+			component: "select",
+			name:      fmt.Sprintf("Heating mode circuit %d", circuit),
+			icon:      "mdi:radiator",
+			options:   []string{"heating", "standby", "cooling", "heatingCooling"},
+			command: func(token *AccountToken, installationID, gatewaySerial, deviceID, payload string) error {
+				return setHeatingMode(token, installationID, gatewaySerial, deviceID, circuit, payload)
+			},
+		})
+	}
+
+	return controls
+}()
+
+var haIDPattern = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// haNodeID returns the discovery node ID for a device
+func haNodeID(gatewayID, deviceID string) string {
+	return haIDPattern.ReplaceAllString("vieventlog_"+gatewayID+"_"+deviceID, "_")
+}
+
+// haDeviceBase returns the state topic base of a device
+func haDeviceBase(settings *MQTTSettings, installationID, gatewayID, deviceID string) string {
+	return strings.Join([]string{
+		settings.TopicPrefix,
+		mqttTopicLevel(installationID),
+		mqttTopicLevel(gatewayID),
+		mqttTopicLevel(deviceID),
+	}, "/")
+}
+
+// haDevice returns the device block shared by all entities of a device
+func haDevice(installationID, gatewayID, deviceID string) map[string]interface{} {
+	name := ""
+	featuresCacheMutex.RLock()
+	if cached, ok := featuresCache[fmt.Sprintf("%s:%s:%s", installationID, gatewayID, deviceID)]; ok {
+		name = deviceNameFromFeatures(cached)
+	}
+	featuresCacheMutex.RUnlock()
+	if name == "" {
+		name = fmt.Sprintf("Viessmann %s/%s", gatewayID, deviceID)
+	}
+
+	return map[string]interface{}{
+		"identifiers":   []string{haNodeID(gatewayID, deviceID)},
+		"name":          name,
+		"manufacturer":  "Viessmann",
+		"serial_number": gatewayID,
+	}
+}
+
+// deviceNameFromFeatures reads the device.name feature without calling the API
+func deviceNameFromFeatures(df *DeviceFeatures) string {
+	deviceName, exists := df.Other["device.name"]
+	if !exists {
+		return ""
+	}
+	if nameValue, ok := deviceName.Value.(string); ok {
+		return nameValue
+	}
+	if nameMap, ok := deviceName.Value.(map[string]FeatureValue); ok {
+		if nameStr, ok := nameMap["name"].Value.(string); ok {
+			return nameStr
+		}
+	}
+	return ""
+}
+
+// announceHomeAssistant publishes a retained discovery config once per connection
+func announceHomeAssistant(settings *MQTTSettings, component, nodeID, objectID string, config map[string]interface{}) {
+	topic := strings.Join([]string{settings.DiscoveryPrefix, component, nodeID, objectID, "config"}, "/")
+
+	mqttPub.mu.Lock()
+	announced := mqttPub.haAnnounced[topic]
+	mqttPub.haAnnounced[topic] = true
+	mqttPub.mu.Unlock()
+	if announced {
+		return
+	}
+
+	config["availability_topic"] = settings.TopicPrefix + "/status"
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	mqttPub.publish(topic, true, payload)
+}
+
+// PublishTemperatureSnapshot publishes a logged snapshot as the sensor state
+// and announces the sensors for the fields the device reports
+func PublishTemperatureSnapshot(snapshot *TemperatureSnapshot) {
+	settings := mqttPub.active()
+	if settings == nil || snapshot == nil {
+		return
+	}
+
+	base := haDeviceBase(settings, snapshot.InstallationID, snapshot.GatewayID, snapshot.DeviceID)
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		return
+	}
+	mqttPub.publish(base+"/snapshot", settings.Retain, payload)
+
+	if !settings.HomeAssistant {
+		return
+	}
+
+	nodeID := haNodeID(snapshot.GatewayID, snapshot.DeviceID)
+	device := haDevice(snapshot.InstallationID, snapshot.GatewayID, snapshot.DeviceID)
+	for _, sensor := range haSensors {
+		if _, ok := snapshotFieldValue(snapshot, sensor.field); !ok {
+			continue
+		}
+
+		config := map[string]interface{}{
+			"name":           sensor.name,
+			"unique_id":      nodeID + "_" + sensor.field,
+			"state_topic":    base + "/snapshot",
+			"value_template": "{{ value_json." + sensor.field + " }}",
+			"state_class":    "measurement",
+			"device":         device,
+		}
+		if sensor.unit != "" {
+			config["unit_of_measurement"] = sensor.unit
+		}
+		if sensor.deviceClass != "" {
+			config["device_class"] = sensor.deviceClass
+		}
+		if sensor.icon != "" {
+			config["icon"] = sensor.icon
+		}
+		announceHomeAssistant(settings, "sensor", nodeID, sensor.field, config)
+	}
+}
+
+// announceHomeAssistantControls announces the controls for the features of a device
+func announceHomeAssistantControls(settings *MQTTSettings, df *DeviceFeatures) {
+	if !settings.HomeAssistantControls {
+		return
+	}
+
+	available := make(map[string]bool, len(df.RawFeatures))
+	for _, feature := range df.RawFeatures {
+		available[feature.Feature] = true
+	}
+
+	base := haDeviceBase(settings, df.InstallationID, df.GatewayID, df.DeviceID)
+	nodeID := haNodeID(df.GatewayID, df.DeviceID)
+	var device map[string]interface{}
+
+	for _, control := range haControls {
+		if !available[control.feature] {
+			continue
+		}
+		if device == nil {
+			device = haDevice(df.InstallationID, df.GatewayID, df.DeviceID)
+		}
+
+		config := map[string]interface{}{
+			"name":          control.name,
+			"unique_id":     nodeID + "_" + control.key,
+			"command_topic": base + "/set/" + control.key,
+			"icon":          control.icon,
+			"device":        device,
+		}
+		if control.component != "button" {
+			config["state_topic"] = base + "/" + mqttTopicLevel(control.feature)
+			config["value_template"] = "{{ value_json.value }}"
+		}
+		switch control.component {
+		case "select":
+			config["options"] = control.options
+		case "number":
+			config["min"] = control.min
+			config["max"] = control.max
+			config["step"] = control.step
+			config["unit_of_measurement"] = "°C"
+			config["mode"] = "box"
+		}
+		announceHomeAssistant(settings, control.component, nodeID, control.key, config)
+	}
+}
+
+// subscribeHomeAssistant subscribes to the HA birth message and, if enabled, to command topics
+func subscribeHomeAssistant(c mqtt.Client, settings *MQTTSettings) {
+	// Home Assistant publishes "online" after a restart, announce everything again
+	c.Subscribe(settings.DiscoveryPrefix+"/status", 0, func(_ mqtt.Client, msg mqtt.Message) {
+		if string(msg.Payload()) == "online" {
+			mqttPub.mu.Lock()
+			mqttPub.haAnnounced = make(map[string]bool)
+			mqttPub.lastValues = make(map[string]string)
+			mqttPub.mu.Unlock()
+		}
+	})
+
+	if !settings.HomeAssistantControls {
+		return
+	}
+	c.Subscribe(settings.TopicPrefix+"/+/+/+/set/+", 1, func(_ mqtt.Client, msg mqtt.Message) {
+		// Commands call the Viessmann API, don't block the paho message router
+		go handleHomeAssistantCommand(settings, msg.Topic(), string(msg.Payload()))
+	})
+}
+
+// handleHomeAssistantCommand executes a command received on <prefix>/<inst>/<gw>/<dev>/set/<control>
+func handleHomeAssistantCommand(settings *MQTTSettings, topic, payload string) {
+	levels := strings.Split(strings.TrimPrefix(topic, settings.TopicPrefix+"/"), "/")
+	if len(levels) != 5 || levels[3] != "set" {
+		return
+	}
+	installationID, gatewaySerial, deviceID, key := levels[0], levels[1], levels[2], levels[4]
+
+	var control *haControl
+	for i := range haControls {
+		if haControls[i].key == key {
+			control = &haControls[i]
+			break
+		}
+	}
+	if control == nil {
+		log.Printf("MQTT command ignored: unknown control %q", key)
+		return
+	}
+
+	accountID := accountIDForInstallation(installationID)
+	if accountID == "" {
+		log.Printf("MQTT command %s ignored: no authenticated account for installation %s", key, installationID)
+		return
+	}
+
+	token, ok := getValidAccountToken(accountID)
+	if !ok {
+		log.Printf("MQTT command %s ignored: account %s not authenticated", key, accountID)
+		return
+	}
+
+	if err := control.command(token, installationID, gatewaySerial, deviceID, payload); err != nil {
+		log.Printf("MQTT command %s=%q for device %s failed: %v", key, payload, deviceID, err)
+		mqttPub.recordError(fmt.Errorf("command %s: %v", key, err))
+		return
+	}
+	log.Printf("MQTT command %s=%q executed for device %s", key, payload, deviceID)
+
+	// Fetch the features again so HA shows the new state
+	featuresCacheMutex.Lock()
+	delete(featuresCache, fmt.Sprintf("%s:%s:%s", installationID, gatewaySerial, deviceID))
+	featuresCacheMutex.Unlock()
+	if _, err := fetchFeaturesWithCache(installationID, gatewaySerial, deviceID, token.AccessToken); err != nil {
+		log.Printf("Failed to refresh features after MQTT command: %v", err)
+	}
+}
+
+// accountIDForInstallation finds the authenticated account owning an installation
+func accountIDForInstallation(installationID string) string {
+	accountsMutex.RLock()
+	defer accountsMutex.RUnlock()
+
+	for accountID, token := range accountTokens {
+		if containsString(token.InstallationIDs, installationID) {
+			return accountID
+		}
+	}
+	return ""
+}
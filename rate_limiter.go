@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiPriority orders outgoing Viessmann API calls when the budget runs low
+type apiPriority int
+
+const (
+	PriorityCommand     apiPriority = iota // user-triggered commands and authentication
+	PriorityDashboard                      // interactive reads from the web UI
+	PriorityArchive                        // event archive job and full syncs
+	PriorityTemperature                    // temperature logging
+)
+
+func (p apiPriority) String() string {
+	switch p {
+	case PriorityCommand:
+		return "command"
+	case PriorityDashboard:
+		return "dashboard"
+	case PriorityArchive:
+		return "archive"
+	case PriorityTemperature:
+		return "temperature"
+	default:
+		return "unknown"
+	}
+}
+
+// apiPriorityPolicy defines how much budget a priority has to leave for more
+// important work and how long it may wait for a token
+type apiPriorityPolicy struct {
+	reserve float64       // fraction of each bucket that must remain after the call
+	maxWait time.Duration // 0 = drop immediately (caller retries on its next run)
+}
+
+var apiPriorityPolicies = map[apiPriority]apiPriorityPolicy{
+	PriorityCommand:     {reserve: 0, maxWait: 30 * time.Second},
+	PriorityDashboard:   {reserve: 0.10, maxWait: 5 * time.Second},
+	PriorityArchive:     {reserve: 0.25, maxWait: 0},
+	PriorityTemperature: {reserve: 0.40, maxWait: 0},
+}
+
+// errAPIBudgetExhausted is returned when a request is dropped by the limiter
+var errAPIBudgetExhausted = errors.New("API rate limit budget exhausted")
+
+// tokenBucket refills continuously so that capacity tokens are restored per window
+type tokenBucket struct {
+	capacity float64
+	window   time.Duration
+	tokens   float64
+	updated  time.Time
+}
+
+func newTokenBucket(capacity int, window time.Duration) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(capacity),
+		window:   window,
+		tokens:   float64(capacity),
+		updated:  time.Now(),
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated)
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens = math.Min(b.capacity, b.tokens+b.capacity*elapsed.Seconds()/b.window.Seconds())
+	b.updated = now
+}
+
+// waitFor returns how long until the bucket holds at least n tokens
+func (b *tokenBucket) waitFor(n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	seconds := (n - b.tokens) * b.window.Seconds() / b.capacity
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// apiRateLimiter is the single gate for all outgoing Viessmann API calls
+// It combines the 10-minute and 24-hour budgets and reserves part of them for
+// higher priorities, so background jobs back off before user actions are blocked.
+type apiRateLimiter struct {
+	mu       sync.Mutex
+	buckets  []*tokenBucket
+	allowed  map[apiPriority]int
+	deferred map[apiPriority]int
+	dropped  map[apiPriority]int
+}
+
+var apiLimiter = newAPIRateLimiter()
+
+func newAPIRateLimiter() *apiRateLimiter {
+	return &apiRateLimiter{
+		buckets: []*tokenBucket{
+			newTokenBucket(apiLimit10Min, 10*time.Minute),
+			newTokenBucket(apiLimit24Hr, 24*time.Hour),
+		},
+		allowed:  make(map[apiPriority]int),
+		deferred: make(map[apiPriority]int),
+		dropped:  make(map[apiPriority]int),
+	}
+}
+
+// reserveWait returns 0 and consumes a token if the priority may call now,
+// otherwise how long it would have to wait. Must be called with l.mu held.
+func (l *apiRateLimiter) reserveWait(priority apiPriority, now time.Time) time.Duration {
+	policy := apiPriorityPolicies[priority]
+
+	var wait time.Duration
+	for _, b := range l.buckets {
+		b.refill(now)
+		if w := b.waitFor(1 + b.capacity*policy.reserve); w > wait {
+			wait = w
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	for _, b := range l.buckets {
+		b.tokens--
+	}
+	return 0
+}
+
+// Acquire takes one token for the given priority, waiting up to the priority's
+// maximum wait time. Returns errAPIBudgetExhausted if the call must be dropped.
+func (l *apiRateLimiter) Acquire(priority apiPriority) error {
+	policy := apiPriorityPolicies[priority]
+	deadline := time.Now().Add(policy.maxWait)
+	waited := false
+
+	for {
+		l.mu.Lock()
+		wait := l.reserveWait(priority, time.Now())
+		if wait == 0 {
+			l.allowed[priority]++
+			if waited {
+				l.deferred[priority]++
+			}
+			l.mu.Unlock()
+			return nil
+		}
+
+		if time.Now().Add(wait).After(deadline) {
+			l.dropped[priority]++
+			l.mu.Unlock()
+			log.Printf("WARNING: Dropping %s API request, budget exhausted (next slot in %s)\n", priority, wait.Round(time.Second))
+			return fmt.Errorf("%w for %s requests (retry in %s)", errAPIBudgetExhausted, priority, wait.Round(time.Second))
+		}
+		l.mu.Unlock()
+
+		waited = true
+		time.Sleep(wait)
+	}
+}
+
+// Allow reports whether a call with the given priority would currently be
+// admitted without waiting, without consuming a token
+func (l *apiRateLimiter) Allow(priority apiPriority) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	policy := apiPriorityPolicies[priority]
+	now := time.Now()
+	for _, b := range l.buckets {
+		b.refill(now)
+		if b.waitFor(1+b.capacity*policy.reserve) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// RateLimitStatus describes the remaining API budget
+type RateLimitStatus struct {
+	Remaining10Min int                            `json:"remaining10Min"`
+	Limit10Min     int                            `json:"limit10Min"`
+	Remaining24Hr  int                            `json:"remaining24Hr"`
+	Limit24Hr      int                            `json:"limit24Hr"`
+	Used10Min      int                            `json:"used10Min"`
+	Used24Hr       int                            `json:"used24Hr"`
+	Priorities     map[string]PriorityBudgetState `json:"priorities"`
+}
+
+// PriorityBudgetState shows whether a priority is currently admitted
+type PriorityBudgetState struct {
+	Available bool    `json:"available"`
+	Reserve   float64 `json:"reserve"`
+	Allowed   int     `json:"allowed"`
+	Deferred  int     `json:"deferred"`
+	Dropped   int     `json:"dropped"`
+}
+
+// Status returns a snapshot of the limiter state
+func (l *apiRateLimiter) Status() RateLimitStatus {
+	used10Min, used24Hr := getAPIUsage()
+
+	l.mu.Lock()
+	now := time.Now()
+	for _, b := range l.buckets {
+		b.refill(now)
+	}
+	status := RateLimitStatus{
+		Remaining10Min: int(l.buckets[0].tokens),
+		Limit10Min:     apiLimit10Min,
+		Remaining24Hr:  int(l.buckets[1].tokens),
+		Limit24Hr:      apiLimit24Hr,
+		Used10Min:      used10Min,
+		Used24Hr:       used24Hr,
+		Priorities:     make(map[string]PriorityBudgetState),
+	}
+	counts := make(map[apiPriority]PriorityBudgetState)
+	for p, policy := range apiPriorityPolicies {
+		counts[p] = PriorityBudgetState{
+			Reserve:  policy.reserve,
+			Allowed:  l.allowed[p],
+			Deferred: l.deferred[p],
+			Dropped:  l.dropped[p],
+		}
+	}
+	l.mu.Unlock()
+
+	for p, state := range counts {
+		state.Available = l.Allow(p)
+		status.Priorities[p.String()] = state
+	}
+	return status
+}
+
+// isAuthURL reports IAM/OAuth endpoints; they are not part of the IoT API budget
+func isAuthURL(url string) bool {
+	if strings.HasPrefix(url, iamBaseURL) && iamBaseURL != apiBaseURL {
+		return true
+	}
+	return strings.Contains(url, "/idp/")
+}
+
+// defaultAPIPriority derives a priority for requests created without one:
+// commands and authentication are user actions, everything else is a dashboard read
+func defaultAPIPriority(method, url string) apiPriority {
+	if isAuthURL(url) || (method == http.MethodPost && strings.Contains(url, "/commands/")) {
+		return PriorityCommand
+	}
+	return PriorityDashboard
+}
+
+// NewPriorityRequest creates an API request tagged with its priority. The token of the
+// central rate limiter is taken when doAPIRequest sends it, not here.
+func NewPriorityRequest(priority apiPriority, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err == nil {
+		req = markAPIRequest(req, priority)
+	}
+	return req, err
+}
+
+// acquireAPICall takes a rate limiter token for a request about to be sent and counts it
+// as an API call. Authentication requests pass without a token. Returns an error wrapping
+// errAPIBudgetExhausted if the request is dropped.
+func acquireAPICall(req *http.Request) error {
+	if isAuthURL(req.URL.String()) {
+		return nil
+	}
+	priority, _ := requestPriority(req)
+	if err := apiLimiter.Acquire(priority); err != nil {
+		return err
+	}
+	trackAPICall()
+	setAPICallsCount()
+	return nil
+}
+
+// rateLimitHandler handles GET /api/rate-limit
+func rateLimitHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(apiLimiter.Status())
+}
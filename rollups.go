@@ -0,0 +1,671 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rollup tables keep long-term temperature history after raw snapshots expire
+const (
+	rollupTableHourly = "temperature_rollups_hourly"
+	rollupTableDaily  = "temperature_rollups_daily"
+)
+
+// Resolutions of temperature history queries
+const (
+	ResolutionRaw  = "raw"
+	ResolutionHour = "hour"
+	ResolutionDay  = "day"
+)
+
+// Longest ranges served at a finer resolution when it is picked automatically
+const (
+	dataRawMaxRange        = 7 * 24 * time.Hour   // temperature charts: raw snapshots up to a week
+	dataHourlyMaxRange     = 180 * 24 * time.Hour // temperature charts: hourly values up to half a year
+	consumptionRawMaxRange = 48 * time.Hour       // consumption sums: raw snapshots up to two days
+
+	// consumption sums use hourly values whenever they are still kept
+	consumptionHourlyMaxRange = 100 * 365 * 24 * time.Hour
+)
+
+// rollupChunk limits how much raw history one rollup statement processes while holding the lock
+const rollupChunk = 7 * 24 * time.Hour
+
+// rollupMinMaxColumns are snapshot columns kept as min/avg/max
+var rollupMinMaxColumns = []string{
+	"outside_temp", "calculated_outside_temp", "return_temp", "supply_temp",
+	"primary_supply_temp", "secondary_supply_temp", "primary_return_temp", "secondary_return_temp",
+	"hp_primary_circuit_supply_temp", "hp_secondary_circuit_supply_temp",
+	"heating_circuit_0_supply_temp", "heating_circuit_1_supply_temp", "heating_circuit_2_supply_temp", "heating_circuit_3_supply_temp",
+	"dhw_temp", "dhw_cylinder_middle_temp", "boiler_temp", "buffer_temp", "buffer_temp_top",
+	"compressor_oil_temp", "compressor_motor_temp", "compressor_inlet_temp", "compressor_outlet_temp",
+}
+
+// rollupAvgColumns are snapshot columns kept as average only
+var rollupAvgColumns = []string{
+	"compressor_speed", "compressor_current", "compressor_pressure", "compressor_power",
+	"volumetric_flow", "thermal_power",
+	"heating_circuit_0_delta_t", "heating_circuit_1_delta_t", "heating_circuit_2_delta_t", "heating_circuit_3_delta_t",
+	"burner_modulation", "pressure_supply",
+}
+
+// rollupColumn is one value column of the rollup tables
+type rollupColumn struct {
+	name   string // column in the rollup tables
+	hourly string // aggregate over raw snapshots
+	daily  string // aggregate over hourly rollups
+}
+
+// rollupWeightedAvg averages an hourly average column weighted by its sample count
+func rollupWeightedAvg(column string) string {
+	return fmt.Sprintf("SUM(%s * samples) / SUM(CASE WHEN %s IS NOT NULL THEN samples END)", column, column)
+}
+
+// rollupColumns lists all value columns; energy follows GetConsumptionStats
+var rollupColumns = func() []rollupColumn {
+	columns := []rollupColumn{
+		{"account_id", "MAX(account_id)", "MAX(account_id)"},
+		{"account_name", "MAX(account_name)", "MAX(account_name)"},
+		{"samples", "COUNT(*)", "SUM(samples)"},
+		{"covered_minutes", "SUM(interval_minutes)", "SUM(covered_minutes)"},
+	}
+	for _, c := range rollupMinMaxColumns {
+		columns = append(columns,
+			rollupColumn{c + "_min", "MIN(" + c + ")", "MIN(" + c + "_min)"},
+			rollupColumn{c + "_avg", "AVG(" + c + ")", rollupWeightedAvg(c + "_avg")},
+			rollupColumn{c + "_max", "MAX(" + c + ")", "MAX(" + c + "_max)"},
+		)
+	}
+	for _, c := range rollupAvgColumns {
+		columns = append(columns, rollupColumn{c + "_avg", "AVG(" + c + ")", rollupWeightedAvg(c + "_avg")})
+	}
+	return append(columns,
+		rollupColumn{"cop_avg", "AVG(CASE WHEN cop > 0 THEN cop END)", "SUM(cop_avg * cop_samples) / SUM(cop_samples)"},
+		rollupColumn{"cop_samples", "COUNT(CASE WHEN cop > 0 THEN 1 END)", "SUM(cop_samples)"},
+		rollupColumn{"electricity_wh", "SUM(COALESCE(compressor_power, 0) * interval_minutes / 60.0)", "SUM(electricity_wh)"},
+		rollupColumn{"thermal_wh", `SUM(COALESCE(
+				CASE WHEN compressor_power > 0 THEN thermal_power
+				ELSE CASE WHEN compressor_power = 0 AND IFNULL(thermal_power, 0) > 0 THEN 0
+					ELSE CASE WHEN IFNULL(thermal_power, 0) = 0 THEN 0 ELSE NULL END
+				END END, 0
+			) * 1000.0 * interval_minutes / 60.0)`, "SUM(thermal_wh)"},
+		rollupColumn{"runtime_minutes", "SUM(CASE WHEN compressor_active = 1 THEN interval_minutes ELSE 0 END)", "SUM(runtime_minutes)"},
+		rollupColumn{"compressor_starts_delta", "SUM(CASE WHEN starts_delta > 0 THEN starts_delta ELSE 0 END)", "SUM(compressor_starts_delta)"},
+		rollupColumn{"compressor_hours", "MAX(compressor_hours)", "MAX(compressor_hours)"},
+		rollupColumn{"compressor_starts", "MAX(compressor_starts)", "MAX(compressor_starts)"},
+	)
+}()
+
+// temperatureRollupTableSQL returns the schema of an hourly or daily rollup table.
+// bucket_start is the UTC start of the hour or of the local (DefaultLocation) day.
+func temperatureRollupTableSQL(table string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `
+		CREATE TABLE IF NOT EXISTS %s (
+			bucket_start TEXT NOT NULL,
+			installation_id TEXT NOT NULL,
+			gateway_id TEXT NOT NULL,
+			device_id TEXT NOT NULL,`, table)
+	for _, c := range rollupColumns {
+		columnType := "REAL"
+		switch c.name {
+		case "account_id", "account_name":
+			columnType = "TEXT"
+		case "samples", "cop_samples":
+			columnType = "INTEGER NOT NULL DEFAULT 0"
+		}
+		fmt.Fprintf(&b, "\n\t\t\t%s %s,", c.name, columnType)
+	}
+	fmt.Fprintf(&b, `
+			PRIMARY KEY (installation_id, gateway_id, device_id, bucket_start)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_%s_bucket ON %s(bucket_start);
+	`, table, table)
+	return b.String()
+}
+
+// rollupMutex serializes rollup runs of the scheduler, startup and imports
+var rollupMutex sync.Mutex
+
+// lastRollupBucket returns the newest bucket start of a rollup table (zero if empty)
+func lastRollupBucket(db sqlExecutor, table string) (time.Time, error) {
+	var last sql.NullString
+	if err := db.QueryRow("SELECT MAX(bucket_start) FROM " + table).Scan(&last); err != nil {
+		return time.Time{}, err
+	}
+	if !last.Valid {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, last.String)
+}
+
+// firstRollupSource returns the time found by a MIN(timestamp) query (zero if there is none)
+func firstRollupSource(db sqlExecutor, query string, args ...interface{}) (time.Time, error) {
+	var first sql.NullString
+	if err := db.QueryRow(query, args...).Scan(&first); err != nil {
+		return time.Time{}, err
+	}
+	if !first.Valid {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, first.String)
+}
+
+// rollupColumnList returns the rollup column names and their aggregates for one level
+func rollupColumnList(daily bool) (string, string) {
+	names := make([]string, len(rollupColumns))
+	exprs := make([]string, len(rollupColumns))
+	for i, c := range rollupColumns {
+		names[i] = c.name
+		exprs[i] = c.hourly
+		if daily {
+			exprs[i] = c.daily
+		}
+	}
+	return strings.Join(names, ", "), strings.Join(exprs, ",\n\t\t\t")
+}
+
+// rollupHours (re)builds the hourly rollups of all devices for [from, to).
+// Compressor starts are counted against the previous snapshot, up to one day back.
+func rollupHours(db sqlExecutor, from, to time.Time, fallbackInterval int) error {
+	names, exprs := rollupColumnList(false)
+	query := `
+		INSERT OR REPLACE INTO ` + rollupTableHourly + ` (bucket_start, installation_id, gateway_id, device_id, ` + names + `)
+		SELECT
+			STRFTIME('%Y-%m-%dT%H:00:00Z', timestamp) AS bucket,
+			installation_id, gateway_id, device_id,
+			` + exprs + `
+		FROM (
+			SELECT *,
+				COALESCE(sample_interval, ?) AS interval_minutes,
+				compressor_starts - MAX(compressor_starts) OVER (
+					PARTITION BY installation_id, gateway_id, device_id ORDER BY timestamp
+					ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING
+				) AS starts_delta
+			FROM temperature_snapshots
+			WHERE timestamp >= ? AND timestamp < ?
+		)
+		WHERE timestamp >= ?
+		GROUP BY bucket, installation_id, gateway_id, device_id
+	`
+	_, err := db.Exec(query, fallbackInterval,
+		from.Add(-24*time.Hour).UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339),
+		from.UTC().Format(time.RFC3339))
+	return err
+}
+
+// rollupDay (re)builds the daily rollups of all devices for the local day starting at day
+func rollupDay(db sqlExecutor, day time.Time) error {
+	names, exprs := rollupColumnList(true)
+	query := `
+		INSERT OR REPLACE INTO ` + rollupTableDaily + ` (bucket_start, installation_id, gateway_id, device_id, ` + names + `)
+		SELECT ?, installation_id, gateway_id, device_id,
+			` + exprs + `
+		FROM ` + rollupTableHourly + `
+		WHERE bucket_start >= ? AND bucket_start < ?
+		GROUP BY installation_id, gateway_id, device_id
+	`
+	start := day.UTC().Format(time.RFC3339)
+	_, err := db.Exec(query, start, start, day.AddDate(0, 0, 1).UTC().Format(time.RFC3339))
+	return err
+}
+
+// rollupRange rebuilds hourly rollups for [from, to) and the daily rollups from dayFrom up to to
+func rollupRange(from, to, dayFrom time.Time, fallbackInterval int) error {
+	for start := from; start.Before(to); start = start.Add(rollupChunk) {
+		end := start.Add(rollupChunk)
+		if end.After(to) {
+			end = to
+		}
+		dbMutex.Lock()
+		err := rollupHours(eventDB, start, end, fallbackInterval)
+		dbMutex.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed to roll up hours from %s: %v", start.Format(time.RFC3339), err)
+		}
+	}
+
+	for day := startOfDay(dayFrom); day.Before(to); day = day.AddDate(0, 0, 1) {
+		dbMutex.Lock()
+		err := rollupDay(eventDB, day)
+		dbMutex.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed to roll up day %s: %v", day.Format("2006-01-02"), err)
+		}
+	}
+	return nil
+}
+
+// UpdateTemperatureRollups rolls up all snapshots since the last hourly bucket, including the
+// current partial hour and day. The first run after the upgrade builds the complete history.
+func UpdateTemperatureRollups() error {
+	if !dbInitialized || eventDB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	rollupMutex.Lock()
+	defer rollupMutex.Unlock()
+
+	settings, err := GetTemperatureLogSettings()
+	if err != nil {
+		return err
+	}
+
+	dbMutex.RLock()
+	from, err := lastRollupBucket(eventDB, rollupTableHourly)
+	if err == nil && from.IsZero() {
+		from, err = firstRollupSource(eventDB, "SELECT MIN(timestamp) FROM temperature_snapshots")
+	}
+	dbMutex.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to find rollup start: %v", err)
+	}
+	if from.IsZero() {
+		return nil
+	}
+
+	// Daily rollups continue from the last (usually partial) day, even if they lag behind
+	dbMutex.RLock()
+	dayFrom, err := lastRollupBucket(eventDB, rollupTableDaily)
+	dbMutex.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to find daily rollup start: %v", err)
+	}
+	if dayFrom.IsZero() || dayFrom.After(from) {
+		dayFrom = from
+	}
+
+	from = from.Truncate(time.Hour)
+	to := time.Now().Truncate(time.Hour).Add(time.Hour)
+	started := time.Now()
+	if err := rollupRange(from, to, dayFrom, settings.SampleInterval); err != nil {
+		return err
+	}
+	if to.Sub(from) > 24*time.Hour {
+		log.Printf("Temperature rollups built from %s in %s", from.In(DefaultLocation).Format("2006-01-02"), time.Since(started).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// RebuildTemperatureRollups recomputes the rollups of an already rolled-up range, e.g. after
+// importing historical snapshots, and then brings them up to date
+func RebuildTemperatureRollups(from, to time.Time) error {
+	if !dbInitialized || eventDB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	settings, err := GetTemperatureLogSettings()
+	if err != nil {
+		return err
+	}
+
+	dbMutex.RLock()
+	last, err := lastRollupBucket(eventDB, rollupTableHourly)
+	dbMutex.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to check temperature rollups: %v", err)
+	}
+
+	if !last.IsZero() && from.Before(last) {
+		// One extra hour for the compressor starts counted against the imported data
+		end := to.Truncate(time.Hour).Add(2 * time.Hour)
+		if end.After(last) {
+			end = last
+		}
+		rollupMutex.Lock()
+		err = rollupRange(from.Truncate(time.Hour), end, from, settings.SampleInterval)
+		rollupMutex.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return UpdateTemperatureRollups()
+}
+
+// CleanupOldTemperatureRollups removes rollups older than their retention (0 keeps them forever).
+// Hourly rollups are only removed once they are part of a daily rollup.
+func CleanupOldTemperatureRollups(hourlyRetentionDays, dailyRetentionDays int) error {
+	if !dbInitialized || eventDB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	now := time.Now().UTC()
+	if hourlyRetentionDays > 0 {
+		cutoffTime := now.AddDate(0, 0, -hourlyRetentionDays)
+		rolledUp, err := lastRollupBucket(eventDB, rollupTableDaily)
+		if err != nil {
+			return fmt.Errorf("failed to check daily rollups: %v", err)
+		}
+		if rolledUp.Before(cutoffTime) {
+			cutoffTime = rolledUp
+		}
+
+		result, err := eventDB.Exec("DELETE FROM "+rollupTableHourly+" WHERE bucket_start < ?", cutoffTime.Format(time.RFC3339))
+		if err != nil {
+			return fmt.Errorf("failed to cleanup old hourly rollups: %v", err)
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+			log.Printf("Cleaned up %d old hourly temperature rollups (retention: %d days)", rowsAffected, hourlyRetentionDays)
+		}
+	}
+
+	if dailyRetentionDays > 0 {
+		cutoffTime := now.AddDate(0, 0, -dailyRetentionDays)
+		result, err := eventDB.Exec("DELETE FROM "+rollupTableDaily+" WHERE bucket_start < ?", cutoffTime.Format(time.RFC3339))
+		if err != nil {
+			return fmt.Errorf("failed to cleanup old daily rollups: %v", err)
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+			log.Printf("Cleaned up %d old daily temperature rollups (retention: %d days)", rowsAffected, dailyRetentionDays)
+		}
+	}
+
+	return nil
+}
+
+// GetTemperatureRollupCounts returns the number of hourly and daily rollup rows
+func GetTemperatureRollupCounts() (int64, int64, error) {
+	if !dbInitialized || eventDB == nil {
+		return 0, 0, fmt.Errorf("database not initialized")
+	}
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	var hourly, daily int64
+	if err := eventDB.QueryRow("SELECT COUNT(*) FROM " + rollupTableHourly).Scan(&hourly); err != nil {
+		return 0, 0, fmt.Errorf("failed to count hourly rollups: %v", err)
+	}
+	if err := eventDB.QueryRow("SELECT COUNT(*) FROM " + rollupTableDaily).Scan(&daily); err != nil {
+		return 0, 0, fmt.Errorf("failed to count daily rollups: %v", err)
+	}
+	return hourly, daily, nil
+}
+
+// chooseTemperatureResolution returns the finest resolution that still holds the whole range
+// and whose range limit is not exceeded. Raw data is used while the rollups lag behind.
+func chooseTemperatureResolution(db sqlExecutor, settings *TemperatureLogSettings, startTime, endTime time.Time, rawMaxRange, hourlyMaxRange time.Duration) string {
+	now := time.Now()
+	span := endTime.Sub(startTime)
+	rawKept := !startTime.Before(now.AddDate(0, 0, -settings.RetentionDays))
+	hourlyKept := settings.HourlyRetentionDays == 0 || !startTime.Before(now.AddDate(0, 0, -settings.HourlyRetentionDays))
+
+	rolledUp := false
+	if last, err := lastRollupBucket(db, rollupTableHourly); err == nil && !last.IsZero() {
+		covered := endTime
+		if covered.After(now) {
+			covered = now
+		}
+		rolledUp = !last.Add(time.Hour).Before(covered.Truncate(time.Hour))
+	}
+
+	switch {
+	case !rolledUp || (rawKept && span <= rawMaxRange):
+		return ResolutionRaw
+	case hourlyKept && span <= hourlyMaxRange:
+		return ResolutionHour
+	default:
+		return ResolutionDay
+	}
+}
+
+// TemperatureDataResolution picks the resolution for a temperature chart range
+func TemperatureDataResolution(startTime, endTime time.Time) (string, error) {
+	if !dbInitialized || eventDB == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+
+	settings, err := GetTemperatureLogSettings()
+	if err != nil {
+		return "", err
+	}
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+	return chooseTemperatureResolution(eventDB, settings, startTime, endTime, dataRawMaxRange, dataHourlyMaxRange), nil
+}
+
+// rollupTable returns the table and bucket start of a time for an hour/day resolution
+func rollupTable(resolution string, t time.Time) (string, time.Time) {
+	if resolution == ResolutionDay {
+		return rollupTableDaily, startOfDay(t)
+	}
+	return rollupTableHourly, t.Truncate(time.Hour)
+}
+
+// TemperatureRollup is one hourly or daily bucket of temperature history. The embedded
+// snapshot holds the averages (timestamp = bucket start) so charts can treat it like a sample.
+type TemperatureRollup struct {
+	TemperatureSnapshot
+	Resolution            string             `json:"resolution"`
+	Samples               int                `json:"samples"`
+	CoveredMinutes        float64            `json:"covered_minutes"`
+	Min                   map[string]float64 `json:"min,omitempty"`
+	Max                   map[string]float64 `json:"max,omitempty"`
+	ElectricityWh         float64            `json:"electricity_wh"`
+	ThermalWh             float64            `json:"thermal_wh"`
+	RuntimeMinutes        float64            `json:"runtime_minutes"`
+	CompressorStartsDelta float64            `json:"compressor_starts_delta"`
+}
+
+// setSnapshotFloat sets the snapshot field whose json name equals a snapshot column
+func setSnapshotFloat(snapshot *TemperatureSnapshot, column string, value float64) {
+	if index, ok := snapshotImportFields[normalizeImportName(column)]; ok {
+		reflect.ValueOf(snapshot).Elem().Field(index).Set(reflect.ValueOf(&value))
+	}
+}
+
+// GetTemperatureRollups retrieves hourly or daily rollups; a partially covered first bucket is included
+func GetTemperatureRollups(resolution, installationID, gatewayID, deviceID string, startTime, endTime time.Time, limit int) ([]TemperatureRollup, error) {
+	if !dbInitialized || eventDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	table, bucketStart := rollupTable(resolution, startTime)
+	bucketMinutes := 60
+	if resolution == ResolutionDay {
+		bucketMinutes = 24 * 60
+	}
+
+	valueColumns := make([]string, 0, len(rollupColumns))
+	for _, c := range rollupColumns {
+		if c.name != "account_id" && c.name != "account_name" && c.name != "cop_samples" {
+			valueColumns = append(valueColumns, c.name)
+		}
+	}
+
+	query := `
+		SELECT bucket_start, installation_id, gateway_id, device_id, account_id, account_name, ` + strings.Join(valueColumns, ", ") + `
+		FROM ` + table + `
+		WHERE installation_id = ? AND bucket_start >= ? AND bucket_start <= ?
+	`
+	args := []interface{}{installationID, bucketStart.UTC().Format(time.RFC3339), endTime.UTC().Format(time.RFC3339)}
+	if gatewayID != "" {
+		query += " AND gateway_id = ?"
+		args = append(args, gatewayID)
+	}
+	if deviceID != "" {
+		query += " AND device_id = ?"
+		args = append(args, deviceID)
+	}
+	query += " ORDER BY bucket_start ASC"
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := eventDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query temperature rollups: %v", err)
+	}
+	defer rows.Close()
+
+	var rollups []TemperatureRollup
+	for rows.Next() {
+		var bucketStr, rowInstallationID, rowGatewayID, rowDeviceID string
+		var accountID, accountName sql.NullString
+		values := make([]sql.NullFloat64, len(valueColumns))
+		dest := []interface{}{&bucketStr, &rowInstallationID, &rowGatewayID, &rowDeviceID, &accountID, &accountName}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			log.Printf("Warning: failed to scan temperature rollup row: %v", err)
+			continue
+		}
+
+		bucket, err := time.Parse(time.RFC3339, bucketStr)
+		if err != nil {
+			log.Printf("Warning: failed to parse rollup bucket %q: %v", bucketStr, err)
+			continue
+		}
+
+		r := TemperatureRollup{
+			TemperatureSnapshot: TemperatureSnapshot{
+				Timestamp:      bucket,
+				InstallationID: rowInstallationID,
+				GatewayID:      rowGatewayID,
+				DeviceID:       rowDeviceID,
+				AccountID:      accountID.String,
+				AccountName:    accountName.String,
+				SampleInterval: bucketMinutes,
+			},
+			Resolution: resolution,
+			Min:        make(map[string]float64),
+			Max:        make(map[string]float64),
+		}
+		for i, column := range valueColumns {
+			if !values[i].Valid {
+				continue
+			}
+			v := values[i].Float64
+			switch {
+			case column == "samples":
+				r.Samples = int(v)
+			case column == "covered_minutes":
+				r.CoveredMinutes = v
+			case column == "electricity_wh":
+				r.ElectricityWh = v
+			case column == "thermal_wh":
+				r.ThermalWh = v
+			case column == "runtime_minutes":
+				r.RuntimeMinutes = v
+			case column == "compressor_starts_delta":
+				r.CompressorStartsDelta = v
+			case strings.HasSuffix(column, "_min"):
+				r.Min[strings.TrimSuffix(column, "_min")] = v
+			case strings.HasSuffix(column, "_max"):
+				r.Max[strings.TrimSuffix(column, "_max")] = v
+			case strings.HasSuffix(column, "_avg"):
+				setSnapshotFloat(&r.TemperatureSnapshot, strings.TrimSuffix(column, "_avg"), v)
+			default:
+				setSnapshotFloat(&r.TemperatureSnapshot, column, v)
+			}
+		}
+		rollups = append(rollups, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating temperature rollups: %v", err)
+	}
+	return rollups, nil
+}
+
+// rollupConsumptionStats sums consumption from hourly or daily rollups (caller holds dbMutex)
+func rollupConsumptionStats(resolution, installationID, gatewayID, deviceID string, startTime, endTime time.Time) (*ConsumptionStats, error) {
+	table, bucketStart := rollupTable(resolution, startTime)
+
+	var electricityWh, thermalWh, runtimeMinutes float64
+	var avgCOP sql.NullFloat64
+	var samples int
+	err := eventDB.QueryRow(`
+		SELECT
+			COALESCE(SUM(electricity_wh), 0),
+			COALESCE(SUM(thermal_wh), 0),
+			SUM(cop_avg * cop_samples) / SUM(cop_samples),
+			COALESCE(SUM(runtime_minutes), 0),
+			COALESCE(SUM(samples), 0)
+		FROM `+table+`
+		WHERE installation_id = ?
+			AND gateway_id = ?
+			AND device_id = ?
+			AND bucket_start >= ?
+			AND bucket_start < ?
+	`, installationID, gatewayID, deviceID,
+		bucketStart.UTC().Format(time.RFC3339), endTime.UTC().Format(time.RFC3339),
+	).Scan(&electricityWh, &thermalWh, &avgCOP, &runtimeMinutes, &samples)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query consumption rollups: %v", err)
+	}
+
+	return &ConsumptionStats{
+		StartTime:      startTime,
+		EndTime:        endTime,
+		Resolution:     resolution,
+		ElectricityKWh: electricityWh / 1000.0,
+		ThermalKWh:     thermalWh / 1000.0,
+		AvgCOP:         avgCOP.Float64,
+		RuntimeHours:   runtimeMinutes / 60.0,
+		Samples:        samples,
+	}, nil
+}
+
+// rollupConsumptionBreakdown returns one data point per rollup bucket in [startTime, endTime)
+// with the bucket start in DefaultLocation (caller holds dbMutex)
+func rollupConsumptionBreakdown(resolution, installationID, gatewayID, deviceID string, startTime, endTime time.Time) ([]ConsumptionDataPoint, error) {
+	table, bucketStart := rollupTable(resolution, startTime)
+
+	rows, err := eventDB.Query(`
+		SELECT bucket_start, COALESCE(electricity_wh, 0), COALESCE(thermal_wh, 0), cop_avg, COALESCE(runtime_minutes, 0), samples
+		FROM `+table+`
+		WHERE installation_id = ?
+			AND gateway_id = ?
+			AND device_id = ?
+			AND bucket_start >= ?
+			AND bucket_start < ?
+		ORDER BY bucket_start ASC
+	`, installationID, gatewayID, deviceID,
+		bucketStart.UTC().Format(time.RFC3339), endTime.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query consumption rollups: %v", err)
+	}
+	defer rows.Close()
+
+	var dataPoints []ConsumptionDataPoint
+	for rows.Next() {
+		var bucketStr string
+		var electricityWh, thermalWh, runtimeMinutes float64
+		var avgCOP sql.NullFloat64
+		var samples int
+		if err := rows.Scan(&bucketStr, &electricityWh, &thermalWh, &avgCOP, &runtimeMinutes, &samples); err != nil {
+			log.Printf("Warning: failed to scan consumption rollup row: %v", err)
+			continue
+		}
+		bucket, err := time.Parse(time.RFC3339, bucketStr)
+		if err != nil {
+			log.Printf("Warning: failed to parse rollup bucket %q: %v", bucketStr, err)
+			continue
+		}
+
+		dataPoints = append(dataPoints, ConsumptionDataPoint{
+			Timestamp:      bucket.In(DefaultLocation),
+			ElectricityKWh: electricityWh / 1000.0,
+			ThermalKWh:     thermalWh / 1000.0,
+			AvgCOP:         avgCOP.Float64,
+			RuntimeHours:   runtimeMinutes / 60.0,
+			Samples:        samples,
+		})
+	}
+	return dataPoints, rows.Err()
+}
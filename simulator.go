@@ -0,0 +1,1013 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	mrand "math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Simulator serves a fake Viessmann IAM and IoT API backed by simulated devices.
+// Start the app with --simulate (or VICARE_SIMULATE=true) to point every request
+// builder at it instead of the real cloud.
+type Simulator struct {
+	mu sync.Mutex
+
+	installationID int
+	description    string
+	gateways       []*simGateway
+
+	events   []simEvent
+	eventSeq int64
+	lastTick time.Time
+	rng      *mrand.Rand
+
+	accessTokens  map[string]time.Time // token -> expiry
+	refreshTokens map[string]bool
+	tokenTTL      time.Duration
+
+	// pendingResolves holds active errors that will be cleared later
+	pendingResolves []simPendingResolve
+}
+
+// simGateway is a simulated gateway with its devices
+type simGateway struct {
+	serial  string
+	version string
+	devices []*simDevice
+}
+
+// simDevice is a simulated device; its model evolves the feature state over time
+type simDevice struct {
+	id         string
+	deviceType string
+	modelID    string
+	gateway    *simGateway
+	features   map[string]*simFeature
+	model      simDeviceModel
+	errorCodes []string // codes this device may raise as random faults
+}
+
+// simDeviceModel advances a device's state by dt
+type simDeviceModel interface {
+	tick(d *simDevice, env *simEnvironment, dt time.Duration)
+}
+
+// simFeature holds the properties and executable commands of a feature
+type simFeature struct {
+	properties map[string]interface{}
+	commands   map[string]*simCommand
+	timestamp  time.Time
+}
+
+// simCommand executes a feature command against the device state
+type simCommand struct {
+	params  map[string]interface{}
+	execute func(d *simDevice, body map[string]interface{}) error
+}
+
+// simEnvironment is the shared weather the devices react to
+type simEnvironment struct {
+	now         time.Time
+	outsideTemp float64
+	solarFactor float64 // 0..1 fraction of peak irradiation
+	sim         *Simulator
+}
+
+type simEvent struct {
+	seq  int64
+	at   time.Time
+	data map[string]interface{}
+}
+
+type simPendingResolve struct {
+	at     time.Time
+	device *simDevice
+	code   string
+}
+
+// simProfile builds the devices of one simulated gateway
+type simProfile struct {
+	Name        string
+	Description string
+	Build       func(gw *simGateway)
+}
+
+var simProfiles = make(map[string]*simProfile)
+
+// registerSimProfile makes a device profile available to the simulator
+func registerSimProfile(p *simProfile) {
+	simProfiles[p.Name] = p
+}
+
+// defaultSimProfiles is used when VICARE_SIM_PROFILES is not set
+const defaultSimProfiles = "heatpump,vitovent,vitocharge,trv"
+
+// simMaxEvents caps the in-memory event history
+const simMaxEvents = 5000
+
+// simTickStep is the maximum integration step for the device models
+const simTickStep = 30 * time.Second
+
+// NewSimulator creates a simulator with one installation and a gateway per profile
+func NewSimulator(profileNames []string, seed uint64) (*Simulator, error) {
+	s := &Simulator{
+		installationID: 1234567,
+		description:    "ViCare Simulator",
+		rng:            mrand.New(mrand.NewPCG(seed, seed^0x5eed)),
+		accessTokens:   make(map[string]time.Time),
+		refreshTokens:  make(map[string]bool),
+		tokenTTL:       time.Hour,
+	}
+
+	for i, name := range profileNames {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		profile, ok := simProfiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown simulator profile %q (available: %s)", name, strings.Join(simProfileNames(), ", "))
+		}
+		gw := &simGateway{
+			serial:  fmt.Sprintf("76374150%08d", 22052200+i),
+			version: "simulated",
+		}
+		profile.Build(gw)
+		s.gateways = append(s.gateways, gw)
+	}
+
+	if len(s.gateways) == 0 {
+		return nil, fmt.Errorf("no simulator profiles configured")
+	}
+
+	return s, nil
+}
+
+// simProfileNames returns the sorted names of all registered profiles
+func simProfileNames() []string {
+	names := make([]string, 0, len(simProfiles))
+	for name := range simProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartSimulator creates the simulator from environment settings, serves it on
+// addr and returns its base URL
+func StartSimulator(addr string) (string, error) {
+	profiles := strings.Split(getEnv("VICARE_SIM_PROFILES", defaultSimProfiles), ",")
+
+	seed := uint64(time.Now().UnixNano())
+	if seedStr := os.Getenv("VICARE_SIM_SEED"); seedStr != "" {
+		parsed, err := strconv.ParseUint(seedStr, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid VICARE_SIM_SEED: %w", err)
+		}
+		seed = parsed
+	}
+
+	sim, err := NewSimulator(profiles, seed)
+	if err != nil {
+		return "", err
+	}
+
+	if ttl := os.Getenv("VICARE_SIM_TOKEN_TTL"); ttl != "" {
+		seconds, err := strconv.Atoi(ttl)
+		if err != nil || seconds <= 0 {
+			return "", fmt.Errorf("invalid VICARE_SIM_TOKEN_TTL: %s", ttl)
+		}
+		sim.tokenTTL = time.Duration(seconds) * time.Second
+	}
+
+	historyDays, _ := strconv.Atoi(getEnv("VICARE_SIM_HISTORY_DAYS", "7"))
+	sim.Start(time.Now(), historyDays)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", fmt.Errorf("failed to start simulator: %w", err)
+	}
+
+	go func() {
+		if err := http.Serve(listener, sim); err != nil {
+			log.Printf("Simulator server error: %v", err)
+		}
+	}()
+
+	baseURL := "http://" + listener.Addr().String()
+	log.Printf("Simulator listening on %s with profiles: %s", baseURL, strings.Join(profiles, ", "))
+	return baseURL, nil
+}
+
+// Start seeds the event history and initializes the simulation clock
+func (s *Simulator) Start(now time.Time, historyDays int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if historyDays > 0 {
+		start := now.Add(-time.Duration(historyDays) * 24 * time.Hour)
+		for _, gw := range s.gateways {
+			s.addEvent(start, "gateway-online", gw, nil, map[string]interface{}{"online": true})
+		}
+		for t := start; t.Before(now); t = t.Add(time.Minute) {
+			s.generateEvents(t, time.Minute)
+		}
+	}
+
+	// Populate the initial feature state
+	env := s.environment(now)
+	for _, gw := range s.gateways {
+		for _, d := range gw.devices {
+			if d.model != nil {
+				d.model.tick(d, env, 0)
+			}
+		}
+	}
+	s.lastTick = now
+}
+
+// advance runs the device models up to now in steps of at most simTickStep
+// Must be called with s.mu held
+func (s *Simulator) advance(now time.Time) {
+	if s.lastTick.IsZero() {
+		s.lastTick = now
+	}
+
+	// Don't replay more than a day if the process was suspended
+	if now.Sub(s.lastTick) > 24*time.Hour {
+		s.lastTick = now.Add(-24 * time.Hour)
+	}
+
+	for s.lastTick.Before(now) {
+		dt := now.Sub(s.lastTick)
+		if dt > simTickStep {
+			dt = simTickStep
+		}
+		t := s.lastTick.Add(dt)
+		env := s.environment(t)
+		for _, gw := range s.gateways {
+			for _, d := range gw.devices {
+				if d.model != nil {
+					d.model.tick(d, env, dt)
+				}
+			}
+		}
+		s.generateEvents(t, dt)
+		s.lastTick = t
+	}
+}
+
+// environment computes the weather at time t
+// Outside temperature follows a seasonal and a daily sine; solar irradiation follows the sun
+func (s *Simulator) environment(t time.Time) *simEnvironment {
+	local := t.In(DefaultLocation)
+	dayOfYear := float64(local.YearDay())
+	hour := float64(local.Hour()) + float64(local.Minute())/60
+
+	seasonal := 9.0 - 10.0*cosDeg(360*(dayOfYear-15)/365)
+	daily := 4.0 * sinDeg(360*(hour-9)/24)
+
+	solar := 0.0
+	dayLength := 12.0 - 4.0*cosDeg(360*(dayOfYear-172)/365+180)
+	sunrise := 13.0 - dayLength/2
+	if hour > sunrise && hour < sunrise+dayLength {
+		solar = sinDeg(180 * (hour - sunrise) / dayLength)
+		solar *= 0.55 + 0.45*cosDeg(360*(dayOfYear-172)/365)
+	}
+
+	return &simEnvironment{
+		now:         t,
+		outsideTemp: seasonal + daily,
+		solarFactor: solar,
+		sim:         s,
+	}
+}
+
+// generateEvents creates random faults and resolves pending ones
+// Must be called with s.mu held
+func (s *Simulator) generateEvents(t time.Time, dt time.Duration) {
+	hours := dt.Hours()
+
+	// Resolve due faults
+	remaining := s.pendingResolves[:0]
+	for _, pr := range s.pendingResolves {
+		if !t.Before(pr.at) {
+			s.addDeviceError(pr.at, pr.device, pr.code, false)
+			continue
+		}
+		remaining = append(remaining, pr)
+	}
+	s.pendingResolves = remaining
+
+	for _, gw := range s.gateways {
+		for _, d := range gw.devices {
+			if len(d.errorCodes) == 0 {
+				continue
+			}
+			// Roughly one fault every two days per device
+			if s.rng.Float64() < 0.02*hours {
+				code := d.errorCodes[s.rng.IntN(len(d.errorCodes))]
+				s.addDeviceError(t, d, code, true)
+				duration := time.Duration(5+s.rng.IntN(90)) * time.Minute
+				s.pendingResolves = append(s.pendingResolves, simPendingResolve{at: t.Add(duration), device: d, code: code})
+			}
+		}
+
+		// Rare connectivity drops
+		if s.rng.Float64() < 0.005*hours {
+			s.addEvent(t, "gateway-online", gw, nil, map[string]interface{}{"online": false})
+			s.addEvent(t.Add(time.Duration(2+s.rng.IntN(15))*time.Minute), "gateway-online", gw, nil, map[string]interface{}{"online": true})
+		}
+	}
+}
+
+// addDeviceError records a device-error event
+func (s *Simulator) addDeviceError(t time.Time, d *simDevice, code string, active bool) {
+	description := getErrorDescription(code)
+	s.addEvent(t, "device-error", d.gateway, d, map[string]interface{}{
+		"errorCode":        code,
+		"errorDescription": description,
+		"active":           active,
+		"equipmentType":    d.deviceType,
+		"errorEventType":   getSeverity(code),
+	})
+}
+
+// addEvent appends an event to the history
+// Must be called with s.mu held
+func (s *Simulator) addEvent(t time.Time, eventType string, gw *simGateway, d *simDevice, body map[string]interface{}) {
+	if body == nil {
+		body = make(map[string]interface{})
+	}
+	if d != nil {
+		body["deviceId"] = d.id
+		body["modelId"] = d.modelID
+	}
+
+	s.eventSeq++
+	ts := t.UTC().Format("2006-01-02T15:04:05.000Z")
+	s.events = append(s.events, simEvent{
+		seq: s.eventSeq,
+		at:  t,
+		data: map[string]interface{}{
+			"eventType":      eventType,
+			"gatewaySerial":  gw.serial,
+			"body":           body,
+			"createdAt":      ts,
+			"eventTimestamp": ts,
+			"editedBy":       "simulator",
+			"origin":         "simulator",
+		},
+	})
+
+	// Keep events ordered by time (resolve events may be scheduled ahead)
+	sort.SliceStable(s.events, func(i, j int) bool { return s.events[i].at.Before(s.events[j].at) })
+
+	if len(s.events) > simMaxEvents {
+		s.events = s.events[len(s.events)-simMaxEvents:]
+	}
+}
+
+// ServeHTTP routes IAM and IoT API requests
+func (s *Simulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+
+	switch {
+	case path == "idp/v3/authorize":
+		s.handleAuthorize(w, r)
+		return
+	case path == "idp/v3/token":
+		s.handleToken(w, r)
+		return
+	}
+
+	if !s.checkBearer(r) {
+		writeSimError(w, http.StatusUnauthorized, "EXPIRED TOKEN", "Access token is missing, invalid or expired")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(time.Now())
+
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "iot/v2/equipment/installations" && r.Method == http.MethodGet:
+		s.handleInstallations(w, r)
+	case len(parts) == 6 && parts[2] == "events-history" && parts[5] == "events" && r.Method == http.MethodGet:
+		s.handleEvents(w, r, parts[4])
+	case len(parts) >= 10 && parts[2] == "features" && parts[3] == "installations" && parts[9] == "features":
+		s.handleFeatures(w, r, parts)
+	default:
+		writeSimError(w, http.StatusNotFound, "NOT_FOUND", "Unknown simulator endpoint: "+r.URL.Path)
+	}
+}
+
+// writeSimError writes an error in the format of the Viessmann API
+func writeSimError(w http.ResponseWriter, status int, errorType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"viErrorId":  "sim-" + randomHex(8),
+		"statusCode": status,
+		"errorType":  errorType,
+		"message":    message,
+	})
+}
+
+func writeSimJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// handleAuthorize accepts any basic-auth credentials and redirects with a code
+func (s *Simulator) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := r.BasicAuth(); !ok {
+		writeSimError(w, http.StatusUnauthorized, "UNAUTHORIZED", "missing credentials")
+		return
+	}
+	redirect := r.URL.Query().Get("redirect_uri")
+	if redirect == "" {
+		redirect = redirectURI
+	}
+	http.Redirect(w, r, redirect+"?code="+randomHex(16), http.StatusFound)
+}
+
+// handleToken issues tokens for the authorization_code, password and refresh_token grants
+func (s *Simulator) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeSimError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code", "password":
+	case "refresh_token":
+		old := r.PostForm.Get("refresh_token")
+		if !s.refreshTokens[old] {
+			writeSimError(w, http.StatusBadRequest, "invalid_grant", "unknown refresh token")
+			return
+		}
+		delete(s.refreshTokens, old)
+	default:
+		writeSimError(w, http.StatusBadRequest, "unsupported_grant_type", "unsupported grant type")
+		return
+	}
+
+	access := "sim-access-" + randomHex(16)
+	refresh := "sim-refresh-" + randomHex(16)
+	s.accessTokens[access] = time.Now().Add(s.tokenTTL)
+	s.refreshTokens[refresh] = true
+
+	writeSimJSON(w, TokenResponse{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int(s.tokenTTL.Seconds()),
+		TokenType:    "Bearer",
+	})
+}
+
+// checkBearer validates the access token of an IoT request
+func (s *Simulator) checkBearer(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiry, ok := s.accessTokens[token]
+	return ok && time.Now().Before(expiry)
+}
+
+// handleInstallations serves the installation topology
+func (s *Simulator) handleInstallations(w http.ResponseWriter, r *http.Request) {
+	gateways := make([]map[string]interface{}, 0, len(s.gateways))
+	for _, gw := range s.gateways {
+		devices := make([]map[string]interface{}, 0, len(gw.devices))
+		for _, d := range gw.devices {
+			devices = append(devices, map[string]interface{}{
+				"id":         d.id,
+				"deviceType": d.deviceType,
+				"modelId":    d.modelID,
+				"status":     "Online",
+			})
+		}
+		gateways = append(gateways, map[string]interface{}{
+			"serial":  gw.serial,
+			"version": gw.version,
+			"devices": devices,
+		})
+	}
+
+	writeSimJSON(w, map[string]interface{}{
+		"data": []map[string]interface{}{{
+			"id":          s.installationID,
+			"description": s.description,
+			"address": map[string]interface{}{
+				"street":      "Simulatorweg",
+				"houseNumber": "1",
+				"zip":         "35108",
+				"city":        "Allendorf",
+				"country":     "DE",
+			},
+			"gateways": gateways,
+		}},
+		"cursor": map[string]interface{}{"next": ""},
+	})
+}
+
+// handleEvents serves the event history newest first with cursor paging
+// The cursor encodes the last returned sequence number and the lastNDays cutoff
+func (s *Simulator) handleEvents(w http.ResponseWriter, r *http.Request, installationID string) {
+	if installationID != strconv.Itoa(s.installationID) {
+		writeSimError(w, http.StatusNotFound, "NOT_FOUND", "installation not found")
+		return
+	}
+
+	q := r.URL.Query()
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+
+	beforeSeq := int64(-1)
+	var cutoff time.Time
+	if cursor := q.Get("cursor"); cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			writeSimError(w, http.StatusBadRequest, "VALIDATION_ERROR", "invalid cursor")
+			return
+		}
+		var cutoffUnix int64
+		if _, err := fmt.Sscanf(string(raw), "%d:%d", &beforeSeq, &cutoffUnix); err != nil {
+			writeSimError(w, http.StatusBadRequest, "VALIDATION_ERROR", "invalid cursor")
+			return
+		}
+		cutoff = time.Unix(cutoffUnix, 0)
+	} else {
+		days, err := strconv.Atoi(q.Get("lastNDays"))
+		if err != nil || days <= 0 {
+			days = 1
+		}
+		cutoff = time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+	}
+
+	// Continue below the cursor event (events are ordered oldest first)
+	start := len(s.events) - 1
+	if beforeSeq >= 0 {
+		start = -1
+		for i := len(s.events) - 1; i >= 0; i-- {
+			if s.events[i].seq == beforeSeq {
+				start = i - 1
+				break
+			}
+		}
+	}
+
+	now := time.Now()
+	page := make([]map[string]interface{}, 0, limit)
+	var lastSeq int64
+	more := false
+	for i := start; i >= 0; i-- {
+		ev := s.events[i]
+		if ev.at.After(now) {
+			continue // scheduled but not yet happened
+		}
+		if ev.at.Before(cutoff) {
+			break
+		}
+		if len(page) == limit {
+			more = true
+			break
+		}
+		page = append(page, ev.data)
+		lastSeq = ev.seq
+	}
+
+	next := ""
+	if more {
+		next = base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", lastSeq, cutoff.Unix())))
+	}
+
+	writeSimJSON(w, map[string]interface{}{
+		"data":   page,
+		"cursor": map[string]interface{}{"next": next},
+	})
+}
+
+// handleFeatures serves feature lists, single features and command execution
+func (s *Simulator) handleFeatures(w http.ResponseWriter, r *http.Request, parts []string) {
+	if parts[4] != strconv.Itoa(s.installationID) {
+		writeSimError(w, http.StatusNotFound, "NOT_FOUND", "installation not found")
+		return
+	}
+
+	d := s.findDevice(parts[6], parts[8])
+	if d == nil {
+		writeSimError(w, http.StatusNotFound, "DEVICE_NOT_FOUND", "device not found")
+		return
+	}
+
+	switch {
+	case len(parts) == 10 && r.Method == http.MethodGet:
+		names := make([]string, 0, len(d.features))
+		for name := range d.features {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		data := make([]map[string]interface{}, 0, len(names))
+		for _, name := range names {
+			data = append(data, s.renderFeature(d, name))
+		}
+		writeSimJSON(w, map[string]interface{}{"data": data})
+
+	case len(parts) == 11 && r.Method == http.MethodGet:
+		if _, ok := d.features[parts[10]]; !ok {
+			writeSimError(w, http.StatusNotFound, "FEATURE_NOT_FOUND", "feature not found: "+parts[10])
+			return
+		}
+		writeSimJSON(w, map[string]interface{}{"data": s.renderFeature(d, parts[10])})
+
+	case len(parts) == 13 && parts[11] == "commands" && r.Method == http.MethodPost:
+		s.handleCommand(w, r, d, parts[10], parts[12])
+
+	default:
+		writeSimError(w, http.StatusNotFound, "NOT_FOUND", "Unknown simulator endpoint: "+r.URL.Path)
+	}
+}
+
+// handleCommand validates and executes a feature command
+func (s *Simulator) handleCommand(w http.ResponseWriter, r *http.Request, d *simDevice, featureName, commandName string) {
+	feature, ok := d.features[featureName]
+	if !ok {
+		writeSimError(w, http.StatusNotFound, "FEATURE_NOT_FOUND", "feature not found: "+featureName)
+		return
+	}
+	cmd, ok := feature.commands[commandName]
+	if !ok {
+		writeSimError(w, http.StatusNotFound, "COMMAND_NOT_FOUND", "command not found: "+commandName)
+		return
+	}
+
+	body := make(map[string]interface{})
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			writeSimError(w, http.StatusBadRequest, "VALIDATION_ERROR", "invalid JSON body: "+err.Error())
+			return
+		}
+	}
+
+	if err := cmd.execute(d, body); err != nil {
+		writeSimError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	feature.timestamp = time.Now()
+	s.addEvent(time.Now(), "feature-changed", d.gateway, d, map[string]interface{}{
+		"featureName": featureName,
+		"commandName": commandName,
+		"commandBody": body,
+	})
+
+	writeSimJSON(w, map[string]interface{}{
+		"data": map[string]interface{}{
+			"success": true,
+			"reason":  "COMMAND_EXECUTION_SUCCESS",
+		},
+	})
+}
+
+// findDevice looks up a device by gateway serial and device ID
+func (s *Simulator) findDevice(serial, deviceID string) *simDevice {
+	for _, gw := range s.gateways {
+		if gw.serial != serial {
+			continue
+		}
+		for _, d := range gw.devices {
+			if d.id == deviceID {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+// renderFeature converts a feature to its API representation
+func (s *Simulator) renderFeature(d *simDevice, name string) map[string]interface{} {
+	f := d.features[name]
+	base := fmt.Sprintf("%s/iot/v2/features/installations/%d/gateways/%s/devices/%s/features/%s",
+		apiBaseURL, s.installationID, d.gateway.serial, d.id, name)
+
+	commands := make(map[string]interface{}, len(f.commands))
+	for cmdName, cmd := range f.commands {
+		params := cmd.params
+		if params == nil {
+			params = map[string]interface{}{}
+		}
+		commands[cmdName] = map[string]interface{}{
+			"uri":          base + "/commands/" + cmdName,
+			"name":         cmdName,
+			"isExecutable": true,
+			"params":       params,
+		}
+	}
+
+	ts := f.timestamp
+	if ts.IsZero() {
+		ts = s.lastTick
+	}
+
+	return map[string]interface{}{
+		"feature":    name,
+		"apiVersion": 1,
+		"uri":        base,
+		"gatewayId":  d.gateway.serial,
+		"deviceId":   d.id,
+		"isEnabled":  true,
+		"isReady":    true,
+		"timestamp":  ts.UTC().Format("2006-01-02T15:04:05.000Z"),
+		"properties": f.properties,
+		"commands":   commands,
+	}
+}
+
+// --- Device helpers used by the profiles ---
+
+// addDevice adds a device to a gateway
+func (gw *simGateway) addDevice(id, deviceType, modelID string) *simDevice {
+	d := &simDevice{
+		id:         id,
+		deviceType: deviceType,
+		modelID:    modelID,
+		gateway:    gw,
+		features:   make(map[string]*simFeature),
+	}
+	gw.devices = append(gw.devices, d)
+	return d
+}
+
+// feature returns a feature, creating it if necessary
+func (d *simDevice) feature(name string) *simFeature {
+	f, ok := d.features[name]
+	if !ok {
+		f = &simFeature{
+			properties: make(map[string]interface{}),
+			commands:   make(map[string]*simCommand),
+		}
+		d.features[name] = f
+	}
+	return f
+}
+
+// setProp sets a typed property of a feature
+func (d *simDevice) setProp(feature, prop string, value interface{}, unit string) {
+	p := map[string]interface{}{
+		"type":  simValueType(value),
+		"value": value,
+	}
+	if unit != "" {
+		p["unit"] = unit
+	}
+	d.feature(feature).properties[prop] = p
+}
+
+// setValue sets the main "value" property of a feature
+func (d *simDevice) setValue(feature string, value interface{}, unit string) {
+	d.setProp(feature, "value", value, unit)
+}
+
+// setStatus sets the "status" property used by pumps and sensors
+func (d *simDevice) setStatus(feature, status string) {
+	d.setProp(feature, "status", status, "")
+}
+
+// num reads a numeric property
+func (d *simDevice) num(feature, prop string) float64 {
+	if f, ok := d.features[feature]; ok {
+		if p, ok := f.properties[prop].(map[string]interface{}); ok {
+			if v, ok := p["value"].(float64); ok {
+				return v
+			}
+		}
+	}
+	return 0
+}
+
+// str reads a string property
+func (d *simDevice) str(feature, prop string) string {
+	if f, ok := d.features[feature]; ok {
+		if p, ok := f.properties[prop].(map[string]interface{}); ok {
+			if v, ok := p["value"].(string); ok {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// flag reads a boolean property
+func (d *simDevice) flag(feature, prop string) bool {
+	if f, ok := d.features[feature]; ok {
+		if p, ok := f.properties[prop].(map[string]interface{}); ok {
+			if v, ok := p["value"].(bool); ok {
+				return v
+			}
+		}
+	}
+	return false
+}
+
+// addCommand registers an executable command on a feature
+func (d *simDevice) addCommand(feature, name string, params map[string]interface{}, execute func(d *simDevice, body map[string]interface{}) error) {
+	d.feature(feature).commands[name] = &simCommand{params: params, execute: execute}
+}
+
+func simValueType(value interface{}) string {
+	switch value.(type) {
+	case float64, int:
+		return "number"
+	case bool:
+		return "boolean"
+	case []float64:
+		return "array"
+	default:
+		return "string"
+	}
+}
+
+// simNumberParam describes a numeric command parameter
+func simNumberParam(min, max, stepping float64) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "number",
+		"required":    true,
+		"constraints": map[string]interface{}{"min": min, "max": max, "stepping": stepping},
+	}
+}
+
+// simEnumParam describes a string command parameter with fixed values
+func simEnumParam(values ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "string",
+		"required":    true,
+		"constraints": map[string]interface{}{"enum": values},
+	}
+}
+
+// simBoolParam describes a boolean command parameter
+func simBoolParam() map[string]interface{} {
+	return map[string]interface{}{"type": "boolean", "required": true, "constraints": map[string]interface{}{}}
+}
+
+// bodyNumber validates a numeric command parameter
+func bodyNumber(body map[string]interface{}, name string, min, max float64) (float64, error) {
+	v, ok := body[name].(float64)
+	if !ok {
+		return 0, fmt.Errorf("parameter %s is required and must be a number", name)
+	}
+	if v < min || v > max {
+		return 0, fmt.Errorf("parameter %s must be between %g and %g", name, min, max)
+	}
+	return v, nil
+}
+
+// bodyEnum validates a string command parameter
+func bodyEnum(body map[string]interface{}, name string, values ...string) (string, error) {
+	v, ok := body[name].(string)
+	if !ok {
+		return "", fmt.Errorf("parameter %s is required and must be a string", name)
+	}
+	for _, allowed := range values {
+		if v == allowed {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("parameter %s must be one of: %s", name, strings.Join(values, ", "))
+}
+
+// bodyBool validates a boolean command parameter
+func bodyBool(body map[string]interface{}, name string) (bool, error) {
+	v, ok := body[name].(bool)
+	if !ok {
+		return false, fmt.Errorf("parameter %s is required and must be a boolean", name)
+	}
+	return v, nil
+}
+
+// --- In-memory credential storage for simulate mode ---
+
+// SimulatorStorage keeps accounts in memory so simulate mode never touches the
+// real keyring or accounts.json
+type SimulatorStorage struct {
+	mu    sync.Mutex
+	store *AccountStore
+}
+
+func newSimulatorStorage() *SimulatorStorage {
+	dbPath := getEnv("VICARE_SIM_DB", filepath.Join(os.TempDir(), "vieventlog-sim.db"))
+	return &SimulatorStorage{
+		store: &AccountStore{
+			Accounts: map[string]*Account{
+				"demo@vicare.sim": {
+					ID:           "demo@vicare.sim",
+					Name:         "Simulator",
+					Email:        "demo@vicare.sim",
+					Password:     "simulator",
+					ClientID:     "vicare-simulator",
+					ClientSecret: defaultClientSecret,
+					Active:       true,
+				},
+			},
+			EventArchiveSettings: &EventArchiveSettings{
+				Enabled:         true,
+				RetentionDays:   30,
+				RefreshInterval: 5,
+				DatabasePath:    dbPath,
+			},
+		},
+	}
+}
+
+func (s *SimulatorStorage) SaveCredentials(creds Credentials) error {
+	return fmt.Errorf("credential saving not supported in simulate mode")
+}
+
+func (s *SimulatorStorage) LoadCredentials() (*Credentials, error) {
+	return nil, nil
+}
+
+func (s *SimulatorStorage) DeleteCredentials() error {
+	return nil
+}
+
+func (s *SimulatorStorage) SaveAccounts(store *AccountStore) error {
+	data, err := json.Marshal(store)
+	if err != nil {
+		return fmt.Errorf("failed to marshal accounts: %w", err)
+	}
+	var copied AccountStore
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return fmt.Errorf("failed to copy accounts: %w", err)
+	}
+
+	s.mu.Lock()
+	s.store = &copied
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *SimulatorStorage) LoadAccounts() (*AccountStore, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(s.store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal accounts: %w", err)
+	}
+	var copied AccountStore
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return nil, fmt.Errorf("failed to copy accounts: %w", err)
+	}
+	if copied.Accounts == nil {
+		copied.Accounts = make(map[string]*Account)
+	}
+	return &copied, nil
+}
+
+func (s *SimulatorStorage) SaveTokens(tokens map[string]*AccountToken) error {
+	return nil // Simulator tokens are not worth persisting
+}
+
+func (s *SimulatorStorage) LoadTokens() (map[string]*AccountToken, error) {
+	return nil, nil
+}
+
+// simulatorEnabled reports whether simulate mode was requested via flag or env
+func simulatorEnabled(flagValue bool) bool {
+	if flagValue {
+		return true
+	}
+	enabled, _ := strconv.ParseBool(os.Getenv("VICARE_SIMULATE"))
+	return enabled
+}
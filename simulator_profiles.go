@@ -0,0 +1,1115 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Device profiles for the API simulator. Each profile builds one gateway with its
+// devices; add new profiles by calling registerSimProfile from an init function.
+
+func init() {
+	registerSimProfile(&simProfile{
+		Name:        "heatpump",
+		Description: "Vitocal 250-A air/water heat pump with DHW cylinder",
+		Build: func(gw *simGateway) {
+			d := gw.addDevice("0", "heating", "E3_Vitocal_16")
+			d.errorCodes = []string{"A.11", "A.16", "A.71", "F.454", "P.4"}
+			d.model = &simHeatingModel{heatPump: true, minOutput: 2.5, maxOutput: 10}
+			setupHeatingControls(d, "Vitocal 250-A", []string{"heating", "standby", "cooling", "heatingCooling"})
+			setupHeatPumpControls(d)
+		},
+	})
+
+	registerSimProfile(&simProfile{
+		Name:        "gasboiler",
+		Description: "Vitodens gas condensing boiler",
+		Build: func(gw *simGateway) {
+			d := gw.addDevice("0", "heating", "E3_Vitodens_100_0421")
+			d.errorCodes = []string{"A.11", "A.19", "F.01", "F.10", "P.8"}
+			d.model = &simHeatingModel{burner: true, minOutput: 3, maxOutput: 19}
+			setupHeatingControls(d, "Vitodens 100-W", []string{"heating", "standby"})
+		},
+	})
+
+	registerSimProfile(&simProfile{
+		Name:        "hybrid",
+		Description: "Hybrid heat pump with gas boiler as secondary heat generator",
+		Build: func(gw *simGateway) {
+			d := gw.addDevice("0", "heating", "E3_HybridPro_Vitocaldens")
+			d.errorCodes = []string{"A.11", "A.16", "F.454", "F.10", "P.4"}
+			d.model = &simHeatingModel{heatPump: true, burner: true, bivalencePoint: -3, minOutput: 2.5, maxOutput: 8}
+			setupHeatingControls(d, "Hybrid Pro", []string{"heating", "standby"})
+			setupHeatPumpControls(d)
+		},
+	})
+
+	registerSimProfile(&simProfile{
+		Name:        "vitovent",
+		Description: "Vitovent 300-F ventilation unit with heat recovery",
+		Build: func(gw *simGateway) {
+			d := gw.addDevice("0", "ventilation", "E3_ViAir_300F")
+			d.errorCodes = []string{"P.35"}
+			d.model = &simVentilationModel{}
+			setupVentilationControls(d)
+		},
+	})
+
+	registerSimProfile(&simProfile{
+		Name:        "vitocharge",
+		Description: "Vitocharge VX3 PV inverter with battery storage",
+		Build: func(gw *simGateway) {
+			d := gw.addDevice("0", "electricityStorage", "E3_VitoCharge_03")
+			d.model = &simEnergyStorageModel{peakPower: 9800, batteryCapacity: 10.2}
+			d.setProp("device.name", "name", "Vitocharge VX3", "")
+			d.setValue("photovoltaic.installedPeakPower", 9.8, "kilowattPeak")
+			d.setValue("ess.configuration.systemType", "hybrid", "")
+			d.setValue("ess.configuration.backupBox", "notAvailable", "")
+			d.setValue("photovoltaic.status", "ready", "")
+		},
+	})
+
+	registerSimProfile(&simProfile{
+		Name:        "trv",
+		Description: "Zigbee room control with radiator thermostats and a climate sensor",
+		Build: func(gw *simGateway) {
+			rooms := []struct {
+				name, roomType string
+				setpoint       float64
+			}{
+				{"Wohnzimmer", "livingroom", 21},
+				{"Bad", "bathroom", 22},
+				{"Schlafzimmer", "bedroom", 18},
+			}
+
+			rc := gw.addDevice("RoomControl-1", "roomControl", "Smart_RoomControl")
+			rcModel := &simRoomControlModel{}
+			rc.model = rcModel
+
+			for i, room := range rooms {
+				prefix := fmt.Sprintf("rooms.%d", i)
+				rc.setProp(prefix, "name", room.name, "")
+				rc.setProp(prefix, "type", room.roomType, "")
+				rc.setProp(prefix+".temperature.levels.normal.perceived", "temperature", room.setpoint, "celsius")
+				rc.addCommand(prefix+".temperature.levels.normal.perceived", "setTemperature",
+					map[string]interface{}{"targetTemperature": simNumberParam(8, 30, 0.5)},
+					func(d *simDevice, body map[string]interface{}) error {
+						v, err := bodyNumber(body, "targetTemperature", 8, 30)
+						if err != nil {
+							return err
+						}
+						d.setProp(prefix+".temperature.levels.normal.perceived", "temperature", v, "celsius")
+						return nil
+					})
+
+				trv := gw.addDevice(fmt.Sprintf("zigbee-%016x", 0x048727fffe1a2b00+i), "zigbee", "Smart_Device_eTRV_generation_1")
+				trv.model = &simTRVModel{room: i, roomControl: rc}
+				setupTRVControls(trv, room.name+" Heizkörper", room.setpoint)
+				rcModel.rooms = append(rcModel.rooms, &simRoomState{temp: room.setpoint - 0.5, humidity: 48, trv: trv})
+			}
+
+			cs := gw.addDevice(fmt.Sprintf("zigbee-%016x", 0x048727fffe1a2bf0), "zigbee", "Smart_Device_cs_generic_1")
+			cs.model = &simClimateSensorModel{roomControl: rcModel}
+			cs.setProp("device.name", "name", "Klimasensor Wohnzimmer", "")
+		},
+	})
+}
+
+// heatPumpCOP estimates the COP of an air/water heat pump from a Carnot
+// efficiency of 50% with a 5K temperature approach
+func heatPumpCOP(supply, outside float64) float64 {
+	lift := supply - outside + 5
+	if lift < 10 {
+		lift = 10
+	}
+	return clampFloat(0.5*(supply+273.15)/lift, 1.5, 6.5)
+}
+
+func clampFloat(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+func sinDeg(deg float64) float64 { return math.Sin(deg * math.Pi / 180) }
+func cosDeg(deg float64) float64 { return math.Cos(deg * math.Pi / 180) }
+
+func round1(v float64) float64 { return math.Round(v*10) / 10 }
+
+// --- Energy counters ---
+
+// simEnergyCounter accumulates energy into the day/week/month/year buckets the
+// Viessmann API reports (index 0 is the current period)
+type simEnergyCounter struct {
+	days   [8]float64
+	weeks  [6]float64
+	months [13]float64
+	years  [2]float64
+	total  float64
+
+	day, week, month, year int
+}
+
+func (c *simEnergyCounter) add(kwh float64, t time.Time) {
+	local := t.In(DefaultLocation)
+	year, week := local.ISOWeek()
+	dayKey := local.Year()*1000 + local.YearDay()
+	weekKey := year*100 + week
+	monthKey := local.Year()*100 + int(local.Month())
+
+	if c.day != 0 {
+		shiftBuckets(c.days[:], c.dayDistance(c.day, dayKey, local))
+		shiftBuckets(c.weeks[:], weekDistance(c.week, weekKey))
+		shiftBuckets(c.months[:], (monthKey/100-c.month/100)*12+(monthKey%100-c.month%100))
+		shiftBuckets(c.years[:], local.Year()-c.year)
+	}
+	c.day, c.week, c.month, c.year = dayKey, weekKey, monthKey, local.Year()
+
+	c.days[0] += kwh
+	c.weeks[0] += kwh
+	c.months[0] += kwh
+	c.years[0] += kwh
+	c.total += kwh
+}
+
+// dayDistance returns how many days lie between two day keys
+func (c *simEnergyCounter) dayDistance(from, to int, local time.Time) int {
+	if from == to {
+		return 0
+	}
+	fromDate := time.Date(from/1000, 1, 1, 0, 0, 0, 0, DefaultLocation).AddDate(0, 0, from%1000-1)
+	toDate := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, DefaultLocation)
+	return int(math.Round(toDate.Sub(fromDate).Hours() / 24))
+}
+
+func weekDistance(from, to int) int {
+	if from == to {
+		return 0
+	}
+	// Approximate: 52 weeks per year is good enough for bucket rotation
+	return (to/100-from/100)*52 + (to%100 - from%100)
+}
+
+// shiftBuckets moves bucket values n periods into the past
+func shiftBuckets(buckets []float64, n int) {
+	if n <= 0 {
+		return
+	}
+	for i := len(buckets) - 1; i >= 0; i-- {
+		if i-n >= 0 {
+			buckets[i] = buckets[i-n]
+		} else {
+			buckets[i] = 0
+		}
+	}
+}
+
+func roundedSlice(values []float64) []float64 {
+	out := make([]float64, len(values))
+	for i, v := range values {
+		out[i] = round1(v)
+	}
+	return out
+}
+
+// setCounterFeature writes a day/week/month/year array feature
+func (d *simDevice) setCounterFeature(name string, c *simEnergyCounter) {
+	d.setProp(name, "day", roundedSlice(c.days[:]), "kilowattHour")
+	d.setProp(name, "week", roundedSlice(c.weeks[:]), "kilowattHour")
+	d.setProp(name, "month", roundedSlice(c.months[:]), "kilowattHour")
+	d.setProp(name, "year", roundedSlice(c.years[:]), "kilowattHour")
+}
+
+// setSummaryFeature writes a summary feature (currentDay, lastSevenDays, ...)
+func (d *simDevice) setSummaryFeature(name string, c *simEnergyCounter) {
+	lastSeven := 0.0
+	for _, v := range c.days[:7] {
+		lastSeven += v
+	}
+	d.setProp(name, "currentDay", round1(c.days[0]), "kilowattHour")
+	d.setProp(name, "lastSevenDays", round1(lastSeven), "kilowattHour")
+	d.setProp(name, "currentMonth", round1(c.months[0]), "kilowattHour")
+	d.setProp(name, "lastMonth", round1(c.months[1]), "kilowattHour")
+	d.setProp(name, "currentYear", round1(c.years[0]), "kilowattHour")
+	d.setProp(name, "lastYear", round1(c.years[1]), "kilowattHour")
+}
+
+// --- Heating devices (heat pump, gas boiler, hybrid) ---
+
+// setupHeatingControls adds heating circuit and DHW features with their commands
+func setupHeatingControls(d *simDevice, name string, circuitModes []string) {
+	d.setProp("device.name", "name", name, "")
+
+	// Heating circuit 0
+	d.setProp("heating.circuits.0", "active", true, "")
+	d.setProp("heating.circuits.0", "name", "Heizkreis 1", "")
+	d.setProp("heating.circuits.0.heating.curve", "slope", 0.6, "")
+	d.setProp("heating.circuits.0.heating.curve", "shift", 0.0, "")
+	d.addCommand("heating.circuits.0.heating.curve", "setCurve",
+		map[string]interface{}{"slope": simNumberParam(0.2, 3.5, 0.1), "shift": simNumberParam(-13, 40, 1)},
+		func(d *simDevice, body map[string]interface{}) error {
+			slope, err := bodyNumber(body, "slope", 0.2, 3.5)
+			if err != nil {
+				return err
+			}
+			shift, err := bodyNumber(body, "shift", -13, 40)
+			if err != nil {
+				return err
+			}
+			d.setProp("heating.circuits.0.heating.curve", "slope", round1(slope), "")
+			d.setProp("heating.circuits.0.heating.curve", "shift", shift, "")
+			return nil
+		})
+
+	d.setValue("heating.circuits.0.operating.modes.active", "heating", "")
+	d.addCommand("heating.circuits.0.operating.modes.active", "setMode",
+		map[string]interface{}{"mode": simEnumParam(circuitModes...)},
+		func(d *simDevice, body map[string]interface{}) error {
+			mode, err := bodyEnum(body, "mode", circuitModes...)
+			if err != nil {
+				return err
+			}
+			d.setValue("heating.circuits.0.operating.modes.active", mode, "")
+			return nil
+		})
+
+	d.setProp("heating.circuits.0.temperature.levels", "min", 15.0, "celsius")
+	d.setProp("heating.circuits.0.temperature.levels", "max", 45.0, "celsius")
+	d.addCommand("heating.circuits.0.temperature.levels", "setMax",
+		map[string]interface{}{"temperature": simNumberParam(25, 70, 1)},
+		func(d *simDevice, body map[string]interface{}) error {
+			v, err := bodyNumber(body, "temperature", 25, 70)
+			if err != nil {
+				return err
+			}
+			d.setProp("heating.circuits.0.temperature.levels", "max", v, "celsius")
+			return nil
+		})
+
+	for program, temp := range map[string]float64{"normal": 20, "reduced": 17, "comfort": 22} {
+		feature := "heating.circuits.0.operating.programs." + program
+		d.setProp(feature, "active", false, "")
+		d.setProp(feature, "temperature", temp, "celsius")
+		d.addCommand(feature, "setTemperature",
+			map[string]interface{}{"targetTemperature": simNumberParam(3, 37, 1)},
+			func(d *simDevice, body map[string]interface{}) error {
+				v, err := bodyNumber(body, "targetTemperature", 3, 37)
+				if err != nil {
+					return err
+				}
+				d.setProp(feature, "temperature", v, "celsius")
+				return nil
+			})
+	}
+
+	// Domestic hot water
+	d.setProp("heating.dhw", "active", true, "")
+	d.setProp("heating.dhw", "status", "on", "")
+
+	dhwModes := []string{"efficient", "efficientWithMinComfort", "balanced", "off"}
+	d.setValue("heating.dhw.operating.modes.active", "efficient", "")
+	d.addCommand("heating.dhw.operating.modes.active", "setMode",
+		map[string]interface{}{"mode": simEnumParam(dhwModes...)},
+		func(d *simDevice, body map[string]interface{}) error {
+			mode, err := bodyEnum(body, "mode", dhwModes...)
+			if err != nil {
+				return err
+			}
+			d.setValue("heating.dhw.operating.modes.active", mode, "")
+			return nil
+		})
+
+	for _, feature := range []string{"heating.dhw.temperature.main", "heating.dhw.temperature.temp2"} {
+		feature := feature
+		d.setValue(feature, 50.0, "celsius")
+		d.addCommand(feature, "setTargetTemperature",
+			map[string]interface{}{"temperature": simNumberParam(10, 60, 1)},
+			func(d *simDevice, body map[string]interface{}) error {
+				v, err := bodyNumber(body, "temperature", 10, 60)
+				if err != nil {
+					return err
+				}
+				d.setValue(feature, v, "celsius")
+				return nil
+			})
+	}
+	d.setValue("heating.dhw.temperature.temp2", 60.0, "celsius")
+
+	d.setValue("heating.dhw.temperature.hysteresis", 5.0, "kelvin")
+	d.setProp("heating.dhw.temperature.hysteresis", "switchOnValue", 5.0, "kelvin")
+	d.setProp("heating.dhw.temperature.hysteresis", "switchOffValue", 0.0, "kelvin")
+	for command, prop := range map[string]string{"setHysteresisSwitchOnValue": "switchOnValue", "setHysteresisSwitchOffValue": "switchOffValue"} {
+		prop := prop
+		d.addCommand("heating.dhw.temperature.hysteresis", command,
+			map[string]interface{}{"hysteresis": simNumberParam(0, 10, 0.5)},
+			func(d *simDevice, body map[string]interface{}) error {
+				v, err := bodyNumber(body, "hysteresis", 0, 10)
+				if err != nil {
+					return err
+				}
+				d.setProp("heating.dhw.temperature.hysteresis", prop, v, "kelvin")
+				if prop == "switchOnValue" {
+					d.setValue("heating.dhw.temperature.hysteresis", v, "kelvin")
+				}
+				return nil
+			})
+	}
+
+	d.setProp("heating.dhw.oneTimeCharge", "active", false, "")
+	d.addCommand("heating.dhw.oneTimeCharge", "activate", nil, func(d *simDevice, body map[string]interface{}) error {
+		d.setProp("heating.dhw.oneTimeCharge", "active", true, "")
+		return nil
+	})
+	d.addCommand("heating.dhw.oneTimeCharge", "deactivate", nil, func(d *simDevice, body map[string]interface{}) error {
+		d.setProp("heating.dhw.oneTimeCharge", "active", false, "")
+		return nil
+	})
+}
+
+// setupHeatPumpControls adds the heat pump specific command features
+func setupHeatPumpControls(d *simDevice) {
+	noiseModes := []string{"notReduced", "slightlyReduced", "maxReduced"}
+	d.setValue("heating.noise.reduction.operating.programs.active", "notReduced", "")
+	d.addCommand("heating.noise.reduction.operating.programs.active", "setMode",
+		map[string]interface{}{"mode": simEnumParam(noiseModes...)},
+		func(d *simDevice, body map[string]interface{}) error {
+			mode, err := bodyEnum(body, "mode", noiseModes...)
+			if err != nil {
+				return err
+			}
+			d.setValue("heating.noise.reduction.operating.programs.active", mode, "")
+			return nil
+		})
+
+	d.setProp("heating.heater.fanRing", "active", false, "")
+	d.addCommand("heating.heater.fanRing", "setActive",
+		map[string]interface{}{"active": simBoolParam()},
+		func(d *simDevice, body map[string]interface{}) error {
+			v, err := bodyBool(body, "active")
+			if err != nil {
+				return err
+			}
+			d.setProp("heating.heater.fanRing", "active", v, "")
+			return nil
+		})
+}
+
+// simHeatingModel simulates a heat generator (heat pump and/or burner) heating a
+// building with one floor heating circuit and a 200l DHW cylinder
+type simHeatingModel struct {
+	heatPump       bool
+	burner         bool
+	bivalencePoint float64 // below this outside temperature a hybrid uses the burner
+	minOutput      float64 // kW thermal
+	maxOutput      float64 // kW thermal
+
+	initialized bool
+	supply      float64
+	room        float64
+	dhw         float64
+	running     bool
+	dhwCharge   bool
+	useBurner   bool
+	lastSwitch  time.Time
+
+	compressorHours, compressorStarts float64
+	burnerHours, burnerStarts         float64
+
+	elecHeating, elecDHW simEnergyCounter
+	heatHeating, heatDHW simEnergyCounter
+	gasHeating, gasDHW   simEnergyCounter
+}
+
+const (
+	simBuildingLoss   = 0.15 // kW/K heat loss coefficient of the building
+	simEmitterFactor  = 0.25 // kW/K floor heating output per K above room temperature
+	simWaterCapacity  = 0.3  // kWh/K heating water in the circuit
+	simRoomCapacity   = 10.0 // kWh/K thermal mass of the building
+	simDHWKelvinPerKW = 4.3  // K temperature rise of a 200l cylinder per kWh
+)
+
+func (m *simHeatingModel) init(d *simDevice, env *simEnvironment) {
+	m.initialized = true
+	m.room = 20
+	m.supply = 28
+	m.dhw = 47
+	m.compressorHours = 4213
+	m.compressorStarts = 9120
+	m.burnerHours = 1840
+	m.burnerStarts = 6350
+
+	// Seed a year of plausible daily energy history from the weather model
+	today := time.Date(env.now.In(DefaultLocation).Year(), env.now.In(DefaultLocation).Month(), env.now.In(DefaultLocation).Day(), 12, 0, 0, 0, DefaultLocation)
+	for day := today.AddDate(-1, 0, 0); day.Before(today); day = day.AddDate(0, 0, 1) {
+		avg := 0.0
+		for h := 0; h < 24; h += 3 {
+			outside, _ := simWeather(day.Add(time.Duration(h-12) * time.Hour))
+			avg += outside / 8
+		}
+		heatDemand := math.Max(0, 17-avg) * simBuildingLoss * 24
+		dhwDemand := 6.0
+		m.accountEnergy(day, heatDemand, dhwDemand, avg)
+	}
+}
+
+// accountEnergy books produced heat into the counters, deriving electricity/gas use
+func (m *simHeatingModel) accountEnergy(t time.Time, heatKWh, dhwKWh, outside float64) {
+	burner := m.burner && (!m.heatPump || outside < m.bivalencePoint)
+	if burner {
+		m.gasHeating.add(heatKWh/0.95, t)
+		m.gasDHW.add(dhwKWh/0.95, t)
+		m.elecHeating.add(heatKWh*0.01, t)
+		m.elecDHW.add(dhwKWh*0.01, t)
+	} else {
+		m.elecHeating.add(heatKWh/heatPumpCOP(heatingCurveSupplyTemp(0.6, 0, 20, outside), outside), t)
+		m.elecDHW.add(dhwKWh/heatPumpCOP(55, outside), t)
+	}
+	m.heatHeating.add(heatKWh, t)
+	m.heatDHW.add(dhwKWh, t)
+}
+
+func (m *simHeatingModel) tick(d *simDevice, env *simEnvironment, dt time.Duration) {
+	if !m.initialized {
+		m.init(d, env)
+	}
+	h := dt.Hours()
+	outside := env.outsideTemp
+	local := env.now.In(DefaultLocation)
+
+	// Active program: reduced at night
+	program := "normal"
+	if local.Hour() >= 22 || local.Hour() < 6 {
+		program = "reduced"
+	}
+	for _, p := range []string{"normal", "reduced", "comfort"} {
+		d.setProp("heating.circuits.0.operating.programs."+p, "active", p == program, "")
+	}
+	d.setValue("heating.circuits.0.operating.programs.active", program, "")
+	roomSetpoint := d.num("heating.circuits.0.operating.programs."+program, "temperature")
+
+	mode := d.str("heating.circuits.0.operating.modes.active", "value")
+	target := heatingCurveSupplyTemp(
+		d.num("heating.circuits.0.heating.curve", "slope"),
+		d.num("heating.circuits.0.heating.curve", "shift"),
+		roomSetpoint, outside)
+	target = clampFloat(target, d.num("heating.circuits.0.temperature.levels", "min"), d.num("heating.circuits.0.temperature.levels", "max"))
+	heatingDemand := (mode == "heating" || mode == "heatingCooling") && outside < roomSetpoint-3
+
+	// Hot water: standby losses and random draws in the morning and evening
+	m.dhw -= 0.8 * h
+	if (local.Hour() >= 6 && local.Hour() < 8) || (local.Hour() >= 18 && local.Hour() < 21) {
+		if env.sim != nil && env.sim.rng.Float64() < 0.6*h {
+			m.dhw -= 4 + env.sim.rng.Float64()*8
+		}
+	}
+	m.dhw = math.Max(m.dhw, 12)
+
+	dhwTarget := d.num("heating.dhw.temperature.main", "value")
+	dhwMode := d.str("heating.dhw.operating.modes.active", "value")
+	oneTime := d.flag("heating.dhw.oneTimeCharge", "active")
+	if !m.dhwCharge && dhwMode != "off" && (m.dhw < dhwTarget-d.num("heating.dhw.temperature.hysteresis", "switchOnValue") || oneTime) {
+		m.dhwCharge = true
+	}
+	if m.dhwCharge && (m.dhw >= dhwTarget+d.num("heating.dhw.temperature.hysteresis", "switchOffValue") || (dhwMode == "off" && !oneTime)) {
+		m.dhwCharge = false
+		if oneTime {
+			d.setProp("heating.dhw.oneTimeCharge", "active", false, "")
+		}
+	}
+
+	// Two-point control on the supply temperature with a minimum run time
+	wantHeat := m.dhwCharge
+	if heatingDemand {
+		if m.running {
+			wantHeat = wantHeat || m.supply < target+2
+		} else {
+			wantHeat = wantHeat || m.supply < target-2
+		}
+	}
+	if m.running && !wantHeat && env.now.Sub(m.lastSwitch) < 6*time.Minute {
+		wantHeat = true
+	}
+
+	if wantHeat && !m.running {
+		m.running = true
+		m.lastSwitch = env.now
+		m.useBurner = m.burner && (!m.heatPump || outside < m.bivalencePoint)
+		if m.useBurner {
+			m.burnerStarts++
+		} else {
+			m.compressorStarts++
+		}
+	} else if !wantHeat && m.running {
+		m.running = false
+		m.lastSwitch = env.now
+	}
+
+	// Heat flows
+	emission := math.Max(0, simEmitterFactor*(m.supply-m.room))
+	loss := simBuildingLoss * (m.room - outside)
+
+	var thermalKW, elecW, gasKW, modulation float64
+	if m.running {
+		setpoint := target
+		if m.dhwCharge {
+			setpoint = dhwTarget + 8
+		}
+		demand := emission + simWaterCapacity*(setpoint-m.supply)/0.25
+		if m.dhwCharge {
+			demand = m.maxOutput
+		}
+		thermalKW = clampFloat(demand, m.minOutput, m.maxOutput)
+		modulation = (thermalKW - m.minOutput) / (m.maxOutput - m.minOutput)
+
+		if m.useBurner {
+			gasKW = thermalKW / 0.95
+			elecW = 70
+		} else {
+			elecW = thermalKW / heatPumpCOP(m.supply, outside) * 1000
+		}
+	}
+
+	if h > 0 {
+		if m.running && m.dhwCharge {
+			m.dhw += thermalKW * h * simDHWKelvinPerKW
+			m.supply += (m.dhw + 6 - m.supply) * (1 - math.Exp(-h*60/5))
+		} else {
+			m.supply += (thermalKW - emission) * h / simWaterCapacity
+		}
+		m.room += (emission - loss) * h / simRoomCapacity
+		m.room = clampFloat(m.room, 12, 28)
+		if !heatingDemand && !m.running {
+			m.supply += (m.room - m.supply) * (1 - math.Exp(-h*60/60))
+		}
+
+		if m.running {
+			if m.useBurner {
+				m.burnerHours += h
+			} else {
+				m.compressorHours += h
+			}
+			if m.dhwCharge {
+				m.heatDHW.add(thermalKW*h, env.now)
+				m.elecDHW.add(elecW/1000*h, env.now)
+				m.gasDHW.add(gasKW*h, env.now)
+			} else {
+				m.heatHeating.add(thermalKW*h, env.now)
+				m.elecHeating.add(elecW/1000*h, env.now)
+				m.gasHeating.add(gasKW*h, env.now)
+			}
+		}
+	}
+
+	flow := 0.0
+	if m.running {
+		flow = 1100
+		if m.dhwCharge {
+			flow = 1500
+		}
+	}
+	returnTemp := m.supply - 0.3
+	if flow > 0 {
+		returnTemp = m.supply - thermalKW*860/flow
+	}
+
+	m.writeFeatures(d, env, outside, target, returnTemp, flow, thermalKW, elecW, modulation, heatingDemand)
+}
+
+func (m *simHeatingModel) writeFeatures(d *simDevice, env *simEnvironment, outside, target, returnTemp, flow, thermalKW, elecW, modulation float64, heatingDemand bool) {
+	d.setValue("heating.sensors.temperature.outside", round1(outside), "celsius")
+	d.setValue("heating.circuits.0.sensors.temperature.supply", round1(m.supply), "celsius")
+	d.setValue("heating.sensors.temperature.return", round1(returnTemp), "celsius")
+	d.setValue("heating.dhw.sensors.temperature.hotWaterStorage", round1(m.dhw), "celsius")
+	d.setValue("heating.dhw.sensors.temperature.dhwCylinder", round1(m.dhw), "celsius")
+	d.setValue("heating.sensors.pressure.supply", round1(1.8+0.1*math.Sin(float64(env.now.Unix())/3600)), "bar")
+	d.setValue("heating.circuits.0.temperature", round1(target), "celsius")
+
+	pump := "off"
+	if heatingDemand || m.running {
+		pump = "on"
+	}
+	d.setStatus("heating.circuits.0.circulation.pump", pump)
+	d.setStatus("heating.dhw.pumps.circulation", "off")
+
+	d.setCounterFeature("heating.power.consumption.heating", &m.elecHeating)
+	d.setCounterFeature("heating.power.consumption.dhw", &m.elecDHW)
+	d.setSummaryFeature("heating.power.consumption.summary.heating", &m.elecHeating)
+	d.setSummaryFeature("heating.power.consumption.summary.dhw", &m.elecDHW)
+	totalElec := m.elecHeating
+	d.setCounterFeature("heating.power.consumption.total", addCounters(&totalElec, &m.elecDHW))
+	d.setCounterFeature("heating.heat.production.heating", &m.heatHeating)
+	d.setCounterFeature("heating.heat.production.dhw", &m.heatDHW)
+	d.setSummaryFeature("heating.heat.production.summary.heating", &m.heatHeating)
+	d.setSummaryFeature("heating.heat.production.summary.dhw", &m.heatDHW)
+
+	if m.heatPump {
+		compressorActive := m.running && !m.useBurner
+		phase := "ready"
+		if compressorActive {
+			phase = "heating"
+		}
+		d.setProp("heating.compressors.0", "active", compressorActive, "")
+		d.setProp("heating.compressors.0", "phase", phase, "")
+		d.setProp("heating.compressors.0.statistics", "hours", math.Round(m.compressorHours), "hour")
+		d.setProp("heating.compressors.0.statistics", "starts", m.compressorStarts, "")
+
+		speed, power, current := 0.0, 0.0, 0.0
+		if compressorActive {
+			speed = 15 + 75*modulation
+			power = elecW
+			current = elecW / 230
+		}
+		d.setValue("heating.compressors.0.speed.current", math.Round(speed), "revolutionsPerSecond")
+		d.setValue("heating.inverters.0.sensors.power.output", math.Round(power), "watt")
+		d.setValue("heating.inverters.0.sensors.power.current", round1(current), "ampere")
+		d.setValue("heating.compressors.0.sensors.temperature.inlet", round1(outside-6+4*modulation), "celsius")
+		d.setValue("heating.compressors.0.sensors.temperature.outlet", round1(m.supply+15*boolFloat(compressorActive)), "celsius")
+		d.setValue("heating.compressors.0.sensors.temperature.oil", round1(25+20*boolFloat(compressorActive)), "celsius")
+		d.setValue("heating.compressors.0.sensors.pressure.inlet", round1(8+4*modulation), "bar")
+		d.setValue("heating.sensors.volumetricFlow.allengra", math.Round(flow), "liter/hour")
+		d.setValue("heating.primaryCircuit.sensors.temperature.supply", round1(outside), "celsius")
+		d.setValue("heating.secondaryCircuit.sensors.temperature.supply", round1(m.supply+0.4), "celsius")
+
+		position := "heating"
+		if m.dhwCharge {
+			position = "domesticHotWater"
+		}
+		d.setValue("heating.valves.fourThreeWay.position", position, "")
+
+		scop := 0.0
+		if totalElec.years[0] > 0 {
+			scop = (m.heatHeating.years[0] + m.heatDHW.years[0]) / totalElec.years[0]
+		}
+		d.setValue("heating.scop.total", round1(scop), "")
+	}
+
+	if m.burner {
+		burnerActive := m.running && m.useBurner
+		burnerModulation := 0.0
+		if burnerActive {
+			burnerModulation = math.Round(10 + 90*modulation)
+		}
+		d.setProp("heating.burners.0", "active", burnerActive, "")
+		d.setValue("heating.burners.0.modulation", burnerModulation, "percent")
+		d.setProp("heating.burners.0.statistics", "hours", math.Round(m.burnerHours), "hour")
+		d.setProp("heating.burners.0.statistics", "starts", m.burnerStarts, "")
+		d.setValue("heating.boiler.sensors.temperature.commonSupply", round1(m.supply+2*boolFloat(burnerActive)), "celsius")
+		d.setValue("heating.boiler.temperature", round1(target), "celsius")
+		d.setStatus("heating.boiler.pumps.internal", map[bool]string{true: "on", false: "off"}[burnerActive])
+		d.setCounterFeature("heating.gas.consumption.heating", &m.gasHeating)
+		d.setCounterFeature("heating.gas.consumption.dhw", &m.gasDHW)
+		d.setSummaryFeature("heating.gas.consumption.summary.heating", &m.gasHeating)
+		d.setSummaryFeature("heating.gas.consumption.summary.dhw", &m.gasDHW)
+
+		if m.heatPump {
+			d.setValue("heating.secondaryHeatGenerator.status", map[bool]string{true: "on", false: "off"}[burnerActive], "")
+		}
+	}
+}
+
+// addCounters adds the buckets of b to a and returns a
+func addCounters(a, b *simEnergyCounter) *simEnergyCounter {
+	for i := range a.days {
+		a.days[i] += b.days[i]
+	}
+	for i := range a.weeks {
+		a.weeks[i] += b.weeks[i]
+	}
+	for i := range a.months {
+		a.months[i] += b.months[i]
+	}
+	for i := range a.years {
+		a.years[i] += b.years[i]
+	}
+	a.total += b.total
+	return a
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// simWeather returns the outside temperature and solar factor at time t
+// without a simulator instance (used to seed history)
+func simWeather(t time.Time) (float64, float64) {
+	var s *Simulator
+	env := s.environment(t)
+	return env.outsideTemp, env.solarFactor
+}
+
+// --- Ventilation (Vitovent) ---
+
+var simVentilationLevels = map[string]float64{
+	"levelOne":   75,
+	"levelTwo":   120,
+	"levelThree": 180,
+	"levelFour":  240,
+}
+
+// setupVentilationControls adds the ventilation features with their commands
+func setupVentilationControls(d *simDevice) {
+	d.setProp("device.name", "name", "Vitovent 300-F", "")
+	d.setProp("ventilation", "active", true, "")
+
+	modes := []string{"permanent", "ventilation", "sensorOverride", "sensorDriven"}
+	d.setValue("ventilation.operating.modes.active", "ventilation", "")
+	d.addCommand("ventilation.operating.modes.active", "setMode",
+		map[string]interface{}{"mode": simEnumParam(modes...)},
+		func(d *simDevice, body map[string]interface{}) error {
+			mode, err := bodyEnum(body, "mode", modes...)
+			if err != nil {
+				return err
+			}
+			d.setValue("ventilation.operating.modes.active", mode, "")
+			return nil
+		})
+
+	for level, volume := range simVentilationLevels {
+		d.setProp("ventilation.levels."+level, "volumeFlow", volume, "cubicMeter/hour")
+	}
+
+	for quickmode, runtime := range map[string]float64{"forcedLevelFour": 30, "silent": 60, "temporaryShutdown": 120} {
+		feature := "ventilation.quickmodes." + quickmode
+		d.setProp(feature, "active", false, "")
+		d.setProp(feature, "defaultRuntime", runtime, "minutes")
+		d.addCommand(feature, "activate", nil, func(d *simDevice, body map[string]interface{}) error {
+			d.setProp(feature, "active", true, "")
+			d.feature(feature).timestamp = time.Now()
+			return nil
+		})
+		d.addCommand(feature, "deactivate", nil, func(d *simDevice, body map[string]interface{}) error {
+			d.setProp(feature, "active", false, "")
+			return nil
+		})
+	}
+
+	d.setValue("ventilation.bypass.configuration.temperature.perceived", 22.0, "celsius")
+}
+
+// simVentilationModel simulates fans, heat recovery and filter wear
+type simVentilationModel struct {
+	initialized    bool
+	extractTemp    float64
+	extractHumid   float64
+	filterHours    float64
+	supplyFanHours float64
+}
+
+func (m *simVentilationModel) tick(d *simDevice, env *simEnvironment, dt time.Duration) {
+	if !m.initialized {
+		m.initialized = true
+		m.extractTemp = 21.5
+		m.extractHumid = 50
+		m.filterHours = 2150
+		m.supplyFanHours = 15830
+	}
+	h := dt.Hours()
+	local := env.now.In(DefaultLocation)
+
+	// Expire quick modes after their default runtime
+	activeQuick := ""
+	for _, qm := range []string{"forcedLevelFour", "silent", "temporaryShutdown"} {
+		feature := "ventilation.quickmodes." + qm
+		if !d.flag(feature, "active") {
+			continue
+		}
+		runtime := time.Duration(d.num(feature, "defaultRuntime")) * time.Minute
+		if started := d.feature(feature).timestamp; !started.IsZero() && env.now.Sub(started) > runtime {
+			d.setProp(feature, "active", false, "")
+			continue
+		}
+		activeQuick = qm
+	}
+
+	// Level by mode and schedule
+	level := "levelTwo"
+	mode := d.str("ventilation.operating.modes.active", "value")
+	switch {
+	case mode == "permanent":
+		level = "levelThree"
+	case mode == "sensorDriven" || mode == "sensorOverride":
+		if m.extractHumid > 60 {
+			level = "levelThree"
+		}
+	case local.Hour() >= 23 || local.Hour() < 6:
+		level = "levelOne"
+	}
+	switch activeQuick {
+	case "forcedLevelFour":
+		level = "levelFour"
+	case "silent":
+		level = "levelOne"
+	}
+
+	volume := simVentilationLevels[level]
+	if activeQuick == "temporaryShutdown" {
+		volume = 0
+	}
+
+	// Humidity rises with occupancy and falls with air exchange
+	if env.sim != nil && h > 0 {
+		m.extractHumid += (env.sim.rng.Float64()-0.45)*4*h - (volume/240)*2*h
+		if (local.Hour() >= 6 && local.Hour() < 8) && env.sim.rng.Float64() < 0.5*h {
+			m.extractHumid += 8 // showers
+		}
+	}
+	m.extractHumid = clampFloat(m.extractHumid, 30, 80)
+
+	outside := env.outsideTemp
+	efficiency := 0.85
+	bypassPosition := 0.0
+	if outside > 15 && m.extractTemp > d.num("ventilation.bypass.configuration.temperature.perceived", "value") {
+		efficiency = 0.1
+		bypassPosition = 100
+	}
+	supplyTemp := outside + efficiency*(m.extractTemp-outside)
+	exhaustTemp := m.extractTemp - efficiency*(m.extractTemp-outside)
+
+	if h > 0 && volume > 0 {
+		m.filterHours += h
+		m.supplyFanHours += h
+	}
+
+	rpm := 0.0
+	if volume > 0 {
+		rpm = 700 + volume*9
+	}
+	status := "connected"
+	if volume == 0 {
+		status = "off"
+	}
+
+	d.setValue("ventilation.operating.programs.active", level, "")
+	d.setProp("ventilation.operating.state", "demand", mode, "")
+	d.setProp("ventilation.operating.state", "level", level, "")
+	d.setProp("ventilation.operating.state", "reason", map[bool]string{true: "quickmode", false: "schedule"}[activeQuick != ""], "")
+	d.setValue("ventilation.sensors.temperature.supply", round1(supplyTemp), "celsius")
+	d.setValue("ventilation.sensors.temperature.extract", round1(m.extractTemp), "celsius")
+	d.setValue("ventilation.sensors.temperature.exhaust", round1(exhaustTemp), "celsius")
+	d.setValue("ventilation.sensors.temperature.outside", round1(outside), "celsius")
+	d.setValue("ventilation.sensors.humidity.extract", math.Round(m.extractHumid), "percent")
+	d.setValue("ventilation.sensors.humidity.supply", math.Round(m.extractHumid*0.8), "percent")
+	d.setValue("ventilation.sensors.humidity.outdoor", 75.0, "percent")
+	d.setValue("ventilation.sensors.humidity.exhaust", math.Round(m.extractHumid*0.9), "percent")
+	d.setValue("ventilation.volumeFlow.current.input", volume, "cubicMeter/hour")
+	d.setValue("ventilation.volumeFlow.current.output", volume, "cubicMeter/hour")
+	for _, fan := range []string{"supply", "exhaust"} {
+		d.setProp("ventilation.fan."+fan, "current", math.Round(rpm), "revolutionsPerMinute")
+		d.setProp("ventilation.fan."+fan, "target", math.Round(rpm), "revolutionsPerMinute")
+		d.setProp("ventilation.fan."+fan, "status", status, "")
+		d.setValue("ventilation.fan."+fan+".runtime", math.Round(m.supplyFanHours), "hour")
+	}
+	d.setValue("ventilation.filter.runtime", math.Round(m.filterHours), "hour")
+	d.setValue("ventilation.filter.pollution.blocked", m.filterHours > 4380, "")
+	d.setValue("ventilation.heating.recovery", math.Round(efficiency*100), "percent")
+	d.setValue("ventilation.bypass.position", bypassPosition, "percent")
+	d.setProp("ventilation.heatExchanger.frostprotection", "status", map[bool]string{true: "on", false: "off"}[outside < -3], "")
+}
+
+// --- Energy storage (Vitocharge) ---
+
+// simEnergyStorageModel simulates PV production, house load and a battery
+type simEnergyStorageModel struct {
+	peakPower       float64 // W
+	batteryCapacity float64 // kWh
+
+	initialized bool
+	soc         float64 // percent
+	cloudiness  float64
+
+	pvCumulated, gridConsumption, gridFeedIn, charged, discharged float64
+}
+
+func (m *simEnergyStorageModel) tick(d *simDevice, env *simEnvironment, dt time.Duration) {
+	if !m.initialized {
+		m.initialized = true
+		m.soc = 55
+		m.cloudiness = 0.3
+		m.pvCumulated = 18240
+		m.gridConsumption = 6120
+		m.gridFeedIn = 9350
+		m.charged = 2980
+		m.discharged = 2710
+	}
+	h := dt.Hours()
+	local := env.now.In(DefaultLocation)
+
+	if env.sim != nil && h > 0 {
+		m.cloudiness = clampFloat(m.cloudiness+(env.sim.rng.Float64()-0.5)*0.6*math.Sqrt(h), 0, 0.9)
+	}
+
+	pv := m.peakPower * env.solarFactor * (1 - m.cloudiness)
+
+	// Base load with cooking and evening peaks
+	load := 350.0
+	switch hour := local.Hour(); {
+	case hour >= 11 && hour < 13:
+		load += 1200
+	case hour >= 17 && hour < 22:
+		load += 700
+	}
+	if env.sim != nil && env.sim.rng.Float64() < 0.1 {
+		load += env.sim.rng.Float64() * 2000
+	}
+
+	// Battery covers surplus/deficit within its limits (4.6 kW, 5-100% SOC)
+	surplus := pv - load
+	battery := clampFloat(surplus, -4600, 4600)
+	if battery > 0 && m.soc >= 100 {
+		battery = 0
+	}
+	if battery < 0 && m.soc <= 5 {
+		battery = 0
+	}
+	grid := load - pv + battery // positive = import
+
+	if h > 0 {
+		m.soc = clampFloat(m.soc+battery/1000*h/m.batteryCapacity*100, 0, 100)
+		m.pvCumulated += pv / 1000 * h
+		if battery > 0 {
+			m.charged += battery / 1000 * h
+		} else {
+			m.discharged += -battery / 1000 * h
+		}
+		if grid > 0 {
+			m.gridConsumption += grid / 1000 * h
+		} else {
+			m.gridFeedIn += -grid / 1000 * h
+		}
+	}
+
+	d.setValue("photovoltaic.production.current", round1(pv/1000), "kilowatt")
+	d.setValue("photovoltaic.production.cumulated", math.Round(m.pvCumulated), "kilowattHour")
+	d.setValue("ess.stateOfCharge", math.Round(m.soc), "percent")
+	d.setValue("ess.power", math.Round(battery), "watt")
+	d.setValue("ess.inverter.ac.power", math.Round(pv-battery), "watt")
+	d.setValue("ess.transfer.charge.cumulated", math.Round(m.charged), "kilowattHour")
+	d.setValue("ess.transfer.discharge.cumulated", math.Round(m.discharged), "kilowattHour")
+	d.setValue("ess.battery.usedAverage", round1(m.discharged/365), "kilowattHour")
+	d.setValue("ess.sensors.temperature.ambient", round1(18+2*env.solarFactor), "celsius")
+	d.setValue("pcc.transfer.power.exchange", math.Round(grid), "watt")
+	d.setValue("pcc.transfer.consumption.total", math.Round(m.gridConsumption), "kilowattHour")
+	d.setValue("pcc.transfer.feedIn.total", math.Round(m.gridFeedIn), "kilowattHour")
+}
+
+// --- Zigbee room control, TRVs and climate sensor ---
+
+type simRoomState struct {
+	temp     float64
+	humidity float64
+	trv      *simDevice
+}
+
+// simRoomControlModel simulates room temperatures driven by the TRV valves
+type simRoomControlModel struct {
+	rooms []*simRoomState
+}
+
+func (m *simRoomControlModel) tick(d *simDevice, env *simEnvironment, dt time.Duration) {
+	h := dt.Hours()
+	for i, room := range m.rooms {
+		prefix := fmt.Sprintf("rooms.%d", i)
+		valve := room.trv.num("trv.valve.position", "position") / 100
+
+		if h > 0 {
+			gain := valve * 2.0                          // K/h at fully open valve
+			loss := 0.05 * (room.temp - env.outsideTemp) // K/h
+			room.temp += (gain - loss) * h
+			if env.sim != nil {
+				room.humidity = clampFloat(room.humidity+(env.sim.rng.Float64()-0.5)*3*h, 35, 70)
+			}
+		}
+
+		d.setStatus(prefix+".sensors.temperature", "connected")
+		d.setValue(prefix+".sensors.temperature", round1(room.temp), "celsius")
+		d.setStatus(prefix+".sensors.humidity", "connected")
+		d.setValue(prefix+".sensors.humidity", math.Round(room.humidity), "percent")
+		d.setValue(prefix+".condensationRisk", false, "")
+		d.setValue(prefix+".sensors.window.openState", false, "")
+
+		// The TRV follows the room setpoint of the room control
+		setpoint := d.num(prefix+".temperature.levels.normal.perceived", "temperature")
+		room.trv.model.(*simTRVModel).roomTemp = room.temp
+		if setpoint > 0 && room.trv.num("trv.temperature", "value") != setpoint && !room.trv.model.(*simTRVModel).manual {
+			room.trv.setValue("trv.temperature", setpoint, "celsius")
+		}
+	}
+}
+
+// setupTRVControls adds the radiator thermostat features with their commands
+func setupTRVControls(d *simDevice, name string, setpoint float64) {
+	d.setProp("device.name", "name", name, "")
+	d.setValue("trv.temperature", setpoint, "celsius")
+	d.addCommand("trv.temperature", "setTargetTemperature",
+		map[string]interface{}{"temperature": simNumberParam(8, 30, 0.5)},
+		func(d *simDevice, body map[string]interface{}) error {
+			v, err := bodyNumber(body, "temperature", 8, 30)
+			if err != nil {
+				return err
+			}
+			d.setValue("trv.temperature", v, "celsius")
+			d.model.(*simTRVModel).manual = true
+			return nil
+		})
+
+	d.setProp("trv.childLock", "status", "off", "")
+	d.addCommand("trv.childLock", "activate", nil, func(d *simDevice, body map[string]interface{}) error {
+		d.setProp("trv.childLock", "status", "on", "")
+		return nil
+	})
+	d.addCommand("trv.childLock", "deactivate", nil, func(d *simDevice, body map[string]interface{}) error {
+		d.setProp("trv.childLock", "status", "off", "")
+		return nil
+	})
+	d.setProp("trv.valve.position", "position", 0.0, "percent")
+}
+
+// simTRVModel is a proportional valve controller with slowly draining battery
+type simTRVModel struct {
+	room        int
+	roomControl *simDevice
+	roomTemp    float64
+	manual      bool // setpoint was overridden on the device
+	battery     float64
+}
+
+func (m *simTRVModel) tick(d *simDevice, env *simEnvironment, dt time.Duration) {
+	if m.battery == 0 {
+		m.battery = 87 - float64(m.room)*11
+	}
+	m.battery = math.Max(5, m.battery-dt.Hours()*0.002)
+
+	position := 0.0
+	if m.roomTemp > 0 {
+		position = clampFloat((d.num("trv.temperature", "value")-m.roomTemp)*50, 0, 100)
+	}
+	d.setProp("trv.valve.position", "position", math.Round(position), "percent")
+	d.setProp("device.power.battery", "level", math.Round(m.battery), "percent")
+	d.setProp("device.zigbee.lqi", "strength", 62.0+float64(m.room)*7, "percent")
+	d.feature("device.zigbee.lqi").timestamp = env.now
+}
+
+// simClimateSensorModel reports the living room climate
+type simClimateSensorModel struct {
+	roomControl *simRoomControlModel
+}
+
+func (m *simClimateSensorModel) tick(d *simDevice, env *simEnvironment, dt time.Duration) {
+	if len(m.roomControl.rooms) == 0 {
+		return
+	}
+	room := m.roomControl.rooms[0]
+	d.setValue("device.sensors.temperature", round1(room.temp), "celsius")
+	d.setValue("device.sensors.humidity", math.Round(room.humidity), "percent")
+	d.setProp("device.power.battery", "level", 91.0, "percent")
+	d.setProp("device.zigbee.lqi", "strength", 80.0, "percent")
+	d.feature("device.zigbee.lqi").timestamp = env.now
+}
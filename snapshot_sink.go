@@ -0,0 +1,853 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// Secondary sink that forwards every logged temperature snapshot to InfluxDB v2
+// (line protocol) or a Prometheus remote-write endpoint. Snapshots that cannot be
+// delivered are kept in an on-disk buffer and retried in order.
+
+const (
+	SinkTypeInfluxDB    = "influxdb"
+	SinkTypeRemoteWrite = "remote_write"
+
+	sinkBufferFile         = "snapshot_sink_buffer.jsonl"
+	sinkDefaultName        = "vieventlog"
+	sinkDefaultMaxBuffered = 100000
+	sinkBatchSize          = 500
+	sinkRetryInterval      = time.Minute
+	sinkQueueSize          = 100
+	sinkHTTPTimeout        = 30 * time.Second
+)
+
+// SnapshotSinkSettings configures the secondary snapshot sink
+type SnapshotSinkSettings struct {
+	Enabled bool   `json:"enabled"`
+	Type    string `json:"type"` // influxdb or remote_write
+	URL     string `json:"url"`  // InfluxDB base URL or full remote-write URL
+
+	// InfluxDB v2
+	Org    string `json:"org,omitempty"`
+	Bucket string `json:"bucket,omitempty"`
+	Token  string `json:"token,omitempty"` // InfluxDB API token or remote-write bearer token
+
+	// Remote write basic auth
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// Measurement (InfluxDB) or metric name prefix (remote write), default "vieventlog"
+	Name string `json:"name,omitempty"`
+
+	MaxBuffered int `json:"maxBuffered"` // snapshots kept on disk while the sink is down
+}
+
+// SnapshotSinkStatus is returned by /api/snapshot-sink/status
+type SnapshotSinkStatus struct {
+	Enabled   bool   `json:"enabled"`
+	Type      string `json:"type,omitempty"`
+	Sent      int64  `json:"sent"`
+	Buffered  int    `json:"buffered"`
+	LastSent  string `json:"lastSent,omitempty"`
+	LastError string `json:"lastError,omitempty"`
+
+	Backfill *SinkBackfillStatus `json:"backfill,omitempty"`
+}
+
+// SinkBackfillStatus reports the progress of a backfill run
+type SinkBackfillStatus struct {
+	Running  bool   `json:"running"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Current  string `json:"current,omitempty"` // day being sent
+	Sent     int64  `json:"sent"`
+	Started  string `json:"started"`
+	Finished string `json:"finished,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type snapshotSink struct {
+	mu        sync.Mutex
+	settings  *SnapshotSinkSettings
+	queue     chan *TemperatureSnapshot
+	stop      chan struct{}
+	done      chan struct{}
+	sent      int64
+	buffered  int
+	lastSent  time.Time
+	lastError string
+	backfill  *SinkBackfillStatus
+	lastFlush time.Time // only used by the worker
+
+	bufferMu sync.Mutex // guards the buffer file
+	trimmed  int64      // lines dropped from the front of the buffer file, guarded by bufferMu
+}
+
+var sink = &snapshotSink{}
+
+// StartSnapshotSink starts the sink worker if a sink is configured
+func StartSnapshotSink() error {
+	settings, err := GetSnapshotSinkSettings()
+	if err != nil {
+		return err
+	}
+	if !settings.Enabled {
+		log.Println("Snapshot sink is disabled")
+		return nil
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if sink.stop != nil {
+		return nil
+	}
+
+	sink.settings = settings
+	sink.queue = make(chan *TemperatureSnapshot, sinkQueueSize)
+	sink.stop = make(chan struct{})
+	sink.done = make(chan struct{})
+	sink.lastError = ""
+	sink.buffered = countBufferedSnapshots()
+
+	go sink.run(settings, sink.queue, sink.stop, sink.done)
+	log.Printf("Snapshot sink started (%s: %s, %d buffered)", settings.Type, settings.URL, sink.buffered)
+	return nil
+}
+
+// StopSnapshotSink stops the worker, queued snapshots are written to the buffer
+func StopSnapshotSink() {
+	sink.mu.Lock()
+	stop, done := sink.stop, sink.done
+	sink.stop = nil
+	sink.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+	log.Println("Snapshot sink stopped")
+}
+
+// RestartSnapshotSink applies new settings
+func RestartSnapshotSink() error {
+	StopSnapshotSink()
+	return StartSnapshotSink()
+}
+
+// ExportSnapshot hands a freshly logged snapshot to the sink without blocking on the
+// sink. When the queue is full, the queue and the snapshot are spilled to the buffer.
+func ExportSnapshot(snapshot *TemperatureSnapshot) {
+	sink.mu.Lock()
+	queue := sink.queue
+	running := sink.stop != nil
+	sink.mu.Unlock()
+
+	if !running || snapshot == nil {
+		return
+	}
+
+	select {
+	case queue <- snapshot:
+		return
+	default:
+	}
+
+	// The worker is stuck on a slow sink for longer than the queue lasts. The queued
+	// snapshots go first so the buffer stays in order.
+	var pending []TemperatureSnapshot
+drain:
+	for {
+		select {
+		case queued := <-queue:
+			pending = append(pending, *queued)
+		default:
+			break drain
+		}
+	}
+	pending = append(pending, *snapshot)
+	if err := sink.appendBuffer(pending); err != nil {
+		log.Printf("Snapshot sink: failed to buffer %d snapshots: %v", len(pending), err)
+	}
+}
+
+func (s *snapshotSink) run(settings *SnapshotSinkSettings, queue chan *TemperatureSnapshot, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(sinkRetryInterval)
+	defer ticker.Stop()
+
+	// Deliver whatever is left from the last run
+	s.flushBuffer(settings)
+
+	for {
+		select {
+		case snapshot := <-queue:
+			s.deliver(settings, *snapshot)
+		case <-ticker.C:
+			s.flushBuffer(settings)
+		case <-stop:
+			// Drain the queue into the buffer so nothing is lost on shutdown
+			var pending []TemperatureSnapshot
+		drain:
+			for {
+				select {
+				case snapshot := <-queue:
+					pending = append(pending, *snapshot)
+				default:
+					break drain
+				}
+			}
+			if len(pending) > 0 {
+				if err := s.appendBuffer(pending); err != nil {
+					log.Printf("Snapshot sink: failed to buffer %d snapshots: %v", len(pending), err)
+				}
+			}
+			return
+		}
+	}
+}
+
+// deliver sends one snapshot, or buffers it if older snapshots are still waiting
+func (s *snapshotSink) deliver(settings *SnapshotSinkSettings, snapshot TemperatureSnapshot) {
+	s.mu.Lock()
+	buffered := s.buffered
+	s.mu.Unlock()
+
+	if buffered == 0 {
+		if err := s.send(settings, []TemperatureSnapshot{snapshot}); err == nil {
+			return
+		}
+	}
+
+	if err := s.appendBuffer([]TemperatureSnapshot{snapshot}); err != nil {
+		log.Printf("Snapshot sink: failed to buffer snapshot: %v", err)
+		return
+	}
+	// The ticker retries as well, don't hammer a sink that is down
+	if buffered > 0 && time.Since(s.lastFlush) >= sinkRetryInterval {
+		s.flushBuffer(settings)
+	}
+}
+
+// send writes a batch to the sink and records the outcome
+func (s *snapshotSink) send(settings *SnapshotSinkSettings, snapshots []TemperatureSnapshot) error {
+	err := writeSnapshotsToSink(settings, snapshots)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.lastError = err.Error()
+		return err
+	}
+	s.sent += int64(len(snapshots))
+	s.lastSent = time.Now()
+	s.lastError = ""
+	return nil
+}
+
+func sinkBufferPath() string {
+	return filepath.Join(getDefaultConfigDir(), sinkBufferFile)
+}
+
+// countBufferedSnapshots counts the lines in the buffer file
+func countBufferedSnapshots() int {
+	f, err := os.Open(sinkBufferPath())
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		count++
+	}
+	return count
+}
+
+// appendBuffer adds snapshots to the on-disk buffer, dropping the oldest beyond the limit
+func (s *snapshotSink) appendBuffer(snapshots []TemperatureSnapshot) error {
+	s.bufferMu.Lock()
+	defer s.bufferMu.Unlock()
+
+	f, err := os.OpenFile(sinkBufferPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for i := range snapshots {
+		line, err := json.Marshal(&snapshots[i])
+		if err != nil {
+			continue
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.buffered += len(snapshots)
+	buffered := s.buffered
+	maxBuffered := sinkDefaultMaxBuffered
+	if s.settings != nil && s.settings.MaxBuffered > 0 {
+		maxBuffered = s.settings.MaxBuffered
+	}
+	s.mu.Unlock()
+
+	if buffered > maxBuffered {
+		lines, err := readBufferLines()
+		if err != nil {
+			return err
+		}
+		dropped := len(lines) - maxBuffered
+		if dropped > 0 {
+			log.Printf("Snapshot sink: buffer full, dropping %d oldest snapshots", dropped)
+			s.trimmed += int64(dropped)
+			return s.rewriteBuffer(lines[dropped:])
+		}
+	}
+	return nil
+}
+
+func readBufferLines() ([][]byte, error) {
+	data, err := os.ReadFile(sinkBufferPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var lines [][]byte
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// rewriteBuffer replaces the buffer file atomically; bufferMu must be held
+func (s *snapshotSink) rewriteBuffer(lines [][]byte) error {
+	path := sinkBufferPath()
+	if len(lines) == 0 {
+		s.mu.Lock()
+		s.buffered = 0
+		s.mu.Unlock()
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	tmp := path + ".tmp"
+	data := append(bytes.Join(lines, []byte("\n")), '\n')
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.buffered = len(lines)
+	s.mu.Unlock()
+	return nil
+}
+
+// flushBuffer sends buffered snapshots in order until the sink fails. The buffer
+// lock is not held during the HTTP requests.
+func (s *snapshotSink) flushBuffer(settings *SnapshotSinkSettings) {
+	s.lastFlush = time.Now()
+
+	s.bufferMu.Lock()
+	lines, err := readBufferLines()
+	trimmed := s.trimmed
+	s.bufferMu.Unlock()
+	if err != nil {
+		log.Printf("Snapshot sink: failed to read buffer: %v", err)
+		return
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	sent := 0
+	for sent < len(lines) {
+		end := sent + sinkBatchSize
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		batch := make([]TemperatureSnapshot, 0, end-sent)
+		for _, line := range lines[sent:end] {
+			var snapshot TemperatureSnapshot
+			if err := json.Unmarshal(line, &snapshot); err == nil {
+				batch = append(batch, snapshot)
+			}
+		}
+		// A snapshot in flight while the queue was spilled ends up behind newer ones
+		sort.SliceStable(batch, func(i, j int) bool { return batch[i].Timestamp.Before(batch[j].Timestamp) })
+		if err := s.send(settings, batch); err != nil {
+			break
+		}
+		sent = end
+	}
+
+	if sent == 0 {
+		return
+	}
+	log.Printf("Snapshot sink: delivered %d buffered snapshots, %d remaining", sent, len(lines)-sent)
+
+	s.bufferMu.Lock()
+	defer s.bufferMu.Unlock()
+
+	// New lines are only appended, but a full buffer may have dropped some of the
+	// delivered lines from the front in the meantime
+	current, err := readBufferLines()
+	if err != nil {
+		log.Printf("Snapshot sink: failed to read buffer: %v", err)
+		return
+	}
+	remove := sent - int(s.trimmed-trimmed)
+	if remove <= 0 {
+		return
+	}
+	if remove > len(current) {
+		remove = len(current)
+	}
+	if err := s.rewriteBuffer(current[remove:]); err != nil {
+		log.Printf("Snapshot sink: failed to update buffer: %v", err)
+	}
+}
+
+// writeSnapshotsToSink encodes and posts a batch in the configured format
+func writeSnapshotsToSink(settings *SnapshotSinkSettings, snapshots []TemperatureSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	var req *http.Request
+	var err error
+
+	switch settings.Type {
+	case SinkTypeInfluxDB:
+		var body bytes.Buffer
+		for i := range snapshots {
+			writeInfluxLine(&body, settings.Name, &snapshots[i])
+		}
+		if body.Len() == 0 {
+			return nil
+		}
+
+		query := url.Values{}
+		query.Set("org", settings.Org)
+		query.Set("bucket", settings.Bucket)
+		query.Set("precision", "s")
+		req, err = http.NewRequest(http.MethodPost, strings.TrimRight(settings.URL, "/")+"/api/v2/write?"+query.Encode(), &body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if settings.Token != "" {
+			req.Header.Set("Authorization", "Token "+settings.Token)
+		}
+
+	case SinkTypeRemoteWrite:
+		writeRequest := encodeRemoteWrite(settings.Name, snapshots)
+		if len(writeRequest) == 0 {
+			return nil
+		}
+		body := snappy.Encode(nil, writeRequest)
+		req, err = http.NewRequest(http.MethodPost, settings.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+		if settings.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+settings.Token)
+		} else if settings.Username != "" {
+			req.SetBasicAuth(settings.Username, settings.Password)
+		}
+
+	default:
+		return fmt.Errorf("unknown sink type %q", settings.Type)
+	}
+
+	resp, err := sinkHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+var sinkHTTPClient = &http.Client{Timeout: sinkHTTPTimeout}
+
+// snapshotField is one populated TemperatureSnapshot field
+type snapshotField struct {
+	name  string
+	value interface{} // float64, bool or string
+}
+
+// snapshotFields returns the populated measurement fields of a snapshot
+func snapshotFields(snapshot *TemperatureSnapshot) []snapshotField {
+	var fields []snapshotField
+	v := reflect.ValueOf(snapshot).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		value := v.Field(i)
+		if value.Kind() != reflect.Ptr || value.IsNil() {
+			continue
+		}
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		switch elem := value.Elem(); elem.Kind() {
+		case reflect.Float64:
+			if !math.IsNaN(elem.Float()) && !math.IsInf(elem.Float(), 0) {
+				fields = append(fields, snapshotField{name, elem.Float()})
+			}
+		case reflect.Bool:
+			fields = append(fields, snapshotField{name, elem.Bool()})
+		case reflect.String:
+			fields = append(fields, snapshotField{name, elem.String()})
+		}
+	}
+	return fields
+}
+
+var (
+	influxKeyEscaper    = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+	influxStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// writeInfluxLine writes one snapshot in InfluxDB line protocol
+func writeInfluxLine(buf *bytes.Buffer, measurement string, snapshot *TemperatureSnapshot) {
+	fields := snapshotFields(snapshot)
+	if len(fields) == 0 {
+		return
+	}
+
+	buf.WriteString(influxKeyEscaper.Replace(measurement))
+	for _, tag := range [][2]string{
+		{"installation_id", snapshot.InstallationID},
+		{"gateway_id", snapshot.GatewayID},
+		{"device_id", snapshot.DeviceID},
+		{"account_id", snapshot.AccountID},
+	} {
+		if tag[1] != "" {
+			fmt.Fprintf(buf, ",%s=%s", tag[0], influxKeyEscaper.Replace(tag[1]))
+		}
+	}
+
+	for i, field := range fields {
+		if i == 0 {
+			buf.WriteByte(' ')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(influxKeyEscaper.Replace(field.name))
+		buf.WriteByte('=')
+		switch value := field.value.(type) {
+		case float64:
+			buf.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+		case bool:
+			buf.WriteString(strconv.FormatBool(value))
+		case string:
+			buf.WriteString(`"` + influxStringEscaper.Replace(value) + `"`)
+		}
+	}
+	fmt.Fprintf(buf, " %d\n", snapshot.Timestamp.Unix())
+}
+
+// encodeRemoteWrite builds a Prometheus remote-write WriteRequest protobuf.
+// Numeric fields become <name>_<field>, booleans 0/1; string fields are skipped.
+func encodeRemoteWrite(prefix string, snapshots []TemperatureSnapshot) []byte {
+	var req []byte
+	for i := range snapshots {
+		s := &snapshots[i]
+		labels := [][2]string{
+			{"device_id", s.DeviceID},
+			{"gateway_id", s.GatewayID},
+			{"installation_id", s.InstallationID},
+		}
+		timestamp := s.Timestamp.UnixMilli()
+
+		for _, field := range snapshotFields(s) {
+			var value float64
+			switch v := field.value.(type) {
+			case float64:
+				value = v
+			case bool:
+				if v {
+					value = 1
+				}
+			default:
+				continue
+			}
+
+			// Labels must be sorted by name, __name__ comes first
+			var series []byte
+			series = protoBytes(series, 1, encodeRemoteWriteLabel("__name__", prefix+"_"+field.name))
+			for _, label := range labels {
+				if label[1] != "" {
+					series = protoBytes(series, 1, encodeRemoteWriteLabel(label[0], label[1]))
+				}
+			}
+
+			var sample []byte
+			sample = binary.AppendUvarint(sample, 1<<3|1) // value, fixed64
+			sample = binary.LittleEndian.AppendUint64(sample, math.Float64bits(value))
+			sample = binary.AppendUvarint(sample, 2<<3|0) // timestamp, varint
+			sample = binary.AppendUvarint(sample, uint64(timestamp))
+			series = protoBytes(series, 2, sample)
+
+			req = protoBytes(req, 1, series)
+		}
+	}
+	return req
+}
+
+func encodeRemoteWriteLabel(name, value string) []byte {
+	var label []byte
+	label = protoBytes(label, 1, []byte(name))
+	label = protoBytes(label, 2, []byte(value))
+	return label
+}
+
+// protoBytes appends a length-delimited protobuf field
+func protoBytes(buf []byte, field int, data []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field)<<3|2)
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+// BackfillSnapshotSink streams historical snapshots between from and to (inclusive days)
+// to the sink, one day at a time. progress is called after every day.
+func BackfillSnapshotSink(settings *SnapshotSinkSettings, from, to time.Time, progress func(day time.Time, sent int64)) (int64, error) {
+	installationIDs, err := getSnapshotInstallationIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	var sent int64
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		end := day.AddDate(0, 0, 1).Add(-time.Second)
+		for _, installationID := range installationIDs {
+			snapshots, err := GetTemperatureSnapshots(installationID, "", "", day, end, 0)
+			if err != nil {
+				return sent, err
+			}
+			for start := 0; start < len(snapshots); start += sinkBatchSize {
+				stop := start + sinkBatchSize
+				if stop > len(snapshots) {
+					stop = len(snapshots)
+				}
+				if err := writeSnapshotsToSink(settings, snapshots[start:stop]); err != nil {
+					return sent, fmt.Errorf("failed at %s: %v", day.Format("2006-01-02"), err)
+				}
+				sent += int64(stop - start)
+			}
+		}
+		if progress != nil {
+			progress(day, sent)
+		}
+	}
+	return sent, nil
+}
+
+// getSnapshotInstallationIDs returns all installations with logged snapshots
+func getSnapshotInstallationIDs() ([]string, error) {
+	if !dbInitialized || eventDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	rows, err := eventDB.Query("SELECT DISTINCT installation_id FROM temperature_snapshots")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, rows.Err()
+}
+
+// getSnapshotTimeRange returns the first and last snapshot day (local midnight)
+func getSnapshotTimeRange() (time.Time, time.Time, error) {
+	if !dbInitialized || eventDB == nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("database not initialized")
+	}
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	var first, last sql.NullString
+	if err := eventDB.QueryRow("SELECT MIN(timestamp), MAX(timestamp) FROM temperature_snapshots").Scan(&first, &last); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if !first.Valid || !last.Valid {
+		return time.Time{}, time.Time{}, fmt.Errorf("no temperature snapshots in the database")
+	}
+	from, err := time.Parse(time.RFC3339, first.String)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := time.Parse(time.RFC3339, last.String)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return startOfDay(from), startOfDay(to), nil
+}
+
+// startOfDay returns local midnight of the given time
+func startOfDay(t time.Time) time.Time {
+	t = t.In(DefaultLocation)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, DefaultLocation)
+}
+
+// startBackfill runs a backfill in the background, reporting progress in the status
+func (s *snapshotSink) startBackfill(settings *SnapshotSinkSettings, from, to time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.backfill != nil && s.backfill.Running {
+		return fmt.Errorf("a backfill is already running")
+	}
+
+	status := &SinkBackfillStatus{
+		Running: true,
+		From:    from.Format("2006-01-02"),
+		To:      to.Format("2006-01-02"),
+		Started: time.Now().Format(time.RFC3339),
+	}
+	s.backfill = status
+
+	go func() {
+		sent, err := BackfillSnapshotSink(settings, from, to, func(day time.Time, sent int64) {
+			s.mu.Lock()
+			status.Current = day.Format("2006-01-02")
+			status.Sent = sent
+			s.mu.Unlock()
+		})
+
+		s.mu.Lock()
+		status.Running = false
+		status.Sent = sent
+		status.Finished = time.Now().Format(time.RFC3339)
+		if err != nil {
+			status.Error = err.Error()
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			log.Printf("Snapshot sink backfill failed after %d snapshots: %v", sent, err)
+		} else {
+			log.Printf("Snapshot sink backfill completed: %d snapshots", sent)
+		}
+	}()
+	return nil
+}
+
+// GetSnapshotSinkStatus returns delivery counters and the backfill progress
+func GetSnapshotSinkStatus() SnapshotSinkStatus {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	status := SnapshotSinkStatus{
+		Enabled:   sink.stop != nil,
+		Sent:      sink.sent,
+		Buffered:  sink.buffered,
+		LastError: sink.lastError,
+	}
+	if sink.settings != nil {
+		status.Type = sink.settings.Type
+	}
+	if !sink.lastSent.IsZero() {
+		status.LastSent = sink.lastSent.Format(time.RFC3339)
+	}
+	if sink.backfill != nil {
+		backfill := *sink.backfill
+		status.Backfill = &backfill
+	}
+	return status
+}
+
+// validateSnapshotSinkSettings checks the settings and fills in defaults
+func validateSnapshotSinkSettings(settings *SnapshotSinkSettings) error {
+	if settings.Name == "" {
+		settings.Name = sinkDefaultName
+	}
+	if settings.MaxBuffered <= 0 {
+		settings.MaxBuffered = sinkDefaultMaxBuffered
+	}
+	if !settings.Enabled {
+		return nil
+	}
+
+	u, err := url.Parse(settings.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an http(s) URL")
+	}
+
+	switch settings.Type {
+	case SinkTypeInfluxDB:
+		if settings.Org == "" || settings.Bucket == "" {
+			return fmt.Errorf("org and bucket are required for InfluxDB")
+		}
+	case SinkTypeRemoteWrite:
+		for _, r := range settings.Name {
+			if !(r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+				return fmt.Errorf("name must be a valid Prometheus metric name prefix")
+			}
+		}
+	default:
+		return fmt.Errorf("type must be %q or %q", SinkTypeInfluxDB, SinkTypeRemoteWrite)
+	}
+	return nil
+}
@@ -0,0 +1,885 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tariff types
+const (
+	TariffFixed     = "fixed"       // one price per kWh
+	TariffTimeOfUse = "time_of_use" // prices per time window (HT/NT)
+	TariffDynamic   = "dynamic"     // hourly prices imported from a file or fetched from a URL
+)
+
+// Units of imported dynamic prices
+const (
+	PriceUnitEURPerKWh = "eur_kwh"
+	PriceUnitCtPerKWh  = "ct_kwh"
+	PriceUnitEURPerMWh = "eur_mwh"
+)
+
+// Periods of cost breakdowns
+const (
+	CostPeriodHour  = "hour"
+	CostPeriodDay   = "day"
+	CostPeriodMonth = "month"
+)
+
+const (
+	defaultElectricityPrice     = 0.30 // EUR/kWh, same default as the device settings
+	defaultPriceRefreshInterval = 60   // minutes
+	costHourlyMaxRange          = 31 * 24 * time.Hour
+)
+
+// TariffSettings holds all electricity tariffs. A device is billed with the tariff of its
+// installation (or a tariff without installation) whose validFrom is the latest before the hour.
+type TariffSettings struct {
+	Tariffs []Tariff `json:"tariffs"`
+}
+
+// Tariff is an electricity price model valid from a given day
+type Tariff struct {
+	Name           string         `json:"name"`                     // unique, dynamic prices are stored under this name
+	InstallationID string         `json:"installationId,omitempty"` // empty = all installations
+	ValidFrom      string         `json:"validFrom,omitempty"`      // YYYY-MM-DD (local), empty = always
+	Type           string         `json:"type"`                     // fixed, time_of_use or dynamic
+	Price          float64        `json:"price"`                    // EUR/kWh: fixed price, time-of-use default, dynamic fallback
+	Periods        []TariffPeriod `json:"periods,omitempty"`        // time-of-use windows, the first match wins
+	Surcharge      float64        `json:"surcharge,omitempty"`      // EUR/kWh added to dynamic prices (grid fees, taxes)
+	MonthlyBaseFee float64        `json:"monthlyBaseFee,omitempty"` // EUR per month, pro-rated by time
+	SourceURL      string         `json:"sourceUrl,omitempty"`      // dynamic: endpoint returning CSV or JSON prices
+	SourceUnit     string         `json:"sourceUnit,omitempty"`     // unit of imported prices (default eur_kwh)
+	RefreshMinutes int            `json:"refreshMinutes,omitempty"` // dynamic: fetch interval (default 60)
+}
+
+// TariffPeriod is a time-of-use window, e.g. NT from 22:00 to 06:00 on weekdays.
+// Windows are matched against the start of each hour; an end before the start wraps over midnight.
+type TariffPeriod struct {
+	Name  string  `json:"name"`           // e.g. HT or NT
+	Days  string  `json:"days,omitempty"` // all (default), weekday or weekend
+	Start string  `json:"start"`          // HH:MM
+	End   string  `json:"end"`            // HH:MM, equal to start = whole day
+	Price float64 `json:"price"`          // EUR/kWh
+}
+
+// parseClockMinutes parses HH:MM into minutes after midnight
+func parseClockMinutes(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (use HH:MM)", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// priceUnitFactor returns the factor converting a price unit to EUR/kWh
+func priceUnitFactor(unit string) (float64, bool) {
+	switch strings.NewReplacer(" ", "", "_", "/", "€", "eur").Replace(strings.ToLower(unit)) {
+	case "", "eur/kwh":
+		return 1, true
+	case "ct/kwh", "cent/kwh":
+		return 0.01, true
+	case "eur/mwh":
+		return 0.001, true
+	}
+	return 0, false
+}
+
+// validateTariffSettings checks names, types, dates, windows and units
+func validateTariffSettings(settings *TariffSettings) error {
+	names := make(map[string]bool)
+	for i := range settings.Tariffs {
+		t := &settings.Tariffs[i]
+		t.Name = strings.TrimSpace(t.Name)
+		if t.Name == "" {
+			return fmt.Errorf("tariff %d: name is required", i+1)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("duplicate tariff name %q", t.Name)
+		}
+		names[t.Name] = true
+
+		if t.ValidFrom != "" {
+			if _, err := time.ParseInLocation("2006-01-02", t.ValidFrom, DefaultLocation); err != nil {
+				return fmt.Errorf("tariff %s: invalid validFrom %q (use YYYY-MM-DD)", t.Name, t.ValidFrom)
+			}
+		}
+		if t.Price < 0 || t.Surcharge < 0 || t.MonthlyBaseFee < 0 {
+			return fmt.Errorf("tariff %s: prices and fees must not be negative", t.Name)
+		}
+
+		switch t.Type {
+		case TariffFixed:
+			if t.Price <= 0 {
+				return fmt.Errorf("tariff %s: price is required", t.Name)
+			}
+		case TariffTimeOfUse:
+			if len(t.Periods) == 0 {
+				return fmt.Errorf("tariff %s: at least one period is required", t.Name)
+			}
+			for _, p := range t.Periods {
+				if _, err := parseClockMinutes(p.Start); err != nil {
+					return fmt.Errorf("tariff %s, period %s: %v", t.Name, p.Name, err)
+				}
+				if _, err := parseClockMinutes(p.End); err != nil {
+					return fmt.Errorf("tariff %s, period %s: %v", t.Name, p.Name, err)
+				}
+				switch p.Days {
+				case "", "all", "weekday", "weekend":
+				default:
+					return fmt.Errorf("tariff %s, period %s: invalid days %q (use all, weekday or weekend)", t.Name, p.Name, p.Days)
+				}
+				if p.Price < 0 {
+					return fmt.Errorf("tariff %s, period %s: price must not be negative", t.Name, p.Name)
+				}
+			}
+		case TariffDynamic:
+			if _, ok := priceUnitFactor(t.SourceUnit); !ok {
+				return fmt.Errorf("tariff %s: invalid sourceUnit %q (use eur_kwh, ct_kwh or eur_mwh)", t.Name, t.SourceUnit)
+			}
+			if t.SourceURL != "" && !strings.HasPrefix(t.SourceURL, "http://") && !strings.HasPrefix(t.SourceURL, "https://") {
+				return fmt.Errorf("tariff %s: sourceUrl must start with http:// or https://", t.Name)
+			}
+			if t.RefreshMinutes < 0 {
+				return fmt.Errorf("tariff %s: refreshMinutes must not be negative", t.Name)
+			}
+		default:
+			return fmt.Errorf("tariff %s: invalid type %q (use fixed, time_of_use or dynamic)", t.Name, t.Type)
+		}
+	}
+	return nil
+}
+
+// activeTariff is a tariff with its parsed start, sorted by start
+type activeTariff struct {
+	Tariff
+	from time.Time
+}
+
+// tariffsForInstallation returns the tariffs of an installation sorted by validFrom.
+// Installation-specific tariffs replace the general ones.
+func tariffsForInstallation(settings *TariffSettings, installationID string) []activeTariff {
+	var specific, general []activeTariff
+	for _, t := range settings.Tariffs {
+		at := activeTariff{Tariff: t}
+		if t.ValidFrom != "" {
+			at.from, _ = time.ParseInLocation("2006-01-02", t.ValidFrom, DefaultLocation)
+		}
+		switch t.InstallationID {
+		case installationID:
+			specific = append(specific, at)
+		case "":
+			general = append(general, at)
+		}
+	}
+	tariffs := general
+	if len(specific) > 0 {
+		tariffs = specific
+	}
+	sort.SliceStable(tariffs, func(i, j int) bool { return tariffs[i].from.Before(tariffs[j].from) })
+	return tariffs
+}
+
+// tariffAt returns the tariff valid at t, or nil before the first tariff starts
+func tariffAt(tariffs []activeTariff, t time.Time) *activeTariff {
+	var found *activeTariff
+	for i := range tariffs {
+		if tariffs[i].from.After(t) {
+			break
+		}
+		found = &tariffs[i]
+	}
+	return found
+}
+
+// periodMatches reports whether a time-of-use window covers the local time t
+func periodMatches(p TariffPeriod, t time.Time) bool {
+	weekend := t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+	if (p.Days == "weekday" && weekend) || (p.Days == "weekend" && !weekend) {
+		return false
+	}
+	start, _ := parseClockMinutes(p.Start)
+	end, _ := parseClockMinutes(p.End)
+	minute := t.Hour()*60 + t.Minute()
+	switch {
+	case start == end:
+		return true
+	case start < end:
+		return minute >= start && minute < end
+	default:
+		return minute >= start || minute < end
+	}
+}
+
+// tariffPricer prices hours with the tariffs of one installation
+type tariffPricer struct {
+	tariffs      []activeTariff
+	fallback     float64                      // before the first tariff (or without any)
+	dynamic      map[string]map[int64]float64 // tariff -> hour start (Unix) -> EUR/kWh
+	missingHours int
+	tariffsUsed  map[string]bool
+}
+
+// price returns the price in EUR/kWh for the hour starting at t
+func (p *tariffPricer) price(t time.Time) float64 {
+	tariff := tariffAt(p.tariffs, t)
+	if tariff == nil {
+		return p.fallback
+	}
+	p.tariffsUsed[tariff.Name] = true
+
+	switch tariff.Type {
+	case TariffTimeOfUse:
+		local := t.In(DefaultLocation)
+		for _, period := range tariff.Periods {
+			if periodMatches(period, local) {
+				return period.Price
+			}
+		}
+	case TariffDynamic:
+		if price, ok := p.dynamic[tariff.Name][t.Truncate(time.Hour).Unix()]; ok {
+			return price + tariff.Surcharge
+		}
+		p.missingHours++
+	}
+	return tariff.Price
+}
+
+// baseFee returns the pro-rated monthly base fees for [from, to)
+func (p *tariffPricer) baseFee(from, to time.Time) float64 {
+	fee := 0.0
+	for day := startOfDay(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		tariff := tariffAt(p.tariffs, day)
+		if tariff == nil || tariff.MonthlyBaseFee == 0 {
+			continue
+		}
+		next := day.AddDate(0, 0, 1)
+		start, end := day, next
+		if from.After(start) {
+			start = from
+		}
+		if to.Before(end) {
+			end = to
+		}
+		month := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, DefaultLocation)
+		daysInMonth := month.AddDate(0, 1, -1).Day()
+		fee += tariff.MonthlyBaseFee / float64(daysInMonth) * end.Sub(start).Hours() / next.Sub(day).Hours()
+	}
+	return fee
+}
+
+// deviceElectricityPrice returns the flat price from the device settings of any active account
+func deviceElectricityPrice(installationID, deviceID string) float64 {
+	accounts, err := GetActiveAccounts()
+	if err != nil {
+		return defaultElectricityPrice
+	}
+	deviceKey := fmt.Sprintf("%s_%s", installationID, deviceID)
+	for _, account := range accounts {
+		if settings, ok := account.DeviceSettings[deviceKey]; ok && settings.ElectricityPrice > 0 {
+			return settings.ElectricityPrice
+		}
+	}
+	return defaultElectricityPrice
+}
+
+// ElectricityPrice is one hourly price of a dynamic tariff
+type ElectricityPrice struct {
+	HourStart time.Time `json:"hourStart"`
+	Price     float64   `json:"price"` // EUR/kWh without surcharge
+	Source    string    `json:"source"`
+}
+
+// SaveElectricityPrices stores hourly prices, replacing existing values of the same hours
+func SaveElectricityPrices(tariff string, prices []ElectricityPrice) error {
+	if !dbInitialized || eventDB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	tx, err := eventDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO electricity_prices (tariff, hour_start, price, source, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (tariff, hour_start) DO UPDATE SET
+			price = excluded.price, source = excluded.source, updated_at = excluded.updated_at
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %v", err)
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, p := range prices {
+		if _, err := stmt.Exec(tariff, p.HourStart.UTC().Format(time.RFC3339), p.Price, p.Source, now); err != nil {
+			return fmt.Errorf("failed to save price: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetElectricityPrices returns the stored hourly prices of a tariff in [from, to)
+func GetElectricityPrices(tariff string, from, to time.Time) ([]ElectricityPrice, error) {
+	if !dbInitialized || eventDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	rows, err := eventDB.Query(`
+		SELECT hour_start, price, source
+		FROM electricity_prices
+		WHERE tariff = ? AND hour_start >= ? AND hour_start < ?
+		ORDER BY hour_start ASC
+	`, tariff, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query electricity prices: %v", err)
+	}
+	defer rows.Close()
+
+	var prices []ElectricityPrice
+	for rows.Next() {
+		var hourStr string
+		var p ElectricityPrice
+		if err := rows.Scan(&hourStr, &p.Price, &p.Source); err != nil {
+			log.Printf("Warning: failed to scan electricity price row: %v", err)
+			continue
+		}
+		if p.HourStart, err = time.Parse(time.RFC3339, hourStr); err != nil {
+			continue
+		}
+		p.HourStart = p.HourStart.In(DefaultLocation)
+		prices = append(prices, p)
+	}
+	return prices, rows.Err()
+}
+
+// priceTimeColumns and priceValueColumns are tried in order (normalized names) when reading prices
+var (
+	priceTimeColumns  = []string{"starttimestamp", "startsat", "start", "from", "timestamp", "time", "datetime", "date", "zeit", "datum", "von"}
+	priceValueColumns = []string{"total", "price", "marketprice", "value", "preis"}
+)
+
+// findPriceColumn returns the first record column matching one of the candidates, exactly
+// or followed by a unit like "Preis (ct/kWh)"
+func findPriceColumn(values map[string]string, candidates []string) string {
+	for _, prefix := range []bool{false, true} {
+		for _, candidate := range candidates {
+			for column := range values {
+				name := normalizeImportName(column)
+				if name == candidate || (prefix && strings.HasPrefix(name, candidate+"(")) {
+					return column
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// columnUnit returns the unit in parentheses of a column name, e.g. "Preis (ct/kWh)"
+func columnUnit(column string) string {
+	start, end := strings.Index(column, "("), strings.LastIndex(column, ")")
+	if start < 0 || end < start {
+		return ""
+	}
+	return column[start+1 : end]
+}
+
+// PriceImportReport summarizes an import of dynamic prices
+type PriceImportReport struct {
+	Tariff      string   `json:"tariff"`
+	Source      string   `json:"source"`
+	RowsRead    int      `json:"rowsRead"`
+	RowsSkipped int      `json:"rowsSkipped"`
+	Hours       int      `json:"hours"` // hourly prices stored (quarter-hour prices are averaged)
+	From        string   `json:"from,omitempty"`
+	To          string   `json:"to,omitempty"`
+	Errors      []string `json:"errors,omitempty"`
+}
+
+// ImportElectricityPrices reads prices from CSV or JSON and stores them as hourly averages.
+// Accepted are records with a start time and a price (e.g. aWATTar, Tibber price lists,
+// Home Assistant exports) and Energy-Charts responses (unix_seconds and price arrays).
+// A unit column or field (e.g. "Eur/MWh") overrides the given unit.
+func ImportElectricityPrices(r io.Reader, tariff, unit, source string, decimalComma bool) (*PriceImportReport, error) {
+	factor, ok := priceUnitFactor(unit)
+	if !ok {
+		return nil, fmt.Errorf("invalid unit %q (use eur_kwh, ct_kwh or eur_mwh)", unit)
+	}
+
+	report := &PriceImportReport{Tariff: tariff, Source: source}
+	parser := &importParser{
+		spec:     &ImportSpec{DecimalComma: decimalComma},
+		report:   &ImportReport{},
+		location: DefaultLocation,
+	}
+
+	type hourSum struct {
+		sum   float64
+		count int
+	}
+	hours := make(map[int64]*hourSum)
+	add := func(t time.Time, price, recordFactor float64) {
+		key := t.Truncate(time.Hour).Unix()
+		if hours[key] == nil {
+			hours[key] = &hourSum{}
+		}
+		hours[key].sum += price * recordFactor
+		hours[key].count++
+	}
+	skip := func(row int, format string, args ...interface{}) {
+		report.RowsSkipped++
+		if len(report.Errors) < importMaxReportErrors {
+			report.Errors = append(report.Errors, fmt.Sprintf("row %d: %s", row, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	err := parser.readRecords(r, func(rec importRecord) error {
+		recordFactor := factor
+		if u := rec.values[findPriceColumn(rec.values, []string{"unit", "einheit"})]; u != "" {
+			if f, ok := priceUnitFactor(u); ok {
+				recordFactor = f
+			}
+		}
+
+		// Energy-Charts: {"unix_seconds": [...], "price": [...], "unit": "EUR / MWh"}
+		if times, ok := rec.raw["unix_seconds"].([]interface{}); ok {
+			prices, _ := rec.raw["price"].([]interface{})
+			for i, ts := range times {
+				report.RowsRead++
+				seconds, okTime := ts.(float64)
+				var price float64
+				okPrice := i < len(prices)
+				if okPrice {
+					price, okPrice = prices[i].(float64)
+				}
+				if !okTime || !okPrice {
+					skip(i+1, "missing time or price")
+					continue
+				}
+				add(time.Unix(int64(seconds), 0), price, recordFactor)
+			}
+			return nil
+		}
+
+		report.RowsRead++
+		timeColumn := findPriceColumn(rec.values, priceTimeColumns)
+		priceColumn := findPriceColumn(rec.values, priceValueColumns)
+		if timeColumn == "" || priceColumn == "" {
+			skip(rec.row, "no time or price column")
+			return nil
+		}
+		t, err := parseImportTime(rec.values[timeColumn], "", DefaultLocation)
+		if err != nil {
+			skip(rec.row, "%v", err)
+			return nil
+		}
+		price, ok := parser.parseImportNumber(rec.values[priceColumn])
+		if !ok {
+			skip(rec.row, "invalid price %q", rec.values[priceColumn])
+			return nil
+		}
+		if f, ok := priceUnitFactor(columnUnit(priceColumn)); ok && columnUnit(priceColumn) != "" {
+			recordFactor = f
+		}
+		add(t, price, recordFactor)
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	prices := make([]ElectricityPrice, 0, len(hours))
+	for key, h := range hours {
+		prices = append(prices, ElectricityPrice{
+			HourStart: time.Unix(key, 0),
+			Price:     math.Round(h.sum/float64(h.count)*1e6) / 1e6,
+			Source:    source,
+		})
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].HourStart.Before(prices[j].HourStart) })
+	if len(prices) == 0 {
+		return report, fmt.Errorf("no prices found")
+	}
+
+	if err := SaveElectricityPrices(tariff, prices); err != nil {
+		return report, err
+	}
+	report.Hours = len(prices)
+	report.From = prices[0].HourStart.UTC().Format(time.RFC3339)
+	report.To = prices[len(prices)-1].HourStart.UTC().Format(time.RFC3339)
+	return report, nil
+}
+
+var priceHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// FetchElectricityPrices downloads and imports the prices of a dynamic tariff from its source URL
+func FetchElectricityPrices(tariff Tariff) (*PriceImportReport, error) {
+	if tariff.SourceURL == "" {
+		return nil, fmt.Errorf("tariff %s has no source URL", tariff.Name)
+	}
+
+	resp, err := priceHTTPClient.Get(tariff.SourceURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch prices: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch prices: HTTP %d", resp.StatusCode)
+	}
+
+	return ImportElectricityPrices(resp.Body, tariff.Name, tariff.SourceUnit, "url", false)
+}
+
+// priceRefresher fetches the prices of dynamic tariffs with a source URL
+var priceRefresher struct {
+	mu        sync.Mutex
+	stop      chan struct{} // nil while the refresher is not running
+	lastFetch map[string]time.Time
+	lastError map[string]string
+}
+
+// StartTariffPriceRefresher checks every minute which dynamic tariffs are due for a refresh
+func StartTariffPriceRefresher() error {
+	if !dbInitialized {
+		return fmt.Errorf("database not initialized")
+	}
+
+	priceRefresher.mu.Lock()
+	defer priceRefresher.mu.Unlock()
+	if priceRefresher.stop != nil {
+		return nil
+	}
+	stop := make(chan struct{})
+	priceRefresher.stop = stop
+	priceRefresher.lastFetch = make(map[string]time.Time)
+	priceRefresher.lastError = make(map[string]string)
+
+	go func() {
+		refreshDueTariffPrices()
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				refreshDueTariffPrices()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// StopTariffPriceRefresher stops the refresh loop
+func StopTariffPriceRefresher() {
+	priceRefresher.mu.Lock()
+	defer priceRefresher.mu.Unlock()
+
+	if priceRefresher.stop == nil {
+		return
+	}
+	close(priceRefresher.stop)
+	priceRefresher.stop = nil
+}
+
+// refreshDueTariffPrices fetches all dynamic tariffs whose refresh interval has passed
+func refreshDueTariffPrices() {
+	settings, err := GetTariffSettings()
+	if err != nil {
+		return
+	}
+
+	for _, tariff := range settings.Tariffs {
+		if tariff.Type != TariffDynamic || tariff.SourceURL == "" {
+			continue
+		}
+		interval := tariff.RefreshMinutes
+		if interval == 0 {
+			interval = defaultPriceRefreshInterval
+		}
+
+		priceRefresher.mu.Lock()
+		due := time.Since(priceRefresher.lastFetch[tariff.Name]) >= time.Duration(interval)*time.Minute
+		if due {
+			priceRefresher.lastFetch[tariff.Name] = time.Now()
+		}
+		priceRefresher.mu.Unlock()
+		if !due {
+			continue
+		}
+
+		report, err := FetchElectricityPrices(tariff)
+		priceRefresher.mu.Lock()
+		if err != nil {
+			if priceRefresher.lastError[tariff.Name] != err.Error() {
+				log.Printf("Tariff %s: %v", tariff.Name, err)
+			}
+			priceRefresher.lastError[tariff.Name] = err.Error()
+		} else {
+			delete(priceRefresher.lastError, tariff.Name)
+			log.Printf("Tariff %s: fetched %d hourly prices up to %s", tariff.Name, report.Hours, report.To)
+		}
+		priceRefresher.mu.Unlock()
+	}
+}
+
+// tariffPriceStatus returns the last fetch time and error of a dynamic tariff
+func tariffPriceStatus(name string) (time.Time, string) {
+	priceRefresher.mu.Lock()
+	defer priceRefresher.mu.Unlock()
+	return priceRefresher.lastFetch[name], priceRefresher.lastError[name]
+}
+
+// CostBucket is the electricity cost of one hour, day or month
+type CostBucket struct {
+	Start          time.Time `json:"start"`
+	ElectricityKWh float64   `json:"electricity_kwh"`
+	EnergyCost     float64   `json:"energy_cost"` // EUR
+	BaseFee        float64   `json:"base_fee"`    // EUR, pro-rated monthly base fees
+	TotalCost      float64   `json:"total_cost"`  // EUR
+	AvgPrice       float64   `json:"avg_price"`   // EUR/kWh, weighted by consumption
+}
+
+// CostReport is the electricity cost of a device for a time range
+type CostReport struct {
+	Period            string       `json:"period"` // breakdown period: hour, day or month
+	StartTime         time.Time    `json:"start_time"`
+	EndTime           time.Time    `json:"end_time"`
+	Resolution        string       `json:"resolution"` // energy source: raw, hour or day rollups
+	ElectricityKWh    float64      `json:"electricity_kwh"`
+	EnergyCost        float64      `json:"energy_cost"`
+	BaseFee           float64      `json:"base_fee"`
+	TotalCost         float64      `json:"total_cost"`
+	AvgPrice          float64      `json:"avg_price"`
+	FlatPrice         float64      `json:"flat_price"` // electricity price from the device settings
+	FlatCost          float64      `json:"flat_cost"`  // consumption x flat price, for comparison
+	Tariffs           []string     `json:"tariffs"`
+	MissingPriceHours int          `json:"missing_price_hours,omitempty"` // dynamic hours billed with the tariff's fallback price
+	Breakdown         []CostBucket `json:"breakdown"`
+}
+
+// costEnergy returns the compressor energy of [startTime, endTime) per UTC hour from the raw
+// snapshots or hourly rollups, or per local day where only daily rollups are kept
+func costEnergy(installationID, gatewayID, deviceID string, startTime, endTime time.Time) ([]ConsumptionDataPoint, string, error) {
+	settings, err := GetTemperatureLogSettings()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get temperature log settings: %v", err)
+	}
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	resolution := chooseTemperatureResolution(eventDB, settings, startTime, endTime, consumptionRawMaxRange, consumptionHourlyMaxRange)
+	if resolution != ResolutionRaw {
+		points, err := rollupConsumptionBreakdown(resolution, installationID, gatewayID, deviceID, startTime, endTime)
+		return points, resolution, err
+	}
+
+	rows, err := eventDB.Query(`
+		SELECT
+			STRFTIME('%Y-%m-%dT%H:00:00Z', timestamp) AS hour,
+			SUM(COALESCE(compressor_power, 0) * COALESCE(sample_interval, ?) / 60.0) AS electricity_wh,
+			COUNT(*) AS samples
+		FROM temperature_snapshots
+		WHERE installation_id = ?
+			AND gateway_id = ?
+			AND device_id = ?
+			AND timestamp >= ?
+			AND timestamp < ?
+		GROUP BY hour
+		ORDER BY hour ASC
+	`, settings.SampleInterval, installationID, gatewayID, deviceID,
+		startTime.UTC().Format(time.RFC3339), endTime.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query hourly consumption: %v", err)
+	}
+	defer rows.Close()
+
+	var points []ConsumptionDataPoint
+	for rows.Next() {
+		var hourStr string
+		var electricityWh float64
+		var samples int
+		if err := rows.Scan(&hourStr, &electricityWh, &samples); err != nil {
+			log.Printf("Warning: failed to scan hourly consumption row: %v", err)
+			continue
+		}
+		hour, err := time.Parse(time.RFC3339, hourStr)
+		if err != nil {
+			continue
+		}
+		points = append(points, ConsumptionDataPoint{
+			Timestamp:      hour.In(DefaultLocation),
+			ElectricityKWh: electricityWh / 1000.0,
+			Samples:        samples,
+		})
+	}
+	return points, resolution, rows.Err()
+}
+
+// costBucketStart returns the start of the breakdown bucket containing t
+func costBucketStart(period string, t time.Time) time.Time {
+	t = t.In(DefaultLocation)
+	switch period {
+	case CostPeriodHour:
+		return t.Truncate(time.Hour)
+	case CostPeriodMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, DefaultLocation)
+	default:
+		return startOfDay(t)
+	}
+}
+
+// nextCostBucket returns the start of the bucket after start
+func nextCostBucket(period string, start time.Time) time.Time {
+	switch period {
+	case CostPeriodHour:
+		return start.Add(time.Hour)
+	case CostPeriodMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// roundCost rounds EUR amounts (and the kWh next to them) to four decimals
+func roundCost(value float64) float64 {
+	return math.Round(value*10000) / 10000
+}
+
+// GetElectricityCosts prices the compressor energy of [startTime, endTime) hour by hour with
+// the tariffs of the installation and adds the base fees. Without a tariff the flat price of
+// the device settings is used. Days only kept as daily rollups are priced with the day's
+// average price.
+func GetElectricityCosts(installationID, gatewayID, deviceID, period string, startTime, endTime time.Time) (*CostReport, error) {
+	if !dbInitialized || eventDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	if period == CostPeriodHour && endTime.Sub(startTime) > costHourlyMaxRange {
+		return nil, fmt.Errorf("hourly breakdown is limited to %d days", int(costHourlyMaxRange.Hours()/24))
+	}
+
+	settings, err := GetTariffSettings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tariff settings: %v", err)
+	}
+
+	flatPrice := deviceElectricityPrice(installationID, deviceID)
+	pricer := &tariffPricer{
+		tariffs:     tariffsForInstallation(settings, installationID),
+		fallback:    flatPrice,
+		dynamic:     make(map[string]map[int64]float64),
+		tariffsUsed: make(map[string]bool),
+	}
+	for _, t := range pricer.tariffs {
+		if t.Type != TariffDynamic {
+			continue
+		}
+		prices, err := GetElectricityPrices(t.Name, startTime, endTime)
+		if err != nil {
+			return nil, err
+		}
+		pricer.dynamic[t.Name] = make(map[int64]float64, len(prices))
+		for _, p := range prices {
+			pricer.dynamic[t.Name][p.HourStart.Unix()] = p.Price
+		}
+	}
+
+	points, resolution, err := costEnergy(installationID, gatewayID, deviceID, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CostReport{
+		Period:     period,
+		StartTime:  startTime,
+		EndTime:    endTime,
+		Resolution: resolution,
+		FlatPrice:  flatPrice,
+		Tariffs:    []string{},
+		Breakdown:  []CostBucket{},
+	}
+
+	// Buckets cover the whole range, base fees accrue without consumption
+	buckets := make(map[int64]*CostBucket)
+	for start := costBucketStart(period, startTime); start.Before(endTime); start = nextCostBucket(period, start) {
+		from, to := start, nextCostBucket(period, start)
+		if from.Before(startTime) {
+			from = startTime
+		}
+		if to.After(endTime) {
+			to = endTime
+		}
+		report.Breakdown = append(report.Breakdown, CostBucket{Start: start, BaseFee: pricer.baseFee(from, to)})
+	}
+	for i := range report.Breakdown {
+		buckets[report.Breakdown[i].Start.Unix()] = &report.Breakdown[i]
+	}
+
+	for _, point := range points {
+		cost := 0.0
+		if resolution == ResolutionDay {
+			// Daily rollup: average price of the day's hours
+			day, next := point.Timestamp, point.Timestamp.AddDate(0, 0, 1)
+			sum, n := 0.0, 0
+			for hour := day; hour.Before(next); hour = hour.Add(time.Hour) {
+				sum += pricer.price(hour)
+				n++
+			}
+			cost = point.ElectricityKWh * sum / float64(n)
+		} else {
+			cost = point.ElectricityKWh * pricer.price(point.Timestamp)
+		}
+
+		bucket := buckets[costBucketStart(period, point.Timestamp).Unix()]
+		if bucket == nil {
+			continue
+		}
+		bucket.ElectricityKWh += point.ElectricityKWh
+		bucket.EnergyCost += cost
+	}
+
+	for i := range report.Breakdown {
+		b := &report.Breakdown[i]
+		report.ElectricityKWh += b.ElectricityKWh
+		b.ElectricityKWh = roundCost(b.ElectricityKWh)
+		report.EnergyCost += b.EnergyCost
+		report.BaseFee += b.BaseFee
+		if b.ElectricityKWh > 0 {
+			b.AvgPrice = roundCost(b.EnergyCost / b.ElectricityKWh)
+		}
+		b.TotalCost = roundCost(b.EnergyCost + b.BaseFee)
+		b.EnergyCost = roundCost(b.EnergyCost)
+		b.BaseFee = roundCost(b.BaseFee)
+	}
+	if report.ElectricityKWh > 0 {
+		report.AvgPrice = roundCost(report.EnergyCost / report.ElectricityKWh)
+	}
+	report.TotalCost = roundCost(report.EnergyCost + report.BaseFee)
+	report.EnergyCost = roundCost(report.EnergyCost)
+	report.BaseFee = roundCost(report.BaseFee)
+	report.FlatCost = roundCost(report.ElectricityKWh * flatPrice)
+	report.ElectricityKWh = roundCost(report.ElectricityKWh)
+	report.MissingPriceHours = pricer.missingHours
+	for name := range pricer.tariffsUsed {
+		report.Tariffs = append(report.Tariffs, name)
+	}
+	sort.Strings(report.Tariffs)
+	return report, nil
+}
@@ -173,6 +173,10 @@ func temperatureLoggingJob() {
 
 	log.Println("Running temperature logging job...")
 
+	if schedulerPausedByThrottle("temperature logging job") {
+		return
+	}
+
 	// Get settings
 	settings, err := GetTemperatureLogSettings()
 	if err != nil {
@@ -185,10 +189,15 @@ func temperatureLoggingJob() {
 		return
 	}
 
+	started := time.Now()
+	failed := false
+	defer func() { recordJobRun("temperature_log", started, failed) }()
+
 	// Get active accounts
 	activeAccounts, err := GetActiveAccounts()
 	if err != nil {
 		log.Printf("Error getting active accounts: %v", err)
+		failed = true
 		return
 	}
 
@@ -198,6 +207,19 @@ func temperatureLoggingJob() {
 	}
 
 	snapshotCount := 0
+	deviceCount := 0
+
+	// Generic feature logging rules (optional)
+	historySettings, err := GetFeatureHistorySettings()
+	if err != nil {
+		log.Printf("Error getting feature history settings: %v", err)
+	}
+
+	// Per-device logging of ventilation, storage and SmartClimate devices
+	deviceLogSettings, err := GetDeviceLoggingSettings()
+	if err != nil {
+		log.Printf("Error getting device logging settings: %v", err)
+	}
 
 	// Process each active account
 	for _, account := range activeAccounts {
@@ -207,6 +229,7 @@ func temperatureLoggingJob() {
 		token, err := ensureAccountAuthenticated(account)
 		if err != nil {
 			log.Printf("Failed to authenticate account %s: %v", account.Email, err)
+			failed = true
 			continue
 		}
 
@@ -230,8 +253,15 @@ func temperatureLoggingJob() {
 			// Process each gateway and device
 			for _, gateway := range installation.Gateways {
 				for _, device := range gateway.Devices {
-					// Only collect from device ID "0" to avoid duplicates
-					if device.DeviceID != "0" {
+					// Only collect snapshots from heating device ID "0" to avoid duplicates;
+					// other devices are fetched when their logging profile is due
+					// or for feature history rules naming them
+					timestamp := time.Now().UTC().Truncate(time.Minute)
+					class := deviceLogClass(device.DeviceID, device.DeviceType, device.ModelID)
+					snapshotDevice := device.DeviceID == "0" && class == DeviceClassHeating
+					historyPatterns := featureHistoryPatterns(historySettings, installationID, gateway.Serial, device.DeviceID)
+					profile := dueDeviceLogProfile(deviceLogSettings, settings.SampleInterval, installationID, gateway.Serial, device.DeviceID, class, timestamp)
+					if !snapshotDevice && len(historyPatterns) == 0 && profile == nil {
 						continue
 					}
 
@@ -245,9 +275,32 @@ func temperatureLoggingJob() {
 					features, err := fetchFeaturesForDeviceWithTracking(installationID, gateway.Serial, device.DeviceID, token.AccessToken)
 					if err != nil {
 						log.Printf("Error fetching features for device %s: %v", device.DeviceID, err)
+						failed = true
+						continue
+					}
+
+					// Log the generic feature history and the device profile of this device
+					points := extractFeatureHistory(features, historyPatterns, installationID, gateway.Serial, device.DeviceID, timestamp)
+					if profile != nil {
+						points = append(points, extractDeviceLogPoints(features, profile, installationID, gateway.Serial, device.DeviceID, timestamp)...)
+					}
+					if err := SaveFeatureHistory(points); err != nil {
+						log.Printf("Error saving feature history for device %s: %v", device.DeviceID, err)
+						failed = true
+					} else if profile != nil {
+						markDeviceLogged(installationID, gateway.Serial, device.DeviceID, timestamp)
+						deviceCount++
+					}
+					if !snapshotDevice {
 						continue
 					}
 
+					// Store the device's own energy counters for the seasonal performance factor
+					if err := SaveEnergyCounters(installationID, gateway.Serial, device.DeviceID, extractEnergyCounters(features, timestamp)); err != nil {
+						log.Printf("Error saving energy counters for device %s: %v", device.DeviceID, err)
+						failed = true
+					}
+
 					// Extract temperature snapshot from features
 					snapshot := extractTemperatureSnapshot(features, installationID, gateway.Serial, device.DeviceID, account)
 					if snapshot == nil {
@@ -262,6 +315,7 @@ func temperatureLoggingJob() {
 					err = SaveTemperatureSnapshot(snapshot)
 					if err != nil {
 						log.Printf("Error saving temperature snapshot: %v", err)
+						failed = true
 						continue
 					}
 
@@ -276,17 +330,48 @@ func temperatureLoggingJob() {
 	}
 
 cleanup:
+	// New or removed devices change the estimated API calls of the logging
+	checkDeviceLogBudget(settings, deviceLogSettings, historySettings)
+
+	// Roll up new snapshots first, so expiring ones are kept as hourly/daily values
+	err = UpdateTemperatureRollups()
+	if err != nil {
+		log.Printf("Error updating temperature rollups: %v", err)
+		failed = true
+	}
+
+	// Compressor runs need the snapshots too, and check the short-cycling alerts
+	err = UpdateCompressorRuns()
+	if err != nil {
+		log.Printf("Error detecting compressor runs: %v", err)
+		failed = true
+	}
+
 	// Cleanup old snapshots based on retention policy
 	err = CleanupOldTemperatureSnapshots(settings.RetentionDays)
 	if err != nil {
 		log.Printf("Error cleaning up old temperature snapshots: %v", err)
+		failed = true
+	}
+
+	err = CleanupOldTemperatureRollups(settings.HourlyRetentionDays, settings.DailyRetentionDays)
+	if err != nil {
+		log.Printf("Error cleaning up old temperature rollups: %v", err)
+		failed = true
+	}
+
+	// Feature history shares the raw snapshot retention
+	err = CleanupOldFeatureHistory(settings.RetentionDays)
+	if err != nil {
+		log.Printf("Error cleaning up old feature history: %v", err)
+		failed = true
 	}
 
 	// Log statistics
 	totalCount, _ := GetTemperatureSnapshotCount()
 	usage10min, usage24hr := getAPIUsage()
-	log.Printf("Temperature logging job completed. Snapshots saved: %d, Total: %d, API usage: %d/10min, %d/24hr",
-		snapshotCount, totalCount, usage10min, usage24hr)
+	log.Printf("Temperature logging job completed. Snapshots saved: %d, Devices logged: %d, Total: %d, API usage: %d/10min, %d/24hr",
+		snapshotCount, deviceCount, totalCount, usage10min, usage24hr)
 }
 
 // fetchFeaturesForDeviceWithTracking wraps fetchFeaturesWithCustomCache with API call tracking
@@ -312,7 +397,7 @@ func fetchFeaturesForDeviceWithTracking(installationID, gatewayID, deviceID, acc
 
 	// Use cached version with custom cache duration
 	// If cache is stale, fetchFeaturesWithCustomCache will make an API call and we track it
-	features, err := fetchFeaturesWithCustomCache(installationID, gatewayID, deviceID, accessToken, cacheDuration)
+	features, err := fetchFeaturesWithCustomCache(installationID, gatewayID, deviceID, accessToken, cacheDuration, PriorityTemperature)
 
 	// Only track API call if cache was stale (indicated by fresh LastUpdate)
 	// if err == nil && time.Since(features.LastUpdate) < 1*time.Second {
@@ -325,27 +410,12 @@ func fetchFeaturesForDeviceWithTracking(installationID, gatewayID, deviceID, acc
 	return features, err
 }
 
-// checkAPIRateLimit checks if we're within API rate limits
+// checkAPIRateLimit checks if the central limiter still admits temperature logging calls
+// Temperature logging has the lowest priority and backs off first when the budget runs low.
 func checkAPIRateLimit() bool {
-	apiCallsMutex.Lock()
-	defer apiCallsMutex.Unlock()
-
-	now := time.Now()
-	cutoff10Min := now.Add(-10 * time.Minute)
-	cutoff24Hr := now.Add(-24 * time.Hour)
-
-	// Clean up old entries
-	apiCalls10Min = filterCallsSince(apiCalls10Min, cutoff10Min)
-	apiCalls24Hr = filterCallsSince(apiCalls24Hr, cutoff24Hr)
-
-	// Check limits
-	if len(apiCalls10Min) >= apiLimit10Min {
-		log.Printf("WARNING: API rate limit reached (10-minute window): %d/%d", len(apiCalls10Min), apiLimit10Min)
-		return false
-	}
-
-	if len(apiCalls24Hr) >= apiLimit24Hr {
-		log.Printf("WARNING: API rate limit reached (24-hour window): %d/%d", len(apiCalls24Hr), apiLimit24Hr)
+	if !apiLimiter.Allow(PriorityTemperature) {
+		usage10min, usage24hr := getAPIUsage()
+		log.Printf("WARNING: API budget reserved for higher priorities (used %d/%d in 10min, %d/%d in 24hr)", usage10min, apiLimit10Min, usage24hr, apiLimit24Hr)
 		return false
 	}
 
@@ -596,9 +666,9 @@ func extractFeatureIntoSnapshot(feature Feature, snapshot *TemperatureSnapshot)
 
 	// Operating state
 
-//remove, will not be used because string content
-	//case "heating.valves.fourThreeWay.position": //heating.compressors.0.refrigerant.fourWayValve":
-	//	snapshot.FourWayValve = getStringValue(feature.Properties)
+	// 4/3-way valve position (heating, domesticHotWater, ...), gives the mode of compressor runs
+	case "heating.valves.fourThreeWay.position":
+		snapshot.FourWayValve = getStringValue(feature.Properties)
 	case "heating.burners.0.modulation":
 		snapshot.BurnerModulation = getFloatValue(feature.Properties)
 
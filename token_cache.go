@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// tokenCacheFile is the encrypted token cache in the config directory
+const tokenCacheFile = "tokens.enc"
+
+// tokenCacheAAD binds the ciphertext to this file format
+var tokenCacheAAD = []byte("vieventlog-token-cache-v1")
+
+// tokenCachePath returns the path of the encrypted token cache file
+func tokenCachePath() string {
+	return filepath.Join(getDefaultConfigDir(), tokenCacheFile)
+}
+
+// writeTokenCache encrypts the tokens with AES-256-GCM and writes them to the cache file
+func writeTokenCache(key []byte, tokens map[string]*AccountToken) error {
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tokens: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, data, tokenCacheAAD)
+
+	path := tokenCachePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated cache
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, sealed, 0600); err != nil {
+		return fmt.Errorf("failed to write token cache: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace token cache: %w", err)
+	}
+
+	return nil
+}
+
+// readTokenCache reads and decrypts the token cache file
+// Returns nil without error if no cache exists yet
+func readTokenCache(key []byte) (map[string]*AccountToken, error) {
+	sealed, err := os.ReadFile(tokenCachePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read token cache: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("token cache is corrupt")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	data, err := gcm.Open(nil, nonce, ciphertext, tokenCacheAAD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt token cache (key changed?): %w", err)
+	}
+
+	var tokens map[string]*AccountToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// newTokenCacheKey generates a random 256-bit key for the token cache
+func newTokenCacheKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate token cache key: %w", err)
+	}
+	return key, nil
+}
+
+// tokenPersistMutex serializes writes of the token cache, so concurrent refreshes neither
+// interleave on the temp file nor overwrite a newer snapshot with an older one
+var tokenPersistMutex sync.Mutex
+
+// persistAccountTokens writes a snapshot of all account tokens to the storage backend
+func persistAccountTokens() {
+	tokenPersistMutex.Lock()
+	defer tokenPersistMutex.Unlock()
+
+	accountsMutex.RLock()
+	snapshot := make(map[string]*AccountToken, len(accountTokens))
+	for id, token := range accountTokens {
+		snapshot[id] = token
+	}
+	accountsMutex.RUnlock()
+
+	if err := storage.SaveTokens(snapshot); err != nil {
+		log.Printf("Warning: Failed to persist account tokens: %v\n", err)
+	}
+}
+
+// restoreAccountTokens loads cached tokens from the storage backend on startup
+// Tokens of accounts that no longer exist or whose email changed are dropped;
+// expired access tokens are kept so they can be renewed via their refresh token.
+func restoreAccountTokens() {
+	tokens, err := storage.LoadTokens()
+	if err != nil {
+		log.Printf("Warning: Failed to load cached account tokens: %v\n", err)
+		return
+	}
+	if len(tokens) == 0 {
+		return
+	}
+
+	store, err := LoadAccounts()
+	if err != nil {
+		log.Printf("Warning: Failed to load accounts for token restore: %v\n", err)
+		return
+	}
+
+	restored := 0
+	accountsMutex.Lock()
+	for id, token := range tokens {
+		account, ok := store.Accounts[id]
+		if !ok || token == nil || token.Email != account.Email || len(token.InstallationIDs) == 0 {
+			continue
+		}
+		accountTokens[id] = token
+		restored++
+	}
+	accountsMutex.Unlock()
+
+	log.Printf("Restored cached tokens for %d account(s)\n", restored)
+}
@@ -6,11 +6,12 @@ import (
 
 // AccountToken holds authentication tokens for a specific account
 type AccountToken struct {
-	AccessToken     string
-	RefreshToken    string
-	TokenExpiry     time.Time
-	InstallationIDs []string
-	Installations   map[string]*Installation
+	Email           string                   `json:"email"` // Account email the token was issued for
+	AccessToken     string                   `json:"accessToken"`
+	RefreshToken    string                   `json:"refreshToken"`
+	TokenExpiry     time.Time                `json:"tokenExpiry"`
+	InstallationIDs []string                 `json:"installationIds"`
+	Installations   map[string]*Installation `json:"installations"`
 }
 
 type Installation struct {
@@ -86,11 +87,13 @@ type DevicesByInstallation struct {
 }
 
 type StatusResponse struct {
-	Connected    bool    `json:"connected"`
-	DeviceID     string  `json:"device_id,omitempty"`
-	LastFetch    *string `json:"last_fetch,omitempty"`
-	CachedEvents int     `json:"cached_events"`
-	Error        string  `json:"error,omitempty"`
+	Connected    bool              `json:"connected"`
+	DeviceID     string            `json:"device_id,omitempty"`
+	LastFetch    *string           `json:"last_fetch,omitempty"`
+	CachedEvents int               `json:"cached_events"`
+	Error        string            `json:"error,omitempty"`
+	RateLimit    *RateLimitStatus  `json:"rate_limit,omitempty"`
+	APIThrottle  APIThrottleStatus `json:"api_throttle"`
 }
 
 type LoginRequest struct {
@@ -355,24 +358,30 @@ type TemperatureSnapshot struct {
 
 // TemperatureLogSettings holds configuration for temperature logging
 type TemperatureLogSettings struct {
-	Enabled        bool   `json:"enabled"`
-	SampleInterval int    `json:"sample_interval"` // Minutes between samples
-	RetentionDays  int    `json:"retention_days"`  // How long to keep data
-	DatabasePath   string `json:"database_path"`   // SQLite database path
+	Enabled             bool   `json:"enabled"`
+	SampleInterval      int    `json:"sample_interval"`       // Minutes between samples
+	RetentionDays       int    `json:"retention_days"`        // How long to keep raw snapshots
+	HourlyRetentionDays int    `json:"hourly_retention_days"` // How long to keep hourly rollups (0 = forever)
+	DailyRetentionDays  int    `json:"daily_retention_days"`  // How long to keep daily rollups (0 = forever)
+	DatabasePath        string `json:"database_path"`         // SQLite database path
 }
 
 // TemperatureLogStatsResponse provides statistics about temperature logging
 type TemperatureLogStatsResponse struct {
-	Enabled          bool   `json:"enabled"`
-	SchedulerRunning bool   `json:"scheduler_running"`
-	TotalSnapshots   int64  `json:"total_snapshots"`
-	SampleInterval   int    `json:"sample_interval"`
-	RetentionDays    int    `json:"retention_days"`
-	DatabasePath     string `json:"database_path"`
-	APIUsage10Min    int    `json:"api_usage_10min"`
-	APIUsage24Hr     int    `json:"api_usage_24hr"`
-	APILimit10Min    int    `json:"api_limit_10min"`
-	APILimit24Hr     int    `json:"api_limit_24hr"`
+	Enabled             bool   `json:"enabled"`
+	SchedulerRunning    bool   `json:"scheduler_running"`
+	TotalSnapshots      int64  `json:"total_snapshots"`
+	HourlyRollups       int64  `json:"hourly_rollups"`
+	DailyRollups        int64  `json:"daily_rollups"`
+	SampleInterval      int    `json:"sample_interval"`
+	RetentionDays       int    `json:"retention_days"`
+	HourlyRetentionDays int    `json:"hourly_retention_days"`
+	DailyRetentionDays  int    `json:"daily_retention_days"`
+	DatabasePath        string `json:"database_path"`
+	APIUsage10Min       int    `json:"api_usage_10min"`
+	APIUsage24Hr        int    `json:"api_usage_24hr"`
+	APILimit10Min       int    `json:"api_limit_10min"`
+	APILimit24Hr        int    `json:"api_limit_24hr"`
 }
 
 // ConsumptionStats represents aggregated consumption statistics for a time period
@@ -385,6 +394,7 @@ type ConsumptionStats struct {
 	AvgCOP          float64                `json:"avg_cop"`         // Average coefficient of performance
 	RuntimeHours    float64                `json:"runtime_hours"`   // Hours compressor was active
 	Samples         int                    `json:"samples"`         // Number of snapshots
+	Resolution      string                 `json:"resolution"`      // Data source: "raw", "hour" or "day" rollups
 	HourlyBreakdown []ConsumptionDataPoint `json:"hourly_breakdown,omitempty"`
 	DailyBreakdown  []ConsumptionDataPoint `json:"daily_breakdown,omitempty"`
 }
@@ -401,7 +411,58 @@ type ConsumptionDataPoint struct {
 
 // ConsumptionComparisonResponse provides comparative consumption statistics
 type ConsumptionComparisonResponse struct {
+	Period        string           `json:"period"` // "week", "month" or "season"
 	Current       ConsumptionStats `json:"current"`
 	Previous      ConsumptionStats `json:"previous"`
-	PercentChange float64          `json:"percent_change"`
+	PercentChange float64          `json:"percent_change"` // electricity, current vs previous
+
+	// Weather normalization with heating degree days from the logged outside temperature
+	CurrentDegreeDays              *DegreeDaySummary `json:"current_degree_days"`
+	PreviousDegreeDays             *DegreeDaySummary `json:"previous_degree_days"`
+	CurrentKWhPerHDD               *float64          `json:"current_kwh_per_hdd,omitempty"`               // electricity
+	PreviousKWhPerHDD              *float64          `json:"previous_kwh_per_hdd,omitempty"`              // electricity
+	PreviousNormalizedKWh          *float64          `json:"previous_normalized_kwh,omitempty"`           // previous electricity at the current period's degree days
+	NormalizedPercentChange        *float64          `json:"normalized_percent_change,omitempty"`         // electricity per HDD
+	NormalizedThermalPercentChange *float64          `json:"normalized_thermal_percent_change,omitempty"` // heat per HDD
+	Warning                        string            `json:"warning,omitempty"`
+}
+
+// Incident is a fault episode from an error's activation to its clearing
+type Incident struct {
+	ID               int64  `json:"id"`
+	InstallationID   string `json:"installationId"`
+	GatewaySerial    string `json:"gatewaySerial"`
+	DeviceID         string `json:"deviceId"`
+	ModelID          string `json:"modelId"`
+	ErrorCode        string `json:"errorCode"`
+	ErrorDescription string `json:"errorDescription"`
+	CodeCategory     string `json:"codeCategory"`
+	Severity         string `json:"severity"`
+	StartTime        string `json:"startTime"`
+	EndTime          string `json:"endTime,omitempty"`
+	DurationSeconds  int64  `json:"durationSeconds"` // up to now for open incidents
+	Open             bool   `json:"open"`
+}
+
+// IncidentCodeStats summarizes all incidents of one error code
+type IncidentCodeStats struct {
+	ErrorCode            string  `json:"errorCode"`
+	ErrorDescription     string  `json:"errorDescription"`
+	Severity             string  `json:"severity"`
+	Occurrences          int     `json:"occurrences"`
+	OpenCount            int     `json:"openCount"`
+	Devices              int     `json:"devices"`
+	TotalDowntimeSeconds int64   `json:"totalDowntimeSeconds"`
+	MTTRSeconds          float64 `json:"mttrSeconds"`           // mean duration of cleared incidents
+	MTBFSeconds          float64 `json:"mtbfSeconds,omitempty"` // mean time from clearing to next activation on the same device
+	FirstOccurrence      string  `json:"firstOccurrence"`
+	LastOccurrence       string  `json:"lastOccurrence"`
+}
+
+// IncidentsResponse is returned by /api/incidents
+type IncidentsResponse struct {
+	Success    bool                `json:"success"`
+	Error      string              `json:"error,omitempty"`
+	Incidents  []Incident          `json:"incidents"`
+	Statistics []IncidentCodeStats `json:"statistics"`
 }
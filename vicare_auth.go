@@ -12,10 +12,11 @@ import (
 	"strings"
 )
 
-const (
-	authorizeURL = "https://iam.viessmann-climatesolutions.com/idp/v3/authorize"
-	tokenURL     = "https://iam.viessmann-climatesolutions.com/idp/v3/token"
-	redirectURI  = "vicare://oauth-callback/everest"
+const redirectURI = "vicare://oauth-callback/everest"
+
+var (
+	authorizeURL = iamBaseURL + "/idp/v3/authorize"
+	tokenURL     = iamBaseURL + "/idp/v3/token"
 )
 
 var viessmannScope = []string{"IoT User"}
@@ -136,6 +137,52 @@ func AuthenticateWithViCare(username, password, clientID string) (*TokenResponse
 	return &tokenResponse, nil
 }
 
+// RefreshAccessToken exchanges a refresh token for a new access token
+// The IdP may rotate the refresh token; if it does not, callers should keep the old one
+func RefreshAccessToken(refreshToken, clientID string) (*TokenResponse, error) {
+	if refreshToken == "" {
+		return nil, fmt.Errorf("no refresh token available")
+	}
+
+	tokenParams := url.Values{}
+	tokenParams.Add("grant_type", "refresh_token")
+	tokenParams.Add("client_id", clientID)
+	tokenParams.Add("refresh_token", refreshToken)
+
+	tokenReq, err := NewRequest("POST", tokenURL, strings.NewReader(tokenParams.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refresh request: %w", err)
+	}
+
+	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	tokenResp, err := http.DefaultClient.Do(tokenReq)
+	if err != nil {
+		return nil, fmt.Errorf("refresh request failed: %w", err)
+	}
+	defer tokenResp.Body.Close()
+
+	if tokenResp.StatusCode != 200 {
+		body, _ := io.ReadAll(tokenResp.Body)
+		return nil, fmt.Errorf("refresh request failed (status %d): %s", tokenResp.StatusCode, string(body))
+	}
+
+	var tokenResponse TokenResponse
+	if err := json.NewDecoder(tokenResp.Body).Decode(&tokenResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode refresh response: %w", err)
+	}
+
+	if tokenResponse.AccessToken == "" {
+		return nil, fmt.Errorf("refresh response contained no access token")
+	}
+
+	if tokenResponse.RefreshToken == "" {
+		tokenResponse.RefreshToken = refreshToken
+	}
+
+	return &tokenResponse, nil
+}
+
 // AuthenticateWithPasswordGrant performs OAuth2 Password Grant flow (like ViCare App)
 // This is the flow used by the official ViCare mobile app
 func AuthenticateWithPasswordGrant(username, password, clientID, clientSecret string) (*TokenResponse, error) {
@@ -20,6 +20,11 @@ var (
 
 // fetchEvents fetches events from all active accounts with cursor-based pagination
 func fetchEvents(daysBack int) ([]Event, error) {
+	return fetchEventsWithPriority(daysBack, PriorityDashboard)
+}
+
+// fetchEventsWithPriority fetches events, issuing API calls with the given rate limit priority
+func fetchEventsWithPriority(daysBack int, priority apiPriority) ([]Event, error) {
 	fetchMutex.Lock()
 	defer fetchMutex.Unlock()
 
@@ -37,7 +42,7 @@ func fetchEvents(daysBack int) ([]Event, error) {
 	if len(activeAccounts) == 0 {
 		// Fallback to legacy single credential
 		if currentCreds != nil {
-			return fetchEventsLegacy(daysBack)
+			return fetchEventsLegacy(daysBack, priority)
 		}
 		return nil, fmt.Errorf("no active accounts found")
 	}
@@ -57,7 +62,7 @@ func fetchEvents(daysBack int) ([]Event, error) {
 
 		// Fetch events from all installations for this account
 		for _, installationID := range token.InstallationIDs {
-			accountEvents, err := fetchEventsForInstallation(installationID, token.AccessToken, account, daysBack)
+			accountEvents, err := fetchEventsForInstallation(installationID, token.AccessToken, account, daysBack, priority)
 			if err != nil {
 				log.Printf("Error fetching events for installation %s: %v\n", installationID, err)
 				continue
@@ -78,13 +83,13 @@ func fetchEvents(daysBack int) ([]Event, error) {
 
 // fetchEventsForInstallation fetches events for a single installation with cursor pagination
 // Stops early if events already exist in SQLite database
-func fetchEventsForInstallation(installationID, accessToken string, account *Account, daysBack int) ([]Event, error) {
-	return fetchEventsForInstallationInternal(installationID, accessToken, account, daysBack, true)
+func fetchEventsForInstallation(installationID, accessToken string, account *Account, daysBack int, priority apiPriority) ([]Event, error) {
+	return fetchEventsForInstallationInternal(installationID, accessToken, account, daysBack, true, priority)
 }
 
 // fetchEventsForInstallationFullSync fetches ALL events without early-stop logic
 func fetchEventsForInstallationFullSync(installationID, accessToken string, account *Account, daysBack int) ([]Event, error) {
-	return fetchEventsForInstallationInternal(installationID, accessToken, account, daysBack, false)
+	return fetchEventsForInstallationInternal(installationID, accessToken, account, daysBack, false, PriorityArchive)
 }
 
 // setAPICallsCount can be used to set an Ui variable
@@ -95,17 +100,14 @@ func setAPICallsCount() {
 }
 
 // NewRequest wraps method http.NewRequest to track API calls
+// The request passes the central rate limiter with a priority derived from the URL when it
+// is sent; use NewPriorityRequest for background work.
 func NewRequest(method, url string, body io.Reader) (*http.Request, error) {
-	req, err := http.NewRequest(method, url, body)
-	if err == nil {
-		trackAPICall()
-		setAPICallsCount()
-	}
-	return req, err
+	return NewPriorityRequest(defaultAPIPriority(method, url), method, url, body)
 }
 
 // fetchEventsForInstallationInternal is the internal implementation with optional early-stop
-func fetchEventsForInstallationInternal(installationID, accessToken string, account *Account, daysBack int, enableEarlyStop bool) ([]Event, error) {
+func fetchEventsForInstallationInternal(installationID, accessToken string, account *Account, daysBack int, enableEarlyStop bool, priority apiPriority) ([]Event, error) {
 	var allEvents []Event
 	var cursor string
 	pageCount := 0
@@ -115,8 +117,8 @@ func fetchEventsForInstallationInternal(installationID, accessToken string, acco
 		pageCount++
 
 		// Build URL with cursor or lastNDays parameter
-		baseURL := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/events-history/installations/%s/events", installationID)
-		req, err := NewRequest("GET", baseURL, nil)
+		baseURL := apiBaseURL + fmt.Sprintf("/iot/v2/events-history/installations/%s/events", installationID)
+		req, err := NewPriorityRequest(priority, "GET", baseURL, nil)
 		if err != nil {
 			return allEvents, fmt.Errorf("failed to create request: %w", err)
 		}
@@ -134,14 +136,15 @@ func fetchEventsForInstallationInternal(installationID, accessToken string, acco
 
 		req.Header.Set("Authorization", "Bearer "+accessToken)
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := doAPIRequest(req)
 		if err != nil {
 			return allEvents, fmt.Errorf("request failed: %w", err)
 		}
 
 		if resp.StatusCode != http.StatusOK {
+			err := apiStatusError(resp)
 			resp.Body.Close()
-			return allEvents, fmt.Errorf("API returned status %d", resp.StatusCode)
+			return allEvents, err
 		}
 
 		var eventsResp EventsResponse
@@ -204,7 +207,7 @@ func fetchEventsForInstallationInternal(installationID, accessToken string, acco
 }
 
 // fetchEventsLegacy fetches events from legacy single credential (backward compatibility)
-func fetchEventsLegacy(daysBack int) ([]Event, error) {
+func fetchEventsLegacy(daysBack int, priority apiPriority) ([]Event, error) {
 	if err := ensureAuthenticated(); err != nil {
 		return eventsCache, err
 	}
@@ -218,7 +221,7 @@ func fetchEventsLegacy(daysBack int) ([]Event, error) {
 			Name: "Legacy Account",
 		}
 
-		accountEvents, err := fetchEventsForInstallation(installationID, accessToken, legacyAccount, daysBack)
+		accountEvents, err := fetchEventsForInstallation(installationID, accessToken, legacyAccount, daysBack, priority)
 		if err != nil {
 			log.Printf("Error fetching events for installation %s: %v\n", installationID, err)
 			continue
@@ -235,13 +238,18 @@ func fetchEventsLegacy(daysBack int) ([]Event, error) {
 
 // fetchFeaturesForDevice fetches features for a specific installation/gateway/device
 func fetchFeaturesForDevice(installationID, gatewayID, deviceID, accessToken string) (*DeviceFeatures, error) {
+	return fetchFeaturesForDeviceWithPriority(installationID, gatewayID, deviceID, accessToken, PriorityDashboard)
+}
+
+// fetchFeaturesForDeviceWithPriority fetches features with the given rate limit priority
+func fetchFeaturesForDeviceWithPriority(installationID, gatewayID, deviceID, accessToken string, priority apiPriority) (*DeviceFeatures, error) {
 	// Build API URL with includeDeviceFeatures parameter to get array-based statistics
-	url := fmt.Sprintf("https://api.viessmann-climatesolutions.com/iot/v2/features/installations/%s/gateways/%s/devices/%s/features?includeDeviceFeatures=true",
+	url := apiBaseURL + fmt.Sprintf("/iot/v2/features/installations/%s/gateways/%s/devices/%s/features?includeDeviceFeatures=true",
 		installationID, gatewayID, deviceID)
 
 	log.Printf("Fetching features from API: %s\n", url)
 
-	req, err := NewRequest("GET", url, nil)
+	req, err := NewPriorityRequest(priority, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -249,7 +257,7 @@ func fetchFeaturesForDevice(installationID, gatewayID, deviceID, accessToken str
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := doAPIRequest(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
@@ -310,11 +318,11 @@ func parseFeatures(features []Feature, installationID, gatewayID, deviceID strin
 
 // fetchFeaturesWithCache fetches features with caching support (default 5 minutes)
 func fetchFeaturesWithCache(installationID, gatewayID, deviceID, accessToken string) (*DeviceFeatures, error) {
-	return fetchFeaturesWithCustomCache(installationID, gatewayID, deviceID, accessToken, 5*time.Minute)
+	return fetchFeaturesWithCustomCache(installationID, gatewayID, deviceID, accessToken, 5*time.Minute, PriorityDashboard)
 }
 
 // fetchFeaturesWithCustomCache fetches features with configurable cache duration
-func fetchFeaturesWithCustomCache(installationID, gatewayID, deviceID, accessToken string, cacheDuration time.Duration) (*DeviceFeatures, error) {
+func fetchFeaturesWithCustomCache(installationID, gatewayID, deviceID, accessToken string, cacheDuration time.Duration, priority apiPriority) (*DeviceFeatures, error) {
 	cacheKey := fmt.Sprintf("%s:%s:%s", installationID, gatewayID, deviceID)
 
 	// Check cache first
@@ -323,13 +331,15 @@ func fetchFeaturesWithCustomCache(installationID, gatewayID, deviceID, accessTok
 		// Cache valid for specified duration
 		if time.Since(cached.LastUpdate) < cacheDuration {
 			featuresCacheMutex.RUnlock()
+			featuresCacheHits.Add(1)
 			return cached, nil
 		}
 	}
 	featuresCacheMutex.RUnlock()
+	featuresCacheMisses.Add(1)
 
 	// Fetch fresh data
-	features, err := fetchFeaturesForDevice(installationID, gatewayID, deviceID, accessToken)
+	features, err := fetchFeaturesForDeviceWithPriority(installationID, gatewayID, deviceID, accessToken, priority)
 	if err != nil {
 		// Return stale cache if available
 		featuresCacheMutex.RLock()
@@ -347,6 +357,9 @@ func fetchFeaturesWithCustomCache(installationID, gatewayID, deviceID, accessTok
 	featuresCache[cacheKey] = features
 	featuresCacheMutex.Unlock()
 
+	// Share fresh values via MQTT (no extra API calls)
+	PublishDeviceFeatures(features)
+
 	return features, nil
 }
 
@@ -378,21 +391,21 @@ func getDeviceNameFromFeatures(installationID, gatewayID, deviceID, accessToken
 // fetchGatewayIDForInstallation fetches the gateway ID for an installation
 func fetchGatewayIDForInstallation(installationID, accessToken string) (string, error) {
 	// Fetch all installations to get gateway info
-	req, err := NewRequest("GET", "https://api.viessmann-climatesolutions.com/iot/v2/equipment/installations", nil)
+	req, err := NewRequest("GET", apiBaseURL+"/iot/v2/equipment/installations", nil)
 	if err != nil {
 		return "", err
 	}
 
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := doAPIRequest(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API returned status %d", resp.StatusCode)
+		return "", apiStatusError(resp)
 	}
 
 	var result struct {
@@ -457,7 +470,7 @@ func executeAPIRequest(method, url, accessToken string, requestBody map[string]i
 
 	log.Printf("Executing %s request to: %s\n", method, url)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := doAPIRequest(req)
 	if err != nil {
 		return 0, nil, fmt.Errorf("request failed: %w", err)
 	}